@@ -21,16 +21,26 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	monitoringv1alpha1 "github.com/coreos/prometheus-operator/pkg/client/monitoring/v1alpha1"
 	"github.com/kubeless/kubeless/pkg/controller"
 	"github.com/kubeless/kubeless/pkg/utils"
 	"github.com/kubeless/kubeless/pkg/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -42,6 +52,26 @@ var rootCmd = &cobra.Command{
 	Short: "Kubeless controller",
 	Long:  globalUsage,
 	Run: func(cmd *cobra.Command, args []string) {
+		workers, err := cmd.Flags().GetInt("workers")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if workers < 1 {
+			logrus.Fatalf("The number of workers should be at least 1, received %d", workers)
+		}
+		leaderElect, err := cmd.Flags().GetBool("leader-elect")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		resyncPeriod, err := cmd.Flags().GetDuration("resync-period")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
 		kubelessClient, err := utils.GetFunctionClientInCluster()
 		if err != nil {
 			logrus.Fatalf("Cannot get kubeless client: %v", err)
@@ -50,6 +80,7 @@ var rootCmd = &cobra.Command{
 		functionCfg := controller.Config{
 			KubeCli:        utils.GetClient(),
 			FunctionClient: kubelessClient,
+			ResyncPeriod:   resyncPeriod,
 		}
 
 		restCfg, err := utils.GetInClusterConfig()
@@ -67,15 +98,120 @@ var rootCmd = &cobra.Command{
 		stopCh := make(chan struct{})
 		defer close(stopCh)
 
-		go functionController.Run(stopCh)
+		// Only the replica processing the functions is ready, once its caches are synced
+		go serveHTTP(port, functionController.Ready)
 
 		sigterm := make(chan os.Signal, 1)
 		signal.Notify(sigterm, syscall.SIGTERM)
 		signal.Notify(sigterm, syscall.SIGINT)
-		<-sigterm
+		leadershipLost := make(chan struct{})
+		controllerStopped := make(chan struct{})
+
+		if leaderElect {
+			lock, err := leaderElectionLock(cmd, functionCfg.KubeCli)
+			if err != nil {
+				logrus.Fatalf("Unable to configure the leader election: %v", err)
+			}
+			leaseDuration, _ := cmd.Flags().GetDuration("leader-elect-lease-duration")
+			renewDeadline, _ := cmd.Flags().GetDuration("leader-elect-renew-deadline")
+			retryPeriod, _ := cmd.Flags().GetDuration("leader-elect-retry-period")
+			go leaderelection.RunOrDie(leaderelection.LeaderElectionConfig{
+				Lock:          lock,
+				LeaseDuration: leaseDuration,
+				RenewDeadline: renewDeadline,
+				RetryPeriod:   retryPeriod,
+				Callbacks: leaderelection.LeaderCallbacks{
+					OnStartedLeading: func(stop <-chan struct{}) {
+						logrus.Infof("Acquired the leadership as %s", lock.Identity())
+						functionController.Run(workers, stop)
+						close(controllerStopped)
+					},
+					OnStoppedLeading: func() {
+						logrus.Errorf("Lost the lease %s as %s, stopping the controller", lock.Describe(), lock.Identity())
+						close(leadershipLost)
+					},
+					OnNewLeader: func(identity string) {
+						logrus.Infof("The current leader is %s", identity)
+					},
+				},
+			})
+		} else {
+			go functionController.Run(workers, stopCh)
+		}
+
+		select {
+		case <-sigterm:
+		case <-leadershipLost:
+			// Wait for the workers so the functions are not processed by two controllers at the same
+			// time and exit: the replica is restarted and joins the election again as a standby
+			<-controllerStopped
+			logrus.Info("Controller stopped, exiting")
+			os.Exit(1)
+		}
 	},
 }
 
+// serveHTTP exposes the metrics of the controller and its liveness and readiness endpoints
+func serveHTTP(port int, ready func() bool) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			http.Error(w, "Not processing functions: waiting for the leadership or for the caches to sync", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	})
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+	logrus.Infof("Serving metrics and health endpoints on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// leaderElectionLock returns the lock that the replicas of the controller compete for
+func leaderElectionLock(cmd *cobra.Command, client kubernetes.Interface) (resourcelock.Interface, error) {
+	namespace, _ := cmd.Flags().GetString("leader-elect-namespace")
+	if namespace == "" {
+		namespace = os.Getenv("KUBELESS_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = "kubeless"
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(logrus.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(namespace)})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "kubeless-function-controller"})
+
+	// The lock is a ConfigMap since the vendored client-go predates the Lease lock (coordination.k8s.io)
+	return resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, "kubeless-function-controller", client.CoreV1(), resourcelock.ResourceLockConfig{
+		Identity:      identity,
+		EventRecorder: recorder,
+	})
+}
+
+func init() {
+	rootCmd.Flags().Int("port", 8080, "Port in which the metrics (/metrics) and health endpoints (/healthz and /readyz) are served")
+	rootCmd.Flags().Duration("resync-period", 10*time.Minute, "Period after which every function is processed again to repair its resources (0 to disable it)")
+	rootCmd.Flags().Int("workers", 1, "Number of functions processed in parallel")
+	rootCmd.Flags().Bool("leader-elect", true, "Run a leader election so only one of the replicas of the controller processes the functions")
+	rootCmd.Flags().String("leader-elect-namespace", "", "Namespace of the leader election lock (the kubeless namespace by default)")
+	rootCmd.Flags().Duration("leader-elect-lease-duration", 15*time.Second, "Time that the standby replicas wait before taking over the leadership if it is not renewed")
+	rootCmd.Flags().Duration("leader-elect-renew-deadline", 10*time.Second, "Time during which the leader tries to renew the leadership before giving up")
+	rootCmd.Flags().Duration("leader-elect-retry-period", 2*time.Second, "Time between attempts to acquire or renew the leadership")
+}
+
 func main() {
 	logrus.Infof("Running Kubeless controller manager version: %v", version.Version)
 	if err := rootCmd.Execute(); err != nil {
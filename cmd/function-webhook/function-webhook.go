@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Kubeless admission webhook binary.
+//
+// See github.com/kubeless/kubeless/tree/master/pkg/webhook
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
+	"github.com/kubeless/kubeless/pkg/version"
+	"github.com/kubeless/kubeless/pkg/webhook"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	globalUsage = `Admission webhook that validates Function objects and sets their default values`
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "kubeless-webhook",
+	Short: "Kubeless admission webhook",
+	Long:  globalUsage,
+	Run: func(cmd *cobra.Command, args []string) {
+		certFile, err := cmd.Flags().GetString("tls-cert-file")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		keyFile, err := cmd.Flags().GetString("tls-private-key-file")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		clientset := utils.GetClient()
+		config, err := utils.GetKubelessConfig(clientset, utils.GetAPIExtensionsClientInCluster())
+		if err != nil {
+			logrus.Fatalf("Unable to read the configmap: %v", err)
+		}
+		lr := langruntime.New(config)
+		lr.ReadConfigMap()
+		webhookServer := webhook.NewServer(lr)
+
+		// Watch the configmap so the functions are validated against the current runtimes
+		configInformer := coreinformers.NewFilteredConfigMapInformer(clientset, config.ObjectMeta.Namespace, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", config.ObjectMeta.Name).String()
+		})
+		configInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, new interface{}) {
+				webhookServer.ReloadConfig(new.(*v1.ConfigMap))
+			},
+		})
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go configInformer.Run(stopCh)
+
+		server := &http.Server{
+			Addr:    fmt.Sprintf(":%d", port),
+			Handler: webhookServer.Handler(),
+		}
+		logrus.Infof("Listening on %s", server.Addr)
+		if err := server.ListenAndServeTLS(certFile, keyFile); err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.Flags().String("tls-cert-file", "/etc/webhook/certs/tls.crt", "File containing the x509 certificate for HTTPS")
+	rootCmd.Flags().String("tls-private-key-file", "/etc/webhook/certs/tls.key", "File containing the x509 private key matching --tls-cert-file")
+	rootCmd.Flags().Int("port", 8443, "Port in which the webhook listens")
+}
+
+func main() {
+	logrus.Infof("Running Kubeless admission webhook version: %v", version.Version)
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,8 @@
 package autoscale
 
 import (
+	"time"
+
 	"github.com/kubeless/kubeless/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -32,8 +34,8 @@ var autoscaleCreateCmd = &cobra.Command{
 		min, err := cmd.Flags().GetInt32("min")
 		if err != nil {
 			logrus.Fatal(err)
-		} else if min <= 0 {
-			logrus.Fatalf("min can't be negative or zero")
+		} else if min < 0 {
+			logrus.Fatalf("min can't be negative")
 		}
 		max, err := cmd.Flags().GetInt32("max")
 		if err != nil {
@@ -55,6 +57,21 @@ var autoscaleCreateCmd = &cobra.Command{
 			logrus.Fatal(err)
 		}
 
+		idleTimeout, err := cmd.Flags().GetString("idle-timeout")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		function.Spec.IdleTimeout = ""
+		if min == 0 {
+			if d, err := time.ParseDuration(idleTimeout); err != nil || d <= 0 {
+				logrus.Fatalf("Invalid idle-timeout %s", idleTimeout)
+			}
+			// The autoscaler can't scale the function to zero,
+			// the controller does it once the function is idle
+			function.Spec.IdleTimeout = idleTimeout
+			min = 1
+		}
+
 		hpa, err := getHorizontalAutoscaleDefinition(funcName, ns, metric, min, max, value, function.ObjectMeta.Labels)
 		if err != nil {
 			logrus.Fatal(err)
@@ -75,7 +92,8 @@ var autoscaleCreateCmd = &cobra.Command{
 }
 
 func init() {
-	autoscaleCreateCmd.Flags().Int32("min", 1, "minimum number of replicas")
+	autoscaleCreateCmd.Flags().Int32("min", 1, "minimum number of replicas. If it is 0 the function is scaled to zero once it is idle")
+	autoscaleCreateCmd.Flags().String("idle-timeout", "10m", "time without requests after which the function is scaled to zero (if min is 0)")
 	autoscaleCreateCmd.Flags().Int32("max", 1, "maximum number of replicas")
 	autoscaleCreateCmd.Flags().String("metric", "cpu", "metric to use for calculating the autoscale. Supported metrics: cpu, qps")
 	autoscaleCreateCmd.Flags().String("value", "", "value of the average of the metric across all replicas. If metric is cpu, value is a number represented as percentage. If metric is qps, value must be in format of Quantity")
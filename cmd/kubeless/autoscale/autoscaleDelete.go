@@ -45,6 +45,7 @@ var autoscaleDeleteCmd = &cobra.Command{
 
 		if function.Spec.HorizontalPodAutoscaler.Name != "" {
 			function.Spec.HorizontalPodAutoscaler = v2beta1.HorizontalPodAutoscaler{}
+			function.Spec.IdleTimeout = ""
 			kubelessClient, err := utils.GetKubelessClientOutCluster()
 			if err != nil {
 				logrus.Fatal(err)
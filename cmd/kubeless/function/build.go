@@ -0,0 +1,169 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+// buildPollInterval is the time between checks of the status of a build
+var buildPollInterval = 2 * time.Second
+
+var buildCmd = &cobra.Command{
+	Use:   "build <function_name> FLAG",
+	Short: "build the image of a function",
+	Long:  `build the image of the current code of a function and wait for the build to finish. A failed build is started again`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("Need exactly one argument - function name")
+		}
+		funcName := args[0]
+
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		cli := utils.GetClientOutOfCluster()
+		config, err := utils.GetKubelessConfig(cli, utils.GetAPIExtensionsClientOutOfCluster())
+		if err != nil {
+			logrus.Fatalf("Unable to read the configmap: %v", err)
+		}
+		if config.Data["enable-build-step"] != "true" {
+			logrus.Fatal("The build step is disabled, set enable-build-step to \"true\" in the Kubeless configuration to build functions")
+		}
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		build, err := requestBuild(cli, kubelessClient, config, funcName, ns)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Waiting for the build %s of the image %s", build.ObjectMeta.Name, build.Spec.Image)
+		build, err = waitForBuild(kubelessClient, ns, build.ObjectMeta.Name, timeout)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Function %s built: %s", funcName, buildResult(build))
+	},
+}
+
+func init() {
+	buildCmd.Flags().StringP("namespace", "n", "", "Specify namespace for the function")
+	buildCmd.Flags().Duration("timeout", 10*time.Minute, "Maximum time to wait for the build to finish")
+}
+
+// requestBuild returns the build of the current code of the function, creating it if it doesn't exist yet
+// or if the previous attempt failed
+func requestBuild(cli kubernetes.Interface, kubelessClient versioned.Interface, config *v1.ConfigMap, funcName, ns string) (*kubelessApi.FunctionBuild, error) {
+	f, err := kubelessClient.KubelessV1beta1().Functions(ns).Get(funcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	target, err := utils.GetBuildTarget(cli, f, config.Data["function-registry"], config.Data["function-repository-prefix"])
+	if err != nil {
+		return nil, err
+	}
+	or, err := utils.GetOwnerReference("Function", "kubeless.io/v1beta1", f.Name, f.UID)
+	if err != nil {
+		return nil, err
+	}
+	builds := kubelessClient.KubelessV1beta1().FunctionBuilds(ns)
+	buildName := utils.FunctionBuildName(funcName, target.Tag)
+	build, err := builds.Get(buildName, metav1.GetOptions{})
+	switch {
+	case err == nil && build.Status.Phase != kubelessApi.FunctionBuildFailed:
+		return build, nil
+	case err == nil:
+		// Remove the failed job before its build so the controller cannot find it again
+		propagation := metav1.DeletePropagationBackground
+		err = cli.BatchV1().Jobs(ns).Delete(buildName, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("Unable to delete the job of the failed build %s: %v", buildName, err)
+		}
+		err = builds.Delete(buildName, &metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("Unable to delete the failed build %s: %v", buildName, err)
+		}
+	case !k8sErrors.IsNotFound(err):
+		return nil, err
+	}
+	build, err = builds.Create(utils.NewFunctionBuild(f, target, or))
+	if k8sErrors.IsAlreadyExists(err) {
+		// The controller has created it in the meantime
+		return builds.Get(buildName, metav1.GetOptions{})
+	}
+	return build, err
+}
+
+// waitForBuild waits until the given build succeeds or fails
+func waitForBuild(kubelessClient versioned.Interface, ns, buildName string, timeout time.Duration) (*kubelessApi.FunctionBuild, error) {
+	var build *kubelessApi.FunctionBuild
+	phase := kubelessApi.FunctionBuildPhase("")
+	err := wait.PollImmediate(buildPollInterval, timeout, func() (bool, error) {
+		var err error
+		build, err = kubelessClient.KubelessV1beta1().FunctionBuilds(ns).Get(buildName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if build.Status.Phase != phase && build.Status.Phase != "" {
+			phase = build.Status.Phase
+			logrus.Infof("Build %s: %s", buildName, phase)
+		}
+		return phase == kubelessApi.FunctionBuildSucceeded || phase == kubelessApi.FunctionBuildFailed, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("Timed out waiting for the build %s, check its progress with 'kubeless function build-logs'", buildName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if phase == kubelessApi.FunctionBuildFailed {
+		return nil, fmt.Errorf("Build %s failed: %s", buildName, build.Status.Message)
+	}
+	return build, nil
+}
+
+// buildResult returns the image generated by a build, including its digest if known
+func buildResult(build *kubelessApi.FunctionBuild) string {
+	if build.Status.Digest == "" {
+		return build.Spec.Image
+	}
+	return fmt.Sprintf("%s (%s)", build.Spec.Image, build.Status.Digest)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	fFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+func buildClients() (*fake.Clientset, *fFake.Clientset) {
+	cli := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeless-registry-credentials", Namespace: "myns"},
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(`{"auths": {"https://registry.example.com/v2/": {"username": "user", "password": "pass"}}}`),
+		},
+	})
+	kubelessClient := fFake.NewSimpleClientset(&kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "myns", UID: "foo-uid"},
+		Spec: kubelessApi.FunctionSpec{
+			Function: "function1",
+			Runtime:  "python2.7",
+		},
+	})
+	return cli, kubelessClient
+}
+
+func TestRequestBuild(t *testing.T) {
+	cli, kubelessClient := buildClients()
+
+	f, _ := kubelessClient.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	tag := utils.FunctionBuildTag(f)
+
+	build, err := requestBuild(cli, kubelessClient, &v1.ConfigMap{}, "foo", "myns")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedSpec := kubelessApi.FunctionBuildSpec{
+		Function: "foo",
+		Checksum: "sha256:" + tag,
+		Runtime:  "python2.7",
+		Image:    "registry.example.com/user/foo:" + tag,
+	}
+	if !reflect.DeepEqual(build.Spec, expectedSpec) {
+		t.Errorf("Expecting %+v, received %+v", expectedSpec, build.Spec)
+	}
+	if build.ObjectMeta.Name != "build-foo-"+tag[0:10] {
+		t.Errorf("Unexpected build name %s", build.ObjectMeta.Name)
+	}
+	if len(build.ObjectMeta.OwnerReferences) != 1 || build.ObjectMeta.OwnerReferences[0].UID != "foo-uid" {
+		t.Errorf("Expecting the build to be owned by the function, received %v", build.ObjectMeta.OwnerReferences)
+	}
+
+	// A running build is reused
+	build.Status = kubelessApi.FunctionBuildStatus{Phase: kubelessApi.FunctionBuildRunning, Job: build.ObjectMeta.Name}
+	kubelessClient.KubelessV1beta1().FunctionBuilds("myns").UpdateStatus(build)
+	build, err = requestBuild(cli, kubelessClient, &v1.ConfigMap{}, "foo", "myns")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if build.Status.Phase != kubelessApi.FunctionBuildRunning {
+		t.Errorf("Expecting the running build, received %+v", build.Status)
+	}
+
+	// A failed build is started again
+	build.Status.Phase = kubelessApi.FunctionBuildFailed
+	kubelessClient.KubelessV1beta1().FunctionBuilds("myns").UpdateStatus(build)
+	cli.BatchV1().Jobs("myns").Create(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: build.ObjectMeta.Name, Namespace: "myns"}})
+	build, err = requestBuild(cli, kubelessClient, &v1.ConfigMap{}, "foo", "myns")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if build.Status.Phase != kubelessApi.FunctionBuildPending {
+		t.Errorf("Expecting a new build, received %+v", build.Status)
+	}
+	if _, err := cli.BatchV1().Jobs("myns").Get(build.ObjectMeta.Name, metav1.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("Expecting the job of the failed build to be deleted, received %v", err)
+	}
+}
+
+func TestWaitForBuild(t *testing.T) {
+	_, kubelessClient := buildClients()
+	kubelessClient.KubelessV1beta1().FunctionBuilds("myns").Create(&kubelessApi.FunctionBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-ok", Namespace: "myns"},
+		Spec:       kubelessApi.FunctionBuildSpec{Image: "registry.example.com/user/foo:abc"},
+		Status:     kubelessApi.FunctionBuildStatus{Phase: kubelessApi.FunctionBuildSucceeded, Digest: "sha256:123"},
+	})
+	kubelessClient.KubelessV1beta1().FunctionBuilds("myns").Create(&kubelessApi.FunctionBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-ko", Namespace: "myns"},
+		Status:     kubelessApi.FunctionBuildStatus{Phase: kubelessApi.FunctionBuildFailed, Message: "Image build job build-ko failed"},
+	})
+	kubelessClient.KubelessV1beta1().FunctionBuilds("myns").Create(&kubelessApi.FunctionBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-running", Namespace: "myns"},
+		Status:     kubelessApi.FunctionBuildStatus{Phase: kubelessApi.FunctionBuildRunning},
+	})
+	buildPollInterval = 10 * time.Millisecond
+
+	build, err := waitForBuild(kubelessClient, "myns", "build-ok", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result := buildResult(build); result != "registry.example.com/user/foo:abc (sha256:123)" {
+		t.Errorf("Unexpected result %s", result)
+	}
+	if _, err := waitForBuild(kubelessClient, "myns", "build-ko", time.Second); err == nil || err.Error() != "Build build-ko failed: Image build job build-ko failed" {
+		t.Errorf("Expecting the failure of the build, received %v", err)
+	}
+	if _, err := waitForBuild(kubelessClient, "myns", "build-running", 50*time.Millisecond); err == nil {
+		t.Error("Expecting a timeout")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+var buildLogsCmd = &cobra.Command{
+	Use:   "build-logs <function_name> FLAG",
+	Short: "get logs from the build of a function",
+	Long:  `stream the logs of every step of the latest build of a function: the init containers that prepare the function and the build container`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("Need exactly one argument - function name")
+		}
+		funcName := args[0]
+
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+		buildName, err := cmd.Flags().GetString("build")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		cli := utils.GetClientOutOfCluster()
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		build, err := getBuild(kubelessClient, funcName, ns, buildName)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if build.Status.Job == "" {
+			if build.Status.Phase == kubelessApi.FunctionBuildSucceeded {
+				logrus.Fatalf("The image of the build %s was found in the registry, there are no logs", build.ObjectMeta.Name)
+			}
+			logrus.Fatalf("The build %s has not started yet", build.ObjectMeta.Name)
+		}
+		pods, err := utils.GetPodsByLabel(cli, ns, "job-name", build.Status.Job)
+		if err != nil {
+			logrus.Fatalf("Can't find the build pod: %v", err)
+		}
+		if len(pods.Items) == 0 {
+			logrus.Fatalf("The job %s of the build %s has no pods", build.Status.Job, build.ObjectMeta.Name)
+		}
+		// Show the last attempt of the job
+		pod := pods.Items[0]
+		for _, p := range pods.Items {
+			if pod.ObjectMeta.CreationTimestamp.Before(&p.ObjectMeta.CreationTimestamp) {
+				pod = p
+			}
+		}
+		err = streamBuildLogs(cli, &pod, os.Stdout)
+		if err != nil {
+			logrus.Fatalf("Getting log failed: %v", err)
+		}
+	},
+}
+
+func init() {
+	buildLogsCmd.Flags().StringP("namespace", "n", "", "Specify namespace for the function")
+	buildLogsCmd.Flags().String("build", "", "Name of the build to show instead of the latest one")
+}
+
+// getBuild returns the build with the given name or the most recent build of the function if the name is empty
+func getBuild(kubelessClient versioned.Interface, funcName, ns, buildName string) (*kubelessApi.FunctionBuild, error) {
+	if buildName != "" {
+		return kubelessClient.KubelessV1beta1().FunctionBuilds(ns).Get(buildName, metav1.GetOptions{})
+	}
+	builds, err := kubelessClient.KubelessV1beta1().FunctionBuilds(ns).List(metav1.ListOptions{
+		LabelSelector: "function=" + funcName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var latest *kubelessApi.FunctionBuild
+	for _, build := range builds.Items {
+		if build.Spec.Function != funcName {
+			continue
+		}
+		if latest == nil || latest.ObjectMeta.CreationTimestamp.Before(&build.ObjectMeta.CreationTimestamp) {
+			latest = build
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("Function %s has not been built", funcName)
+	}
+	return latest, nil
+}
+
+// buildSteps returns the containers of a build pod in the order they run
+func buildSteps(pod *v1.Pod) []string {
+	steps := []string{}
+	for _, c := range pod.Spec.InitContainers {
+		steps = append(steps, c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		steps = append(steps, c.Name)
+	}
+	return steps
+}
+
+// stepStarted returns true if the given container of the pod is running or has finished
+func stepStarted(pod *v1.Pod, container string) bool {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name == container {
+			return status.State.Running != nil || status.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+// streamBuildLogs writes the logs of every container of the build pod, waiting for each one of them to start
+func streamBuildLogs(cli kubernetes.Interface, pod *v1.Pod, out io.Writer) error {
+	for _, step := range buildSteps(pod) {
+		// The containers run one after the other so wait until it starts or the pod finishes without running it
+		var finished bool
+		err := wait.PollImmediateInfinite(buildPollInterval, func() (bool, error) {
+			current, err := cli.CoreV1().Pods(pod.ObjectMeta.Namespace).Get(pod.ObjectMeta.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if stepStarted(current, step) {
+				return true, nil
+			}
+			finished = current.Status.Phase == v1.PodSucceeded || current.Status.Phase == v1.PodFailed
+			return finished, nil
+		})
+		if err != nil {
+			return err
+		}
+		if finished {
+			// A previous step failed
+			return nil
+		}
+		fmt.Fprintf(out, "==> %s <==\n", step)
+		readCloser, err := cli.CoreV1().Pods(pod.ObjectMeta.Namespace).GetLogs(pod.ObjectMeta.Name, &v1.PodLogOptions{
+			Container: step,
+			Follow:    true,
+		}).Stream()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, readCloser)
+		readCloser.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+)
+
+func TestGetBuild(t *testing.T) {
+	_, kubelessClient := buildClients()
+	now := time.Now()
+	for i, name := range []string{"build-foo-old", "build-foo-new"} {
+		kubelessClient.KubelessV1beta1().FunctionBuilds("myns").Create(&kubelessApi.FunctionBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "myns",
+				Labels:            map[string]string{"function": "foo"},
+				CreationTimestamp: metav1.NewTime(now.Add(time.Duration(i) * time.Minute)),
+			},
+			Spec: kubelessApi.FunctionBuildSpec{Function: "foo"},
+		})
+	}
+
+	build, err := getBuild(kubelessClient, "foo", "myns", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if build.ObjectMeta.Name != "build-foo-new" {
+		t.Errorf("Expecting the latest build, received %s", build.ObjectMeta.Name)
+	}
+	build, err = getBuild(kubelessClient, "foo", "myns", "build-foo-old")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if build.ObjectMeta.Name != "build-foo-old" {
+		t.Errorf("Expecting the requested build, received %s", build.ObjectMeta.Name)
+	}
+	if _, err := getBuild(kubelessClient, "bar", "myns", ""); err == nil {
+		t.Error("Expecting an error for a function without builds")
+	}
+}
+
+func TestBuildSteps(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "prepare"}, {Name: "install"}, {Name: "bundle"}},
+			Containers:     []v1.Container{{Name: "build"}},
+		},
+		Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "prepare", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}},
+				{Name: "install", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+				{Name: "bundle", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{}}},
+			},
+		},
+	}
+	expected := []string{"prepare", "install", "bundle", "build"}
+	if steps := buildSteps(pod); !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expecting %v, received %v", expected, steps)
+	}
+	for step, started := range map[string]bool{"prepare": true, "install": true, "bundle": false, "build": false} {
+		if stepStarted(pod, step) != started {
+			t.Errorf("Expecting the step %s started: %v", step, started)
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	cronjobApi "github.com/kubeless/cronjob-trigger/pkg/apis/kubeless/v1beta1"
 	cronjobUtils "github.com/kubeless/cronjob-trigger/pkg/utils"
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/artifacts"
 	"github.com/kubeless/kubeless/pkg/langruntime"
 	kubelessutil "github.com/kubeless/kubeless/pkg/utils"
 	"github.com/robfig/cron"
@@ -53,10 +54,11 @@ var deployCmd = &cobra.Command{
 
 		// Checking runtime parameter if allowed by RBAC, otherwide skip the check
 		config, err := kubelessutil.GetKubelessConfig(cli, apiExtensionsClientset)
+		var lr *langruntime.Langruntimes
 		if config == nil || err != nil {
 			logrus.Warnf("%v. Runtime check is disabled.", err)
 		} else {
-			lr := langruntime.New(config)
+			lr = langruntime.New(config)
 			lr.ReadConfigMap()
 
 			if runtime != "" && !lr.IsValidRuntime(runtime) {
@@ -96,6 +98,44 @@ var deployCmd = &cobra.Command{
 			logrus.Fatal(err)
 		}
 
+		gitRepo, err := cmd.Flags().GetString("from-git")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		gitRef, err := cmd.Flags().GetString("ref")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		gitPath, err := cmd.Flags().GetString("path")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		functionSecret, err := cmd.Flags().GetString("function-secret")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		signKey, err := cmd.Flags().GetString("sign-key")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		signaturePayload, err := cmd.Flags().GetString("signature-payload")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		checksumAlgorithm, err := cmd.Flags().GetString("checksum-algorithm")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if file != "" && gitRepo != "" {
+			logrus.Fatal("The flags --from-file and --from-git are mutually exclusive")
+		}
+
 		ns, err := cmd.Flags().GetString("namespace")
 		if err != nil {
 			logrus.Fatal(err)
@@ -214,10 +254,46 @@ var deployCmd = &cobra.Command{
 			"function":   funcName,
 		}
 
-		f, err := getFunctionDescription(funcName, ns, handler, file, funcDeps, runtime, runtimeImage, mem, cpu, timeout, imagePullPolicy, serviceAccount, port, servicePort, headless, envs, labels, secrets, nodeSelectors, defaultFunctionSpec)
+		var sourceCreds *kubelessutil.SourceCredentials
+		if functionSecret != "" && file != "" {
+			sourceCreds, err = kubelessutil.GetSourceCredentials(cli, ns, functionSecret)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
+		f, err := getFunctionDescription(funcName, ns, handler, file, funcDeps, runtime, runtimeImage, mem, cpu, timeout, imagePullPolicy, serviceAccount, port, servicePort, headless, envs, labels, secrets, nodeSelectors, defaultFunctionSpec, sourceCreds, checksumAlgorithm)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if sourceCreds != nil && strings.Contains(f.Spec.FunctionContentType, "url") {
+			f.Spec.FunctionSecret = functionSecret
+		}
+		if gitRepo != "" {
+			err = setGitSource(cli, f, gitRepo, gitRef, gitPath, functionSecret)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		err = setDepsChecksum(f, lr, checksumAlgorithm)
 		if err != nil {
 			logrus.Fatal(err)
 		}
+		if signKey != "" {
+			err = signFunction(f, signKey)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if signaturePayload != "" {
+			err = writeSignaturePayload(f, signaturePayload)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		f.ObjectMeta.Annotations = map[string]string{
+			kubelessutil.ChangeCauseAnnotation: getChangeCause(cmd, funcName),
+		}
 
 		if dryrun == true {
 			if output == "json" {
@@ -240,6 +316,15 @@ var deployCmd = &cobra.Command{
 			}
 		}
 
+		if config != nil {
+			err = uploadLargeFunction(f, file, config, func() (artifacts.Store, error) {
+				return newArtifactStore(cli, config, ns)
+			})
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
 		kubelessClient, err := kubelessutil.GetKubelessClientOutCluster()
 		if err != nil {
 			logrus.Fatal(err)
@@ -285,6 +370,13 @@ func init() {
 	deployCmd.Flags().StringP("runtime", "r", "", "Specify runtime")
 	deployCmd.Flags().StringP("handler", "", "", "Specify handler")
 	deployCmd.Flags().StringP("from-file", "f", "", "Specify code file or a URL to the code file")
+	deployCmd.Flags().StringP("from-git", "", "", "Specify a Git repository with the code of the function")
+	deployCmd.Flags().StringP("ref", "", "", "Branch, tag or commit of the Git repository to deploy. The default branch if empty")
+	deployCmd.Flags().StringP("path", "", "", "Directory of the Git repository with the code of the function")
+	deployCmd.Flags().StringP("function-secret", "", "", "Specify a Secret with the credentials to fetch the code of the function from a URL or a Git repository")
+	deployCmd.Flags().StringP("checksum-algorithm", "", "sha256", "Algorithm of the checksums of the function and its files: sha256 or sha512")
+	deployCmd.Flags().StringP("sign-key", "", "", "Specify a PEM encoded Ed25519 or ECDSA P-256 private key to sign the code of the function")
+	deployCmd.Flags().StringP("signature-payload", "", "", "Write the payload covered by the signature of the function to a file, to sign it with other tools like cosign sign-blob")
 	deployCmd.Flags().StringSliceP("label", "l", []string{}, "Specify labels of the function. Both separator ':' and '=' are allowed. For example: --label foo1=bar1,foo2:bar2")
 	deployCmd.Flags().StringSliceP("secrets", "", []string{}, "Specify Secrets to be mounted to the functions container. For example: --secrets mySecret")
 	deployCmd.Flags().StringSliceP("env", "e", []string{}, "Specify environment variable of the function. Both separator ':' and '=' are allowed. For example: --env foo1=bar1,foo2:bar2")
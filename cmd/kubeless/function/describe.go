@@ -19,6 +19,9 @@ package function
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/gosuri/uitable"
@@ -26,6 +29,8 @@ import (
 	"github.com/kubeless/kubeless/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 var describeCmd = &cobra.Command{
@@ -61,6 +66,24 @@ var describeCmd = &cobra.Command{
 		if err != nil {
 			logrus.Fatalf("Can not describe function: %v", err)
 		}
+
+		if output == "" {
+			kubelessClient, err := utils.GetKubelessClientOutCluster()
+			if err != nil {
+				logrus.Fatalf("Can not describe function: %v", err)
+			}
+			revisions, err := utils.GetFunctionRevisions(kubelessClient, funcName, ns)
+			if err != nil {
+				logrus.Fatalf("Can not list the revisions of the function: %v", err)
+			}
+			printChangedFiles(os.Stdout, revisions, f.Status.Revision)
+
+			events, err := utils.GetFunctionEvents(utils.GetClientOutOfCluster(), funcName, ns)
+			if err != nil {
+				logrus.Fatalf("Can not list the events of the function: %v", err)
+			}
+			printEvents(os.Stdout, events, time.Now())
+		}
 	},
 }
 
@@ -97,6 +120,37 @@ func print(f kubelessApi.Function, name, output string) error {
 		table.AddRow("Envvar:", env)
 		table.AddRow("Memory:", memory)
 		table.AddRow("Dependencies:", f.Spec.Deps)
+		if f.Spec.IdleTimeout != "" {
+			table.AddRow("Idle timeout:", f.Spec.IdleTimeout)
+		}
+		table.AddRow("Status:", f.Status.Phase)
+		for _, c := range f.Status.Conditions {
+			condition := fmt.Sprintf("%s=%s", c.Type, c.Status)
+			if c.Reason != "" {
+				condition += fmt.Sprintf(" (%s)", c.Reason)
+			}
+			if c.Message != "" {
+				condition += ": " + c.Message
+			}
+			table.AddRow("", condition)
+		}
+		if d := f.Status.LastDrift; d != nil {
+			change := "modified"
+			if d.Deleted {
+				change = "deleted"
+			}
+			table.AddRow("Last drift:", fmt.Sprintf("%s %s %s outside of the controller, restored at %s", d.Kind, d.Name, change, d.Time.String()))
+		}
+		if len(f.Status.Traffic) > 0 {
+			table.AddRow("Traffic:", "")
+			for _, t := range f.Status.Traffic {
+				target := fmt.Sprintf("revision %d: %d%%", t.Revision, t.Percent)
+				if t.Revision == f.Status.Revision {
+					target += " (latest)"
+				}
+				table.AddRow("", target)
+			}
+		}
 		fmt.Println(table)
 	case "json":
 		b, err := json.MarshalIndent(f, "", "  ")
@@ -116,3 +170,70 @@ func print(f kubelessApi.Function, name, output string) error {
 
 	return nil
 }
+
+// printChangedFiles writes the files of the function that changed between the given revision and the
+// previous one, according to their checksum manifests. Nothing is written for the first revision
+func printChangedFiles(w io.Writer, revisions []*kubelessApi.FunctionRevision, revision int64) {
+	var current, previous *kubelessApi.FunctionRevision
+	for _, r := range revisions {
+		if r.Spec.Revision == revision {
+			current = r
+		} else if r.Spec.Revision < revision && (previous == nil || r.Spec.Revision > previous.Spec.Revision) {
+			previous = r
+		}
+	}
+	if current == nil || previous == nil {
+		return
+	}
+	title := fmt.Sprintf("Changed files since revision %d:", previous.Spec.Revision)
+	oldFiles, oldErr := utils.ParseChecksumManifest(previous.Spec.Function.ChecksumManifest)
+	newFiles, newErr := utils.ParseChecksumManifest(current.Spec.Function.ChecksumManifest)
+	if oldErr != nil || newErr != nil || len(oldFiles) == 0 || len(newFiles) == 0 {
+		if previous.Spec.Function.Checksum == current.Spec.Function.Checksum && previous.Spec.Function.Deps == current.Spec.Function.Deps {
+			fmt.Fprintf(w, "%s\t<none>\n", title)
+		} else {
+			fmt.Fprintf(w, "%s\t<unknown>, the code changed but the revisions don't have a checksum manifest\n", title)
+		}
+		return
+	}
+	added, modified, removed := utils.DiffChecksumManifests(oldFiles, newFiles)
+	if len(added)+len(modified)+len(removed) == 0 {
+		fmt.Fprintf(w, "%s\t<none>\n", title)
+		return
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("CHANGE", "FILE")
+	for _, change := range []struct {
+		name  string
+		files []string
+	}{{"modified", modified}, {"added", added}, {"removed", removed}} {
+		for _, f := range change.files {
+			table.AddRow(change.name, f)
+		}
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w, table)
+}
+
+// printEvents writes the table of events of a function, newest last
+func printEvents(w io.Writer, events []v1.Event, now time.Time) {
+	if len(events) == 0 {
+		fmt.Fprintln(w, "Events:\t<none>")
+		return
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("TYPE", "REASON", "AGE", "FROM", "MESSAGE")
+	for _, e := range events {
+		age := duration.ShortHumanDuration(now.Sub(e.LastTimestamp.Time))
+		if e.Count > 1 {
+			age = fmt.Sprintf("%s (x%d over %s)", age, e.Count, duration.ShortHumanDuration(now.Sub(e.FirstTimestamp.Time)))
+		}
+		table.AddRow(e.Type, e.Reason, age, e.Source.Component, e.Message)
+	}
+	fmt.Fprintln(w, "Events:")
+	fmt.Fprintln(w, table)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrintEvents(t *testing.T) {
+	now := time.Now()
+	events := []v1.Event{
+		{
+			Type:           v1.EventTypeNormal,
+			Reason:         "DeploymentCreated",
+			Message:        "Created Deployment foo",
+			Source:         v1.EventSource{Component: "kubeless-function-controller"},
+			FirstTimestamp: metav1.NewTime(now.Add(-5 * time.Minute)),
+			LastTimestamp:  metav1.NewTime(now.Add(-5 * time.Minute)),
+			Count:          1,
+		},
+		{
+			Type:           v1.EventTypeWarning,
+			Reason:         "SyncFailed",
+			Message:        "Unable to create the service",
+			Source:         v1.EventSource{Component: "kubeless-function-controller"},
+			FirstTimestamp: metav1.NewTime(now.Add(-2 * time.Minute)),
+			LastTimestamp:  metav1.NewTime(now.Add(-30 * time.Second)),
+			Count:          3,
+		},
+	}
+	var buf bytes.Buffer
+	printEvents(&buf, events, now)
+	output := buf.String()
+	t.Log("output is", output)
+	for _, expected := range []string{"Normal\\s+DeploymentCreated\\s+5m\\s.*Created Deployment foo", "Warning\\s+SyncFailed\\s+30s \\(x3 over 2m\\)"} {
+		m, err := regexp.MatchString(expected, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m {
+			t.Errorf("events output doesn't match %s", expected)
+		}
+	}
+
+	buf.Reset()
+	printEvents(&buf, []v1.Event{}, now)
+	if buf.String() != "Events:\t<none>\n" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+}
+
+func TestPrintChangedFiles(t *testing.T) {
+	sum := func(c byte) string {
+		return "sha256:" + strings.Repeat(string(c), 64)
+	}
+	revision := func(n int64, manifest string) *kubelessApi.FunctionRevision {
+		return &kubelessApi.FunctionRevision{
+			Spec: kubelessApi.FunctionRevisionSpec{
+				Revision: n,
+				Function: kubelessApi.FunctionSpec{Checksum: sum(byte('0' + n)), ChecksumManifest: manifest},
+			},
+		}
+	}
+	revisions := []*kubelessApi.FunctionRevision{
+		revision(1, sum('a')+"  handler.py\n"+sum('b')+"  lib/old.py\n"),
+		revision(2, sum('c')+"  handler.py\n"+sum('b')+"  lib/old.py\n"),
+		revision(3, sum('c')+"  handler.py\n"+sum('d')+"  lib/new.py\n"+sum('e')+"  requirements.txt\n"),
+		revision(4, ""),
+	}
+
+	var buf bytes.Buffer
+	printChangedFiles(&buf, revisions, 3)
+	output := buf.String()
+	t.Log("output is", output)
+	for _, expected := range []string{"Changed files since revision 2:", "added\\s+lib/new.py", "added\\s+requirements.txt", "removed\\s+lib/old.py"} {
+		m, err := regexp.MatchString(expected, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m {
+			t.Errorf("changed files output doesn't match %s", expected)
+		}
+	}
+	if strings.Contains(output, "handler.py") {
+		t.Error("Unexpected unchanged file handler.py")
+	}
+
+	buf.Reset()
+	printChangedFiles(&buf, revisions, 2)
+	if m, _ := regexp.MatchString("modified\\s+handler.py", buf.String()); !m || strings.Contains(buf.String(), "old.py") {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	printChangedFiles(&buf, revisions, 4)
+	if !strings.Contains(buf.String(), "<unknown>") {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	printChangedFiles(&buf, revisions, 1)
+	if buf.String() != "" {
+		t.Errorf("Unexpected output for the first revision %q", buf.String())
+	}
+}
@@ -17,14 +17,21 @@ limitations under the License.
 package function
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"strings"
 
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/artifacts"
 	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/langruntime"
 	kubelessutil "github.com/kubeless/kubeless/pkg/utils"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -50,6 +57,21 @@ func init() {
 	FunctionCmd.AddCommand(describeCmd)
 	FunctionCmd.AddCommand(updateCmd)
 	FunctionCmd.AddCommand(topCmd)
+	FunctionCmd.AddCommand(historyCmd)
+	FunctionCmd.AddCommand(rollbackCmd)
+	FunctionCmd.AddCommand(promoteCmd)
+	FunctionCmd.AddCommand(buildCmd)
+	FunctionCmd.AddCommand(buildLogsCmd)
+}
+
+// getChangeCause returns a description of the command executed including the name (but not the value)
+// of the flags given to it, to be recorded in the revision of the function
+func getChangeCause(cmd *cobra.Command, funcName string) string {
+	changeCause := fmt.Sprintf("kubeless function %s %s", cmd.Name(), funcName)
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		changeCause += " --" + flag.Name
+	})
+	return changeCause
 }
 
 func getKV(input string) (string, string) {
@@ -109,7 +131,7 @@ func parseNodeSelectors(nodeSelectors []string) map[string]string {
 	return funcNodeSelectors
 }
 
-func getFunctionDescription(funcName, ns, handler, file, deps, runtime, runtimeImage, mem, cpu, timeout string, imagePullPolicy string, serviceAccount string, port int32, servicePort int32, headless bool, envs, labels, secrets, nodeSelectors []string, defaultFunction kubelessApi.Function) (*kubelessApi.Function, error) {
+func getFunctionDescription(funcName, ns, handler, file, deps, runtime, runtimeImage, mem, cpu, timeout string, imagePullPolicy string, serviceAccount string, port int32, servicePort int32, headless bool, envs, labels, secrets, nodeSelectors []string, defaultFunction kubelessApi.Function, sourceCreds *kubelessutil.SourceCredentials, checksumAlgorithm string) (*kubelessApi.Function, error) {
 	function := defaultFunction
 	function.TypeMeta = metav1.TypeMeta{
 		Kind:       "Function",
@@ -124,18 +146,36 @@ func getFunctionDescription(funcName, ns, handler, file, deps, runtime, runtimeI
 		if err != nil {
 			return nil, err
 		}
-		functionContent, checksum, err := kubelessutil.ParseContent(file, contentType)
+		functionContent, checksum, err := kubelessutil.ParseContentWithCredentials(file, contentType, checksumAlgorithm, sourceCreds)
 		if err != nil {
 			return nil, err
 		}
+		function.Spec.Checksum = checksum
+		bundle := []byte(functionContent)
 		if strings.Contains(contentType, "url") {
 			// set the function to be the URL provided on the command line
 			function.Spec.Function = file
 		} else {
 			function.Spec.Function = functionContent
+			bundle, err = ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
 		}
-		function.Spec.Checksum = checksum
+		// The provision container verifies every file extracted from the bundle
+		files, err := kubelessutil.BundleChecksums(checksumAlgorithm, contentType, bundle)
+		if err != nil {
+			return nil, err
+		}
+		if files == nil && strings.Contains(contentType, "compressedtar") {
+			logrus.Warnf("Unable to list the files of %s, only the checksum of the file will be verified", file)
+		}
+		function.Spec.ChecksumManifest = kubelessutil.FormatChecksumManifest(files)
 		function.Spec.FunctionContentType = contentType
+		function.Spec.FunctionRef = ""
+		function.Spec.FunctionPath = ""
+		function.Spec.FunctionSecret = ""
+		function.Spec.Signature = ""
 	}
 
 	if deps != "" {
@@ -266,6 +306,137 @@ func getFunctionDescription(funcName, ns, handler, file, deps, runtime, runtimeI
 	return &function, nil
 }
 
+// setGitSource sets the code of the function to the given path of a Git repository at the commit the ref points to.
+// The refs of private HTTP repositories are read with the username and password of the function secret
+func setGitSource(cli kubernetes.Interface, function *kubelessApi.Function, repo, ref, subPath, secret string) error {
+	username, password := "", ""
+	if secret != "" {
+		creds, err := kubelessutil.GetSourceCredentials(cli, function.ObjectMeta.Namespace, secret)
+		if err != nil {
+			return err
+		}
+		username, password = creds.Username, creds.Password
+	}
+	commit, err := kubelessutil.ResolveGitRef(repo, ref, username, password)
+	if err != nil {
+		return err
+	}
+	function.Spec.Function = repo
+	function.Spec.FunctionRef = ref
+	function.Spec.FunctionPath = subPath
+	function.Spec.FunctionSecret = secret
+	function.Spec.Checksum = kubelessutil.GitChecksum(commit)
+	function.Spec.ChecksumManifest = ""
+	function.Spec.Signature = ""
+	function.Spec.FunctionContentType = "git"
+	if function.Spec.Deps == "" {
+		// Install the dependencies file of the repository
+		function.Spec.FunctionContentType = "git+deps"
+	}
+	return nil
+}
+
+// setDepsChecksum adds the checksum of the dependencies file to the checksum manifest of the function, unless
+// the dependencies are part of the bundle. The file is copied to the directory of the function even if it is
+// empty when the function is a bundle, so in that case its checksum replaces the one of the bundle file
+func setDepsChecksum(f *kubelessApi.Function, lr *langruntime.Langruntimes, algorithm string) error {
+	if lr == nil || strings.Contains(f.Spec.FunctionContentType, "deps") {
+		return nil
+	}
+	runtimeInf, err := lr.GetRuntimeInfo(f.Spec.Runtime)
+	if err != nil || runtimeInf.DepName == "" {
+		return nil
+	}
+	files, err := kubelessutil.ParseChecksumManifest(f.Spec.ChecksumManifest)
+	if err != nil {
+		return err
+	}
+	if f.Spec.Deps == "" && len(files) == 0 {
+		return nil
+	}
+	files[runtimeInf.DepName], err = kubelessutil.ComputeChecksum(algorithm, []byte(f.Spec.Deps))
+	if err != nil {
+		return err
+	}
+	f.Spec.ChecksumManifest = kubelessutil.FormatChecksumManifest(files)
+	return nil
+}
+
+// signFunction signs the function with the private key stored in the given file
+func signFunction(f *kubelessApi.Function, keyFile string) error {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("Unable to read the signing key: %v", err)
+	}
+	return kubelessutil.SignFunction(&f.Spec, key)
+}
+
+// writeSignaturePayload stores the payload covered by the signature of the function in the given file,
+// so it can be signed with other tools like `cosign sign-blob`
+func writeSignaturePayload(f *kubelessApi.Function, file string) error {
+	payload, err := kubelessutil.FunctionSignaturePayload(&f.Spec)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, payload, 0644)
+}
+
+// removeStaleSignature removes the signature of the function if a field covered by it has changed
+func removeStaleSignature(f, previous *kubelessApi.Function) {
+	payload, err := kubelessutil.FunctionSignaturePayload(&f.Spec)
+	previousPayload, previousErr := kubelessutil.FunctionSignaturePayload(&previous.Spec)
+	if err != nil || previousErr != nil || !bytes.Equal(payload, previousPayload) {
+		f.Spec.Signature = ""
+	}
+}
+
+// uploadLargeFunction moves the code of the function to the artifact store if the file is larger than
+// the threshold of the kubeless configuration. The function keeps the URL of the bundle and its checksum
+func uploadLargeFunction(f *kubelessApi.Function, file string, config *v1.ConfigMap, newStore func() (artifacts.Store, error)) error {
+	if file == "" || strings.Contains(f.Spec.FunctionContentType, "url") {
+		return nil
+	}
+	threshold, err := artifacts.Threshold(config)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) <= threshold {
+		return nil
+	}
+	store, err := newStore()
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		logrus.Warnf("The function file is %d bytes, larger than the threshold of %d bytes. It may exceed the maximum size of the Function and ConfigMap objects, configure an artifact store to avoid it", len(content), threshold)
+		return nil
+	}
+	functionURL, err := store.Put(artifacts.Key(f.ObjectMeta.Namespace, f.ObjectMeta.Name, file, content), content)
+	if err != nil {
+		return err
+	}
+	// The provision container downloads the bundle and verifies the checksum of the file
+	contentType := strings.SplitN(f.Spec.FunctionContentType, "+", 2)
+	contentType[0] = "url"
+	f.Spec.Function = functionURL
+	f.Spec.FunctionContentType = strings.Join(contentType, "+")
+	f.Spec.FunctionSecret = store.Secret()
+	return nil
+}
+
+// newArtifactStore returns the artifact store of the kubeless configuration for the functions of the namespace
+func newArtifactStore(cli kubernetes.Interface, config *v1.ConfigMap, ns string) (artifacts.Store, error) {
+	restConfig, err := kubelessutil.BuildOutOfClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.NewStore(cli, restConfig, config, ns)
+}
+
 func getDeploymentStatus(cli kubernetes.Interface, funcName, ns string) (string, error) {
 	dpm, err := cli.AppsV1().Deployments(ns).Get(funcName, metav1.GetOptions{})
 	if err != nil {
@@ -280,6 +451,28 @@ func getDeploymentStatus(cli kubernetes.Interface, funcName, ns string) (string,
 	return status, nil
 }
 
+// getFunctionStatus returns the status of the function deployment followed
+// by the reason of the first step that is not ready according to the function status
+func getFunctionStatus(cli kubernetes.Interface, f *kubelessApi.Function) (string, error) {
+	failed := kubelessutil.FunctionObjFailedCondition(f)
+	status, err := getDeploymentStatus(cli, f.ObjectMeta.Name, f.ObjectMeta.Namespace)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return "", err
+		}
+		if failed == nil {
+			return "MISSING: Check controller logs", nil
+		}
+		return fmt.Sprintf("%s: %s", strings.ToUpper(string(f.Status.Phase)), failed.Reason), nil
+	}
+	if failed != nil {
+		status += ": " + failed.Reason
+	} else if c := kubelessutil.FunctionObjGetCondition(f, kubelessApi.FunctionDeploymentAvailable); c != nil && c.Reason == "ScaledToZero" && strings.HasPrefix(status, "0/0 ") {
+		status = "0/0 SCALED TO ZERO"
+	}
+	return status, nil
+}
+
 func getFunctions(kubelessClient versioned.Interface, namespace, functionName string) ([]*kubelessApi.Function, error) {
 	if functionName == "" {
 		f, err := kubelessClient.KubelessV1beta1().Functions(namespace).List(metav1.ListOptions{})
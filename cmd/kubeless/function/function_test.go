@@ -28,16 +28,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/artifacts"
+	kubelessutil "github.com/kubeless/kubeless/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2beta1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestParseLabel(t *testing.T) {
@@ -121,7 +126,7 @@ func TestGetFunctionDescription(t *testing.T) {
 	file.Close()
 	defer os.Remove(file.Name()) // clean up
 
-	result, err := getFunctionDescription("test", "default", "file.handler", file.Name(), "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo1=bar1", "baz1:qux1"}, kubelessApi.Function{})
+	result, err := getFunctionDescription("test", "default", "file.handler", file.Name(), "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo1=bar1", "baz1:qux1"}, kubelessApi.Function{}, nil, "sha256")
 
 	if err != nil {
 		t.Error(err)
@@ -213,7 +218,7 @@ func TestGetFunctionDescription(t *testing.T) {
 	}
 
 	// It should take the default values
-	result2, err := getFunctionDescription("test", "default", "", "", "", "", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction)
+	result2, err := getFunctionDescription("test", "default", "", "", "", "", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction, nil, "sha256")
 
 	if err != nil {
 		t.Error(err)
@@ -234,7 +239,7 @@ func TestGetFunctionDescription(t *testing.T) {
 	file.Close()
 	defer os.Remove(file.Name()) // clean up
 
-	result3, err := getFunctionDescription("test", "default", "file.handler2", file.Name(), "dependencies2", "runtime2", "test-image2", "256Mi", "100m", "20", "Always", "NewServiceAccount", 8080, 0, false, []string{"TEST=2"}, []string{"test=2"}, []string{"secret2"}, []string{"foo2=bar2", "baz2:qux2"}, expectedFunction)
+	result3, err := getFunctionDescription("test", "default", "file.handler2", file.Name(), "dependencies2", "runtime2", "test-image2", "256Mi", "100m", "20", "Always", "NewServiceAccount", 8080, 0, false, []string{"TEST=2"}, []string{"test=2"}, []string{"secret2"}, []string{"foo2=bar2", "baz2:qux2"}, expectedFunction, nil, "sha256")
 
 	if err != nil {
 		t.Error(err)
@@ -384,7 +389,11 @@ func TestGetFunctionDescription(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	_, err = io.Copy(writer, file)
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = io.Copy(tarW, file)
 	if err != nil {
 		t.Error(err)
 	}
@@ -396,7 +405,7 @@ func TestGetFunctionDescription(t *testing.T) {
 	gzipW.Close()
 	tarGzFile.Close()
 
-	result4A, err := getFunctionDescription("test", "default", "file.handler", zipFile.Name(), "dependencies", "runtime", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction)
+	result4A, err := getFunctionDescription("test", "default", "file.handler", zipFile.Name(), "dependencies", "runtime", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction, nil, "sha256")
 	if err != nil {
 		t.Error(err)
 	}
@@ -404,7 +413,7 @@ func TestGetFunctionDescription(t *testing.T) {
 		t.Errorf("Should return base64+zip, received %s", result4A.Spec.FunctionContentType)
 	}
 
-	result4B, err := getFunctionDescription("test", "default", "file.handler", tarGzFile.Name(), "dependencies", "runtime", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction)
+	result4B, err := getFunctionDescription("test", "default", "file.handler", tarGzFile.Name(), "dependencies", "runtime", "", "", "", "", "Always", "", 8080, 0, false, []string{}, []string{}, []string{}, []string{}, expectedFunction, nil, "sha256")
 	if err != nil {
 		t.Error(err)
 	}
@@ -422,13 +431,13 @@ func TestGetFunctionDescription(t *testing.T) {
 				},
 			},
 		},
-	})
+	}, nil, "sha256")
 	if result5.Spec.HorizontalPodAutoscaler.ObjectMeta.Name != "previous-hpa" {
 		t.Error("should maintain previous HPA definition")
 	}
 
 	// It should set the Port, ServicePort and headless service properly
-	result6, err := getFunctionDescription("test", "default", "file.handler", file.Name(), "dependencies", "runtime", "test-image", "128Mi", "", "", "Always", "serviceAccount", 9091, 9092, true, []string{}, []string{}, []string{}, []string{}, kubelessApi.Function{})
+	result6, err := getFunctionDescription("test", "default", "file.handler", file.Name(), "dependencies", "runtime", "test-image", "128Mi", "", "", "Always", "serviceAccount", 9091, 9092, true, []string{}, []string{}, []string{}, []string{}, kubelessApi.Function{}, nil, "sha256")
 	expectedPort := v1.ServicePort{
 		Name:       "http-function-port",
 		Port:       9092,
@@ -530,7 +539,7 @@ func TestGetFunctionDescription(t *testing.T) {
 		},
 	}
 
-	result7, err := getFunctionDescription("test", "default", "file.handler", ts.URL, "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{})
+	result7, err := getFunctionDescription("test", "default", "file.handler", ts.URL, "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{}, nil, "sha256")
 
 	if err != nil {
 		t.Error(err)
@@ -557,8 +566,18 @@ func TestGetFunctionDescription(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	// The manifest lists the files of the bundle
+	fileContent, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Error(err)
+	}
+	fileChecksum, err := getSha256(fileContent)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedURLFunction.Spec.ChecksumManifest = fmt.Sprintf("%s  %s\n", fileChecksum, filepath.Base(file.Name()))
 
-	result8A, err := getFunctionDescription("test", "default", "file.handler", ts2A.URL+"/test.zip", "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{})
+	result8A, err := getFunctionDescription("test", "default", "file.handler", ts2A.URL+"/test.zip", "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{}, nil, "sha256")
 	if err != nil {
 		t.Error(err)
 	}
@@ -581,8 +600,9 @@ func TestGetFunctionDescription(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	expectedURLFunction.Spec.ChecksumManifest = fmt.Sprintf("%s  %s\n", fileChecksum, strings.TrimPrefix(file.Name(), "/"))
 
-	result8B, err := getFunctionDescription("test", "default", "file.handler", ts2B.URL+"/test.tar.gz", "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{})
+	result8B, err := getFunctionDescription("test", "default", "file.handler", ts2B.URL+"/test.tar.gz", "dependencies", "runtime", "test-image", "128Mi", "", "10", "Always", "serviceAccount", 8080, 0, false, []string{"TEST=1"}, []string{"test=1"}, []string{"secretName"}, []string{"foo3=bar3", "baz3:qux3"}, kubelessApi.Function{}, nil, "sha256")
 	if err != nil {
 		t.Error(err)
 	}
@@ -592,6 +612,169 @@ func TestGetFunctionDescription(t *testing.T) {
 	// end test
 }
 
+func TestGetFunctionDescriptionCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Private-Token") != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("function"))
+	}))
+	defer ts.Close()
+
+	_, err := getFunctionDescription("test", "default", "file.handler", ts.URL+"/file.py", "", "python2.7", "", "", "", "", "Always", "", 8080, 0, false, nil, nil, nil, nil, kubelessApi.Function{}, nil, "sha256")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expecting an unauthorized error, received %v", err)
+	}
+
+	creds := &kubelessutil.SourceCredentials{Headers: http.Header{"Private-Token": []string{"abc"}}}
+	f, err := getFunctionDescription("test", "default", "file.handler", ts.URL+"/file.py", "", "python2.7", "", "", "", "", "Always", "", 8080, 0, false, nil, nil, nil, nil, kubelessApi.Function{}, creds, "sha256")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checksum, _ := getSha256([]byte("function"))
+	if f.Spec.Function != ts.URL+"/file.py" || f.Spec.Checksum != checksum {
+		t.Errorf("Unexpected function %s with checksum %s", f.Spec.Function, f.Spec.Checksum)
+	}
+}
+
+// memoryStore keeps the uploaded bundles in memory
+type memoryStore map[string][]byte
+
+func (s memoryStore) Put(key string, content []byte) (string, error) {
+	s[key] = content
+	return "http://artifact-server.kubeless.svc:8080/" + key, nil
+}
+
+func (s memoryStore) Secret() string {
+	return ""
+}
+
+func TestUploadLargeFunction(t *testing.T) {
+	file, err := ioutil.TempFile("", "func*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	content := []byte(strings.Repeat("a", 2048))
+	file.Write(content)
+	file.Close()
+
+	store := memoryStore{}
+	newStore := func() (artifacts.Store, error) {
+		return store, nil
+	}
+	config := &v1.ConfigMap{Data: map[string]string{"artifact-store-threshold": "4Ki"}}
+	f := &kubelessApi.Function{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	f.Spec.Function = "inline"
+	f.Spec.FunctionContentType = "base64+zip"
+	if err := uploadLargeFunction(f, file.Name(), config, newStore); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.Spec.Function != "inline" || len(store) != 0 {
+		t.Errorf("Expecting the function below the threshold to be kept in the object")
+	}
+
+	config.Data["artifact-store-threshold"] = "1Ki"
+	if err := uploadLargeFunction(f, file.Name(), config, newStore); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	key := artifacts.Key("default", "foo", file.Name(), content)
+	if string(store[key]) != string(content) {
+		t.Errorf("Expecting the bundle to be stored with the key %s, received %v", key, store)
+	}
+	if f.Spec.Function != "http://artifact-server.kubeless.svc:8080/"+key || f.Spec.FunctionContentType != "url+zip" {
+		t.Errorf("Unexpected function %s of type %s", f.Spec.Function, f.Spec.FunctionContentType)
+	}
+
+	// Without store the function is kept in the object
+	f.Spec.Function = "inline"
+	f.Spec.FunctionContentType = "text"
+	err = uploadLargeFunction(f, file.Name(), config, func() (artifacts.Store, error) {
+		return nil, nil
+	})
+	if err != nil || f.Spec.Function != "inline" {
+		t.Errorf("Unexpected function %s: %v", f.Spec.Function, err)
+	}
+}
+
+func TestSetGitSource(t *testing.T) {
+	commit := "2222222222222222222222222222222222222222"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		line := commit + " refs/heads/dev\n"
+		fmt.Fprintf(w, "0000%04x%s0000", len(line)+4, line)
+	}))
+	defer ts.Close()
+	cli := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-creds", Namespace: "default"},
+		Data: map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		},
+	})
+
+	f := &kubelessApi.Function{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	err := setGitSource(cli, f, ts.URL+"/repo.git", "dev", "hello", "git-creds")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedSpec := kubelessApi.FunctionSpec{
+		Function:            ts.URL + "/repo.git",
+		FunctionContentType: "git+deps",
+		FunctionRef:         "dev",
+		FunctionPath:        "hello",
+		FunctionSecret:      "git-creds",
+		Checksum:            "sha1:" + commit,
+	}
+	if !reflect.DeepEqual(f.Spec, expectedSpec) {
+		t.Errorf("Unexpected result. Expecting:\n %+v\nReceived:\n %+v", expectedSpec, f.Spec)
+	}
+
+	// The dependencies of the function replace the ones of the repository
+	f.Spec.Deps = "requests"
+	err = setGitSource(cli, f, ts.URL+"/repo.git", "dev", "hello", "git-creds")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.Spec.FunctionContentType != "git" {
+		t.Errorf("Expecting the content type git, received %s", f.Spec.FunctionContentType)
+	}
+
+	err = setGitSource(cli, f, ts.URL+"/repo.git", "dev", "hello", "")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expecting an unauthorized error, received %v", err)
+	}
+	err = setGitSource(cli, f, ts.URL+"/repo.git", "dev", "hello", "missing")
+	if err == nil || !strings.Contains(err.Error(), "Unable to read the function secret") {
+		t.Errorf("Expecting an error reading the secret, received %v", err)
+	}
+}
+
+func TestRemoveStaleSignature(t *testing.T) {
+	previous := &kubelessApi.Function{Spec: kubelessApi.FunctionSpec{
+		Checksum:  "sha256:abc",
+		Handler:   "hello.foo",
+		Runtime:   "python2.7",
+		Signature: "signature",
+	}}
+	f := previous.DeepCopy()
+	f.Spec.Timeout = "10"
+	removeStaleSignature(f, previous)
+	if f.Spec.Signature != "signature" {
+		t.Error("Expecting the signature to be kept if the signed fields don't change")
+	}
+	f.Spec.Handler = "hello.bar"
+	removeStaleSignature(f, previous)
+	if f.Spec.Signature != "" {
+		t.Error("Expecting the signature to be removed when the handler changes")
+	}
+}
+
 func getSha256(bytes []byte) (string, error) {
 	h := sha256.New()
 	_, err := h.Write(bytes)
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gosuri/uitable"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <function_name> FLAG",
+	Short: "list the revisions of a function",
+	Long:  `list the revisions of a function stored by the Kubeless controller`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("Need exactly one argument - function name")
+		}
+		funcName := args[0]
+
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatalf("Can not list revisions: %v", err)
+		}
+
+		if err := doHistory(cmd.OutOrStdout(), kubelessClient, funcName, ns); err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringP("namespace", "n", "", "Specify namespace for the function")
+}
+
+func doHistory(w io.Writer, kubelessClient versioned.Interface, funcName, ns string) error {
+	f, err := kubelessClient.KubelessV1beta1().Functions(ns).Get(funcName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	revisions, err := utils.GetFunctionRevisions(kubelessClient, funcName, ns)
+	if err != nil {
+		return err
+	}
+
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("REVISION", "CREATED", "CHECKSUM", "CHANGE-CAUSE")
+	for _, r := range revisions {
+		revision := fmt.Sprintf("%d", r.Spec.Revision)
+		if r.Spec.Revision == f.Status.Revision {
+			revision += " (current)"
+		}
+		table.AddRow(revision, r.ObjectMeta.CreationTimestamp.String(), r.Spec.Function.Checksum, r.ObjectMeta.Annotations[utils.ChangeCauseAnnotation])
+	}
+	fmt.Fprintln(w, table)
+	return nil
+}
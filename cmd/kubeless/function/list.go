@@ -27,7 +27,6 @@ import (
 	"github.com/gosuri/uitable"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
@@ -128,10 +127,8 @@ func printFunctions(w io.Writer, functions []*kubelessApi.Function, cli kubernet
 			h := f.Spec.Handler
 			r := f.Spec.Runtime
 			ns := f.ObjectMeta.Namespace
-			status, err := getDeploymentStatus(cli, f.ObjectMeta.Name, f.ObjectMeta.Namespace)
-			if err != nil && k8sErrors.IsNotFound(err) {
-				status = "MISSING: Check controller logs"
-			} else if err != nil {
+			status, err := getFunctionStatus(cli, f)
+			if err != nil {
 				return err
 			}
 			deps, err := parseDeps(f.Spec.Deps, r)
@@ -155,10 +152,8 @@ func printFunctions(w io.Writer, functions []*kubelessApi.Function, cli kubernet
 				return err
 			}
 			ns := f.ObjectMeta.Namespace
-			status, err := getDeploymentStatus(cli, f.ObjectMeta.Name, f.ObjectMeta.Namespace)
-			if err != nil && k8sErrors.IsNotFound(err) {
-				status = "MISSING: Check controller logs"
-			} else if err != nil {
+			status, err := getFunctionStatus(cli, f)
+			if err != nil {
 				return err
 			}
 			mem := ""
@@ -135,10 +135,55 @@ func TestList(t *testing.T) {
 					},
 				},
 			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "failed",
+					Namespace: "myns",
+				},
+				Status: kubelessApi.FunctionStatus{
+					Phase: kubelessApi.FunctionPhaseFailed,
+					Conditions: []kubelessApi.FunctionCondition{
+						{
+							Type:   kubelessApi.FunctionConfigReady,
+							Status: v1.ConditionFalse,
+							Reason: "InvalidDeploymentConfig",
+						},
+					},
+				},
+				Spec: kubelessApi.FunctionSpec{
+					Handler:  "fhandler",
+					Function: "ffunction",
+					Runtime:  "fruntime",
+					Deps:     "fdeps",
+					Deployment: appsv1.Deployment{
+						Spec: appsv1.DeploymentSpec{
+							Template: v1.PodTemplateSpec{
+								Spec: v1.PodSpec{
+									Containers: []v1.Container{{}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	listObj.Items[1].Status = kubelessApi.FunctionStatus{
+		Phase: kubelessApi.FunctionPhaseDeploying,
+		Conditions: []kubelessApi.FunctionCondition{
+			{
+				Type:   kubelessApi.FunctionConfigReady,
+				Status: v1.ConditionTrue,
+			},
+			{
+				Type:   kubelessApi.FunctionDeploymentAvailable,
+				Status: v1.ConditionFalse,
+				Reason: "CrashLoopBackOff",
+			},
 		},
 	}
 
-	client := fFake.NewSimpleClientset(listObj.Items[0], listObj.Items[1], listObj.Items[2])
+	client := fFake.NewSimpleClientset(listObj.Items[0], listObj.Items[1], listObj.Items[2], listObj.Items[3])
 
 	deploymentFoo := appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -177,7 +222,7 @@ func TestList(t *testing.T) {
 	if !m {
 		t.Errorf("table output didn't mention deployment status")
 	}
-	m, err = regexp.MatchString("bar.*0/2 NOT READY", output)
+	m, err = regexp.MatchString("bar.*0/2 NOT READY: CrashLoopBackOff", output)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -191,6 +236,13 @@ func TestList(t *testing.T) {
 	if !m {
 		t.Errorf("table output didn't mention deployment status")
 	}
+	m, err = regexp.MatchString("failed.*FAILED: InvalidDeploymentConfig", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m {
+		t.Errorf("table output didn't mention the reason of the failure")
+	}
 
 	// Explicit arg(s)
 	output = listOutput(t, client, apiV1Client, "myns", "", []string{"foo"})
@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote <function_name> FLAG",
+	Short: "send all the requests of a function to its latest revision",
+	Long:  `send all the requests of a function to its latest revision, removing the traffic split created with 'kubeless function update --canary'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("Need exactly one argument - function name")
+		}
+		funcName := args[0]
+
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		err = doPromote(kubelessClient, funcName, ns)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Function %s promoted", funcName)
+	},
+}
+
+func init() {
+	promoteCmd.Flags().StringP("namespace", "n", "", "Specify namespace for the function")
+}
+
+// doPromote removes the traffic split of the function so the latest revision receives all the requests
+func doPromote(kubelessClient versioned.Interface, funcName, ns string) error {
+	f, err := kubelessClient.KubelessV1beta1().Functions(ns).Get(funcName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if len(f.Spec.Traffic) == 0 {
+		return fmt.Errorf("Function %s is not splitting its traffic between revisions", funcName)
+	}
+	f.Spec.Traffic = nil
+	if f.ObjectMeta.Annotations == nil {
+		f.ObjectMeta.Annotations = map[string]string{}
+	}
+	f.ObjectMeta.Annotations[utils.ChangeCauseAnnotation] = fmt.Sprintf("kubeless function promote %s", funcName)
+	return utils.UpdateFunctionCustomResource(kubelessClient, f)
+}
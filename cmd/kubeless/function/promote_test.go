@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+)
+
+func TestCanaryTraffic(t *testing.T) {
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Status:     kubelessApi.FunctionStatus{Revision: 3},
+	}
+	traffic, err := canaryTraffic(f, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []kubelessApi.FunctionTrafficTarget{{Revision: 3, Percent: 90}, {LatestRevision: true, Percent: 10}}
+	if !reflect.DeepEqual(traffic, expected) {
+		t.Errorf("Expecting %v, received %v", expected, traffic)
+	}
+
+	// An ongoing canary keeps its stable revision
+	f.Spec.Traffic = expected
+	f.Status.Revision = 4
+	traffic, err = canaryTraffic(f, 50)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = []kubelessApi.FunctionTrafficTarget{{Revision: 3, Percent: 50}, {LatestRevision: true, Percent: 50}}
+	if !reflect.DeepEqual(traffic, expected) {
+		t.Errorf("Expecting %v, received %v", expected, traffic)
+	}
+
+	// The function has not been processed by the controller
+	if _, err := canaryTraffic(&kubelessApi.Function{}, 10); err == nil {
+		t.Error("Expecting an error for a function without revision")
+	}
+}
+
+func TestPromote(t *testing.T) {
+	client := revisionsClient()
+	if err := doPromote(client, "foo", "myns"); err == nil {
+		t.Error("Expecting an error for a function without traffic split")
+	}
+
+	f, _ := client.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	f.Spec.Traffic = []kubelessApi.FunctionTrafficTarget{{Revision: 2, Percent: 90}, {LatestRevision: true, Percent: 10}}
+	if _, err := client.KubelessV1beta1().Functions("myns").Update(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := doPromote(client, "foo", "myns"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, _ = client.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	if len(f.Spec.Traffic) != 0 {
+		t.Errorf("Expecting the traffic split to be removed, received %v", f.Spec.Traffic)
+	}
+}
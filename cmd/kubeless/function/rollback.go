@@ -0,0 +1,116 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <function_name> FLAG",
+	Short: "rollback a function to a previous revision",
+	Long:  `rollback a function to a previous revision. Use 'kubeless function history' to list the available revisions`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("Need exactly one argument - function name")
+		}
+		funcName := args[0]
+
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+
+		toRevision, err := cmd.Flags().GetInt64("to-revision")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if toRevision < 0 {
+			logrus.Fatalf("Invalid revision %d specified", toRevision)
+		}
+
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		revision, err := doRollback(kubelessClient, funcName, ns, toRevision)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Function %s rolled back to revision %d", funcName, revision)
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().StringP("namespace", "n", "", "Specify namespace for the function")
+	rollbackCmd.Flags().Int64("to-revision", 0, "The revision to rollback to. Default to 0 (previous revision)")
+}
+
+// doRollback restores the spec of the given revision in the function and returns the revision used
+func doRollback(kubelessClient versioned.Interface, funcName, ns string, toRevision int64) (int64, error) {
+	f, err := kubelessClient.KubelessV1beta1().Functions(ns).Get(funcName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	revisions, err := utils.GetFunctionRevisions(kubelessClient, funcName, ns)
+	if err != nil {
+		return 0, err
+	}
+
+	var target *kubelessApi.FunctionRevision
+	for _, r := range revisions {
+		if toRevision == 0 {
+			// Look for the latest revision previous to the current one
+			if r.Spec.Revision < f.Status.Revision {
+				target = r
+			}
+		} else if r.Spec.Revision == toRevision {
+			target = r
+		}
+	}
+	if target == nil {
+		if toRevision == 0 {
+			return 0, fmt.Errorf("Function %s doesn't have a previous revision", funcName)
+		}
+		return 0, fmt.Errorf("Revision %d of function %s not found", toRevision, funcName)
+	}
+
+	idleTimeout := f.Spec.IdleTimeout
+	f.Spec = *target.Spec.Function.DeepCopy()
+	f.Spec.IdleTimeout = idleTimeout
+	if f.ObjectMeta.Annotations == nil {
+		f.ObjectMeta.Annotations = map[string]string{}
+	}
+	f.ObjectMeta.Annotations[utils.ChangeCauseAnnotation] = fmt.Sprintf("Rollback to revision %d", target.Spec.Revision)
+	err = utils.UpdateFunctionCustomResource(kubelessClient, f)
+	if err != nil {
+		return 0, err
+	}
+	return target.Spec.Revision, nil
+}
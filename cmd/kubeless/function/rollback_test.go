@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	fFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+func revisionsClient() *fFake.Clientset {
+	objects := []runtime.Object{
+		&kubelessApi.Function{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "myns",
+			},
+			Spec: kubelessApi.FunctionSpec{
+				Function: "function3",
+				Checksum: "sha256:3",
+			},
+			Status: kubelessApi.FunctionStatus{
+				Revision: 3,
+			},
+		},
+	}
+	for i, content := range []string{"function1", "function2", "function3"} {
+		objects = append(objects, &kubelessApi.FunctionRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("foo-%d", i+1),
+				Namespace: "myns",
+				Labels: map[string]string{
+					"created-by": "kubeless",
+					"function":   "foo",
+				},
+				Annotations: map[string]string{
+					utils.ChangeCauseAnnotation: "kubeless function update foo --from-file",
+				},
+			},
+			Spec: kubelessApi.FunctionRevisionSpec{
+				Revision: int64(i + 1),
+				Function: kubelessApi.FunctionSpec{
+					Function: content,
+					Checksum: fmt.Sprintf("sha256:%d", i+1),
+				},
+			},
+		})
+	}
+	return fFake.NewSimpleClientset(objects...)
+}
+
+func TestHistory(t *testing.T) {
+	var buf bytes.Buffer
+	if err := doHistory(&buf, revisionsClient(), "foo", "myns"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := buf.String()
+	t.Log("output is", output)
+	for _, expected := range []string{"1 .*sha256:1.*--from-file", "2 .*sha256:2", "3 \\(current\\).*sha256:3"} {
+		m, err := regexp.MatchString(expected, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m {
+			t.Errorf("history output doesn't match %s", expected)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	client := revisionsClient()
+
+	// Default to the previous revision
+	revision, err := doRollback(client, "foo", "myns", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if revision != 2 {
+		t.Errorf("Expecting rollback to revision 2, got %d", revision)
+	}
+	f, _ := client.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	if f.Spec.Function != "function2" || f.Spec.Checksum != "sha256:2" {
+		t.Errorf("Function spec not restored: %v", f.Spec)
+	}
+	if f.ObjectMeta.Annotations[utils.ChangeCauseAnnotation] != "Rollback to revision 2" {
+		t.Errorf("Unexpected change cause %s", f.ObjectMeta.Annotations[utils.ChangeCauseAnnotation])
+	}
+
+	// Explicit revision
+	revision, err = doRollback(client, "foo", "myns", 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, _ = client.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	if revision != 1 || f.Spec.Function != "function1" {
+		t.Errorf("Function spec not restored: %v", f.Spec)
+	}
+
+	// Unknown revision
+	if _, err := doRollback(client, "foo", "myns", 7); err == nil {
+		t.Error("Expecting an error for an unknown revision")
+	}
+}
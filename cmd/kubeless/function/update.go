@@ -22,6 +22,8 @@ import (
 	"strings"
 
 	"github.com/ghodss/yaml"
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/artifacts"
 	"github.com/kubeless/kubeless/pkg/langruntime"
 	"github.com/kubeless/kubeless/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -69,6 +71,44 @@ var updateCmd = &cobra.Command{
 			logrus.Fatal(err)
 		}
 
+		gitRepo, err := cmd.Flags().GetString("from-git")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		gitRef, err := cmd.Flags().GetString("ref")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		gitPath, err := cmd.Flags().GetString("path")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		functionSecret, err := cmd.Flags().GetString("function-secret")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		signKey, err := cmd.Flags().GetString("sign-key")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		signaturePayload, err := cmd.Flags().GetString("signature-payload")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		checksumAlgorithm, err := cmd.Flags().GetString("checksum-algorithm")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if file != "" && gitRepo != "" {
+			logrus.Fatal("The flags --from-file and --from-git are mutually exclusive")
+		}
+
 		secrets, err := cmd.Flags().GetStringSlice("secrets")
 		if err != nil {
 			logrus.Fatal(err)
@@ -177,15 +217,83 @@ var updateCmd = &cobra.Command{
 			logrus.Fatal(err)
 		}
 
+		canary, err := cmd.Flags().GetInt32("canary")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if canary < 0 || canary > 99 {
+			logrus.Fatalf("Invalid canary percentage %d specified", canary)
+		}
+
 		previousFunction, err := utils.GetFunction(funcName, ns)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
-		f, err := getFunctionDescription(funcName, ns, handler, file, funcDeps, runtime, runtimeImage, mem, cpu, timeout, imagePullPolicy, serviceAccount, port, servicePort, headless, envs, labels, secrets, nodeSelectors, previousFunction)
+		if !cmd.Flags().Changed("function-secret") {
+			functionSecret = previousFunction.Spec.FunctionSecret
+		}
+		var sourceCreds *utils.SourceCredentials
+		if functionSecret != "" && file != "" {
+			sourceCreds, err = utils.GetSourceCredentials(cli, ns, functionSecret)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
+		f, err := getFunctionDescription(funcName, ns, handler, file, funcDeps, runtime, runtimeImage, mem, cpu, timeout, imagePullPolicy, serviceAccount, port, servicePort, headless, envs, labels, secrets, nodeSelectors, previousFunction, sourceCreds, checksumAlgorithm)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if sourceCreds != nil && strings.Contains(f.Spec.FunctionContentType, "url") {
+			f.Spec.FunctionSecret = functionSecret
+		}
+		if gitRepo == "" && strings.Contains(previousFunction.Spec.FunctionContentType, "git") &&
+			(cmd.Flags().Changed("ref") || cmd.Flags().Changed("path") || cmd.Flags().Changed("function-secret")) {
+			// Deploy another ref or path of the same repository
+			gitRepo = previousFunction.Spec.Function
+			if !cmd.Flags().Changed("ref") {
+				gitRef = previousFunction.Spec.FunctionRef
+			}
+			if !cmd.Flags().Changed("path") {
+				gitPath = previousFunction.Spec.FunctionPath
+			}
+		}
+		if gitRepo != "" {
+			err = setGitSource(cli, f, gitRepo, gitRef, gitPath, functionSecret)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		err = setDepsChecksum(f, lr, checksumAlgorithm)
 		if err != nil {
 			logrus.Fatal(err)
 		}
+		removeStaleSignature(f, &previousFunction)
+		if signKey != "" {
+			err = signFunction(f, signKey)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if signaturePayload != "" {
+			err = writeSignaturePayload(f, signaturePayload)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if previousFunction.Spec.Signature != "" && f.Spec.Signature == "" {
+			logrus.Warnf("The function changed and it is not signed anymore, use --sign-key to sign it")
+		}
+		f.ObjectMeta.Annotations = map[string]string{
+			utils.ChangeCauseAnnotation: getChangeCause(cmd, funcName),
+		}
+		if canary > 0 {
+			f.Spec.Traffic, err = canaryTraffic(&previousFunction, canary)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
 
 		if dryrun == true {
 			if output == "json" {
@@ -208,6 +316,13 @@ var updateCmd = &cobra.Command{
 			}
 		}
 
+		err = uploadLargeFunction(f, file, config, func() (artifacts.Store, error) {
+			return newArtifactStore(cli, config, ns)
+		})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
 		kubelessClient, err := utils.GetKubelessClientOutCluster()
 		if err != nil {
 			logrus.Fatal(err)
@@ -219,13 +334,43 @@ var updateCmd = &cobra.Command{
 		}
 		logrus.Infof("Function %s submitted for deployment", funcName)
 		logrus.Infof("Check the deployment status executing 'kubeless function ls %s%s'", funcName, nsArg)
+		if canary > 0 {
+			logrus.Infof("%d%% of the requests will be sent to the new revision. Execute 'kubeless function promote %s%s' to send all of them", canary, funcName, nsArg)
+		}
 	},
 }
 
+// canaryTraffic returns a traffic split that sends the given percentage of the requests to the
+// latest revision of the function and the rest to the stable one. If the function has already
+// a traffic split, its fixed revision is considered the stable one
+func canaryTraffic(previousFunction *kubelessApi.Function, percent int32) ([]kubelessApi.FunctionTrafficTarget, error) {
+	stable := previousFunction.Status.Revision
+	for _, t := range previousFunction.Spec.Traffic {
+		if !t.LatestRevision && t.Revision != 0 {
+			stable = t.Revision
+			break
+		}
+	}
+	if stable == 0 {
+		return nil, fmt.Errorf("Unable to find the current revision of the function %s", previousFunction.ObjectMeta.Name)
+	}
+	return []kubelessApi.FunctionTrafficTarget{
+		{Revision: stable, Percent: 100 - percent},
+		{LatestRevision: true, Percent: percent},
+	}, nil
+}
+
 func init() {
 	updateCmd.Flags().StringP("runtime", "r", "", "Specify runtime")
 	updateCmd.Flags().StringP("handler", "", "", "Specify handler")
 	updateCmd.Flags().StringP("from-file", "f", "", "Specify code file or a URL to the code file")
+	updateCmd.Flags().StringP("from-git", "", "", "Specify a Git repository with the code of the function")
+	updateCmd.Flags().StringP("ref", "", "", "Branch, tag or commit of the Git repository to deploy. The default branch if empty")
+	updateCmd.Flags().StringP("path", "", "", "Directory of the Git repository with the code of the function")
+	updateCmd.Flags().StringP("function-secret", "", "", "Specify a Secret with the credentials to fetch the code of the function from a URL or a Git repository")
+	updateCmd.Flags().StringP("checksum-algorithm", "", "sha256", "Algorithm of the checksums of the function and its files: sha256 or sha512")
+	updateCmd.Flags().StringP("sign-key", "", "", "Specify a PEM encoded Ed25519 or ECDSA P-256 private key to sign the code of the function")
+	updateCmd.Flags().StringP("signature-payload", "", "", "Write the payload covered by the signature of the function to a file, to sign it with other tools like cosign sign-blob")
 	updateCmd.Flags().StringP("memory", "", "", "Request amount of memory for the function")
 	updateCmd.Flags().StringP("cpu", "", "", "Request amount of cpu for the function.")
 	updateCmd.Flags().StringSliceP("label", "l", []string{}, "Specify labels of the function")
@@ -243,4 +388,5 @@ func init() {
 	updateCmd.Flags().Int32("servicePort", 0, "Deploy http-based function with a custom service port")
 	updateCmd.Flags().Bool("dryrun", false, "Output JSON manifest of the function without creating it")
 	updateCmd.Flags().StringP("output", "o", "yaml", "Output format")
+	updateCmd.Flags().Int32("canary", 0, "Percentage of the requests that the new revision of the function should receive. The rest is sent to the current revision")
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/kubeless/kubeless/cmd/kubeless/completion"
 	"github.com/kubeless/kubeless/cmd/kubeless/function"
 	"github.com/kubeless/kubeless/cmd/kubeless/getserverconfig"
+	"github.com/kubeless/kubeless/cmd/kubeless/registry"
 	"github.com/kubeless/kubeless/cmd/kubeless/topic"
 	"github.com/kubeless/kubeless/cmd/kubeless/trigger"
 	"github.com/kubeless/kubeless/cmd/kubeless/version"
@@ -39,7 +40,7 @@ func newRootCmd() *cobra.Command {
 		Long:  globalUsage,
 	}
 
-	cmd.AddCommand(function.FunctionCmd, topic.TopicCmd, version.VersionCmd, autoscale.AutoscaleCmd, getserverconfig.GetServerConfigCmd, trigger.TriggerCmd, completion.CompletionCmd)
+	cmd.AddCommand(function.FunctionCmd, topic.TopicCmd, version.VersionCmd, autoscale.AutoscaleCmd, getserverconfig.GetServerConfigCmd, trigger.TriggerCmd, completion.CompletionCmd, registry.RegistryCmd)
 	return cmd
 }
 
@@ -0,0 +1,312 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	"github.com/kubeless/kubeless/pkg/registry"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+// defaultKeep is the number of revisions whose images are kept if function-revision-history-limit is not set
+const defaultKeep = 10
+
+// buildTagRegexp matches the tags of the images pushed by the build step, the only ones that are deleted
+var buildTagRegexp = regexp.MustCompile("^[a-f0-9]{64}$")
+
+var gcCmd = &cobra.Command{
+	Use:   "gc FLAG",
+	Short: "delete the stale images of the functions",
+	Long: `delete the images of the functions of a namespace that are not used by their current code nor by their last revisions,
+and every image of the functions of the namespace that no longer exist. Only the tags generated by the build step are deleted,
+and only if the labels of the image prove that it was built by this installation for a function of the namespace`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ns, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if ns == "" {
+			ns = utils.GetDefaultNamespace()
+		}
+		keep, err := cmd.Flags().GetInt("keep")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		cli := utils.GetClientOutOfCluster()
+		config, err := utils.GetKubelessConfig(cli, utils.GetAPIExtensionsClientOutOfCluster())
+		if err != nil {
+			logrus.Fatalf("Unable to read the configmap: %v", err)
+		}
+		if keep < 0 {
+			keep = defaultKeep
+			if limit, err := strconv.Atoi(config.Data["function-revision-history-limit"]); err == nil {
+				keep = limit
+			}
+		}
+		kubelessClient, err := utils.GetKubelessClientOutCluster()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		deleted, err := collectGarbage(cli, kubelessClient, config, ns, keep, dryRun)
+		for _, image := range deleted {
+			if dryRun {
+				fmt.Printf("Would delete %s\n", image)
+			} else {
+				fmt.Printf("Deleted %s\n", image)
+			}
+		}
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	gcCmd.Flags().StringP("namespace", "n", "", "Specify the namespace of the functions")
+	gcCmd.Flags().Int("keep", -1, "Number of revisions of each function whose images are kept besides the current one (function-revision-history-limit of the Kubeless configuration by default)")
+	gcCmd.Flags().Bool("dry-run", false, "Only print the images that would be deleted")
+}
+
+// gcRepository is a repository of the registry that is cleaned up
+type gcRepository struct {
+	registry *registry.Registry
+	host     string
+	name     string
+}
+
+// repositories indexes the repositories by their full name
+type repositories map[string]*gcRepository
+
+func (r repositories) add(reg *registry.Registry, host, name string) {
+	key := host + "/" + name
+	if _, ok := r[key]; !ok {
+		r[key] = &gcRepository{registry: reg, host: host, name: name}
+	}
+}
+
+// gcPolicy decides which images of the repositories can be deleted
+type gcPolicy struct {
+	// installation is the UID of the Kubeless configuration, recorded in the images it builds
+	installation string
+	namespace    string
+	// keep has the tags of the current code and of the last revisions of the functions of every namespace,
+	// since functions with the same name share their repositories
+	keep map[string]bool
+	// skipped has the functions whose images cannot be found, none of their images is deleted
+	skipped map[string]bool
+}
+
+// owns returns true if an image with the given labels was built by this installation for a function of the
+// namespace. The images without labels, like the ones built by previous versions, are never deleted
+func (p *gcPolicy) owns(labels map[string]string) bool {
+	name := labels[utils.ImageFunctionLabel]
+	return p.installation != "" && labels[utils.ImageInstallationLabel] == p.installation &&
+		labels[utils.ImageNamespaceLabel] == p.namespace && name != "" && !p.skipped[name]
+}
+
+// newGCPolicy returns the policy to collect the images of a namespace, keeping the images of the current code
+// and of the last revisions of every function. It also returns the functions that have been skipped
+func newGCPolicy(kubelessClient versioned.Interface, config *v1.ConfigMap, ns string, keep int) (*gcPolicy, []*kubelessApi.Function, []string, error) {
+	functions, err := kubelessClient.KubelessV1beta1().Functions(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Unable to list the functions of every namespace: %v", err)
+	}
+	policy := &gcPolicy{
+		installation: string(config.ObjectMeta.UID),
+		namespace:    ns,
+		keep:         map[string]bool{},
+		skipped:      map[string]bool{},
+	}
+	nsFunctions := []*kubelessApi.Function{}
+	failures := []string{}
+	for _, f := range functions.Items {
+		revisions, err := utils.GetFunctionRevisions(kubelessClient, f.ObjectMeta.Name, f.ObjectMeta.Namespace)
+		if err != nil {
+			policy.skipped[f.ObjectMeta.Name] = true
+			failures = append(failures, fmt.Sprintf("Unable to list the revisions of the function %s/%s: %v", f.ObjectMeta.Namespace, f.ObjectMeta.Name, err))
+			continue
+		}
+		if len(revisions) > keep {
+			revisions = revisions[len(revisions)-keep:]
+		}
+		policy.keep[utils.FunctionBuildTag(f)] = true
+		policy.keep[utils.FunctionDepsTag(f)] = true
+		for _, rev := range revisions {
+			revFunc := &kubelessApi.Function{ObjectMeta: f.ObjectMeta, Spec: rev.Spec.Function}
+			policy.keep[utils.FunctionBuildTag(revFunc)] = true
+			policy.keep[utils.FunctionDepsTag(revFunc)] = true
+		}
+		if f.ObjectMeta.Namespace == ns {
+			nsFunctions = append(nsFunctions, f)
+		}
+	}
+	return policy, nsFunctions, failures, nil
+}
+
+// functionRepositories adds the repositories of the given functions. The functions whose repositories cannot be
+// found are skipped and returned as failures
+func functionRepositories(cli kubernetes.Interface, config *v1.ConfigMap, functions []*kubelessApi.Function, policy *gcPolicy, repos repositories) []string {
+	failures := []string{}
+	for _, f := range functions {
+		target, err := utils.GetBuildTarget(cli, f, config.Data["function-registry"], config.Data["function-repository-prefix"])
+		if err != nil {
+			policy.skipped[f.ObjectMeta.Name] = true
+			failures = append(failures, fmt.Sprintf("Unable to find the images of the function %s: %v", f.ObjectMeta.Name, err))
+			continue
+		}
+		repos.add(target.Registry, target.Host, target.Name)
+		repos.add(target.Registry, target.Host, target.DepsName)
+	}
+	return failures
+}
+
+// prefixRepositories adds the function repositories of the default registry and prefix, which include the ones
+// of the functions that no longer exist
+func prefixRepositories(cli kubernetes.Interface, config *v1.ConfigMap, ns string, repos repositories) error {
+	reg, host, prefix, err := utils.GetBuildRegistry(cli, ns, nil, config.Data["function-registry"], config.Data["function-repository-prefix"])
+	if err != nil {
+		return err
+	}
+	catalog, err := reg.Catalog()
+	if registry.IsUnsupported(err) || registry.IsUnauthorized(err) || registry.IsNotFound(err) {
+		logrus.Warningf("Unable to list the repositories of %s, skipping the images of the deleted functions: %v", host, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range catalog {
+		funcName := strings.TrimPrefix(name, prefix+"/")
+		if funcName == name || strings.Contains(funcName, "/") {
+			continue
+		}
+		repos.add(reg, host, name)
+	}
+	return nil
+}
+
+// collectGarbage deletes the images of the functions of the namespace that are not kept and the images of the
+// functions of the namespace that no longer exist. It returns the deleted images (or the images that would be
+// deleted in dry run). The functions and repositories that fail are skipped and reported in the error
+func collectGarbage(cli kubernetes.Interface, kubelessClient versioned.Interface, config *v1.ConfigMap, ns string, keep int, dryRun bool) ([]string, error) {
+	policy, functions, failures, err := newGCPolicy(kubelessClient, config, ns, keep)
+	if err != nil {
+		return nil, err
+	}
+	if policy.installation == "" {
+		return nil, fmt.Errorf("Unable to identify the images of this installation: the Kubeless configuration doesn't have a UID")
+	}
+	repos := repositories{}
+	failures = append(failures, functionRepositories(cli, config, functions, policy, repos)...)
+	err = prefixRepositories(cli, config, ns, repos)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("Unable to list the repositories of the deleted functions: %v", err))
+	}
+	for _, failure := range failures {
+		logrus.Warning(failure)
+	}
+
+	keys := []string{}
+	for key := range repos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	deleted := []string{}
+	for _, key := range keys {
+		images, err := collectRepository(repos[key], policy, dryRun)
+		deleted = append(deleted, images...)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Unable to clean up %s: %v", key, err))
+		}
+	}
+	if len(failures) > 0 {
+		return deleted, fmt.Errorf("Some images have not been collected:\n%s", strings.Join(failures, "\n"))
+	}
+	return deleted, nil
+}
+
+// collectRepository deletes the tags of the build step that are not kept and belong to the namespace. The images
+// are deleted by digest so an image is not deleted if a kept tag or a tag not generated by the build step
+// references it
+func collectRepository(repo *gcRepository, policy *gcPolicy, dryRun bool) ([]string, error) {
+	tags, err := repo.registry.Tags(repo.name)
+	if registry.IsNotFound(err) {
+		// Nothing has been pushed yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+	digests := map[string]string{}
+	keptDigests := map[string]bool{}
+	stale := []string{}
+	for _, tag := range tags {
+		digest, err := repo.registry.ImageDigest(repo.name, tag)
+		if err != nil {
+			return nil, err
+		}
+		digests[tag] = digest
+		if !policy.keep[tag] && buildTagRegexp.MatchString(tag) {
+			labels, err := repo.registry.ImageLabels(repo.name, digest)
+			if err != nil {
+				return nil, err
+			}
+			if policy.owns(labels) {
+				stale = append(stale, tag)
+				continue
+			}
+		}
+		keptDigests[digest] = true
+	}
+	deleted := []string{}
+	deletedDigests := map[string]bool{}
+	for _, tag := range stale {
+		digest := digests[tag]
+		if keptDigests[digest] {
+			continue
+		}
+		if !dryRun && !deletedDigests[digest] {
+			err = repo.registry.DeleteImage(repo.name, digest)
+			if err != nil && !registry.IsNotFound(err) {
+				return deleted, err
+			}
+			deletedDigests[digest] = true
+		}
+		deleted = append(deleted, fmt.Sprintf("%s/%s:%s", repo.host, repo.name, tag))
+	}
+	return deleted, nil
+}
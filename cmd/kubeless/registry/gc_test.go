@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	fFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+// fakeRegistry stores the digest of every tag of every repository and the labels of every digest
+type fakeRegistry struct {
+	images map[string]map[string]string
+	labels map[string]map[string]string
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "_catalog":
+		repositories := []string{}
+		for repo := range r.images {
+			repositories = append(repositories, repo)
+		}
+		sort.Strings(repositories)
+		json.NewEncoder(w).Encode(map[string][]string{"repositories": repositories})
+	case strings.HasSuffix(path, "/tags/list"):
+		repo := strings.TrimSuffix(path, "/tags/list")
+		tags, ok := r.images[repo]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[{"code":"NAME_UNKNOWN"}]}`)
+			return
+		}
+		list := []string{}
+		for tag := range tags {
+			list = append(list, tag)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": list})
+	case strings.Contains(path, "/manifests/"):
+		parts := strings.SplitN(path, "/manifests/", 2)
+		repo, reference := parts[0], parts[1]
+		if req.Method == "DELETE" {
+			for tag, digest := range r.images[repo] {
+				if digest == reference {
+					delete(r.images[repo], tag)
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		digest, ok := r.images[repo][reference]
+		for _, d := range r.images[repo] {
+			if d == reference {
+				digest, ok = d, true
+			}
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		fmt.Fprintf(w, `{"schemaVersion":2,"config":{"digest":"%s-config"},"layers":[]}`, digest)
+	case strings.Contains(path, "/blobs/"):
+		digest := strings.TrimSuffix(strings.SplitN(path, "/blobs/", 2)[1], "-config")
+		json.NewEncoder(w).Encode(map[string]interface{}{"config": map[string]interface{}{"Labels": r.labels[digest]}})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func gcFunction(name, code string) *kubelessApi.Function {
+	return &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "myns"},
+		Spec:       kubelessApi.FunctionSpec{Function: code, Runtime: "python2.7", Deps: "requests"},
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	current := gcFunction("foo", "v3")
+	previous := gcFunction("foo", "v2")
+	old := gcFunction("foo", "v1")
+	tag := utils.FunctionBuildTag
+	depsTag := utils.FunctionDepsTag(current)
+	removedTag := utils.FunctionBuildTag(gcFunction("removed", "v1"))
+
+	// A function with the same name in other namespace shares the repositories
+	otherFoo := gcFunction("foo", "v0")
+	otherFoo.ObjectMeta.Namespace = "otherns"
+	otherStale := tag(gcFunction("foo", "v-1"))
+	labels := func(ns, name string) map[string]string {
+		return map[string]string{utils.ImageInstallationLabel: "kubeless-uid", utils.ImageNamespaceLabel: ns, utils.ImageFunctionLabel: name}
+	}
+
+	fakeReg := &fakeRegistry{images: map[string]map[string]string{
+		"user/foo": {
+			tag(current):  "sha256:3",
+			tag(previous): "sha256:2",
+			tag(old):      "sha256:1",
+			"latest":      "sha256:3",
+			tag(otherFoo): "sha256:0",
+			otherStale:    "sha256:-1",
+		},
+		"user/foo-deps":   {depsTag: "sha256:d"},
+		"user/removed":    {removedTag: "sha256:r"},
+		"user/released":   {removedTag: "sha256:p", "1.0": "sha256:p"},
+		"user/unlabelled": {removedTag: "sha256:u"},
+		"user/cluster2":   {removedTag: "sha256:c"},
+		"other/bar":       {removedTag: "sha256:o"},
+	}, labels: map[string]map[string]string{
+		"sha256:3":  labels("myns", "foo"),
+		"sha256:2":  labels("myns", "foo"),
+		"sha256:1":  labels("myns", "foo"),
+		"sha256:0":  labels("myns", "foo"),
+		"sha256:-1": labels("otherns", "foo"),
+		"sha256:d":  labels("myns", "foo"),
+		"sha256:r":  labels("myns", "removed"),
+		"sha256:p":  labels("myns", "released"),
+		"sha256:c":  {utils.ImageInstallationLabel: "other-uid", utils.ImageNamespaceLabel: "myns", utils.ImageFunctionLabel: "cluster2"},
+		"sha256:o":  labels("myns", "bar"),
+	}}
+	server := httptest.NewServer(fakeReg)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	cli := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: utils.RegistryCredentialsSecret, Namespace: "myns"},
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(fmt.Sprintf(`{"auths": {"%s/v2/": {"username": "user", "password": "pass"}}}`, server.URL)),
+		},
+	})
+	kubelessClient := fFake.NewSimpleClientset(current, otherFoo,
+		&kubelessApi.FunctionRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-1", Namespace: "myns", Labels: map[string]string{"created-by": "kubeless", "function": "foo"}},
+			Spec:       kubelessApi.FunctionRevisionSpec{Revision: 1, Function: old.Spec},
+		},
+		&kubelessApi.FunctionRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-2", Namespace: "myns", Labels: map[string]string{"created-by": "kubeless", "function": "foo"}},
+			Spec:       kubelessApi.FunctionRevisionSpec{Revision: 2, Function: previous.Spec},
+		},
+	)
+	config := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{UID: "kubeless-uid"}, Data: map[string]string{}}
+
+	// The old revision and the deleted functions are stale. The tags that don't belong to builds are never deleted,
+	// nor the images of other namespaces, other installations or without labels, nor the ones used in other namespace
+	expected := []string{
+		fmt.Sprintf("%s/user/foo:%s", serverURL.Host, tag(old)),
+		fmt.Sprintf("%s/user/removed:%s", serverURL.Host, removedTag),
+	}
+	sort.Strings(expected)
+	deleted, err := collectGarbage(cli, kubelessClient, config, "myns", 1, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expecting %v, received %v", expected, deleted)
+	}
+	if len(fakeReg.images["user/foo"]) != 6 || len(fakeReg.images["user/removed"]) != 1 {
+		t.Errorf("Expecting the dry run to keep every image, found %v", fakeReg.images)
+	}
+
+	deleted, err = collectGarbage(cli, kubelessClient, config, "myns", 1, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expecting %v, received %v", expected, deleted)
+	}
+	for repo, tags := range map[string][]string{
+		"user/foo":        {tag(current), tag(previous), "latest", tag(otherFoo), otherStale},
+		"user/released":   {removedTag, "1.0"},
+		"user/foo-deps":   {depsTag},
+		"user/removed":    {},
+		"user/unlabelled": {removedTag},
+		"user/cluster2":   {removedTag},
+		"other/bar":       {removedTag},
+	} {
+		found := []string{}
+		for tag := range fakeReg.images[repo] {
+			found = append(found, tag)
+		}
+		sort.Strings(found)
+		sort.Strings(tags)
+		if !reflect.DeepEqual(found, tags) {
+			t.Errorf("Expecting the tags %v in %s, found %v", tags, repo, found)
+		}
+	}
+
+	// Keeping every revision
+	fakeReg.images["user/foo"][tag(old)] = "sha256:1"
+	deleted, err = collectGarbage(cli, kubelessClient, config, "myns", 10, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expecting to keep every image, received %v", deleted)
+	}
+
+	// A function whose images cannot be found is skipped and reported without stopping the collection
+	broken := gcFunction("broken", "v5")
+	broken.ObjectMeta.Annotations = map[string]string{utils.BuildRegistryAnnotation: "unknown.example.com"}
+	kubelessClient.KubelessV1beta1().Functions("myns").Create(broken)
+	fakeReg.images["user/broken"] = map[string]string{tag(gcFunction("broken", "v4")): "sha256:b"}
+	fakeReg.labels["sha256:b"] = labels("myns", "broken")
+	deleted, err = collectGarbage(cli, kubelessClient, config, "myns", 0, true)
+	if err == nil || !strings.Contains(err.Error(), "function broken") {
+		t.Errorf("Expecting an error for the function broken, received %v", err)
+	}
+	expected = []string{
+		fmt.Sprintf("%s/user/foo:%s", serverURL.Host, tag(old)),
+		fmt.Sprintf("%s/user/foo:%s", serverURL.Host, tag(previous)),
+	}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expecting %v, received %v", expected, deleted)
+	}
+}
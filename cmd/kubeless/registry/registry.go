@@ -0,0 +1,35 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// RegistryCmd contains first-class command for the registry of the function images
+var RegistryCmd = &cobra.Command{
+	Use:   "registry SUBCOMMAND",
+	Short: "manage the function images of the registry",
+	Long:  `registry command allows user to manage the images of the functions pushed to the registry by the build step`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	RegistryCmd.AddCommand(gcCmd)
+}
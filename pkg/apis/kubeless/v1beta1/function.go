@@ -30,21 +30,104 @@ import (
 type Function struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              FunctionSpec `json:"spec"`
+	Spec              FunctionSpec   `json:"spec"`
+	Status            FunctionStatus `json:"status,omitempty"`
 }
 
 // FunctionSpec contains func specification
 type FunctionSpec struct {
-	Handler                 string                          `json:"handler"`               // Function handler: "file.function"
-	Function                string                          `json:"function"`              // Function file content or URL of the function
-	FunctionContentType     string                          `json:"function-content-type"` // Function file content type (plain text, url, base64, zip or compressedtar)
-	Checksum                string                          `json:"checksum"`              // Checksum of the file
-	Runtime                 string                          `json:"runtime"`               // Function runtime to use
-	Timeout                 string                          `json:"timeout"`               // Maximum timeout for the function to complete its execution
-	Deps                    string                          `json:"deps"`                  // Function dependencies
+	Handler                 string                          `json:"handler"`                   // Function handler: "file.function"
+	Function                string                          `json:"function"`                  // Function file content, URL of the function or Git repository
+	FunctionContentType     string                          `json:"function-content-type"`     // Function file content type (plain text, url, git, base64, zip or compressedtar)
+	FunctionRef             string                          `json:"function-ref,omitempty"`    // Git ref (branch, tag or commit) the function was deployed from
+	FunctionPath            string                          `json:"function-path,omitempty"`   // Directory of the Git repository with the function
+	FunctionSecret          string                          `json:"function-secret,omitempty"` // Secret with the credentials to fetch the function
+	Checksum                string                          `json:"checksum"`                  // Checksum of the file
+	ChecksumManifest        string                          `json:"checksum-manifest"`         // Checksums of the files extracted from the bundle and of the dependencies
+	Signature               string                          `json:"signature"`                 // Base64 signature of the fields that decide the code of the function
+	Runtime                 string                          `json:"runtime"`                   // Function runtime to use
+	Timeout                 string                          `json:"timeout"`                   // Maximum timeout for the function to complete its execution
+	Deps                    string                          `json:"deps"`                      // Function dependencies
 	Deployment              appsv1.Deployment               `json:"deployment" protobuf:"bytes,3,opt,name=template"`
 	ServiceSpec             v1.ServiceSpec                  `json:"service"`
 	HorizontalPodAutoscaler v2beta1.HorizontalPodAutoscaler `json:"horizontalPodAutoscaler" protobuf:"bytes,3,opt,name=horizontalPodAutoscaler"`
+	Traffic                 []FunctionTrafficTarget         `json:"traffic,omitempty"`     // Split of the requests between revisions of the function
+	IdleTimeout             string                          `json:"idleTimeout,omitempty"` // Time without requests after which the function is scaled to zero (e.g. 10m)
+}
+
+// FunctionTrafficTarget routes a percentage of the requests of a function to one of its revisions
+type FunctionTrafficTarget struct {
+	Revision       int64 `json:"revision,omitempty"`       // Revision that receives the requests
+	LatestRevision bool  `json:"latestRevision,omitempty"` // Send the requests to the latest revision instead of a fixed one
+	Percent        int32 `json:"percent"`                  // Percentage of the requests sent to the revision
+}
+
+// FunctionPhase is a label for the overall state of a function
+type FunctionPhase string
+
+const (
+	// FunctionPhasePending means that the function has been accepted but not processed yet
+	FunctionPhasePending FunctionPhase = "Pending"
+	// FunctionPhaseBuilding means that the image of the function is being built
+	FunctionPhaseBuilding FunctionPhase = "Building"
+	// FunctionPhaseDeploying means that the function resources exist but it is not available yet
+	FunctionPhaseDeploying FunctionPhase = "Deploying"
+	// FunctionPhaseReady means that the function is available
+	FunctionPhaseReady FunctionPhase = "Ready"
+	// FunctionPhaseFailed means that the last attempt to deploy the function failed
+	FunctionPhaseFailed FunctionPhase = "Failed"
+)
+
+// FunctionConditionType is a valid value for FunctionCondition.Type
+type FunctionConditionType string
+
+const (
+	// FunctionSignatureVerified means that the function is signed by a key trusted in its namespace
+	FunctionSignatureVerified FunctionConditionType = "SignatureVerified"
+	// FunctionConfigReady means that the ConfigMap and the Service of the function are up to date
+	FunctionConfigReady FunctionConditionType = "ConfigReady"
+	// FunctionImageBuilt means that the image of the function is available in the registry
+	FunctionImageBuilt FunctionConditionType = "ImageBuilt"
+	// FunctionDeploymentAvailable means that the Deployment of the function has available replicas
+	FunctionDeploymentAvailable FunctionConditionType = "DeploymentAvailable"
+	// FunctionAutoscalerReady means that the HorizontalPodAutoscaler of the function is up to date
+	FunctionAutoscalerReady FunctionConditionType = "AutoscalerReady"
+)
+
+// FunctionConditionTypes lists the function conditions in the order in which they are reconciled
+var FunctionConditionTypes = []FunctionConditionType{
+	FunctionSignatureVerified,
+	FunctionConfigReady,
+	FunctionImageBuilt,
+	FunctionDeploymentAvailable,
+	FunctionAutoscalerReady,
+}
+
+// FunctionCondition describes the state of a function step at a certain point
+type FunctionCondition struct {
+	Type               FunctionConditionType `json:"type"`
+	Status             v1.ConditionStatus    `json:"status"`
+	LastTransitionTime metav1.Time           `json:"lastTransitionTime,omitempty"`
+	Reason             string                `json:"reason,omitempty"`
+	Message            string                `json:"message,omitempty"`
+}
+
+// FunctionDrift describes a resource of the function changed outside of the controller and restored
+type FunctionDrift struct {
+	Kind    string      `json:"kind"`           // Kind of the resource (e.g. Deployment)
+	Name    string      `json:"name"`           // Name of the resource
+	Deleted bool        `json:"deleted"`        // The resource was deleted instead of modified
+	Time    metav1.Time `json:"time,omitempty"` // Time in which the resource was restored
+}
+
+// FunctionStatus contains the observed state of a function
+type FunctionStatus struct {
+	ObservedGeneration int64                   `json:"observedGeneration,omitempty"` // Generation of the spec processed by the controller
+	Phase              FunctionPhase           `json:"phase,omitempty"`              // Summary of the function conditions
+	Conditions         []FunctionCondition     `json:"conditions,omitempty"`         // Result of each of the reconciliation steps
+	Revision           int64                   `json:"revision,omitempty"`           // Revision that matches the current spec
+	Traffic            []FunctionTrafficTarget `json:"traffic,omitempty"`            // Traffic split applied, with the revisions resolved
+	LastDrift          *FunctionDrift          `json:"lastDrift,omitempty"`          // Last resource restored after an out-of-band change
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FunctionBuild is the build of the image of a function for a given version of its code
+type FunctionBuild struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              FunctionBuildSpec   `json:"spec"`
+	Status            FunctionBuildStatus `json:"status,omitempty"`
+}
+
+// FunctionBuildSpec contains the function to build and the image to generate
+type FunctionBuildSpec struct {
+	Function string `json:"function"` // Name of the function to build
+	Checksum string `json:"checksum"` // Checksum of the code and dependencies of the function
+	Runtime  string `json:"runtime"`  // Runtime of the function
+	Image    string `json:"image"`    // Target image, including the registry and the tag
+}
+
+// FunctionBuildPhase is a label for the state of a build
+type FunctionBuildPhase string
+
+const (
+	// FunctionBuildPending means that the build has been accepted but its job has not started yet
+	FunctionBuildPending FunctionBuildPhase = "Pending"
+	// FunctionBuildRunning means that the build job is running
+	FunctionBuildRunning FunctionBuildPhase = "Running"
+	// FunctionBuildSucceeded means that the image has been pushed to the registry
+	FunctionBuildSucceeded FunctionBuildPhase = "Succeeded"
+	// FunctionBuildFailed means that the build job has failed
+	FunctionBuildFailed FunctionBuildPhase = "Failed"
+)
+
+// FunctionBuildStatus contains the result of the build
+type FunctionBuildStatus struct {
+	Phase          FunctionBuildPhase `json:"phase,omitempty"`          // Current state of the build
+	Job            string             `json:"job,omitempty"`            // Name of the job that builds the image
+	StartTime      *metav1.Time       `json:"startTime,omitempty"`      // Time when the build job started
+	CompletionTime *metav1.Time       `json:"completionTime,omitempty"` // Time when the build finished or failed
+	Digest         string             `json:"digest,omitempty"`         // Digest of the manifest of the image pushed
+	Message        string             `json:"message,omitempty"`        // Details about the result of the build
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FunctionBuildList contains map of function builds
+type FunctionBuildList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	// Items is a list of third party objects
+	Items []*FunctionBuild `json:"items"`
+}
@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubeless/kubeless/pkg/artifacts"
+)
+
+// server stores the function bundles uploaded by the CLI in a directory, usually a persistent volume,
+// and serves them to the provision containers. The bundles are stored under their checksum so they
+// are never replaced: an upload with a different content than the one of its key is rejected
+type server struct {
+	dir     string
+	maxSize int64
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		w.Write([]byte("OK"))
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	checksum, err := artifacts.ValidKey(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file := filepath.Join(s.dir, filepath.FromSlash(key))
+	switch r.Method {
+	case "GET", "HEAD":
+		if _, err := os.Stat(file); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, file)
+	case "PUT":
+		status, err := s.store(file, checksum, r.Body)
+		if err != nil {
+			log.Printf("Unable to store %s: %v", key, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("Stored %s", key)
+		w.WriteHeader(status)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// store writes the content to the file if it matches the checksum and returns the status of the response
+func (s *server) store(file, checksum string, content io.Reader) (int, error) {
+	if _, err := os.Stat(file); err == nil {
+		// Same key, same content
+		return http.StatusOK, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".upload-")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(content, s.maxSize+1))
+	tmp.Close()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if n > s.maxSize {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	}
+	if hex.EncodeToString(h.Sum(nil)) != checksum {
+		return http.StatusBadRequest, errChecksum
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+type serverError string
+
+func (e serverError) Error() string {
+	return string(e)
+}
+
+const (
+	errTooLarge = serverError("The bundle exceeds the maximum size")
+	errChecksum = serverError("The content doesn't match the checksum of the key")
+)
+
+func main() {
+	dir := flag.String("dir", "/artifacts", "Directory where the function bundles are stored")
+	listen := flag.String("listen", ":8080", "Address to listen on")
+	maxSize := flag.Int64("max-size", 1<<30, "Maximum size in bytes of a function bundle")
+	flag.Parse()
+
+	s := &server{dir: *dir, maxSize: *maxSize}
+	log.Printf("Serving the function bundles of %s on %s", *dir, *listen)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
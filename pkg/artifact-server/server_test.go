@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func request(t *testing.T, method, url string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, content
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(&server{dir: dir, maxSize: 16})
+	defer srv.Close()
+
+	content := []byte("function")
+	key := fmt.Sprintf("default/foo/%x.zip", sha256.Sum256(content))
+
+	if status, _ := request(t, "GET", srv.URL+"/"+key, nil); status != http.StatusNotFound {
+		t.Errorf("Expecting %d before the upload, received %d", http.StatusNotFound, status)
+	}
+	if status, body := request(t, "PUT", srv.URL+"/"+key, content); status != http.StatusCreated {
+		t.Fatalf("Expecting %d, received %d: %s", http.StatusCreated, status, body)
+	}
+	if status, body := request(t, "GET", srv.URL+"/"+key, nil); status != http.StatusOK || !bytes.Equal(body, content) {
+		t.Errorf("Unexpected response %d: %s", status, body)
+	}
+	// Uploading the same bundle again succeeds
+	if status, _ := request(t, "PUT", srv.URL+"/"+key, content); status != http.StatusOK {
+		t.Errorf("Expecting %d, received %d", http.StatusOK, status)
+	}
+
+	tests := []struct {
+		method string
+		key    string
+		body   []byte
+		status int
+	}{
+		// The content should match the checksum of the key
+		{"PUT", fmt.Sprintf("default/bar/%x", sha256.Sum256([]byte("other"))), content, http.StatusBadRequest},
+		{"PUT", fmt.Sprintf("default/bar/%x", sha256.Sum256([]byte("a function larger than the maximum"))), []byte("a function larger than the maximum"), http.StatusRequestEntityTooLarge},
+		{"PUT", "../../etc/passwd", content, http.StatusBadRequest},
+		{"GET", "default/foo/bar", nil, http.StatusBadRequest},
+		{"DELETE", key, nil, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		if status, body := request(t, test.method, srv.URL+"/"+test.key, test.body); status != test.status {
+			t.Errorf("%s %s: expecting %d, received %d: %s", test.method, test.key, test.status, status, body)
+		}
+	}
+	// Rejected uploads don't leave files
+	files, _ := ioutil.ReadDir(dir + "/default/bar")
+	if len(files) != 0 {
+		t.Errorf("Unexpected files %v", files)
+	}
+	if status, body := request(t, "GET", srv.URL+"/"+key, nil); status != http.StatusOK || !bytes.Equal(body, content) {
+		t.Errorf("Unexpected response %d: %s", status, body)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifacts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+const (
+	// HTTPStore is the artifact-store of the kubeless configuration that keeps the bundles in the artifact server
+	HTTPStore = "http"
+	// S3Store is the artifact-store of the kubeless configuration that keeps the bundles in S3-compatible storage
+	S3Store = "s3"
+	// defaultThreshold is the size above which the bundles are stored if artifact-store-threshold is not set.
+	// It leaves room for the base64 encoding below the limit of 1MiB of the ConfigMaps
+	defaultThreshold = "512Ki"
+	// defaultArtifactService is the service of the artifact server if artifact-service is not set
+	defaultArtifactService = "artifact-server"
+)
+
+// keyRegexp matches the keys of the bundles: <namespace>/<function>/<sha256 of the content>[<extension>]
+var keyRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?/[a-z0-9]([-.a-z0-9]*[a-z0-9])?/([a-f0-9]{64})(\.[a-z0-9]+)*$`)
+
+// Store keeps the function bundles that are too large to be stored in the Function objects
+type Store interface {
+	// Put stores the content under the given key and returns the URL from which the provision container downloads it
+	Put(key string, content []byte) (string, error)
+	// Secret returns the name of the secret with the credentials to download the bundles, empty if they are public
+	Secret() string
+}
+
+// Key returns the key of the bundle of a function. The key contains the checksum of the content so
+// a bundle is never replaced and the extension of the file to make it easier to identify
+func Key(namespace, function, filename string, content []byte) string {
+	ext := ""
+	for _, e := range []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tgz", ".zip", ".tar"} {
+		if strings.HasSuffix(filename, e) {
+			ext = e
+			break
+		}
+	}
+	if ext == "" {
+		ext = path.Ext(filename)
+	}
+	return fmt.Sprintf("%s/%s/%x%s", namespace, function, sha256.Sum256(content), strings.ToLower(ext))
+}
+
+// ValidKey returns the checksum of the content of a key or an error if the key is not valid
+func ValidKey(key string) (string, error) {
+	match := keyRegexp.FindStringSubmatch(key)
+	if match == nil {
+		return "", fmt.Errorf("Invalid key %q: expecting <namespace>/<function>/<sha256>[.<extension>]", key)
+	}
+	return match[3], nil
+}
+
+// httpStore keeps the bundles in the artifact server
+type httpStore struct {
+	uploadURL   string // URL of the server reachable by the client
+	downloadURL string // URL of the server reachable by the pods of the cluster
+	client      *http.Client
+}
+
+// NewHTTPStore returns a store that uploads the bundles to the artifact server at uploadURL.
+// The provision containers download them from downloadURL
+func NewHTTPStore(uploadURL, downloadURL string, client *http.Client) Store {
+	return &httpStore{
+		uploadURL:   strings.TrimSuffix(uploadURL, "/"),
+		downloadURL: strings.TrimSuffix(downloadURL, "/"),
+		client:      client,
+	}
+}
+
+func (s *httpStore) Put(key string, content []byte) (string, error) {
+	req, err := http.NewRequest("PUT", s.uploadURL+"/"+key, bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	if err := put(s.client, req); err != nil {
+		return "", err
+	}
+	return s.downloadURL + "/" + key, nil
+}
+
+func (s *httpStore) Secret() string {
+	return ""
+}
+
+// s3Store keeps the bundles in a bucket of S3-compatible storage
+type s3Store struct {
+	bucketURL string
+	secret    string
+	creds     *utils.S3Credentials
+	client    *http.Client
+}
+
+// NewS3Store returns a store that uploads the bundles to the bucket at the given URL (e.g.
+// https://my-bucket.s3.eu-west-1.amazonaws.com or https://minio.example.com/my-bucket) signing the
+// requests with the credentials of the given secret, also used by the provision containers
+func NewS3Store(bucketURL string, secret *v1.Secret, client *http.Client) (Store, error) {
+	creds, err := utils.NewSourceCredentials(secret)
+	if err != nil {
+		return nil, err
+	}
+	if creds.S3 == nil {
+		return nil, fmt.Errorf("The secret %s doesn't have S3 credentials", secret.ObjectMeta.Name)
+	}
+	return &s3Store{
+		bucketURL: strings.TrimSuffix(bucketURL, "/"),
+		secret:    secret.ObjectMeta.Name,
+		creds:     creds.S3,
+		client:    client,
+	}, nil
+}
+
+func (s *s3Store) Put(key string, content []byte) (string, error) {
+	objectURL := s.bucketURL + "/" + key
+	body := bytes.NewReader(content)
+	req, err := http.NewRequest("PUT", objectURL, body)
+	if err != nil {
+		return "", err
+	}
+	signer := v4.NewSigner(credentials.NewStaticCredentials(s.creds.AccessKeyID, s.creds.SecretAccessKey, s.creds.SessionToken))
+	if _, err := signer.Sign(req, body, "s3", s.creds.Region, time.Now()); err != nil {
+		return "", err
+	}
+	if err := put(s.client, req); err != nil {
+		return "", err
+	}
+	return objectURL, nil
+}
+
+func (s *s3Store) Secret() string {
+	return s.secret
+}
+
+// put sends a request that uploads a bundle
+func put(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to upload the function bundle: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unable to upload the function bundle to %s: %s %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Threshold returns the size in bytes above which the function bundles are kept in the artifact store
+func Threshold(config *v1.ConfigMap) (int64, error) {
+	value := config.Data["artifact-store-threshold"]
+	if value == "" {
+		value = defaultThreshold
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse artifact-store-threshold %q: %v", value, err)
+	}
+	return q.Value(), nil
+}
+
+// NewStore returns the artifact store of the kubeless configuration, nil if there is none. The bundles of the
+// functions of the given namespace are uploaded to the artifact server through the proxy of the API server.
+// The secret with the S3 credentials should exist in the namespace of the functions
+func NewStore(client kubernetes.Interface, restConfig *rest.Config, config *v1.ConfigMap, namespace string) (Store, error) {
+	switch config.Data["artifact-store"] {
+	case "":
+		return nil, nil
+	case HTTPStore:
+		name := config.Data["artifact-service"]
+		if name == "" {
+			name = defaultArtifactService
+		}
+		svc, err := client.CoreV1().Services(config.ObjectMeta.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find the artifact server: %v", err)
+		}
+		if len(svc.Spec.Ports) == 0 {
+			return nil, fmt.Errorf("The service %s of the artifact server doesn't have ports", name)
+		}
+		port := svc.Spec.Ports[0].Port
+		transport, err := rest.TransportFor(restConfig)
+		if err != nil {
+			return nil, err
+		}
+		uploadURL := fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s:%d/proxy", strings.TrimSuffix(restConfig.Host, "/"), svc.ObjectMeta.Namespace, name, port)
+		downloadURL := fmt.Sprintf("http://%s.%s.svc:%d", name, svc.ObjectMeta.Namespace, port)
+		return NewHTTPStore(uploadURL, downloadURL, &http.Client{Transport: transport}), nil
+	case S3Store:
+		bucketURL := config.Data["artifact-store-url"]
+		if bucketURL == "" {
+			return nil, fmt.Errorf("The artifact store %s requires artifact-store-url", S3Store)
+		}
+		secretName := config.Data["artifact-store-secret"]
+		if secretName == "" {
+			return nil, fmt.Errorf("The artifact store %s requires artifact-store-secret", S3Store)
+		}
+		secret, err := client.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the credentials of the artifact store: %v", err)
+		}
+		return NewS3Store(bucketURL, secret, http.DefaultClient)
+	default:
+		return nil, fmt.Errorf("Unknown artifact store %q, expecting %s or %s", config.Data["artifact-store"], HTTPStore, S3Store)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package artifacts
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// bucket stores the objects uploaded with PUT
+type bucket struct {
+	sync.Mutex
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func newBucket() (*bucket, *httptest.Server) {
+	b := &bucket{objects: map[string][]byte{}}
+	return b, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.Lock()
+		defer b.Unlock()
+		b.requests = append(b.requests, r)
+		if r.Method != "PUT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		b.objects[r.URL.Path] = content
+		w.WriteHeader(http.StatusCreated)
+	}))
+}
+
+func TestKey(t *testing.T) {
+	content := []byte("content")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+	tests := []struct {
+		filename string
+		key      string
+	}{
+		{"func.zip", "default/foo/" + checksum + ".zip"},
+		{"/tmp/func.tar.gz", "default/foo/" + checksum + ".tar.gz"},
+		{"func.PY", "default/foo/" + checksum + ".py"},
+		{"func", "default/foo/" + checksum},
+	}
+	for _, test := range tests {
+		key := Key("default", "foo", test.filename, content)
+		if key != test.key {
+			t.Errorf("Expecting %s, received %s", test.key, key)
+		}
+		c, err := ValidKey(key)
+		if err != nil || c != checksum {
+			t.Errorf("Expecting the key %s to be valid, received %s %v", key, c, err)
+		}
+	}
+	for _, invalid := range []string{"", "foo/" + checksum, "default/foo/abc.zip", "../foo/" + checksum, "default/../" + checksum, "default/foo/" + checksum + "/bar"} {
+		if _, err := ValidKey(invalid); err == nil {
+			t.Errorf("Expecting an error for the key %q", invalid)
+		}
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	b, srv := newBucket()
+	defer srv.Close()
+
+	store := NewHTTPStore(srv.URL+"/proxy/", "http://artifact-server.kubeless.svc:8080", http.DefaultClient)
+	url, err := store.Put("default/foo/abc.zip", []byte("content"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if url != "http://artifact-server.kubeless.svc:8080/default/foo/abc.zip" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+	if string(b.objects["/proxy/default/foo/abc.zip"]) != "content" {
+		t.Errorf("Unexpected objects %v", b.objects)
+	}
+	if store.Secret() != "" {
+		t.Errorf("Unexpected secret %s", store.Secret())
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "The content doesn't match the checksum of the key", http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+	store = NewHTTPStore(rejecting.URL, "http://artifact-server.kubeless.svc:8080", http.DefaultClient)
+	if _, err := store.Put("default/foo/abc.zip", []byte("content")); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expecting the error of the server, received %v", err)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	b, srv := newBucket()
+	defer srv.Close()
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-creds"},
+		Data: map[string][]byte{
+			"aws-access-key-id":     []byte("AKID"),
+			"aws-secret-access-key": []byte("secret"),
+			"aws-region":            []byte("eu-west-1"),
+		},
+	}
+	store, err := NewS3Store(srv.URL+"/functions", secret, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	url, err := store.Put("default/foo/abc.zip", []byte("content"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if url != srv.URL+"/functions/default/foo/abc.zip" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+	if string(b.objects["/functions/default/foo/abc.zip"]) != "content" {
+		t.Errorf("Unexpected objects %v", b.objects)
+	}
+	req := b.requests[0]
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(req.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request") {
+		t.Errorf("Unexpected authorization %s", req.Header.Get("Authorization"))
+	}
+	// The payload is signed
+	if req.Header.Get("X-Amz-Content-Sha256") != fmt.Sprintf("%x", sha256.Sum256([]byte("content"))) {
+		t.Errorf("Unexpected payload hash %s", req.Header.Get("X-Amz-Content-Sha256"))
+	}
+	if store.Secret() != "s3-creds" {
+		t.Errorf("Unexpected secret %s", store.Secret())
+	}
+
+	if _, err := NewS3Store(srv.URL, &v1.Secret{Data: map[string][]byte{"username": []byte("foo")}}, http.DefaultClient); err == nil {
+		t.Error("Expecting an error for a secret without S3 credentials")
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "artifact-server", Namespace: "kubeless"},
+			Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "http", Port: 8080}}},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "s3-creds", Namespace: "default"},
+			Data: map[string][]byte{
+				"aws-access-key-id":     []byte("AKID"),
+				"aws-secret-access-key": []byte("secret"),
+			},
+		},
+	)
+	b, srv := newBucket()
+	defer srv.Close()
+	config := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeless-config", Namespace: "kubeless"},
+		Data:       map[string]string{},
+	}
+
+	store, err := NewStore(client, &rest.Config{Host: srv.URL}, config, "default")
+	if err != nil || store != nil {
+		t.Errorf("Expecting no store, received %v %v", store, err)
+	}
+
+	config.Data["artifact-store"] = "http"
+	store, err = NewStore(client, &rest.Config{Host: srv.URL}, config, "default")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	url, err := store.Put("default/foo/abc.zip", []byte("content"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if url != "http://artifact-server.kubeless.svc:8080/default/foo/abc.zip" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+	// The bundle is uploaded through the proxy of the API server
+	if _, ok := b.objects["/api/v1/namespaces/kubeless/services/artifact-server:8080/proxy/default/foo/abc.zip"]; !ok {
+		t.Errorf("Unexpected objects %v", b.objects)
+	}
+
+	config.Data["artifact-store"] = "s3"
+	if _, err := NewStore(client, &rest.Config{Host: srv.URL}, config, "default"); err == nil {
+		t.Error("Expecting an error without artifact-store-url")
+	}
+	config.Data["artifact-store-url"] = srv.URL + "/functions"
+	config.Data["artifact-store-secret"] = "s3-creds"
+	store, err = NewStore(client, &rest.Config{Host: srv.URL}, config, "default")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store.Secret() != "s3-creds" {
+		t.Errorf("Unexpected secret %s", store.Secret())
+	}
+	if _, err := NewStore(client, &rest.Config{Host: srv.URL}, config, "other"); err == nil {
+		t.Error("Expecting an error without the secret in the namespace of the function")
+	}
+
+	config.Data["artifact-store"] = "ftp"
+	if _, err := NewStore(client, &rest.Config{Host: srv.URL}, config, "default"); err == nil {
+		t.Error("Expecting an error for an unknown store")
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	config := &v1.ConfigMap{Data: map[string]string{}}
+	threshold, err := Threshold(config)
+	if err != nil || threshold != 512*1024 {
+		t.Errorf("Expecting the default threshold, received %d %v", threshold, err)
+	}
+	config.Data["artifact-store-threshold"] = "100k"
+	threshold, err = Threshold(config)
+	if err != nil || threshold != 100000 {
+		t.Errorf("Expecting 100000, received %d %v", threshold, err)
+	}
+	config.Data["artifact-store-threshold"] = "much"
+	if _, err := Threshold(config); err == nil {
+		t.Error("Expecting an error for an invalid threshold")
+	}
+}
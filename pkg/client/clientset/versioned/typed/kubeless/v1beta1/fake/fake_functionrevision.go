@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	v1beta1 "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeFunctionRevisions implements FunctionRevisionInterface
+type FakeFunctionRevisions struct {
+	Fake *FakeKubelessV1beta1
+	ns   string
+}
+
+var functionrevisionsResource = schema.GroupVersionResource{Group: "kubeless.io", Version: "v1beta1", Resource: "functionrevisions"}
+
+var functionrevisionsKind = schema.GroupVersionKind{Group: "kubeless.io", Version: "v1beta1", Kind: "FunctionRevision"}
+
+// Get takes name of the functionRevision, and returns the corresponding functionRevision object, and an error if there is any.
+func (c *FakeFunctionRevisions) Get(name string, options v1.GetOptions) (result *v1beta1.FunctionRevision, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(functionrevisionsResource, c.ns, name), &v1beta1.FunctionRevision{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.FunctionRevision), err
+}
+
+// List takes label and field selectors, and returns the list of FunctionRevisions that match those selectors.
+func (c *FakeFunctionRevisions) List(opts v1.ListOptions) (result *v1beta1.FunctionRevisionList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(functionrevisionsResource, functionrevisionsKind, c.ns, opts), &v1beta1.FunctionRevisionList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1beta1.FunctionRevisionList{}
+	for _, item := range obj.(*v1beta1.FunctionRevisionList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested functionRevisions.
+func (c *FakeFunctionRevisions) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(functionrevisionsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a functionRevision and creates it.  Returns the server's representation of the functionRevision, and an error, if there is any.
+func (c *FakeFunctionRevisions) Create(functionRevision *v1beta1.FunctionRevision) (result *v1beta1.FunctionRevision, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(functionrevisionsResource, c.ns, functionRevision), &v1beta1.FunctionRevision{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.FunctionRevision), err
+}
+
+// Update takes the representation of a functionRevision and updates it. Returns the server's representation of the functionRevision, and an error, if there is any.
+func (c *FakeFunctionRevisions) Update(functionRevision *v1beta1.FunctionRevision) (result *v1beta1.FunctionRevision, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(functionrevisionsResource, c.ns, functionRevision), &v1beta1.FunctionRevision{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.FunctionRevision), err
+}
+
+// Delete takes name of the functionRevision and deletes it. Returns an error if one occurs.
+func (c *FakeFunctionRevisions) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(functionrevisionsResource, c.ns, name), &v1beta1.FunctionRevision{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeFunctionRevisions) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(functionrevisionsResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1beta1.FunctionRevisionList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched functionRevision.
+func (c *FakeFunctionRevisions) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.FunctionRevision, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(functionrevisionsResource, c.ns, name, data, subresources...), &v1beta1.FunctionRevision{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.FunctionRevision), err
+}
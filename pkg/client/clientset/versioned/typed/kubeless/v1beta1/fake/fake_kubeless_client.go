@@ -29,6 +29,14 @@ func (c *FakeKubelessV1beta1) Functions(namespace string) v1beta1.FunctionInterf
 	return &FakeFunctions{c, namespace}
 }
 
+func (c *FakeKubelessV1beta1) FunctionBuilds(namespace string) v1beta1.FunctionBuildInterface {
+	return &FakeFunctionBuilds{c, namespace}
+}
+
+func (c *FakeKubelessV1beta1) FunctionRevisions(namespace string) v1beta1.FunctionRevisionInterface {
+	return &FakeFunctionRevisions{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKubelessV1beta1) RESTClient() rest.Interface {
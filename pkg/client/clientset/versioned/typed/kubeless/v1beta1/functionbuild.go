@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	v1beta1 "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	scheme "github.com/kubeless/kubeless/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// FunctionBuildsGetter has a method to return a FunctionBuildInterface.
+// A group's client should implement this interface.
+type FunctionBuildsGetter interface {
+	FunctionBuilds(namespace string) FunctionBuildInterface
+}
+
+// FunctionBuildInterface has methods to work with FunctionBuild resources.
+type FunctionBuildInterface interface {
+	Create(*v1beta1.FunctionBuild) (*v1beta1.FunctionBuild, error)
+	Update(*v1beta1.FunctionBuild) (*v1beta1.FunctionBuild, error)
+	UpdateStatus(*v1beta1.FunctionBuild) (*v1beta1.FunctionBuild, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1beta1.FunctionBuild, error)
+	List(opts v1.ListOptions) (*v1beta1.FunctionBuildList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.FunctionBuild, err error)
+	FunctionBuildExpansion
+}
+
+// functionBuilds implements FunctionBuildInterface
+type functionBuilds struct {
+	client rest.Interface
+	ns     string
+}
+
+// newFunctionBuilds returns a FunctionBuilds
+func newFunctionBuilds(c *KubelessV1beta1Client, namespace string) *functionBuilds {
+	return &functionBuilds{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the functionBuild, and returns the corresponding functionBuild object, and an error if there is any.
+func (c *functionBuilds) Get(name string, options v1.GetOptions) (result *v1beta1.FunctionBuild, err error) {
+	result = &v1beta1.FunctionBuild{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of FunctionBuilds that match those selectors.
+func (c *functionBuilds) List(opts v1.ListOptions) (result *v1beta1.FunctionBuildList, err error) {
+	result = &v1beta1.FunctionBuildList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested functionBuilds.
+func (c *functionBuilds) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a functionBuild and creates it.  Returns the server's representation of the functionBuild, and an error, if there is any.
+func (c *functionBuilds) Create(functionBuild *v1beta1.FunctionBuild) (result *v1beta1.FunctionBuild, err error) {
+	result = &v1beta1.FunctionBuild{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		Body(functionBuild).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a functionBuild and updates it. Returns the server's representation of the functionBuild, and an error, if there is any.
+func (c *functionBuilds) Update(functionBuild *v1beta1.FunctionBuild) (result *v1beta1.FunctionBuild, err error) {
+	result = &v1beta1.FunctionBuild{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		Name(functionBuild.Name).
+		Body(functionBuild).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *functionBuilds) UpdateStatus(functionBuild *v1beta1.FunctionBuild) (result *v1beta1.FunctionBuild, err error) {
+	result = &v1beta1.FunctionBuild{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		Name(functionBuild.Name).
+		SubResource("status").
+		Body(functionBuild).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the functionBuild and deletes it. Returns an error if one occurs.
+func (c *functionBuilds) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *functionBuilds) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched functionBuild.
+func (c *functionBuilds) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.FunctionBuild, err error) {
+	result = &v1beta1.FunctionBuild{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("functionbuilds").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	v1beta1 "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	scheme "github.com/kubeless/kubeless/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// FunctionRevisionsGetter has a method to return a FunctionRevisionInterface.
+// A group's client should implement this interface.
+type FunctionRevisionsGetter interface {
+	FunctionRevisions(namespace string) FunctionRevisionInterface
+}
+
+// FunctionRevisionInterface has methods to work with FunctionRevision resources.
+type FunctionRevisionInterface interface {
+	Create(*v1beta1.FunctionRevision) (*v1beta1.FunctionRevision, error)
+	Update(*v1beta1.FunctionRevision) (*v1beta1.FunctionRevision, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1beta1.FunctionRevision, error)
+	List(opts v1.ListOptions) (*v1beta1.FunctionRevisionList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.FunctionRevision, err error)
+	FunctionRevisionExpansion
+}
+
+// functionRevisions implements FunctionRevisionInterface
+type functionRevisions struct {
+	client rest.Interface
+	ns     string
+}
+
+// newFunctionRevisions returns a FunctionRevisions
+func newFunctionRevisions(c *KubelessV1beta1Client, namespace string) *functionRevisions {
+	return &functionRevisions{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the functionRevision, and returns the corresponding functionRevision object, and an error if there is any.
+func (c *functionRevisions) Get(name string, options v1.GetOptions) (result *v1beta1.FunctionRevision, err error) {
+	result = &v1beta1.FunctionRevision{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of FunctionRevisions that match those selectors.
+func (c *functionRevisions) List(opts v1.ListOptions) (result *v1beta1.FunctionRevisionList, err error) {
+	result = &v1beta1.FunctionRevisionList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested functionRevisions.
+func (c *functionRevisions) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a functionRevision and creates it.  Returns the server's representation of the functionRevision, and an error, if there is any.
+func (c *functionRevisions) Create(functionRevision *v1beta1.FunctionRevision) (result *v1beta1.FunctionRevision, err error) {
+	result = &v1beta1.FunctionRevision{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		Body(functionRevision).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a functionRevision and updates it. Returns the server's representation of the functionRevision, and an error, if there is any.
+func (c *functionRevisions) Update(functionRevision *v1beta1.FunctionRevision) (result *v1beta1.FunctionRevision, err error) {
+	result = &v1beta1.FunctionRevision{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		Name(functionRevision.Name).
+		Body(functionRevision).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the functionRevision and deletes it. Returns an error if one occurs.
+func (c *functionRevisions) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *functionRevisions) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched functionRevision.
+func (c *functionRevisions) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.FunctionRevision, err error) {
+	result = &v1beta1.FunctionRevision{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("functionrevisions").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
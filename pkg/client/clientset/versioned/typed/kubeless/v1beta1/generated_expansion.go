@@ -16,3 +16,7 @@ limitations under the License.
 package v1beta1
 
 type FunctionExpansion interface{}
+
+type FunctionBuildExpansion interface{}
+
+type FunctionRevisionExpansion interface{}
@@ -25,6 +25,8 @@ import (
 type KubelessV1beta1Interface interface {
 	RESTClient() rest.Interface
 	FunctionsGetter
+	FunctionBuildsGetter
+	FunctionRevisionsGetter
 }
 
 // KubelessV1beta1Client is used to interact with features provided by the kubeless.io group.
@@ -36,6 +38,14 @@ func (c *KubelessV1beta1Client) Functions(namespace string) FunctionInterface {
 	return newFunctions(c, namespace)
 }
 
+func (c *KubelessV1beta1Client) FunctionBuilds(namespace string) FunctionBuildInterface {
+	return newFunctionBuilds(c, namespace)
+}
+
+func (c *KubelessV1beta1Client) FunctionRevisions(namespace string) FunctionRevisionInterface {
+	return newFunctionRevisions(c, namespace)
+}
+
 // NewForConfig creates a new KubelessV1beta1Client for the given config.
 func NewForConfig(c *rest.Config) (*KubelessV1beta1Client, error) {
 	config := *c
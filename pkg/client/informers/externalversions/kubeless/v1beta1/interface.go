@@ -26,6 +26,10 @@ import (
 type Interface interface {
 	// Functions returns a FunctionInformer.
 	Functions() FunctionInformer
+	// FunctionBuilds returns a FunctionBuildInformer.
+	FunctionBuilds() FunctionBuildInformer
+	// FunctionRevisions returns a FunctionRevisionInformer.
+	FunctionRevisions() FunctionRevisionInformer
 }
 
 type version struct {
@@ -43,3 +47,13 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) Functions() FunctionInformer {
 	return &functionInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// FunctionBuilds returns a FunctionBuildInformer.
+func (v *version) FunctionBuilds() FunctionBuildInformer {
+	return &functionBuildInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// FunctionRevisions returns a FunctionRevisionInformer.
+func (v *version) FunctionRevisions() FunctionRevisionInformer {
+	return &functionRevisionInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
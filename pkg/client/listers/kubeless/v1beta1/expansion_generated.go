@@ -25,3 +25,19 @@ type FunctionListerExpansion interface{}
 // FunctionNamespaceListerExpansion allows custom methods to be added to
 // FunctionNamespaceLister.
 type FunctionNamespaceListerExpansion interface{}
+
+// FunctionBuildListerExpansion allows custom methods to be added to
+// FunctionBuildLister.
+type FunctionBuildListerExpansion interface{}
+
+// FunctionBuildNamespaceListerExpansion allows custom methods to be added to
+// FunctionBuildNamespaceLister.
+type FunctionBuildNamespaceListerExpansion interface{}
+
+// FunctionRevisionListerExpansion allows custom methods to be added to
+// FunctionRevisionLister.
+type FunctionRevisionListerExpansion interface{}
+
+// FunctionRevisionNamespaceListerExpansion allows custom methods to be added to
+// FunctionRevisionNamespaceLister.
+type FunctionRevisionNamespaceListerExpansion interface{}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file was automatically generated by lister-gen
+
+package v1beta1
+
+import (
+	v1beta1 "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// FunctionRevisionLister helps list FunctionRevisions.
+type FunctionRevisionLister interface {
+	// List lists all FunctionRevisions in the indexer.
+	List(selector labels.Selector) (ret []*v1beta1.FunctionRevision, err error)
+	// FunctionRevisions returns an object that can list and get FunctionRevisions.
+	FunctionRevisions(namespace string) FunctionRevisionNamespaceLister
+	FunctionRevisionListerExpansion
+}
+
+// functionRevisionLister implements the FunctionRevisionLister interface.
+type functionRevisionLister struct {
+	indexer cache.Indexer
+}
+
+// NewFunctionRevisionLister returns a new FunctionRevisionLister.
+func NewFunctionRevisionLister(indexer cache.Indexer) FunctionRevisionLister {
+	return &functionRevisionLister{indexer: indexer}
+}
+
+// List lists all FunctionRevisions in the indexer.
+func (s *functionRevisionLister) List(selector labels.Selector) (ret []*v1beta1.FunctionRevision, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta1.FunctionRevision))
+	})
+	return ret, err
+}
+
+// FunctionRevisions returns an object that can list and get FunctionRevisions.
+func (s *functionRevisionLister) FunctionRevisions(namespace string) FunctionRevisionNamespaceLister {
+	return functionRevisionNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// FunctionRevisionNamespaceLister helps list and get FunctionRevisions.
+type FunctionRevisionNamespaceLister interface {
+	// List lists all FunctionRevisions in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1beta1.FunctionRevision, err error)
+	// Get retrieves the FunctionRevision from the indexer for a given namespace and name.
+	Get(name string) (*v1beta1.FunctionRevision, error)
+	FunctionRevisionNamespaceListerExpansion
+}
+
+// functionRevisionNamespaceLister implements the FunctionRevisionNamespaceLister
+// interface.
+type functionRevisionNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all FunctionRevisions in the indexer for a given namespace.
+func (s functionRevisionNamespaceLister) List(selector labels.Selector) (ret []*v1beta1.FunctionRevision, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta1.FunctionRevision))
+	})
+	return ret, err
+}
+
+// Get retrieves the FunctionRevision from the indexer for a given namespace and name.
+func (s functionRevisionNamespaceLister) Get(name string) (*v1beta1.FunctionRevision, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1beta1.Resource("functionrevision"), name)
+	}
+	return obj.(*v1beta1.FunctionRevision), nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+const (
+	// imbuilderBackend builds the images adding layers to the runtime image with the function image builder
+	imbuilderBackend = "imbuilder"
+	// kanikoBackend builds the images with a Dockerfile and kaniko
+	kanikoBackend = "kaniko"
+	// buildahBackend builds the images with a Dockerfile and buildah
+	buildahBackend = "buildah"
+	// defaultKanikoImage is the image of kaniko if kaniko-image is not set
+	defaultKanikoImage = "gcr.io/kaniko-project/executor:latest"
+	// defaultBuildahImage is the image of buildah if buildah-image is not set
+	defaultBuildahImage = "quay.io/buildah/stable:latest"
+)
+
+// Builder generates the workload that builds and pushes the image of a function
+type Builder interface {
+	// BuildJob returns the job that builds the target image of the function
+	BuildJob(funcObj *kubelessApi.Function, target *utils.BuildTarget, or []metav1.OwnerReference) (*batchv1.Job, error)
+}
+
+// buildSettings are the properties of the kubeless configuration shared by every backend
+type buildSettings struct {
+	lr                 *langruntime.Langruntimes
+	provisionImage     string
+	registryTLSEnabled bool
+	imagePullSecrets   []corev1.LocalObjectReference
+}
+
+// imbuilderBuilder builds the images with a job that runs the function image builder
+type imbuilderBuilder struct {
+	buildSettings
+	builderImage string
+}
+
+func (b *imbuilderBuilder) BuildJob(funcObj *kubelessApi.Function, target *utils.BuildTarget, or []metav1.OwnerReference) (*batchv1.Job, error) {
+	return utils.NewFuncImageJob(funcObj, b.lr, or, target, b.builderImage, b.provisionImage, b.registryTLSEnabled, b.imagePullSecrets)
+}
+
+// kanikoBuilder builds the images with a job that runs kaniko, which doesn't require a privileged container
+type kanikoBuilder struct {
+	buildSettings
+	image string
+}
+
+func (b *kanikoBuilder) BuildJob(funcObj *kubelessApi.Function, target *utils.BuildTarget, or []metav1.OwnerReference) (*batchv1.Job, error) {
+	args := []string{
+		"--dockerfile", utils.BuildDockerfile,
+		"--context", "dir://" + utils.BuildContextDir,
+		"--destination", target.Image(),
+		"--reproducible",
+	}
+	for _, label := range target.LabelList() {
+		args = append(args, "--label", label)
+	}
+	if !b.registryTLSEnabled {
+		args = append(args, "--insecure", "--insecure-pull", "--skip-tls-verify", "--skip-tls-verify-pull")
+	}
+	switch target.Platform {
+	case "":
+	case "all":
+		return nil, fmt.Errorf("The %s build backend cannot build images for every platform", kanikoBackend)
+	default:
+		args = append(args, "--custom-platform", target.Platform)
+	}
+	return utils.NewDockerfileBuildJob(funcObj, b.lr, or, target, b.provisionImage, b.imagePullSecrets, corev1.Container{
+		Image: b.image,
+		Args:  args,
+	})
+}
+
+// buildahBuilder builds the images with a job that runs buildah in a privileged container
+type buildahBuilder struct {
+	buildSettings
+	image string
+}
+
+func (b *buildahBuilder) BuildJob(funcObj *kubelessApi.Function, target *utils.BuildTarget, or []metav1.OwnerReference) (*batchv1.Job, error) {
+	tlsVerify := "--tls-verify=" + strconv.FormatBool(b.registryTLSEnabled)
+	authFile := utils.BuildDockerConfigDir + "/config.json"
+	bud := fmt.Sprintf("buildah bud %s --authfile %s --timestamp %d -f %s -t %s", tlsVerify, authFile, target.Timestamp.Unix(), utils.BuildDockerfile, target.Image())
+	switch target.Platform {
+	case "":
+	case "all":
+		return nil, fmt.Errorf("The %s build backend cannot build images for every platform", buildahBackend)
+	default:
+		bud += " --platform " + target.Platform
+	}
+	for _, label := range target.LabelList() {
+		bud += " --label " + label
+	}
+	push := fmt.Sprintf("buildah push %s --authfile %s %s", tlsVerify, authFile, target.Image())
+	privileged := true
+	return utils.NewDockerfileBuildJob(funcObj, b.lr, or, target, b.provisionImage, b.imagePullSecrets, corev1.Container{
+		Image:   b.image,
+		Command: []string{"sh", "-c"},
+		Args:    []string{fmt.Sprintf("%s %s && %s", bud, utils.BuildContextDir, push)},
+		Env: []corev1.EnvVar{
+			{Name: "STORAGE_DRIVER", Value: "vfs"},
+			{Name: "BUILDAH_ISOLATION", Value: "chroot"},
+		},
+		SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+	})
+}
+
+// validBuildBackend returns an error if the given backend doesn't exist
+func validBuildBackend(name string) error {
+	switch name {
+	case "", imbuilderBackend, kanikoBackend, buildahBackend:
+		return nil
+	default:
+		return fmt.Errorf("Unknown build backend %q, expecting %s, %s or %s", name, imbuilderBackend, kanikoBackend, buildahBackend)
+	}
+}
+
+// NewBuilder returns the build backend of the functions of the given runtime: the one of the runtime in
+// runtime-images or function-build-backend of the kubeless configuration otherwise
+func NewBuilder(config *corev1.ConfigMap, lr *langruntime.Langruntimes, imagePullSecrets []corev1.LocalObjectReference, runtime string) (Builder, error) {
+	name := config.Data["function-build-backend"]
+	if backend := lr.GetBuildBackend(runtime); backend != "" {
+		name = backend
+	}
+	settings := buildSettings{
+		lr:                 lr,
+		provisionImage:     config.Data["provision-image"],
+		registryTLSEnabled: config.Data["function-registry-tls-verify"] != "false",
+		imagePullSecrets:   imagePullSecrets,
+	}
+	switch name {
+	case "", imbuilderBackend:
+		return &imbuilderBuilder{buildSettings: settings, builderImage: config.Data["builder-image"]}, nil
+	case kanikoBackend:
+		image := config.Data["kaniko-image"]
+		if image == "" {
+			image = defaultKanikoImage
+		}
+		return &kanikoBuilder{buildSettings: settings, image: image}, nil
+	case buildahBackend:
+		image := config.Data["buildah-image"]
+		if image == "" {
+			image = defaultBuildahImage
+		}
+		return &buildahBuilder{buildSettings: settings, image: image}, nil
+	default:
+		return nil, validBuildBackend(name)
+	}
+}
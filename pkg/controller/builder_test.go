@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+func builderConfig(data map[string]string) (*corev1.ConfigMap, *langruntime.Langruntimes) {
+	config := &corev1.ConfigMap{Data: map[string]string{
+		"runtime-images": `[
+  {"ID": "python", "depName": "requirements.txt", "fileNameSuffix": ".py", "versions": [{"name": "python27", "version": "2.7", "runtimeImage": [{"phase": "runtime", "image": "python-runtime"}]}]},
+  {"ID": "java", "depName": "pom.xml", "fileNameSuffix": ".java", "buildBackend": "buildah", "versions": [{"name": "java8", "version": "1.8", "runtimeImage": [{"phase": "runtime", "image": "java-runtime"}]}]}
+]`,
+		"provision-image": "unzip",
+		"builder-image":   "kubeless/function-image-builder",
+	}}
+	for key, value := range data {
+		config.Data[key] = value
+	}
+	lr := langruntime.New(config)
+	lr.ReadConfigMap()
+	return config, lr
+}
+
+func buildTestFunction(runtime string) (*kubelessApi.Function, *utils.BuildTarget) {
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       kubelessApi.FunctionSpec{Function: "function", Handler: "foo.bar", Runtime: runtime},
+	}
+	return f, &utils.BuildTarget{
+		Secret:    "registry-creds",
+		Host:      "registry.example.com",
+		Name:      "user/foo",
+		Tag:       utils.FunctionBuildTag(f),
+		Platform:  "linux/arm64",
+		Timestamp: time.Unix(1000, 0),
+		Labels:    map[string]string{utils.ImageNamespaceLabel: "default", utils.ImageFunctionLabel: "foo"},
+	}
+}
+
+func TestNewBuilder(t *testing.T) {
+	config, lr := builderConfig(map[string]string{})
+	tests := []struct {
+		backend string
+		runtime string
+		image   string
+	}{
+		{"", "python2.7", "kubeless/function-image-builder"},
+		{"imbuilder", "python2.7", "kubeless/function-image-builder"},
+		{"kaniko", "python2.7", defaultKanikoImage},
+		{"buildah", "python2.7", defaultBuildahImage},
+		// The backend of the runtime overrides the default one
+		{"kaniko", "java1.8", defaultBuildahImage},
+	}
+	for _, test := range tests {
+		config.Data["function-build-backend"] = test.backend
+		builder, err := NewBuilder(config, lr, nil, test.runtime)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		f, target := buildTestFunction(test.runtime)
+		job, err := builder.BuildJob(f, target, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error for the backend %q: %v", test.backend, err)
+		}
+		build := job.Spec.Template.Spec.Containers[0]
+		if build.Image != test.image {
+			t.Errorf("Expecting the image %s for the backend %q and the runtime %s, received %s", test.image, test.backend, test.runtime, build.Image)
+		}
+		if job.ObjectMeta.Name != utils.FunctionBuildName("foo", target.Tag) {
+			t.Errorf("Unexpected job name %s", job.ObjectMeta.Name)
+		}
+	}
+
+	config.Data["function-build-backend"] = "docker"
+	if _, err := NewBuilder(config, lr, nil, "python2.7"); err == nil {
+		t.Error("Expecting an error for an unknown backend")
+	}
+	if _, _, err := parseConfig(config); err == nil {
+		t.Error("Expecting the configuration with an unknown backend to be rejected")
+	}
+}
+
+func TestKanikoBuilder(t *testing.T) {
+	config, lr := builderConfig(map[string]string{"function-build-backend": "kaniko", "kaniko-image": "kaniko", "function-registry-tls-verify": "false"})
+	builder, err := NewBuilder(config, lr, nil, "python2.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, target := buildTestFunction("python2.7")
+	job, err := builder.BuildJob(f, target, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	build := job.Spec.Template.Spec.Containers[0]
+	args := strings.Join(build.Args, " ")
+	for _, expected := range []string{
+		"--dockerfile " + utils.BuildDockerfile,
+		"--context dir:///kubeless",
+		"--destination " + target.Image(),
+		"--reproducible",
+		"--insecure",
+		"--custom-platform linux/arm64",
+		"--label io.kubeless.function.name=foo --label io.kubeless.function.namespace=default",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expecting %q in the arguments of kaniko: %s", expected, args)
+		}
+	}
+	if build.Image != "kaniko" || build.SecurityContext != nil {
+		t.Errorf("Unexpected build container %+v", build)
+	}
+
+	target.Platform = "all"
+	if _, err := builder.BuildJob(f, target, nil); err == nil {
+		t.Error("Expecting an error building every platform")
+	}
+}
+
+func TestBuildahBuilder(t *testing.T) {
+	config, lr := builderConfig(map[string]string{"function-build-backend": "buildah"})
+	builder, err := NewBuilder(config, lr, nil, "python2.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, target := buildTestFunction("python2.7")
+	job, err := builder.BuildJob(f, target, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	build := job.Spec.Template.Spec.Containers[0]
+	command := build.Args[0]
+	for _, expected := range []string{
+		"buildah bud --tls-verify=true --authfile /docker/config.json --timestamp 1000 -f " + utils.BuildDockerfile + " -t " + target.Image() + " --platform linux/arm64 --label io.kubeless.function.name=foo --label io.kubeless.function.namespace=default /kubeless",
+		"buildah push --tls-verify=true --authfile /docker/config.json " + target.Image(),
+	} {
+		if !strings.Contains(command, expected) {
+			t.Errorf("Expecting %q in the command of buildah: %s", expected, command)
+		}
+	}
+	if build.SecurityContext == nil || build.SecurityContext.Privileged == nil || !*build.SecurityContext.Privileged {
+		t.Errorf("Expecting a privileged container, received %+v", build.SecurityContext)
+	}
+}
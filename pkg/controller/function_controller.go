@@ -17,31 +17,45 @@ limitations under the License.
 package controller
 
 import (
-	"crypto/sha256"
 	"fmt"
-	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	monitoringv1alpha1 "github.com/coreos/prometheus-operator/pkg/client/monitoring/v1alpha1"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2beta1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	autoscalinginformers "k8s.io/client-go/informers/autoscaling/v2beta1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
 	"github.com/ghodss/yaml"
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
 	"github.com/kubeless/kubeless/pkg/client/clientset/versioned"
+	kubelessScheme "github.com/kubeless/kubeless/pkg/client/clientset/versioned/scheme"
 	kv1beta1 "github.com/kubeless/kubeless/pkg/client/informers/externalversions/kubeless/v1beta1"
 	"github.com/kubeless/kubeless/pkg/langruntime"
-	"github.com/kubeless/kubeless/pkg/registry"
 	"github.com/kubeless/kubeless/pkg/utils"
 )
 
@@ -50,8 +64,43 @@ const (
 	funcKind          = "Function"
 	funcAPIVersion    = "kubeless.io/v1beta1"
 	functionFinalizer = "kubeless.io/function"
+	// statusResyncPeriod is the time to wait before checking again the status of a function being built or deployed
+	statusResyncPeriod = 15 * time.Second
+	// buildLogTailLines is the number of lines of the logs of a failed build stored in the function status
+	buildLogTailLines = 10
+	// defaultRevisionHistoryLimit is the number of revisions to keep if function-revision-history-limit is not set
+	defaultRevisionHistoryLimit = 10
+	// defaultRouterImage is the image used to split the traffic between revisions if router-image is not set
+	defaultRouterImage = "kubeless/function-router:latest"
+	// revisionOfLabel is the label that links the resources of a revision to its function
+	revisionOfLabel = "kubeless.io/revision-of"
+	// buildInProgressReason is the reason of the ImageBuilt condition while the build job is running
+	buildInProgressReason = "BuildInProgress"
+	// idleCheckPeriod is the time between checks of the activity of the functions with an idle timeout
+	idleCheckPeriod = 30 * time.Second
+	// defaultActivatorService is the service of the activator in the kubeless namespace if activator-service is not set
+	defaultActivatorService = "function-activator"
+	// scaledToZeroReason is the reason of the DeploymentAvailable condition of an idle function
+	scaledToZeroReason = "ScaledToZero"
+	// configReloadedReason is the reason of the event emitted when the configuration is applied
+	configReloadedReason = "ConfigReloaded"
+	// eventComponent is the source of the events emitted by the controller
+	eventComponent = "kubeless-function-controller"
+	// invalidConfigReason is the reason of the event emitted when the configuration is rejected
+	invalidConfigReason = "InvalidConfig"
+	// untrustedSignatureReason is the reason of the SignatureVerified condition of a function not signed by a trusted key
+	untrustedSignatureReason = "UntrustedSignature"
 )
 
+// configDependentKeys are the properties of the configuration used to generate the resources of every function
+var configDependentKeys = []string{"deployment", "provision-image", "provision-image-secret", "builder-image", "builder-image-secret", "enable-build-step", "router-image", "function-trust-policy"}
+
+// functionActivity stores the number of calls of a function the last time it changed
+type functionActivity struct {
+	calls        float64
+	lastActivity time.Time
+}
+
 // FunctionController object
 type FunctionController struct {
 	logger           *logrus.Entry
@@ -61,20 +110,33 @@ type FunctionController struct {
 	Functions        map[string]*kubelessApi.Function
 	queue            workqueue.RateLimitingInterface
 	informer         cache.SharedIndexInformer
+	configInformer   cache.SharedIndexInformer
+	ownedInformers   map[string]cache.SharedIndexInformer
+	recorder         record.EventRecorder
+	configMutex      sync.RWMutex
 	config           *corev1.ConfigMap
 	langRuntime      *langruntime.Langruntimes
 	imagePullSecrets []corev1.LocalObjectReference
+	metricsHandler   utils.PodMetricsRetriever
+	logsRetriever    utils.PodLogsRetriever
+	activity         map[string]*functionActivity
+	activityMutex    sync.Mutex
+	activatorMutex   sync.Mutex
+	applied          map[string]interface{}
+	appliedMutex     sync.Mutex
+	synced           int32
 }
 
 // Config contains k8s client of a controller
 type Config struct {
 	KubeCli        kubernetes.Interface
 	FunctionClient versioned.Interface
+	ResyncPeriod   time.Duration // Period after which every function is processed again (0 to disable it)
 }
 
 // NewFunctionController returns a new *FunctionController
 func NewFunctionController(cfg Config, smclient *monitoringv1alpha1.MonitoringV1alpha1Client) *FunctionController {
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), queueName)
 
 	apiExtensionsClientset := utils.GetAPIExtensionsClientInCluster()
 	config, err := utils.GetKubelessConfig(cfg.KubeCli, apiExtensionsClientset)
@@ -82,7 +144,7 @@ func NewFunctionController(cfg Config, smclient *monitoringv1alpha1.MonitoringV1
 		logrus.Fatalf("Unable to read the configmap: %s", err)
 	}
 
-	informer := kv1beta1.NewFunctionInformer(cfg.FunctionClient, config.Data["functions-namespace"], 0, cache.Indexers{})
+	informer := kv1beta1.NewFunctionInformer(cfg.FunctionClient, config.Data["functions-namespace"], cfg.ResyncPeriod, cache.Indexers{})
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -96,7 +158,8 @@ func NewFunctionController(cfg Config, smclient *monitoringv1alpha1.MonitoringV1
 			if err == nil {
 				newFunctionObj := new.(*kubelessApi.Function)
 				oldFunctionObj := old.(*kubelessApi.Function)
-				if functionObjChanged(oldFunctionObj, newFunctionObj) {
+				// Periodic resyncs deliver the same version of the function
+				if oldFunctionObj.ResourceVersion == newFunctionObj.ResourceVersion || functionObjChanged(oldFunctionObj, newFunctionObj) {
 					queue.Add(key)
 				}
 			}
@@ -109,43 +172,237 @@ func NewFunctionController(cfg Config, smclient *monitoringv1alpha1.MonitoringV1
 		},
 	})
 
-	var lr = langruntime.New(config)
-	lr.ReadConfigMap()
-
-	imagePullSecrets := utils.GetSecretsAsLocalObjectReference(config.Data["provision-image-secret"], config.Data["builder-image-secret"])
-	if config.Data["enable-build-step"] == "true" {
-		imagePullSecrets = append(imagePullSecrets, utils.GetSecretsAsLocalObjectReference("kubeless-registry-credentials")...)
+	lr, imagePullSecrets, err := parseConfig(config)
+	if err != nil {
+		logrus.Fatalf("Invalid configmap %s: %v", config.ObjectMeta.Name, err)
 	}
-	return &FunctionController{
+
+	// The events refer both to functions and to core objects like the configmap
+	eventScheme := runtime.NewScheme()
+	scheme.AddToScheme(eventScheme)
+	kubelessScheme.AddToScheme(eventScheme)
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cfg.KubeCli.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: eventComponent})
+
+	controller := &FunctionController{
 		logger:           logrus.WithField("pkg", "function-controller"),
 		clientset:        cfg.KubeCli,
 		smclient:         smclient,
 		kubelessclient:   cfg.FunctionClient,
 		informer:         informer,
 		queue:            queue,
+		recorder:         recorder,
 		config:           config,
 		langRuntime:      lr,
 		imagePullSecrets: imagePullSecrets,
+		metricsHandler:   &utils.PrometheusMetricsHandler{},
+		logsRetriever:    &utils.APIPodLogsRetriever{},
+		activity:         map[string]*functionActivity{},
+		applied:          map[string]interface{}{},
+	}
+
+	// Watch the resources created for the functions to restore them if they are modified or deleted
+	// and the builds and their jobs to deploy the functions as soon as their images are ready
+	ns := config.Data["functions-namespace"]
+	ownedOnly := func(options *metav1.ListOptions) {
+		options.LabelSelector = "created-by=kubeless"
+	}
+	controller.ownedInformers = map[string]cache.SharedIndexInformer{
+		"configmaps":               coreinformers.NewFilteredConfigMapInformer(cfg.KubeCli, ns, 0, cache.Indexers{}, ownedOnly),
+		"services":                 coreinformers.NewFilteredServiceInformer(cfg.KubeCli, ns, 0, cache.Indexers{utils.ActivatorPortIndex: utils.ActivatorPortIndexFunc}, ownedOnly),
+		"deployments":              appsinformers.NewFilteredDeploymentInformer(cfg.KubeCli, ns, 0, cache.Indexers{}, ownedOnly),
+		"horizontalpodautoscalers": autoscalinginformers.NewFilteredHorizontalPodAutoscalerInformer(cfg.KubeCli, ns, 0, cache.Indexers{}, ownedOnly),
+		"jobs":                     batchinformers.NewFilteredJobInformer(cfg.KubeCli, ns, 0, cache.Indexers{}, ownedOnly),
+		"functionbuilds":           kv1beta1.NewFilteredFunctionBuildInformer(cfg.FunctionClient, ns, 0, cache.Indexers{}, ownedOnly),
+	}
+	for _, ownedInformer := range controller.ownedInformers {
+		ownedInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueOwner,
+			UpdateFunc: func(old, new interface{}) {
+				if old.(metav1.Object).GetResourceVersion() != new.(metav1.Object).GetResourceVersion() {
+					controller.enqueueOwner(new)
+				}
+			},
+			DeleteFunc: controller.enqueueOwner,
+		})
+	}
+
+	// Watch the configmap to apply its changes without restarting the controller
+	controller.configInformer = coreinformers.NewFilteredConfigMapInformer(cfg.KubeCli, config.ObjectMeta.Namespace, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", config.ObjectMeta.Name).String()
+	})
+	controller.configInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			controller.reloadConfig(obj.(*corev1.ConfigMap))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			controller.reloadConfig(new.(*corev1.ConfigMap))
+		},
+	})
+	return controller
+}
+
+// parseConfig validates the kubeless configuration and returns the runtimes it defines
+// and the secrets needed to pull the images it references
+func parseConfig(config *corev1.ConfigMap) (*langruntime.Langruntimes, []corev1.LocalObjectReference, error) {
+	lr := langruntime.New(config)
+	if err := lr.ParseConfigMap(); err != nil {
+		return nil, nil, err
+	}
+	if deploymentConfigData, ok := config.Data["deployment"]; ok {
+		deployment := appsv1.Deployment{}
+		err := yaml.UnmarshalStrict([]byte(deploymentConfigData), &deployment, yaml.DisallowUnknownFields)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to parse the deployment: %v", err)
+		}
+	}
+	if limit, ok := config.Data["function-revision-history-limit"]; ok && limit != "" {
+		if _, err := strconv.Atoi(limit); err != nil {
+			return nil, nil, fmt.Errorf("Invalid function-revision-history-limit %q: %v", limit, err)
+		}
+	}
+
+	if err := validBuildBackend(config.Data["function-build-backend"]); err != nil {
+		return nil, nil, err
+	}
+	if err := utils.ValidateTrustPolicy(config); err != nil {
+		return nil, nil, err
+	}
+	for _, runtimeInf := range lr.AvailableRuntimes {
+		if err := validBuildBackend(runtimeInf.BuildBackend); err != nil {
+			return nil, nil, fmt.Errorf("Invalid build backend of the runtime %s: %v", runtimeInf.ID, err)
+		}
+	}
+
+	imagePullSecrets := utils.GetSecretsAsLocalObjectReference(config.Data["provision-image-secret"], config.Data["builder-image-secret"])
+	if config.Data["enable-build-step"] == "true" {
+		imagePullSecrets = append(imagePullSecrets, utils.GetSecretsAsLocalObjectReference("kubeless-registry-credentials")...)
+	}
+	return lr, imagePullSecrets, nil
+}
+
+// reloadConfig applies a new version of the kubeless configuration. If it is not valid
+// it is rejected with an event and the controller keeps using the previous one.
+// The configuration is swapped once the workers finish the functions they are processing
+func (c *FunctionController) reloadConfig(config *corev1.ConfigMap) {
+	c.configMutex.RLock()
+	current := c.config
+	c.configMutex.RUnlock()
+	if reflect.DeepEqual(current.Data, config.Data) {
+		return
+	}
+
+	lr, imagePullSecrets, err := parseConfig(config)
+	if err != nil {
+		c.logger.Errorf("Ignoring the changes of the configmap %s: %v", config.ObjectMeta.Name, err)
+		c.recorder.Eventf(config, corev1.EventTypeWarning, invalidConfigReason, "Invalid configuration, the controller keeps using the previous one: %v", err)
+		return
+	}
+	if current.Data["functions-namespace"] != config.Data["functions-namespace"] {
+		c.logger.Warnf("The controller needs to be restarted to watch the functions of a different namespace")
+	}
+
+	c.configMutex.Lock()
+	oldLr := c.langRuntime
+	c.config, c.langRuntime, c.imagePullSecrets = config, lr, imagePullSecrets
+	c.configMutex.Unlock()
+
+	c.logger.Infof("Configuration reloaded from the configmap %s", config.ObjectMeta.Name)
+	c.recorder.Event(config, corev1.EventTypeNormal, configReloadedReason, "Configuration reloaded")
+	c.requeueAffectedFunctions(current, config, oldLr, lr)
+}
+
+// enqueueOwner adds to the queue the function that owns the given resource, if any
+func (c *FunctionController) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	for _, owner := range meta.GetOwnerReferences() {
+		if owner.Kind == funcKind && owner.APIVersion == funcAPIVersion {
+			c.queue.Add(meta.GetNamespace() + "/" + owner.Name)
+			return
+		}
+	}
+}
+
+// requeueAffectedFunctions processes again the functions whose resources change with the new configuration:
+// all of them if a property used for every function changed, the ones that use a modified runtime otherwise
+func (c *FunctionController) requeueAffectedFunctions(oldConfig, newConfig *corev1.ConfigMap, oldLr, newLr *langruntime.Langruntimes) {
+	all := false
+	for _, key := range configDependentKeys {
+		if oldConfig.Data[key] != newConfig.Data[key] {
+			all = true
+		}
+	}
+	for _, obj := range c.informer.GetStore().List() {
+		funcObj := obj.(*kubelessApi.Function)
+		if !all {
+			oldInfo, oldErr := oldLr.GetRuntimeInfo(funcObj.Spec.Runtime)
+			newInfo, newErr := newLr.GetRuntimeInfo(funcObj.Spec.Runtime)
+			if (oldErr == nil) == (newErr == nil) && reflect.DeepEqual(oldInfo, newInfo) {
+				continue
+			}
+		}
+		key, err := cache.MetaNamespaceKeyFunc(funcObj)
+		if err == nil {
+			c.logger.Infof("Processing again the function %s after the configuration change", key)
+			c.queue.Add(key)
+		}
 	}
 }
 
-// Run starts the kubeless controller
-func (c *FunctionController) Run(stopCh <-chan struct{}) {
+// Run starts the kubeless controller with the given number of workers processing functions in parallel
+func (c *FunctionController) Run(workers int, stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
 	defer c.queue.ShutDown()
 
 	c.logger.Info("Starting Function controller")
 
 	go c.informer.Run(stopCh)
+	go c.configInformer.Run(stopCh)
 
-	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
+	informerSynced.WithLabelValues("functions").Set(0)
+	informerSynced.WithLabelValues("config").Set(0)
+	cacheSyncs := []cache.InformerSynced{c.HasSynced, c.configInformer.HasSynced}
+	for resource, ownedInformer := range c.ownedInformers {
+		go ownedInformer.Run(stopCh)
+		informerSynced.WithLabelValues(resource).Set(0)
+		cacheSyncs = append(cacheSyncs, ownedInformer.HasSynced)
+	}
+
+	if !cache.WaitForCacheSync(stopCh, cacheSyncs...) {
 		utilruntime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
 		return
 	}
+	informerSynced.WithLabelValues("functions").Set(1)
+	informerSynced.WithLabelValues("config").Set(1)
+	for resource := range c.ownedInformers {
+		informerSynced.WithLabelValues(resource).Set(1)
+	}
+	atomic.StoreInt32(&c.synced, 1)
 
-	c.logger.Info("Function controller synced and ready")
+	c.logger.Infof("Function controller synced and ready, starting %d workers", workers)
 
-	wait.Until(c.runWorker, time.Second, stopCh)
+	// The queue never hands the same key to two workers at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(c.runWorker, time.Second, stopCh)
+		}()
+	}
+
+	<-stopCh
+	c.logger.Info("Stopping Function controller")
+	// Let the workers finish the functions in progress
+	c.queue.ShutDown()
+	wg.Wait()
 }
 
 // HasSynced is required for the cache.Controller interface.
@@ -153,6 +410,11 @@ func (c *FunctionController) HasSynced() bool {
 	return c.informer.HasSynced()
 }
 
+// Ready returns true once the caches of the controller have been synced and it has started processing functions
+func (c *FunctionController) Ready() bool {
+	return atomic.LoadInt32(&c.synced) == 1
+}
+
 // LastSyncResourceVersion is required for the cache.Controller interface.
 func (c *FunctionController) LastSyncResourceVersion() string {
 	return c.informer.LastSyncResourceVersion()
@@ -171,7 +433,9 @@ func (c *FunctionController) processNextItem() bool {
 	}
 	defer c.queue.Done(key)
 
+	start := time.Now()
 	err := c.processItem(key.(string))
+	observeReconcile(start, err)
 	if err == nil {
 		// No error, reset the ratelimit counters
 		c.queue.Forget(key)
@@ -182,6 +446,10 @@ func (c *FunctionController) processNextItem() bool {
 		// err != nil and too many retries
 		c.logger.Errorf("Error processing %s (giving up): %v", key, err)
 		c.queue.Forget(key)
+		droppedTotal.Inc()
+		if obj, exists, _ := c.informer.GetIndexer().GetByKey(key.(string)); exists {
+			c.recorder.Eventf(obj.(*kubelessApi.Function), corev1.EventTypeWarning, "RetriesExhausted", "Giving up after %d retries: %v", maxRetries, err)
+		}
 		utilruntime.HandleError(err)
 	}
 
@@ -191,6 +459,10 @@ func (c *FunctionController) processNextItem() bool {
 func (c *FunctionController) processItem(key string) error {
 	c.logger.Infof("Processing change to Function %s", key)
 
+	// The configuration cannot be reloaded while the function is processed
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
 	ns, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return err
@@ -207,7 +479,7 @@ func (c *FunctionController) processItem(key string) error {
 		return nil
 	}
 
-	funcObj := obj.(*kubelessApi.Function)
+	funcObj := obj.(*kubelessApi.Function).DeepCopy()
 
 	// Function API object is marked for deletion (DeletionTimestamp != nil), so lets process the delete update
 	if funcObj.ObjectMeta.DeletionTimestamp != nil {
@@ -221,6 +493,7 @@ func (c *FunctionController) processItem(key string) error {
 		err := c.deleteK8sResources(ns, name)
 		if err != nil {
 			c.logger.Errorf("Can't delete function: %v", err)
+			c.recorder.Eventf(funcObj, corev1.EventTypeWarning, "DeletionFailed", "Unable to delete the resources of the function: %v", err)
 			return err
 		}
 
@@ -231,6 +504,7 @@ func (c *FunctionController) processItem(key string) error {
 			return err
 		}
 		c.logger.Infof("Function object %s has been successfully processed and marked for deletion", key)
+		c.recorder.Event(funcObj, corev1.EventTypeNormal, "Deleted", "Deleted the resources of the function")
 		return nil
 	}
 
@@ -241,65 +515,371 @@ func (c *FunctionController) processItem(key string) error {
 			c.logger.Errorf("Error adding Function controller as finalizer to Function Obj: %s CRD due to: %v: ", key, err)
 			return err
 		}
+		c.recorder.Eventf(funcObj, corev1.EventTypeNormal, "FinalizerAdded", "Added the finalizer %s", functionFinalizer)
+	}
+
+	err = c.ensureFunctionRevision(funcObj)
+	if err != nil {
+		c.logger.Errorf("Unable to store the revision of the function %s: %v", key, err)
+		return err
 	}
 
 	err = c.ensureK8sResources(funcObj)
+	c.updateFunctionStatus(funcObj, err)
 	if err != nil {
 		c.logger.Errorf("Function can not be created/updated: %v", err)
+		c.recorder.Eventf(funcObj, corev1.EventTypeWarning, "SyncFailed", "Unable to deploy the function: %v", err)
 		return err
 	}
 
+	if period := requeuePeriod(funcObj); period > 0 {
+		c.queue.AddAfter(key, period)
+	}
+
 	c.logger.Infof("Processed change to function: %s", key)
 	return nil
 }
 
-// startImageBuildJob creates (if necessary) a job that will build an image for the given function
-// returns the name of the image, a boolean indicating if the build job has been created and an error
-func (c *FunctionController) startImageBuildJob(funcObj *kubelessApi.Function, or []metav1.OwnerReference) (string, bool, error) {
-	imagePullSecret, err := c.clientset.CoreV1().Secrets(funcObj.ObjectMeta.Namespace).Get("kubeless-registry-credentials", metav1.GetOptions{})
+// updateFunctionStatus computes the phase of the function based on its conditions and stores its status
+func (c *FunctionController) updateFunctionStatus(funcObj *kubelessApi.Function, reconcileErr error) {
+	funcObj.Status.ObservedGeneration = funcObj.ObjectMeta.Generation
+	funcObj.Status.Phase = functionPhase(funcObj, reconcileErr)
+	err := utils.UpdateFunctionStatus(c.kubelessclient, funcObj)
 	if err != nil {
-		return "", false, fmt.Errorf("Unable to locate registry credentials to build function image: %v", err)
+		c.logger.Errorf("Unable to update the status of the function %s: %v", funcObj.ObjectMeta.Name, err)
+	}
+}
+
+// requeuePeriod returns the time after which a function should be processed again, or zero if it
+// only needs to be processed when it changes. Failed functions are not requeued: they are retried
+// when the function is updated or in the periodic resync of the informer
+func requeuePeriod(funcObj *kubelessApi.Function) time.Duration {
+	switch funcObj.Status.Phase {
+	case kubelessApi.FunctionPhaseBuilding, kubelessApi.FunctionPhaseDeploying:
+		// The function is still being built or deployed, check it again later
+		return statusResyncPeriod
+	case kubelessApi.FunctionPhaseReady:
+		if funcObj.Spec.IdleTimeout != "" {
+			// Check periodically if the function should be scaled to (or from) zero
+			return idleCheckPeriod
+		}
+	}
+	return 0
+}
+
+// functionPhase returns the phase of a function given its conditions and the result of the last reconciliation
+func functionPhase(funcObj *kubelessApi.Function, reconcileErr error) kubelessApi.FunctionPhase {
+	if reconcileErr != nil {
+		return kubelessApi.FunctionPhaseFailed
+	}
+	if len(funcObj.Status.Conditions) == 0 {
+		return kubelessApi.FunctionPhasePending
 	}
-	reg, err := registry.New(*imagePullSecret)
+	failed := utils.FunctionObjFailedCondition(funcObj)
+	if failed == nil {
+		return kubelessApi.FunctionPhaseReady
+	}
+	switch failed.Type {
+	case kubelessApi.FunctionImageBuilt:
+		if failed.Reason == buildInProgressReason {
+			return kubelessApi.FunctionPhaseBuilding
+		}
+	case kubelessApi.FunctionDeploymentAvailable:
+		return kubelessApi.FunctionPhaseDeploying
+	}
+	return kubelessApi.FunctionPhaseFailed
+}
+
+// revisionHistoryLimit returns the number of revisions to keep for each function
+func (c *FunctionController) revisionHistoryLimit() int {
+	limit, err := strconv.Atoi(c.config.Data["function-revision-history-limit"])
+	if err != nil || limit < 1 {
+		return defaultRevisionHistoryLimit
+	}
+	return limit
+}
+
+// ensureFunctionRevision stores a new revision of the function if its spec differs from
+// the latest revision and removes the revisions that exceed the history limit
+func (c *FunctionController) ensureFunctionRevision(funcObj *kubelessApi.Function) error {
+	revisions, err := utils.GetFunctionRevisions(c.kubelessclient, funcObj.ObjectMeta.Name, funcObj.ObjectMeta.Namespace)
 	if err != nil {
-		return "", false, fmt.Errorf("Unable to retrieve registry information: %v", err)
+		return err
+	}
+	var latest *kubelessApi.FunctionRevision
+	if len(revisions) > 0 {
+		latest = revisions[len(revisions)-1]
+	}
+	if latest == nil || functionSpecChanged(&latest.Spec.Function, &funcObj.Spec) {
+		revisionNumber := int64(1)
+		if latest != nil {
+			revisionNumber = latest.Spec.Revision + 1
+		}
+		or, err := utils.GetOwnerReference(funcKind, funcAPIVersion, funcObj.Name, funcObj.UID)
+		if err != nil {
+			return err
+		}
+		revision := &kubelessApi.FunctionRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("%s-%d", funcObj.ObjectMeta.Name, revisionNumber),
+				Namespace:       funcObj.ObjectMeta.Namespace,
+				OwnerReferences: or,
+				Labels: map[string]string{
+					"created-by": "kubeless",
+					"function":   funcObj.ObjectMeta.Name,
+				},
+			},
+			Spec: kubelessApi.FunctionRevisionSpec{
+				Revision: revisionNumber,
+				Function: *funcObj.Spec.DeepCopy(),
+			},
+		}
+		// The traffic split and the idle timeout are not part of the revision
+		revision.Spec.Function.Traffic = nil
+		revision.Spec.Function.IdleTimeout = ""
+		if changeCause, ok := funcObj.ObjectMeta.Annotations[utils.ChangeCauseAnnotation]; ok {
+			revision.ObjectMeta.Annotations = map[string]string{utils.ChangeCauseAnnotation: changeCause}
+		}
+		_, err = c.kubelessclient.KubelessV1beta1().FunctionRevisions(funcObj.ObjectMeta.Namespace).Create(revision)
+		if err != nil && !k8sErrors.IsAlreadyExists(err) {
+			return err
+		}
+		c.logger.Infof("Stored revision %d of function %s", revisionNumber, funcObj.ObjectMeta.Name)
+		latest = revision
+		revisions = append(revisions, revision)
+	}
+	funcObj.Status.Revision = latest.Spec.Revision
+
+	// Remove the oldest revisions, except the ones that still receive traffic
+	referenced := map[int64]bool{}
+	for _, t := range funcObj.Spec.Traffic {
+		referenced[t.Revision] = true
 	}
-	// Use function content and deps as tag (digested)
-	tag := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%v%v", funcObj.Spec.Function, funcObj.Spec.Deps))))
-	imageName := fmt.Sprintf("%s/%s", reg.Creds.Username, funcObj.ObjectMeta.Name)
-	// Check if image already exists
-	exists, err := reg.ImageExists(imageName, tag)
+	for i := 0; i < len(revisions)-c.revisionHistoryLimit(); i++ {
+		if referenced[revisions[i].Spec.Revision] {
+			continue
+		}
+		err = c.kubelessclient.KubelessV1beta1().FunctionRevisions(funcObj.ObjectMeta.Namespace).Delete(revisions[i].ObjectMeta.Name, &metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// startImageBuildJob ensures the FunctionBuild of the current code of the function and its job
+// returns the name of the image, a boolean indicating if the build is still running and an error
+func (c *FunctionController) startImageBuildJob(funcObj *kubelessApi.Function, or []metav1.OwnerReference) (string, bool, error) {
+	target, err := utils.GetBuildTarget(c.clientset, funcObj, c.config.Data["function-registry"], c.config.Data["function-repository-prefix"])
 	if err != nil {
-		return "", false, fmt.Errorf("Unable to check is target image exists: %v", err)
+		return "", false, err
 	}
-	regURL, err := url.Parse(reg.Endpoint)
+	build, err := c.ensureFunctionBuild(funcObj, target, or)
 	if err != nil {
-		return "", false, fmt.Errorf("Unable to parse registry URL: %v", err)
+		return "", false, err
 	}
-	image := fmt.Sprintf("%s/%s:%s", regURL.Host, imageName, tag)
-	if !exists {
-		tlsVerify := true
-		if c.config.Data["function-registry-tls-verify"] == "false" {
-			tlsVerify = false
+	image := target.Image()
+	if build.Status.Phase == kubelessApi.FunctionBuildSucceeded {
+		// A previous build of the same code keeps its image even if the push registry has changed since then
+		return build.Spec.Image, false, nil
+	}
+
+	status := build.Status.DeepCopy()
+	var buildErr error
+	if status.Job == "" {
+		// Check if image already exists
+		lookupStart := time.Now()
+		exists, err := target.Registry.ImageExists(target.Name, target.Tag)
+		observeRegistryLookup(lookupStart, err)
+		if err != nil {
+			return "", false, fmt.Errorf("Unable to check is target image exists: %v", err)
+		}
+		if exists {
+			now := metav1.Now()
+			status.Phase = kubelessApi.FunctionBuildSucceeded
+			status.CompletionTime = &now
+			status.Message = "Found the image in the registry"
+			status.Digest = c.imageDigest(target)
 		}
-		err = utils.EnsureFuncImage(c.clientset, funcObj, c.langRuntime, or, imageName, tag, c.config.Data["builder-image"], regURL.Host, imagePullSecret.Name, c.config.Data["provision-image"], tlsVerify, c.imagePullSecrets)
+	}
+	if status.Phase != kubelessApi.FunctionBuildSucceeded {
+		if target.DepsTag != "" && status.Job == "" {
+			// Reuse the dependencies of a previous build if they have not changed
+			lookupStart := time.Now()
+			target.DepsCached, err = target.Registry.ImageExists(target.DepsName, target.DepsTag)
+			observeRegistryLookup(lookupStart, err)
+			if err != nil {
+				return "", false, fmt.Errorf("Unable to check if the dependencies image exists: %v", err)
+			}
+		}
+		target.Platform = c.config.Data["function-build-platform"]
+		target.Labels = utils.FunctionImageLabels(funcObj, c.config)
+		target.Timestamp, err = utils.BuildTimestamp(funcObj, c.config.Data["function-build-timestamp"])
+		if err != nil {
+			return "", false, err
+		}
+		builder, err := NewBuilder(c.config, c.langRuntime, c.imagePullSecrets, funcObj.Spec.Runtime)
+		if err != nil {
+			return "", false, err
+		}
+		job, err := builder.BuildJob(funcObj, target, or)
+		if err != nil {
+			return "", false, fmt.Errorf("Unable to generate the image build job: %v", err)
+		}
+		err = utils.EnsureBuildJob(c.clientset, job)
 		if err != nil {
 			return "", false, fmt.Errorf("Unable to create image build job: %v", err)
 		}
+		status.Job = build.ObjectMeta.Name
+		buildErr = c.checkImageBuildJob(funcObj.ObjectMeta.Namespace, status)
+		if status.Phase == kubelessApi.FunctionBuildSucceeded {
+			status.Digest = c.imageDigest(target)
+		}
+	}
+	if !apiequality.Semantic.DeepEqual(*status, build.Status) {
+		build.Status = *status
+		if _, err := c.kubelessclient.KubelessV1beta1().FunctionBuilds(build.ObjectMeta.Namespace).UpdateStatus(build); err != nil {
+			return "", false, fmt.Errorf("Unable to update the status of the build %s: %v", build.ObjectMeta.Name, err)
+		}
+	}
+	if buildErr != nil {
+		return "", false, buildErr
+	}
+	return image, status.Phase != kubelessApi.FunctionBuildSucceeded, nil
+}
+
+// ensureFunctionBuild returns the FunctionBuild of the current code of the function, creating it if necessary
+func (c *FunctionController) ensureFunctionBuild(funcObj *kubelessApi.Function, target *utils.BuildTarget, or []metav1.OwnerReference) (*kubelessApi.FunctionBuild, error) {
+	builds := c.kubelessclient.KubelessV1beta1().FunctionBuilds(funcObj.ObjectMeta.Namespace)
+	build, err := builds.Get(utils.FunctionBuildName(funcObj.ObjectMeta.Name, target.Tag), metav1.GetOptions{})
+	if err == nil {
+		return build, nil
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("Unable to retrieve the build of the function: %v", err)
+	}
+	build, err = builds.Create(utils.NewFunctionBuild(funcObj, target, or))
+	if err != nil && k8sErrors.IsAlreadyExists(err) {
+		// The build has been requested at the same time with 'kubeless function build'
+		build, err = builds.Get(utils.FunctionBuildName(funcObj.ObjectMeta.Name, target.Tag), metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create the build of the function: %v", err)
+	}
+	return build, nil
+}
+
+// imageDigest returns the digest of the target image or an empty string if it cannot be retrieved
+func (c *FunctionController) imageDigest(target *utils.BuildTarget) string {
+	lookupStart := time.Now()
+	digest, err := target.Registry.ImageDigest(target.Name, target.Tag)
+	observeRegistryLookup(lookupStart, err)
+	if err != nil {
+		c.logger.Warningf("Unable to retrieve the digest of the image %s: %v", target.Image(), err)
+		return ""
+	}
+	return digest
+}
+
+// buildJobError describes the failure of an image build job
+type buildJobError struct {
+	job       string
+	reason    string
+	container string
+	exitCode  int32
+	logs      string
+}
+
+func (e *buildJobError) Error() string {
+	msg := fmt.Sprintf("Image build job %s failed", e.job)
+	if e.container != "" {
+		msg += fmt.Sprintf(" in the container %s (exit code %d)", e.container, e.exitCode)
+	}
+	if e.reason != "" {
+		msg += ": " + e.reason
+	}
+	if e.logs != "" {
+		msg += "\n" + e.logs
+	}
+	return msg
+}
+
+// checkImageBuildJob updates the given build status with the state of its job
+// returns a *buildJobError if the job has failed
+func (c *FunctionController) checkImageBuildJob(ns string, status *kubelessApi.FunctionBuildStatus) error {
+	job, err := c.clientset.BatchV1().Jobs(ns).Get(status.Job, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve image build job: %v", err)
+	}
+	if job.Status.StartTime != nil {
+		status.Phase = kubelessApi.FunctionBuildRunning
+		status.StartTime = job.Status.StartTime
 	} else {
-		// Image already exists
-		return image, false, nil
+		status.Phase = kubelessApi.FunctionBuildPending
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			status.Phase = kubelessApi.FunctionBuildSucceeded
+			status.CompletionTime = job.Status.CompletionTime
+			status.Message = ""
+			return nil
+		case batchv1.JobFailed:
+			failure := &buildJobError{job: status.Job, reason: cond.Message}
+			c.describeBuildFailure(ns, failure)
+			status.Phase = kubelessApi.FunctionBuildFailed
+			status.CompletionTime = &cond.LastTransitionTime
+			status.Message = failure.Error()
+			return failure
+		}
 	}
-	return image, true, nil
+	return nil
 }
 
-// ensureK8sResources creates/updates k8s objects (deploy, svc, configmap) for the function
-func (c *FunctionController) ensureK8sResources(funcObj *kubelessApi.Function) error {
-	if len(funcObj.ObjectMeta.Labels) == 0 {
-		funcObj.ObjectMeta.Labels = make(map[string]string)
+// describeBuildFailure fills in the container that made the build job fail and the last lines of its logs
+func (c *FunctionController) describeBuildFailure(ns string, failure *buildJobError) {
+	pods, err := c.clientset.CoreV1().Pods(ns).List(metav1.ListOptions{
+		LabelSelector: "job-name=" + failure.job,
+	})
+	if err != nil {
+		c.logger.Warningf("Unable to list the pods of the job %s: %v", failure.job, err)
+		return
 	}
-	funcObj.ObjectMeta.Labels["function"] = funcObj.ObjectMeta.Name
+	// Check the pods from the most recent one
+	items := pods.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[j].ObjectMeta.CreationTimestamp.Before(&items[i].ObjectMeta.CreationTimestamp)
+	})
+	for _, pod := range items {
+		// The init containers (prepare, install, compile and bundle) run before the build container
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			terminated := status.State.Terminated
+			if terminated == nil || terminated.ExitCode == 0 {
+				continue
+			}
+			failure.container = status.Name
+			failure.exitCode = terminated.ExitCode
+			tailLines := int64(buildLogTailLines)
+			logs, err := c.logsRetriever.GetPodLogs(c.clientset, ns, pod.ObjectMeta.Name, &corev1.PodLogOptions{
+				Container: status.Name,
+				TailLines: &tailLines,
+			})
+			if err != nil {
+				c.logger.Warningf("Unable to retrieve the logs of the container %s of the pod %s: %v", status.Name, pod.ObjectMeta.Name, err)
+			} else {
+				failure.logs = strings.TrimSpace(string(logs))
+			}
+			return
+		}
+	}
+}
 
+// mergeDeploymentConfig merges the default deployment from the controller configuration into the function deployment
+func (c *FunctionController) mergeDeploymentConfig(funcObj *kubelessApi.Function) error {
 	deployment := appsv1.Deployment{}
 	if deploymentConfigData, ok := c.config.Data["deployment"]; ok {
 		err := yaml.UnmarshalStrict([]byte(deploymentConfigData), &deployment, yaml.DisallowUnknownFields)
@@ -313,22 +893,14 @@ func (c *FunctionController) ensureK8sResources(funcObj *kubelessApi.Function) e
 			return err
 		}
 	}
+	return nil
+}
 
-	or, err := utils.GetOwnerReference(funcKind, funcAPIVersion, funcObj.Name, funcObj.UID)
-	if err != nil {
-		return err
-	}
-
-	err = utils.EnsureFuncConfigMap(c.clientset, funcObj, or, c.langRuntime)
-	if err != nil {
-		return err
-	}
-
-	err = utils.EnsureFuncService(c.clientset, funcObj, or)
-	if err != nil {
-		return err
-	}
-
+// ensureFunctionImage builds the image of the function if the build step is enabled. The events and the
+// ImageBuilt condition are recorded in target, the function object that exists in the cluster (funcObj may
+// be a revision of it). Returns the image to use in the function deployment (empty if the image should be
+// provisioned), false if the image is still being built and an error if the build job has failed
+func (c *FunctionController) ensureFunctionImage(funcObj, target *kubelessApi.Function, or []metav1.OwnerReference) (string, bool, error) {
 	prebuiltImage := ""
 	if len(funcObj.Spec.Deployment.Spec.Template.Spec.Containers) > 0 && funcObj.Spec.Deployment.Spec.Template.Spec.Containers[0].Image != "" {
 		prebuiltImage = funcObj.Spec.Deployment.Spec.Template.Spec.Containers[0].Image
@@ -337,48 +909,692 @@ func (c *FunctionController) ensureK8sResources(funcObj *kubelessApi.Function) e
 	if prebuiltImage == "" {
 		if c.config.Data["enable-build-step"] == "true" {
 			var isBuilding bool
+			var err error
+			// Events are only emitted when the state of the build changes, not in every resync
+			previous := utils.FunctionObjGetCondition(target, kubelessApi.FunctionImageBuilt)
+			transition := func(reason string) bool {
+				return previous == nil || previous.Reason != reason
+			}
 			prebuiltImage, isBuilding, err = c.startImageBuildJob(funcObj, or)
 			if err != nil {
 				logrus.Errorf("Unable to build function: %v", err)
+				if transition("BuildFailed") {
+					c.recorder.Eventf(target, corev1.EventTypeWarning, "BuildFailed", "Unable to build the function image: %v", err)
+				}
+				utils.FunctionObjSetCondition(target, kubelessApi.FunctionImageBuilt, corev1.ConditionFalse, "BuildFailed", err.Error())
+				if _, jobFailed := err.(*buildJobError); jobFailed {
+					// Keep the current deployment and retry later in case the failure was transient
+					return "", false, err
+				}
 			} else {
 				if isBuilding {
 					logrus.Infof("Started build process for function %s", funcObj.ObjectMeta.Name)
+					if transition(buildInProgressReason) {
+						buildJobsTotal.Inc()
+						c.recorder.Eventf(target, corev1.EventTypeNormal, "BuildStarted", "Started the build job of the image %s", prebuiltImage)
+					}
+					utils.FunctionObjSetCondition(target, kubelessApi.FunctionImageBuilt, corev1.ConditionFalse, buildInProgressReason, fmt.Sprintf("Building image %s", prebuiltImage))
 				} else {
 					logrus.Infof("Found existing image %s", prebuiltImage)
+					if transition("ImageFound") {
+						c.recorder.Eventf(target, corev1.EventTypeNormal, "ImageFound", "Found the image %s in the registry", prebuiltImage)
+					}
+					utils.FunctionObjSetCondition(target, kubelessApi.FunctionImageBuilt, corev1.ConditionTrue, "ImageFound", fmt.Sprintf("Using image %s", prebuiltImage))
 				}
 			}
+		} else {
+			utils.FunctionObjRemoveCondition(target, kubelessApi.FunctionImageBuilt)
 		}
 	} else {
 		logrus.Infof("Skipping image-build step for %s", funcObj.ObjectMeta.Name)
+		utils.FunctionObjRemoveCondition(target, kubelessApi.FunctionImageBuilt)
+	}
+	building := utils.FunctionObjGetCondition(target, kubelessApi.FunctionImageBuilt)
+	return prebuiltImage, building == nil || building.Reason != buildInProgressReason, nil
+}
+
+// idleTime returns the time since the function received its last request, based on
+// the number of calls reported by its pods
+func (c *FunctionController) idleTime(funcObj *kubelessApi.Function) (time.Duration, error) {
+	calls, err := utils.GetFunctionCalls(c.clientset, c.metricsHandler, funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Name)
+	if err != nil {
+		return 0, err
+	}
+	key := funcObj.ObjectMeta.Namespace + "/" + funcObj.ObjectMeta.Name
+	c.activityMutex.Lock()
+	defer c.activityMutex.Unlock()
+	a, ok := c.activity[key]
+	if !ok || a.calls != calls {
+		c.activity[key] = &functionActivity{calls: calls, lastActivity: time.Now()}
+		return 0, nil
+	}
+	return time.Since(a.lastActivity), nil
+}
+
+// forgetActivity removes the activity stored for a function
+func (c *FunctionController) forgetActivity(funcObj *kubelessApi.Function) {
+	c.activityMutex.Lock()
+	defer c.activityMutex.Unlock()
+	delete(c.activity, funcObj.ObjectMeta.Namespace+"/"+funcObj.ObjectMeta.Name)
+}
+
+// activatorEndpoints returns the endpoints of the activator service
+func (c *FunctionController) activatorEndpoints() (*corev1.Endpoints, error) {
+	activatorService := c.config.Data["activator-service"]
+	if activatorService == "" {
+		activatorService = defaultActivatorService
+	}
+	return c.clientset.CoreV1().Endpoints(c.config.ObjectMeta.Namespace).Get(activatorService, metav1.GetOptions{})
+}
+
+// redirectToActivator sends the requests of the function to the activator. The workers redirect
+// one function at a time, since each function reserves a different port of the activator
+func (c *FunctionController) redirectToActivator(funcObj *kubelessApi.Function, activator *corev1.Endpoints) error {
+	c.activatorMutex.Lock()
+	defer c.activatorMutex.Unlock()
+	return c.ensureResource(funcObj, "Service", funcObj.ObjectMeta.Name, func() error {
+		return utils.RedirectFuncServiceToActivator(c.clientset, c.ownedInformers["services"].GetIndexer(), funcObj, activator)
+	})
+}
+
+// ensureScaleToZero sends the requests of a function to the activator once it has been idle
+// for longer than its idle timeout and restores its service when the activator scales it up again.
+// Functions splitting their traffic between revisions are not scaled to zero.
+// Returns true if the function should be scaled to zero
+func (c *FunctionController) ensureScaleToZero(funcObj *kubelessApi.Function) (bool, error) {
+	idleTimeoutSet := funcObj.Spec.IdleTimeout != "" && len(funcObj.Spec.Traffic) == 0
+	svc, err := c.clientset.CoreV1().Services(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	replicas := int32(-1)
+	dpm, err := c.clientset.AppsV1().Deployments(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil {
+		replicas = 1
+		if dpm.Spec.Replicas != nil {
+			replicas = *dpm.Spec.Replicas
+		}
+	}
+
+	if _, scaledToZero := svc.ObjectMeta.Annotations[utils.ScaledToZeroAnnotation]; scaledToZero {
+		if idleTimeoutSet && replicas == 0 {
+			// Keep the endpoints of the activator up to date
+			activator, err := c.activatorEndpoints()
+			if err == nil {
+				var port int32
+				port, err = utils.ActivatorPort(svc)
+				if err == nil {
+					err = utils.EnsureFuncActivatorEndpoints(c.clientset, funcObj, activator, port)
+				} else {
+					// The service doesn't have a port of the activator reserved yet
+					err = c.redirectToActivator(funcObj, activator)
+				}
+			}
+			if err != nil {
+				c.logger.Errorf("Unable to update the activator endpoints of the function %s: %v", funcObj.ObjectMeta.Name, err)
+			}
+			return true, nil
+		}
+		// The activator has scaled up the function (or the idle timeout has been removed)
+		c.logger.Infof("Function %s has been scaled up, restoring its service", funcObj.ObjectMeta.Name)
+		c.forgetActivity(funcObj)
+		return false, c.ensureResource(funcObj, "Service", funcObj.ObjectMeta.Name, func() error {
+			return utils.RestoreFuncService(c.clientset, funcObj)
+		})
+	}
+
+	if !idleTimeoutSet || replicas <= 0 {
+		c.forgetActivity(funcObj)
+		return false, nil
+	}
+	idleTimeout, err := time.ParseDuration(funcObj.Spec.IdleTimeout)
+	if err != nil || idleTimeout <= 0 {
+		err = fmt.Errorf("Invalid idle timeout %q", funcObj.Spec.IdleTimeout)
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "InvalidIdleTimeout", err.Error())
+		return false, err
+	}
+	idle, err := c.idleTime(funcObj)
+	if err != nil {
+		// The function may not expose metrics, keep it running
+		c.logger.Warningf("Unable to get the number of calls of the function %s: %v", funcObj.ObjectMeta.Name, err)
+		return false, nil
+	}
+	if idle < idleTimeout {
+		return false, nil
+	}
+
+	activator, err := c.activatorEndpoints()
+	if err != nil {
+		c.logger.Errorf("Unable to scale the function %s to zero, the activator is not available: %v", funcObj.ObjectMeta.Name, err)
+		return false, nil
+	}
+	err = c.redirectToActivator(funcObj, activator)
+	if err != nil {
+		c.logger.Errorf("Unable to scale the function %s to zero: %v", funcObj.ObjectMeta.Name, err)
+		// Keep the pods running until the activator is ready to receive the requests
+		restoreErr := c.ensureResource(funcObj, "Service", funcObj.ObjectMeta.Name, func() error {
+			return utils.RestoreFuncService(c.clientset, funcObj)
+		})
+		if restoreErr != nil {
+			return false, restoreErr
+		}
+		return false, nil
+	}
+	c.logger.Infof("Function %s has been idle for %v, scaling it to zero", funcObj.ObjectMeta.Name, idle)
+	c.forgetActivity(funcObj)
+	return true, nil
+}
+
+// resolveTraffic returns the traffic targets of the function with the revision numbers resolved.
+// Targets pointing to the same revision are merged and targets without traffic are discarded
+func resolveTraffic(funcObj *kubelessApi.Function, revisions []*kubelessApi.FunctionRevision) ([]kubelessApi.FunctionTrafficTarget, error) {
+	existing := map[int64]bool{}
+	for _, r := range revisions {
+		existing[r.Spec.Revision] = true
+	}
+	resolved := []kubelessApi.FunctionTrafficTarget{}
+	index := map[int64]int{}
+	total := int32(0)
+	for _, t := range funcObj.Spec.Traffic {
+		if t.Percent < 0 || t.Percent > 100 {
+			return nil, fmt.Errorf("Invalid traffic percentage %d", t.Percent)
+		}
+		total += t.Percent
+		revision := t.Revision
+		if t.LatestRevision {
+			revision = funcObj.Status.Revision
+		}
+		if !existing[revision] {
+			return nil, fmt.Errorf("Revision %d of function %s not found", revision, funcObj.ObjectMeta.Name)
+		}
+		if t.Percent == 0 {
+			continue
+		}
+		if i, ok := index[revision]; ok {
+			resolved[i].Percent += t.Percent
+			continue
+		}
+		index[revision] = len(resolved)
+		resolved = append(resolved, kubelessApi.FunctionTrafficTarget{Revision: revision, Percent: t.Percent})
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("The traffic percentages of function %s sum %d, expecting 100", funcObj.ObjectMeta.Name, total)
+	}
+	return resolved, nil
+}
+
+// revisionFunction returns a function object with the spec of the given revision
+// that can be deployed along with other revisions of the same function
+func (c *FunctionController) revisionFunction(funcObj *kubelessApi.Function, revision *kubelessApi.FunctionRevision) (*kubelessApi.Function, error) {
+	revFunc := funcObj.DeepCopy()
+	revFunc.ObjectMeta.Name = fmt.Sprintf("%s-r%d", funcObj.ObjectMeta.Name, revision.Spec.Revision)
+	revFunc.Spec = *revision.Spec.Function.DeepCopy()
+	labels := map[string]string{}
+	for k, v := range funcObj.ObjectMeta.Labels {
+		labels[k] = v
+	}
+	labels["function"] = revFunc.ObjectMeta.Name
+	labels[revisionOfLabel] = funcObj.ObjectMeta.Name
+	revFunc.ObjectMeta.Labels = labels
+	if len(revFunc.Spec.ServiceSpec.Ports) > 0 {
+		// The service of the revision should only select its own pods
+		revFunc.Spec.ServiceSpec.Selector = map[string]string{}
+		for k, v := range labels {
+			revFunc.Spec.ServiceSpec.Selector[k] = v
+		}
+	}
+	err := c.verifySignature(revFunc)
+	if err != nil {
+		return nil, err
+	}
+	err = c.mergeDeploymentConfig(revFunc)
+	if err != nil {
+		return nil, err
+	}
+	return revFunc, nil
+}
+
+// ensureTrafficSplit deploys the revisions of the function that receive traffic and a router
+// that splits the requests between them. Returns the name of the deployments created
+func (c *FunctionController) ensureTrafficSplit(funcObj *kubelessApi.Function, or []metav1.OwnerReference) ([]string, error) {
+	revisions, err := utils.GetFunctionRevisions(c.kubelessclient, funcObj.ObjectMeta.Name, funcObj.ObjectMeta.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	traffic, err := resolveTraffic(funcObj, revisions)
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "InvalidTraffic", err.Error())
+		return nil, err
+	}
+
+	deployments := []string{funcObj.ObjectMeta.Name}
+	active := map[string]bool{}
+	targets := []utils.FunctionRouterTarget{}
+	for _, t := range traffic {
+		var revision *kubelessApi.FunctionRevision
+		for _, r := range revisions {
+			if r.Spec.Revision == t.Revision {
+				revision = r
+			}
+		}
+		revFunc, err := c.revisionFunction(funcObj, revision)
+		if err == nil {
+			err = c.ensureResource(funcObj, "ConfigMap", revFunc.ObjectMeta.Name, func() error {
+				return utils.EnsureFuncConfigMap(c.clientset, revFunc, or, c.langRuntime)
+			})
+		}
+		if err == nil {
+			err = c.ensureResource(funcObj, "Service", revFunc.ObjectMeta.Name, func() error {
+				return utils.EnsureFuncService(c.clientset, revFunc, or)
+			})
+		}
+		if err == nil {
+			var prebuiltImage string
+			var imageReady bool
+			prebuiltImage, imageReady, err = c.ensureFunctionImage(revFunc, funcObj, or)
+			if err == nil && !imageReady {
+				// Keep the current deployments until the image of the revision is built
+				c.logger.Infof("Waiting for the image of revision %d of function %s", t.Revision, funcObj.ObjectMeta.Name)
+				utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionImageBuilt, corev1.ConditionFalse, buildInProgressReason, fmt.Sprintf("Building the image of revision %d", t.Revision))
+				return nil, nil
+			}
+			if err == nil {
+				err = c.ensureResource(funcObj, "Deployment", revFunc.ObjectMeta.Name, func() error {
+					return utils.EnsureFuncDeployment(c.clientset, revFunc, or, c.langRuntime, prebuiltImage, c.config.Data["provision-image"], c.imagePullSecrets)
+				})
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("Unable to deploy revision %d: %v", t.Revision, err)
+			utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "RevisionDeploymentError", err.Error())
+			return nil, err
+		}
+		deployments = append(deployments, revFunc.ObjectMeta.Name)
+		active[revFunc.ObjectMeta.Name] = true
+		targets = append(targets, utils.FunctionRouterTarget{
+			Revision: t.Revision,
+			URL:      utils.FunctionServiceURL(revFunc),
+			Weight:   t.Percent,
+		})
+	}
+
+	routerImage := c.config.Data["router-image"]
+	if routerImage == "" {
+		routerImage = defaultRouterImage
+	}
+	err = c.ensureResource(funcObj, "Deployment", funcObj.ObjectMeta.Name, func() error {
+		return utils.EnsureFuncRouterDeployment(c.clientset, funcObj, or, routerImage, targets, c.imagePullSecrets)
+	})
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "DeploymentError", err.Error())
+		return nil, err
+	}
+	funcObj.Status.Traffic = traffic
+
+	// Remove the revisions that don't receive traffic anymore
+	err = c.deleteRevisionResources(funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Name, active)
+	if err != nil {
+		return nil, err
+	}
+	return deployments, nil
+}
+
+// deleteRevisionResources removes the deployments, services and configmaps of the revisions
+// of a function, except the ones in keep
+func (c *FunctionController) deleteRevisionResources(ns, name string, keep map[string]bool) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("created-by=kubeless,%s=%s", revisionOfLabel, name),
+	}
+	deletePolicy := metav1.DeletePropagationBackground
+	deployments, err := c.clientset.AppsV1().Deployments(ns).List(listOptions)
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if !keep[d.ObjectMeta.Name] {
+			err = c.clientset.AppsV1().Deployments(ns).Delete(d.ObjectMeta.Name, &metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+			c.forgetResource("Deployment", ns, d.ObjectMeta.Name)
+		}
+	}
+	services, err := c.clientset.CoreV1().Services(ns).List(listOptions)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services.Items {
+		if !keep[svc.ObjectMeta.Name] {
+			err = c.clientset.CoreV1().Services(ns).Delete(svc.ObjectMeta.Name, &metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+			c.forgetResource("Service", ns, svc.ObjectMeta.Name)
+		}
+	}
+	configMaps, err := c.clientset.CoreV1().ConfigMaps(ns).List(listOptions)
+	if err != nil {
+		return err
+	}
+	for _, cm := range configMaps.Items {
+		if !keep[cm.ObjectMeta.Name] {
+			err = c.clientset.CoreV1().ConfigMaps(ns).Delete(cm.ObjectMeta.Name, &metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+			c.forgetResource("ConfigMap", ns, cm.ObjectMeta.Name)
+		}
+	}
+	return nil
+}
+
+// verifySignature checks that the function is signed by one of the keys that the trust policy of the
+// kubeless configuration allows in its namespace. The functions of namespaces without keys are not verified
+func (c *FunctionController) verifySignature(funcObj *kubelessApi.Function) error {
+	keys, err := utils.TrustedKeys(c.config, funcObj.ObjectMeta.Namespace)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		utils.FunctionObjRemoveCondition(funcObj, kubelessApi.FunctionSignatureVerified)
+		return nil
+	}
+	err = utils.VerifyFunctionSignature(&funcObj.Spec, keys)
+	if err != nil {
+		return fmt.Errorf("Untrusted function: %v", err)
+	}
+	utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionSignatureVerified, corev1.ConditionTrue, "SignatureVerified", "The function is signed by a trusted key")
+	return nil
+}
+
+// ensureK8sResources creates/updates k8s objects (deploy, svc, configmap) for the function
+// and records the result of each step in the conditions of the function status
+func (c *FunctionController) ensureK8sResources(funcObj *kubelessApi.Function) error {
+	if len(funcObj.ObjectMeta.Labels) == 0 {
+		funcObj.ObjectMeta.Labels = make(map[string]string)
+	}
+	funcObj.ObjectMeta.Labels["function"] = funcObj.ObjectMeta.Name
+
+	// Nothing that runs the code of the function is created if it isn't signed by a trusted key
+	err := c.verifySignature(funcObj)
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionSignatureVerified, corev1.ConditionFalse, untrustedSignatureReason, err.Error())
+		return err
+	}
+
+	err = c.mergeDeploymentConfig(funcObj)
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionConfigReady, corev1.ConditionFalse, "InvalidDeploymentConfig", err.Error())
+		return err
+	}
+
+	or, err := utils.GetOwnerReference(funcKind, funcAPIVersion, funcObj.Name, funcObj.UID)
+	if err != nil {
+		return err
+	}
+
+	err = c.ensureResource(funcObj, "ConfigMap", funcObj.ObjectMeta.Name, func() error {
+		return utils.EnsureFuncConfigMap(c.clientset, funcObj, or, c.langRuntime)
+	})
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionConfigReady, corev1.ConditionFalse, "ConfigMapError", err.Error())
+		return err
+	}
+
+	err = c.ensureResource(funcObj, "Service", funcObj.ObjectMeta.Name, func() error {
+		return utils.EnsureFuncService(c.clientset, funcObj, or)
+	})
+	if err != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionConfigReady, corev1.ConditionFalse, "ServiceError", err.Error())
+		return err
 	}
+	utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionConfigReady, corev1.ConditionTrue, "ConfigCreated", "ConfigMap and Service are up to date")
 
-	err = utils.EnsureFuncDeployment(c.clientset, funcObj, or, c.langRuntime, prebuiltImage, c.config.Data["provision-image"], c.imagePullSecrets)
+	scaledToZero, err := c.ensureScaleToZero(funcObj)
 	if err != nil {
 		return err
 	}
 
+	if len(funcObj.Spec.Traffic) > 0 {
+		deployments, err := c.ensureTrafficSplit(funcObj, or)
+		if err != nil {
+			return err
+		}
+		if deployments == nil {
+			// An image is being built, the function is processed again once the build job finishes
+			return nil
+		}
+		err = c.checkDeploymentAvailable(funcObj, deployments...)
+		if err != nil {
+			return err
+		}
+	} else {
+		dpmFunc := funcObj
+		if scaledToZero {
+			dpmFunc = funcObj.DeepCopy()
+			replicas := int32(0)
+			dpmFunc.Spec.Deployment.Spec.Replicas = &replicas
+		}
+		prebuiltImage, imageReady, err := c.ensureFunctionImage(funcObj, funcObj, or)
+		if err != nil {
+			return err
+		}
+		if !imageReady {
+			// Keep the current deployment running until the new image is available in the registry,
+			// the function is processed again once the build job finishes
+			c.logger.Infof("Waiting for the image of function %s to be built", funcObj.ObjectMeta.Name)
+			return nil
+		}
+		err = c.ensureResource(funcObj, "Deployment", funcObj.ObjectMeta.Name, func() error {
+			return utils.EnsureFuncDeployment(c.clientset, dpmFunc, or, c.langRuntime, prebuiltImage, c.config.Data["provision-image"], c.imagePullSecrets)
+		})
+		if err != nil {
+			utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "DeploymentError", err.Error())
+			return err
+		}
+		// Remove the resources of a previous traffic split
+		funcObj.Status.Traffic = nil
+		err = c.deleteRevisionResources(funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Name, nil)
+		if err != nil {
+			return err
+		}
+		if scaledToZero {
+			utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionTrue, scaledToZeroReason, "The function is idle, it will be scaled up with the next request")
+		} else {
+			err = c.checkDeploymentAvailable(funcObj, funcObj.ObjectMeta.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if funcObj.Spec.HorizontalPodAutoscaler.Name != "" && funcObj.Spec.HorizontalPodAutoscaler.Spec.ScaleTargetRef.Name != "" {
 		funcObj.Spec.HorizontalPodAutoscaler.OwnerReferences = or
 		if funcObj.Spec.HorizontalPodAutoscaler.Spec.Metrics[0].Type == v2beta1.ObjectMetricSourceType {
 			// A service monitor is needed when the metric is an object
 			err = utils.CreateServiceMonitor(*c.smclient, funcObj, funcObj.ObjectMeta.Namespace, or)
 			if err != nil {
+				utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionAutoscalerReady, corev1.ConditionFalse, "ServiceMonitorError", err.Error())
 				return err
 			}
 		}
-		err = utils.CreateAutoscale(c.clientset, funcObj.Spec.HorizontalPodAutoscaler)
-		if err != nil && k8sErrors.IsAlreadyExists(err) {
-			err = utils.UpdateAutoscale(c.clientset, funcObj.Spec.HorizontalPodAutoscaler)
-		}
+		err = c.ensureResource(funcObj, "HorizontalPodAutoscaler", funcObj.Spec.HorizontalPodAutoscaler.Name, func() error {
+			err := utils.CreateAutoscale(c.clientset, funcObj.Spec.HorizontalPodAutoscaler)
+			if err != nil && k8sErrors.IsAlreadyExists(err) {
+				err = utils.UpdateAutoscale(c.clientset, funcObj.Spec.HorizontalPodAutoscaler)
+			}
+			return err
+		})
 		if err != nil {
+			utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionAutoscalerReady, corev1.ConditionFalse, "AutoscalerError", err.Error())
 			return err
 		}
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionAutoscalerReady, corev1.ConditionTrue, "AutoscalerCreated", "HorizontalPodAutoscaler is up to date")
 	} else {
 		// HorizontalPodAutoscaler doesn't exists, try to delete if it already existed
 		err = c.deleteAutoscale(funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Name)
 		if err != nil && !k8sErrors.IsNotFound(err) {
 			return err
 		}
+		utils.FunctionObjRemoveCondition(funcObj, kubelessApi.FunctionAutoscalerReady)
+	}
+	return nil
+}
+
+// ensureResource runs ensure to create or update a resource of the function and emits an
+// event if the resource has been created or the fields managed by the controller have changed.
+// If the resource doesn't match the state in which the controller left it, it reports the drift
+// in the status of the function
+func (c *FunctionController) ensureResource(funcObj *kubelessApi.Function, kind, name string, ensure func() error) error {
+	key := fmt.Sprintf("%s/%s/%s", kind, funcObj.ObjectMeta.Namespace, name)
+	before, err := c.resourceState(kind, funcObj.ObjectMeta.Namespace, name)
+	if err != nil {
+		return err
+	}
+	err = ensure()
+	if err != nil {
+		return err
+	}
+	after, err := c.resourceState(kind, funcObj.ObjectMeta.Namespace, name)
+	if err != nil {
+		return err
+	}
+
+	c.appliedMutex.Lock()
+	applied, known := c.applied[key]
+	c.applied[key] = after
+	c.appliedMutex.Unlock()
+	if known && !apiequality.Semantic.DeepEqual(applied, before) {
+		change := "modified"
+		if before == nil {
+			change = "deleted"
+		}
+		c.logger.Warningf("%s %s of function %s was %s outside of the controller, restoring it", kind, name, funcObj.ObjectMeta.Name, change)
+		c.recorder.Eventf(funcObj, corev1.EventTypeWarning, "DriftCorrected", "%s %s was %s outside of the controller, restored it", kind, name, change)
+		driftTotal.WithLabelValues(kind).Inc()
+		funcObj.Status.LastDrift = &kubelessApi.FunctionDrift{
+			Kind:    kind,
+			Name:    name,
+			Deleted: before == nil,
+			Time:    metav1.Now(),
+		}
+	}
+
+	if before == nil {
+		c.recorder.Eventf(funcObj, corev1.EventTypeNormal, kind+"Created", "Created %s %s", kind, name)
+	} else if !apiequality.Semantic.DeepEqual(before, after) {
+		c.recorder.Eventf(funcObj, corev1.EventTypeNormal, kind+"Updated", "Updated %s %s", kind, name)
+	}
+	return nil
+}
+
+// forgetResource discards the state of a resource deleted by the controller
+func (c *FunctionController) forgetResource(kind, ns, name string) {
+	c.appliedMutex.Lock()
+	defer c.appliedMutex.Unlock()
+	delete(c.applied, fmt.Sprintf("%s/%s/%s", kind, ns, name))
+}
+
+// resourceState returns the fields managed by the controller of a resource or nil if it doesn't exist
+func (c *FunctionController) resourceState(kind, ns, name string) (interface{}, error) {
+	var state interface{}
+	var err error
+	switch kind {
+	case "ConfigMap":
+		var cm *corev1.ConfigMap
+		if cm, err = c.clientset.CoreV1().ConfigMaps(ns).Get(name, metav1.GetOptions{}); err == nil {
+			state = []interface{}{cm.ObjectMeta.Labels, cm.Data}
+		}
+	case "Service":
+		var svc *corev1.Service
+		if svc, err = c.clientset.CoreV1().Services(ns).Get(name, metav1.GetOptions{}); err == nil {
+			state = []interface{}{svc.ObjectMeta.Labels, svc.Spec.Ports, svc.Spec.Selector}
+		}
+	case "Deployment":
+		var dpm *appsv1.Deployment
+		if dpm, err = c.clientset.AppsV1().Deployments(ns).Get(name, metav1.GetOptions{}); err == nil {
+			// The replicas are managed by the autoscalers
+			spec := dpm.Spec.DeepCopy()
+			spec.Replicas = nil
+			state = []interface{}{dpm.ObjectMeta.Labels, *spec}
+		}
+	case "HorizontalPodAutoscaler":
+		var hpa *v2beta1.HorizontalPodAutoscaler
+		if hpa, err = c.clientset.AutoscalingV2beta1().HorizontalPodAutoscalers(ns).Get(name, metav1.GetOptions{}); err == nil {
+			state = hpa.Spec
+		}
+	default:
+		return nil, fmt.Errorf("Unknown resource kind %s", kind)
+	}
+	if k8sErrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return state, err
+}
+
+// checkDeploymentAvailable sets the DeploymentAvailable condition of the function based on the status
+// of the given deployments and, if one of them is not available, the state of its pods
+func (c *FunctionController) checkDeploymentAvailable(funcObj *kubelessApi.Function, deployments ...string) error {
+	var available *appsv1.DeploymentCondition
+	for _, name := range deployments {
+		dpm, err := c.clientset.AppsV1().Deployments(funcObj.ObjectMeta.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "DeploymentError", err.Error())
+			return err
+		}
+		available = nil
+		if dpm.Status.ObservedGeneration >= dpm.ObjectMeta.Generation &&
+			dpm.Spec.Replicas != nil && dpm.Status.UpdatedReplicas == *dpm.Spec.Replicas {
+			for i := range dpm.Status.Conditions {
+				if dpm.Status.Conditions[i].Type == appsv1.DeploymentAvailable && dpm.Status.Conditions[i].Status == corev1.ConditionTrue {
+					available = &dpm.Status.Conditions[i]
+				}
+			}
+		}
+		if available != nil {
+			continue
+		}
+
+		reason := "DeploymentInProgress"
+		message := fmt.Sprintf("%d/%d replicas ready", dpm.Status.ReadyReplicas, dpm.Status.Replicas)
+		if name != funcObj.ObjectMeta.Name {
+			message = fmt.Sprintf("%s: %s", name, message)
+		}
+		pods, err := c.clientset.CoreV1().Pods(funcObj.ObjectMeta.Namespace).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("function=%s", name),
+		})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			if waiting := podWaitingState(pod); waiting != nil {
+				reason = waiting.Reason
+				message = waiting.Message
+				break
+			}
+		}
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, reason, message)
+		return nil
+	}
+	if available != nil {
+		utils.FunctionObjSetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionTrue, available.Reason, available.Message)
+	}
+	return nil
+}
+
+// podWaitingState returns the state of the first container of the pod that is waiting for an error
+func podWaitingState(pod corev1.Pod) *corev1.ContainerStateWaiting {
+	statuses := []corev1.ContainerStatus{}
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if s.State.Waiting != nil && s.State.Waiting.Reason != "" &&
+			s.State.Waiting.Reason != "ContainerCreating" && s.State.Waiting.Reason != "PodInitializing" {
+			return s.State.Waiting
+		}
 	}
 	return nil
 }
@@ -396,6 +1612,7 @@ func (c *FunctionController) deleteAutoscale(ns, name string) error {
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
+	c.forgetResource("HorizontalPodAutoscaler", ns, name)
 	return nil
 }
 
@@ -419,6 +1636,9 @@ func (c *FunctionController) deleteK8sResources(ns, name string) error {
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
+	c.forgetResource("Deployment", ns, name)
+	c.forgetResource("Service", ns, name)
+	c.forgetResource("ConfigMap", ns, name)
 
 	// delete service monitor
 	err = c.deleteAutoscale(ns, name)
@@ -426,6 +1646,12 @@ func (c *FunctionController) deleteK8sResources(ns, name string) error {
 		return err
 	}
 
+	// delete the resources of the revisions that were receiving traffic
+	err = c.deleteRevisionResources(ns, name, nil)
+	if err != nil {
+		return err
+	}
+
 	// delete build job
 	err = c.clientset.BatchV1().Jobs(ns).DeleteCollection(&metav1.DeleteOptions{}, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("created-by=kubeless,function=%s", name),
@@ -446,15 +1672,27 @@ func functionObjChanged(oldFunctionObj, newFunctionObj *kubelessApi.Function) bo
 	if oldFunctionObj.ResourceVersion == newFunctionObj.ResourceVersion {
 		return false
 	}
-	newSpec := &oldFunctionObj.Spec
-	oldSpec := &newFunctionObj.Spec
+	if !apiequality.Semantic.DeepEqual(oldFunctionObj.Spec.Traffic, newFunctionObj.Spec.Traffic) ||
+		oldFunctionObj.Spec.IdleTimeout != newFunctionObj.Spec.IdleTimeout {
+		return true
+	}
+	return functionSpecChanged(&oldFunctionObj.Spec, &newFunctionObj.Spec)
+}
 
+// functionSpecChanged returns true if the differences between the given specs
+// require to redeploy the function
+func functionSpecChanged(oldSpec, newSpec *kubelessApi.FunctionSpec) bool {
 	if newSpec.Function != oldSpec.Function ||
 		// compare checksum since the url content type uses Function field to pass the URL for the function
 		// comparing the checksum ensures that if the function code has changed but the URL remains the same, the function will get redeployed
 		newSpec.Checksum != oldSpec.Checksum ||
+		newSpec.ChecksumManifest != oldSpec.ChecksumManifest ||
 		newSpec.Handler != oldSpec.Handler ||
 		newSpec.FunctionContentType != oldSpec.FunctionContentType ||
+		newSpec.FunctionPath != oldSpec.FunctionPath ||
+		newSpec.FunctionSecret != oldSpec.FunctionSecret ||
+		newSpec.Signature != oldSpec.Signature ||
+		newSpec.Runtime != oldSpec.Runtime ||
 		newSpec.Deps != oldSpec.Deps ||
 		newSpec.Timeout != oldSpec.Timeout {
 		return true
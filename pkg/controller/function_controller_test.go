@@ -1,20 +1,39 @@
 package controller
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ghodss/yaml"
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	fFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
+	kv1beta1 "github.com/kubeless/kubeless/pkg/client/informers/externalversions/kubeless/v1beta1"
 	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2beta1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func findAction(fake *fake.Clientset, verb, resource string) ktesting.Action {
@@ -168,6 +187,281 @@ func TestEnsureK8sResourcesWithDeploymentDefinitionFromConfigMap(t *testing.T) {
 	}
 }
 
+func TestEnsureK8sResourcesEvents(t *testing.T) {
+	funcObj := testFunc()
+	clientset := fake.NewSimpleClientset()
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images": testRuntimeImages(),
+	})
+
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	expected := []string{
+		"Normal ConfigMapCreated Created ConfigMap foo",
+		"Normal ServiceCreated Created Service foo",
+		"Normal DeploymentCreated Created Deployment foo",
+	}
+	if events := recordedEvents(controller); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expecting events %v, received %v", expected, events)
+	}
+
+	// Nothing changes if the function is processed again
+	if err := controller.ensureK8sResources(testFunc()); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if events := recordedEvents(controller); len(events) != 0 {
+		t.Errorf("Expecting no events, received %v", events)
+	}
+
+	funcObj = testFunc()
+	funcObj.Spec.Function = "new function"
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if events := recordedEvents(controller); len(events) == 0 || events[0] != "Normal ConfigMapUpdated Updated ConfigMap foo" {
+		t.Errorf("Expecting a ConfigMapUpdated event, received %v", events)
+	}
+}
+
+func TestEnsureK8sResourcesDrift(t *testing.T) {
+	funcObj := testFunc()
+	clientset := fake.NewSimpleClientset()
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images": testRuntimeImages(),
+	})
+
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	recordedEvents(controller)
+
+	// Modify the configmap and delete the service of the function
+	cm, _ := clientset.CoreV1().ConfigMaps(funcObj.Namespace).Get("foo", metav1.GetOptions{})
+	cm.Data = map[string]string{"handler": "edited"}
+	clientset.CoreV1().ConfigMaps(funcObj.Namespace).Update(cm)
+	clientset.CoreV1().Services(funcObj.Namespace).Delete("foo", &metav1.DeleteOptions{})
+
+	funcObj = testFunc()
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	expected := []string{
+		"Warning DriftCorrected ConfigMap foo was modified outside of the controller, restored it",
+		"Normal ConfigMapUpdated Updated ConfigMap foo",
+		"Warning DriftCorrected Service foo was deleted outside of the controller, restored it",
+		"Normal ServiceCreated Created Service foo",
+	}
+	if events := recordedEvents(controller); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expecting events %v, received %v", expected, events)
+	}
+	cm, _ = clientset.CoreV1().ConfigMaps(funcObj.Namespace).Get("foo", metav1.GetOptions{})
+	if cm.Data["handler"] != "foo.bar" {
+		t.Errorf("Expecting the configmap to be restored, received %v", cm.Data)
+	}
+	drift := funcObj.Status.LastDrift
+	if drift == nil || drift.Kind != "Service" || drift.Name != "foo" || !drift.Deleted {
+		t.Errorf("Expecting the drift of the service in the status, received %v", drift)
+	}
+
+	// The changes made by the controller are not reported as drift
+	funcObj = testFunc()
+	funcObj.Spec.Function = "new function"
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if funcObj.Status.LastDrift != nil {
+		t.Errorf("Unexpected drift %v", funcObj.Status.LastDrift)
+	}
+}
+
+// fakeLogsRetriever returns the same logs for every container
+type fakeLogsRetriever struct {
+	logs string
+}
+
+func (r *fakeLogsRetriever) GetPodLogs(c kubernetes.Interface, ns, podName string, opts *v1.PodLogOptions) ([]byte, error) {
+	return []byte(r.logs), nil
+}
+
+func TestEnsureK8sResourcesBuildJob(t *testing.T) {
+	// The registry doesn't contain any image
+	registrySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+			return
+		}
+		w.Write([]byte(`{"name": "user/foo", "tags": []}`))
+	}))
+	defer registrySrv.Close()
+
+	funcObj := testFunc()
+	funcObj.Spec.Deps = ""
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeless-registry-credentials", Namespace: funcObj.Namespace},
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(fmt.Sprintf(`{"auths": {"%s/v2/": {"username": "user", "password": "pass"}}}`, registrySrv.URL)),
+		},
+	})
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images":    testRuntimeImages(),
+		"enable-build-step": "true",
+		"builder-image":     "kubeless/builder",
+		"provision-image":   "kubeless/unzip",
+	})
+	controller.logsRetriever = &fakeLogsRetriever{logs: "\nERROR: Unable to install the dependencies\n"}
+	kubelessClient := fFake.NewSimpleClientset()
+	controller.kubelessclient = kubelessClient
+	getBuild := func() *kubelessApi.FunctionBuild {
+		builds, _ := kubelessClient.KubelessV1beta1().FunctionBuilds(funcObj.Namespace).List(metav1.ListOptions{})
+		if len(builds.Items) != 1 {
+			t.Fatalf("Expecting a function build, found %d", len(builds.Items))
+		}
+		return builds.Items[0]
+	}
+
+	// The deployment is not created while the image is being built
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get("foo", metav1.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("Expecting the deployment to wait for the image, received %v", err)
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionImageBuilt); c == nil || c.Reason != buildInProgressReason {
+		t.Errorf("Expecting the image to be building, received %v", c)
+	}
+	jobs, _ := clientset.BatchV1().Jobs(funcObj.Namespace).List(metav1.ListOptions{})
+	if len(jobs.Items) != 1 {
+		t.Fatalf("Expecting a build job, found %d", len(jobs.Items))
+	}
+	job := jobs.Items[0]
+	build := getBuild()
+	if build.ObjectMeta.Name != job.Name || build.Status.Job != job.Name || build.Status.Phase != kubelessApi.FunctionBuildPending {
+		t.Errorf("Expecting a pending build of the job %s, received %+v", job.Name, build)
+	}
+	if build.Spec.Function != "foo" || build.Spec.Image != strings.TrimPrefix(registrySrv.URL, "http://")+"/user/foo:"+strings.TrimPrefix(build.Spec.Checksum, "sha256:") {
+		t.Errorf("Unexpected build spec %+v", build.Spec)
+	}
+
+	// The failed container and its logs are reported in the status
+	startTime := metav1.Now()
+	job.Status.StartTime = &startTime
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	clientset.BatchV1().Jobs(funcObj.Namespace).Update(&job)
+	clientset.CoreV1().Pods(funcObj.Namespace).Create(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-abcde", Namespace: funcObj.Namespace, Labels: map[string]string{"job-name": job.Name}},
+		Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "prepare", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}},
+				{Name: "install", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 2}}},
+			},
+		},
+	})
+	funcObj = testFunc()
+	funcObj.Spec.Deps = ""
+	err := controller.ensureK8sResources(funcObj)
+	if _, ok := err.(*buildJobError); !ok {
+		t.Fatalf("Expecting a build job error, received %v", err)
+	}
+	expected := fmt.Sprintf("Image build job %s failed in the container install (exit code 2): Job has reached the specified backoff limit\nERROR: Unable to install the dependencies", job.Name)
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionImageBuilt); c == nil || c.Reason != "BuildFailed" || c.Message != expected {
+		t.Errorf("Expecting the message %q, received %v", expected, c)
+	}
+	if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get("foo", metav1.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("Expecting no deployment after the build failure, received %v", err)
+	}
+	if build := getBuild(); build.Status.Phase != kubelessApi.FunctionBuildFailed || build.Status.Message != expected || build.Status.StartTime == nil {
+		t.Errorf("Expecting a failed build, received %+v", build.Status)
+	}
+
+	// The function is deployed once the job succeeds
+	completionTime := metav1.Now()
+	job.Status.CompletionTime = &completionTime
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+	clientset.BatchV1().Jobs(funcObj.Namespace).Update(&job)
+	funcObj = testFunc()
+	funcObj.Spec.Deps = ""
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	dpm, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expecting the deployment to be created: %v", err)
+	}
+	image := dpm.Spec.Template.Spec.Containers[0].Image
+	if image != build.Spec.Image {
+		t.Errorf("Expecting the built image %s, received %s", build.Spec.Image, image)
+	}
+	if build := getBuild(); build.Status.Phase != kubelessApi.FunctionBuildSucceeded || build.Status.Digest != "sha256:abc" || build.Status.CompletionTime == nil || build.Status.Message != "" {
+		t.Errorf("Expecting a successful build, received %+v", build.Status)
+	}
+}
+
+func TestEnsureFunctionImageOfRevision(t *testing.T) {
+	// The registry doesn't contain any image
+	registrySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "user/foo", "tags": []}`))
+	}))
+	defer registrySrv.Close()
+
+	funcObj := testFunc()
+	funcObj.Spec.Deps = ""
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeless-registry-credentials", Namespace: funcObj.Namespace},
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(fmt.Sprintf(`{"auths": {"%s/v2/": {"username": "user", "password": "pass"}}}`, registrySrv.URL)),
+		},
+	})
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images":    testRuntimeImages(),
+		"enable-build-step": "true",
+		"builder-image":     "kubeless/builder",
+		"provision-image":   "kubeless/unzip",
+	})
+	controller.kubelessclient = fFake.NewSimpleClientset()
+	revFunc := funcObj.DeepCopy()
+	revFunc.ObjectMeta.Name = "foo-r1"
+	or, _ := utils.GetOwnerReference("Function", "kubeless.io/v1beta1", funcObj.Name, funcObj.UID)
+
+	// The image is built for the revision but reported in the function
+	_, ready, err := controller.ensureFunctionImage(revFunc, funcObj, or)
+	if err != nil || ready {
+		t.Fatalf("Expecting the image to be building, received %v (ready: %v)", err, ready)
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionImageBuilt); c == nil || c.Reason != buildInProgressReason {
+		t.Errorf("Expecting the function to report the build, received %v", c)
+	}
+	if c := utils.FunctionObjGetCondition(revFunc, kubelessApi.FunctionImageBuilt); c != nil {
+		t.Errorf("Unexpected condition in the revision %v", c)
+	}
+	if events := recordedEvents(controller); len(events) != 1 || !strings.HasPrefix(events[0], "Normal BuildStarted") {
+		t.Errorf("Expecting a BuildStarted event, received %v", events)
+	}
+	builds, _ := controller.kubelessclient.KubelessV1beta1().FunctionBuilds(funcObj.Namespace).List(metav1.ListOptions{})
+	if len(builds.Items) != 1 || builds.Items[0].Spec.Function != "foo-r1" {
+		t.Errorf("Expecting a build of the revision, received %v", builds.Items)
+	}
+}
+
+func TestEnqueueOwner(t *testing.T) {
+	controller := testController(fake.NewSimpleClientset(), "default", map[string]string{})
+	controller.queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer controller.queue.ShutDown()
+
+	or, _ := utils.GetOwnerReference("Function", "kubeless.io/v1beta1", "foo", "uid")
+	owned := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "myns", OwnerReferences: or}}
+	controller.enqueueOwner(owned)
+	controller.enqueueOwner(cache.DeletedFinalStateUnknown{Key: "myns/foo", Obj: owned})
+	controller.enqueueOwner(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "myns"}})
+
+	if controller.queue.Len() != 1 {
+		t.Fatalf("Expecting only the owner function in the queue, found %d items", controller.queue.Len())
+	}
+	if key, _ := controller.queue.Get(); key != "myns/foo" {
+		t.Errorf("Expecting myns/foo, received %v", key)
+	}
+}
+
 func TestEnsureK8sResourcesWithDeploymentDefinitionFromConfigMapUnknownKey(t *testing.T) {
 	funcObj := testFunc()
 	deploymentConfigData := `{
@@ -243,6 +537,511 @@ func TestEnsureK8sResourcesWithLivenessProbeFromConfigMap(t *testing.T) {
 
 }
 
+func TestEnsureK8sResourcesConditions(t *testing.T) {
+	funcObj := testFunc()
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo-1234",
+			Namespace: funcObj.Namespace,
+			Labels:    map[string]string{"function": funcObj.Name},
+		},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name: "foo",
+					State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{
+							Reason:  "CrashLoopBackOff",
+							Message: "Back-off restarting failed container",
+						},
+					},
+				},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images": testRuntimeImages(),
+	})
+
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	for _, condType := range []kubelessApi.FunctionConditionType{kubelessApi.FunctionImageBuilt, kubelessApi.FunctionAutoscalerReady} {
+		if c := utils.FunctionObjGetCondition(funcObj, condType); c != nil {
+			t.Errorf("Unexpected condition %v", c)
+		}
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionConfigReady); c == nil || c.Status != v1.ConditionTrue {
+		t.Errorf("Expecting ConfigReady to be true, received %v", c)
+	}
+	c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable)
+	if c == nil || c.Status != v1.ConditionFalse || c.Reason != "CrashLoopBackOff" {
+		t.Errorf("Expecting DeploymentAvailable to be false due to CrashLoopBackOff, received %v", c)
+	}
+	if phase := functionPhase(funcObj, nil); phase != kubelessApi.FunctionPhaseDeploying {
+		t.Errorf("Expecting phase %s, received %s", kubelessApi.FunctionPhaseDeploying, phase)
+	}
+
+	// The deployment becomes available
+	dpm, _ := clientset.AppsV1().Deployments(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	dpm.Status.UpdatedReplicas = *dpm.Spec.Replicas
+	dpm.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentAvailable, Status: v1.ConditionTrue, Reason: "MinimumReplicasAvailable"},
+	}
+	if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).UpdateStatus(dpm); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if phase := functionPhase(funcObj, nil); phase != kubelessApi.FunctionPhaseReady {
+		t.Errorf("Expecting phase %s, received %s", kubelessApi.FunctionPhaseReady, phase)
+	}
+}
+
+func TestEnsureK8sResourcesInvalidConfigCondition(t *testing.T) {
+	funcObj := testFunc()
+	controller := testController(fake.NewSimpleClientset(), funcObj.Namespace, map[string]string{
+		"deployment":     `{"spec": {"unknown": "property"}}`,
+		"runtime-images": testRuntimeImages(),
+	})
+
+	err := controller.ensureK8sResources(funcObj)
+	if err == nil {
+		t.Fatal("Expecting an error parsing the deployment config")
+	}
+	c := utils.FunctionObjFailedCondition(funcObj)
+	if c == nil || c.Type != kubelessApi.FunctionConfigReady || c.Reason != "InvalidDeploymentConfig" {
+		t.Errorf("Expecting ConfigReady to be false, received %v", c)
+	}
+	if phase := functionPhase(funcObj, err); phase != kubelessApi.FunctionPhaseFailed {
+		t.Errorf("Expecting phase %s, received %s", kubelessApi.FunctionPhaseFailed, phase)
+	}
+}
+
+func TestRequeuePeriod(t *testing.T) {
+	tests := []struct {
+		phase       kubelessApi.FunctionPhase
+		idleTimeout string
+		expected    time.Duration
+	}{
+		{kubelessApi.FunctionPhasePending, "", 0},
+		{kubelessApi.FunctionPhaseBuilding, "", statusResyncPeriod},
+		{kubelessApi.FunctionPhaseDeploying, "5m", statusResyncPeriod},
+		{kubelessApi.FunctionPhaseReady, "", 0},
+		{kubelessApi.FunctionPhaseReady, "5m", idleCheckPeriod},
+		// Failed functions wait for a change or the resync of the informer
+		{kubelessApi.FunctionPhaseFailed, "", 0},
+		{kubelessApi.FunctionPhaseFailed, "5m", 0},
+	}
+	for _, tt := range tests {
+		funcObj := testFunc()
+		funcObj.Spec.IdleTimeout = tt.idleTimeout
+		funcObj.Status.Phase = tt.phase
+		if period := requeuePeriod(funcObj); period != tt.expected {
+			t.Errorf("Expecting %v for a %s function with idle timeout %q, received %v", tt.expected, tt.phase, tt.idleTimeout, period)
+		}
+	}
+}
+
+func TestEnsureK8sResourcesSignature(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	publicDER, _ := x509.MarshalPKIXPublicKey(public)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	policy := "default:\n  - |\n    " + strings.Replace(strings.TrimSpace(string(publicPEM)), "\n", "\n    ", -1) + "\n"
+
+	funcObj := testFunc()
+	funcObj.Spec.Checksum = "sha256:6f5ddb6c7e15f0a6d1e4e0c9ef9c0d0f4e1b0a5c1c1a5f1e2e3d4c5b6a7980ab"
+	clientset := fake.NewSimpleClientset()
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images":        testRuntimeImages(),
+		"function-trust-policy": policy,
+	})
+
+	err := controller.ensureK8sResources(funcObj)
+	if err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("Expecting an error for an unsigned function, received %v", err)
+	}
+	c := utils.FunctionObjFailedCondition(funcObj)
+	if c == nil || c.Type != kubelessApi.FunctionSignatureVerified || c.Reason != untrustedSignatureReason {
+		t.Errorf("Expecting SignatureVerified to be false, received %v", c)
+	}
+	if phase := functionPhase(funcObj, err); phase != kubelessApi.FunctionPhaseFailed {
+		t.Errorf("Expecting phase %s, received %s", kubelessApi.FunctionPhaseFailed, phase)
+	}
+	if hasAction(clientset, "create", "deployments") {
+		t.Error("Unexpected deployment of an unsigned function")
+	}
+
+	err = utils.SignFunction(&funcObj.Spec, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionSignatureVerified); c == nil || c.Status != v1.ConditionTrue {
+		t.Errorf("Expecting SignatureVerified to be true, received %v", c)
+	}
+	if !hasAction(clientset, "create", "deployments") {
+		t.Error("Expecting the deployment of the signed function")
+	}
+
+	// The runtime image cannot be replaced in namespaces of the policy, even by a signed function
+	custom := funcObj.DeepCopy()
+	custom.ObjectMeta.Name = "custom"
+	custom.Spec.Deployment.Spec.Template.Spec.Containers = []v1.Container{{Image: "custom/runtime"}}
+	err = utils.SignFunction(&custom.Spec, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = controller.ensureK8sResources(custom)
+	if err == nil || !strings.Contains(err.Error(), "custom images are not allowed") {
+		t.Errorf("Expecting an error for a custom runtime image, received %v", err)
+	}
+
+	// Functions of namespaces out of the policy don't need to be signed
+	funcObj = testFunc()
+	funcObj.ObjectMeta.Namespace = "other"
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionSignatureVerified); c != nil {
+		t.Errorf("Unexpected condition %v", c)
+	}
+}
+
+func TestEnsureFunctionRevision(t *testing.T) {
+	funcObj := testFunc()
+	funcObj.ObjectMeta.Annotations = map[string]string{utils.ChangeCauseAnnotation: "kubeless function deploy"}
+	kubelessClient := fFake.NewSimpleClientset()
+	controller := testController(fake.NewSimpleClientset(), funcObj.Namespace, map[string]string{
+		"function-revision-history-limit": "2",
+	})
+	controller.kubelessclient = kubelessClient
+
+	if err := controller.ensureFunctionRevision(funcObj); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rev, err := kubelessClient.KubelessV1beta1().FunctionRevisions(funcObj.Namespace).Get("foo-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expecting revision foo-1 to be created: %v", err)
+	}
+	if rev.Spec.Revision != 1 || rev.Spec.Function.Function != "function" || rev.ObjectMeta.Annotations[utils.ChangeCauseAnnotation] != "kubeless function deploy" {
+		t.Errorf("Unexpected revision %v", rev)
+	}
+	if len(rev.ObjectMeta.OwnerReferences) != 1 || rev.ObjectMeta.OwnerReferences[0].UID != funcObj.UID {
+		t.Errorf("Revision should be owned by the function: %v", rev.ObjectMeta.OwnerReferences)
+	}
+	if funcObj.Status.Revision != 1 {
+		t.Errorf("Expecting revision 1 in the status, received %d", funcObj.Status.Revision)
+	}
+
+	// The same spec should not generate a new revision
+	if err := controller.ensureFunctionRevision(funcObj); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revisions, _ := utils.GetFunctionRevisions(kubelessClient, funcObj.Name, funcObj.Namespace)
+	if len(revisions) != 1 {
+		t.Errorf("Expecting 1 revision, found %d", len(revisions))
+	}
+
+	// New revisions should respect the history limit
+	for _, content := range []string{"function2", "function3"} {
+		funcObj.Spec.Function = content
+		if err := controller.ensureFunctionRevision(funcObj); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	revisions, _ = utils.GetFunctionRevisions(kubelessClient, funcObj.Name, funcObj.Namespace)
+	if len(revisions) != 2 || revisions[0].Spec.Revision != 2 || revisions[1].Spec.Revision != 3 {
+		t.Errorf("Expecting revisions 2 and 3, found %v", revisions)
+	}
+	if funcObj.Status.Revision != 3 {
+		t.Errorf("Expecting revision 3 in the status, received %d", funcObj.Status.Revision)
+	}
+}
+
+func TestEnsureK8sResourcesTrafficSplit(t *testing.T) {
+	funcObj := testFunc()
+	kubelessClient := fFake.NewSimpleClientset()
+	clientset := fake.NewSimpleClientset()
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images": testRuntimeImages(),
+		"router-image":   "kubeless/function-router:test",
+	})
+	controller.kubelessclient = kubelessClient
+	for _, content := range []string{"function", "function2"} {
+		funcObj.Spec.Function = content
+		if err := controller.ensureFunctionRevision(funcObj); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	funcObj.Spec.Traffic = []kubelessApi.FunctionTrafficTarget{
+		{Revision: 1, Percent: 90},
+		{LatestRevision: true, Percent: 10},
+	}
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	expectedTraffic := []kubelessApi.FunctionTrafficTarget{{Revision: 1, Percent: 90}, {Revision: 2, Percent: 10}}
+	if !reflect.DeepEqual(funcObj.Status.Traffic, expectedTraffic) {
+		t.Errorf("Expecting traffic %v, received %v", expectedTraffic, funcObj.Status.Traffic)
+	}
+	dpm, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expecting the router deployment to be created: %v", err)
+	}
+	if dpm.Spec.Template.Spec.Containers[0].Image != "kubeless/function-router:test" {
+		t.Errorf("Unexpected router image %s", dpm.Spec.Template.Spec.Containers[0].Image)
+	}
+	for _, name := range []string{"foo-r1", "foo-r2"} {
+		if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get(name, metav1.GetOptions{}); err != nil {
+			t.Errorf("Expecting deployment %s to be created: %v", name, err)
+		}
+		svc, err := clientset.CoreV1().Services(funcObj.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Expecting service %s to be created: %v", name, err)
+		} else if svc.Spec.Selector["function"] != name {
+			t.Errorf("Service %s should only select the pods of the revision: %v", name, svc.Spec.Selector)
+		}
+	}
+	cm, _ := clientset.CoreV1().ConfigMaps(funcObj.Namespace).Get("foo-r1", metav1.GetOptions{})
+	if cm == nil || cm.Data["foo.rb"] != "function" {
+		t.Errorf("Expecting the ConfigMap of the revision 1 to contain its code, received %v", cm)
+	}
+
+	// Sending all the traffic to the latest revision removes the resources of the traffic split
+	funcObj.Spec.Traffic = nil
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	if funcObj.Status.Traffic != nil {
+		t.Errorf("Unexpected traffic %v", funcObj.Status.Traffic)
+	}
+	for _, name := range []string{"foo-r1", "foo-r2"} {
+		if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).Get(name, metav1.GetOptions{}); !k8sErrors.IsNotFound(err) {
+			t.Errorf("Expecting deployment %s to be deleted", name)
+		}
+		if _, err := clientset.CoreV1().Services(funcObj.Namespace).Get(name, metav1.GetOptions{}); !k8sErrors.IsNotFound(err) {
+			t.Errorf("Expecting service %s to be deleted", name)
+		}
+	}
+}
+
+func TestResolveTraffic(t *testing.T) {
+	funcObj := testFunc()
+	funcObj.Status.Revision = 2
+	revisions := []*kubelessApi.FunctionRevision{
+		{Spec: kubelessApi.FunctionRevisionSpec{Revision: 1}},
+		{Spec: kubelessApi.FunctionRevisionSpec{Revision: 2}},
+	}
+	tests := []struct {
+		name     string
+		traffic  []kubelessApi.FunctionTrafficTarget
+		expected []kubelessApi.FunctionTrafficTarget
+		err      bool
+	}{
+		{
+			name:     "merges targets of the same revision",
+			traffic:  []kubelessApi.FunctionTrafficTarget{{Revision: 2, Percent: 50}, {LatestRevision: true, Percent: 50}, {Revision: 1, Percent: 0}},
+			expected: []kubelessApi.FunctionTrafficTarget{{Revision: 2, Percent: 100}},
+		},
+		{
+			name:    "percentages should sum 100",
+			traffic: []kubelessApi.FunctionTrafficTarget{{Revision: 1, Percent: 50}, {Revision: 2, Percent: 40}},
+			err:     true,
+		},
+		{
+			name:    "revisions should exist",
+			traffic: []kubelessApi.FunctionTrafficTarget{{Revision: 3, Percent: 100}},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		funcObj.Spec.Traffic = tt.traffic
+		traffic, err := resolveTraffic(funcObj, revisions)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expecting an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(traffic, tt.expected) {
+			t.Errorf("%s: expecting %v, received %v", tt.name, tt.expected, traffic)
+		}
+	}
+}
+
+type fakePodMetrics struct {
+	calls int
+}
+
+func (h *fakePodMetrics) GetPodRawMetrics(apiV1Client kubernetes.Interface, namespace, podName, port string) ([]byte, error) {
+	return []byte(fmt.Sprintf("function_calls_total{method=\"GET\"} %d\n", h.calls)), nil
+}
+
+func TestEnsureK8sResourcesScaleToZero(t *testing.T) {
+	funcObj := testFunc()
+	funcObj.Spec.IdleTimeout = "1ms"
+	clientset := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-1234", Namespace: funcObj.Namespace, Labels: map[string]string{"function": funcObj.Name}},
+			Status:     v1.PodStatus{Phase: v1.PodRunning},
+		},
+		&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "function-activator", Namespace: funcObj.Namespace},
+			Subsets: []v1.EndpointSubset{
+				{
+					Addresses: []v1.EndpointAddress{{IP: "10.0.0.10"}},
+					Ports:     []v1.EndpointPort{{Port: 9090}},
+				},
+			},
+		},
+	)
+	controller := testController(clientset, funcObj.Namespace, map[string]string{
+		"runtime-images": testRuntimeImages(),
+	})
+	metrics := &fakePodMetrics{calls: 1}
+	controller.metricsHandler = metrics
+
+	// The first check stores the number of calls, the function is idle from then on
+	for i := 0; i < 2; i++ {
+		if err := controller.ensureK8sResources(funcObj); err != nil {
+			t.Fatalf("Creating/Updating resources returned err: %v", err)
+		}
+	}
+	svc, _ := clientset.CoreV1().Services(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	if _, ok := svc.Annotations[utils.ScaledToZeroAnnotation]; ok {
+		t.Fatal("The function should not be scaled to zero yet")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	svc, _ = clientset.CoreV1().Services(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	if _, ok := svc.Annotations[utils.ScaledToZeroAnnotation]; !ok || svc.Spec.Selector != nil {
+		t.Errorf("Expecting the service to be redirected to the activator: %v", svc)
+	}
+	endpoints, err := clientset.CoreV1().Endpoints(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expecting the endpoints of the function to be created: %v", err)
+	}
+	if endpoints.Subsets[0].Addresses[0].IP != "10.0.0.10" || endpoints.Subsets[0].Ports[0].Port != utils.ActivatorFirstFunctionPort {
+		t.Errorf("Expecting the endpoints of the activator, received %v", endpoints.Subsets)
+	}
+	if port, err := utils.ActivatorPort(svc); err != nil || port != utils.ActivatorFirstFunctionPort {
+		t.Errorf("Expecting the first port of the activator to be reserved for the function, received %d %v", port, err)
+	}
+	if replicas := lastPatchedReplicas(t, clientset); replicas != 0 {
+		t.Errorf("Expecting the deployment to be scaled to zero, found %d replicas", replicas)
+	}
+	if c := utils.FunctionObjGetCondition(funcObj, kubelessApi.FunctionDeploymentAvailable); c == nil || c.Reason != scaledToZeroReason {
+		t.Errorf("Expecting DeploymentAvailable to be %s, received %v", scaledToZeroReason, c)
+	}
+
+	// The activator scales up the function
+	dpm, _ := clientset.AppsV1().Deployments(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	replicas := int32(1)
+	dpm.Spec.Replicas = &replicas
+	if _, err := clientset.AppsV1().Deployments(funcObj.Namespace).Update(dpm); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.ensureK8sResources(funcObj); err != nil {
+		t.Fatalf("Creating/Updating resources returned err: %v", err)
+	}
+	svc, _ = clientset.CoreV1().Services(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+	if _, ok := svc.Annotations[utils.ScaledToZeroAnnotation]; ok || !reflect.DeepEqual(svc.Spec.Selector, funcObj.Labels) {
+		t.Errorf("Expecting the service to be restored: %v", svc)
+	}
+	if replicas := lastPatchedReplicas(t, clientset); replicas != *funcObj.Spec.Deployment.Spec.Replicas {
+		t.Errorf("Expecting %d replicas, found %d", *funcObj.Spec.Deployment.Spec.Replicas, replicas)
+	}
+}
+
+// lastPatchedReplicas returns the replicas of the last patch applied to a deployment
+func lastPatchedReplicas(t *testing.T, clientset *fake.Clientset) int32 {
+	var patch []byte
+	for _, a := range clientset.Actions() {
+		if a.Matches("patch", "deployments") {
+			patch = a.(ktesting.PatchAction).GetPatch()
+		}
+	}
+	dpm := appsv1.Deployment{}
+	if err := json.Unmarshal(patch, &dpm); err != nil || dpm.Spec.Replicas == nil {
+		t.Fatalf("Unable to find the replicas of the deployment patch %s: %v", patch, err)
+	}
+	return *dpm.Spec.Replicas
+}
+
+func TestReloadConfig(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	controller := testController(clientset, "kubeless", map[string]string{
+		"runtime-images": testRuntimeImages(),
+	})
+	controller.queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	controller.informer = kv1beta1.NewFunctionInformer(fFake.NewSimpleClientset(), "", 0, cache.Indexers{})
+	rubyFunc := testFunc()
+	customFunc := testFunc()
+	customFunc.ObjectMeta.Name = "custom"
+	customFunc.Spec.Runtime = ""
+	controller.informer.GetStore().Add(rubyFunc)
+	controller.informer.GetStore().Add(customFunc)
+
+	// An invalid configuration is rejected
+	invalid := controller.config.DeepCopy()
+	invalid.Data["runtime-images"] = "not: [valid"
+	controller.reloadConfig(invalid)
+	if controller.config.Data["runtime-images"] != testRuntimeImages() {
+		t.Errorf("The configuration should not be applied")
+	}
+	if events := recordedEvents(controller); len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+invalidConfigReason) {
+		t.Errorf("Expecting an InvalidConfig event, received %v", events)
+	}
+
+	// Changing a runtime requeues the functions that use it
+	runtimeImages := []langruntime.RuntimeInfo{{
+		ID:             "ruby",
+		DepName:        "Gemfile",
+		FileNameSuffix: ".rb",
+		Versions: []langruntime.RuntimeVersion{
+			{Name: "ruby24", Version: "2.4", Images: []langruntime.Image{{Phase: "runtime", Image: "bitnami/ruby:2.4.5"}}},
+			{Name: "ruby25", Version: "2.5", Images: []langruntime.Image{{Phase: "runtime", Image: "bitnami/ruby:2.5"}}},
+		},
+	}}
+	out, _ := yaml.Marshal(runtimeImages)
+	updated := controller.config.DeepCopy()
+	updated.Data["runtime-images"] = string(out)
+	controller.reloadConfig(updated)
+	image, err := controller.langRuntime.GetFunctionImage("ruby2.5")
+	if err != nil || image != "bitnami/ruby:2.5" {
+		t.Errorf("Expecting the new runtime to be available, received %s: %v", image, err)
+	}
+	if controller.queue.Len() != 1 {
+		t.Fatalf("Expecting the ruby function to be requeued, found %d items", controller.queue.Len())
+	}
+	key, _ := controller.queue.Get()
+	if key != "default/foo" {
+		t.Errorf("Unexpected function requeued %s", key)
+	}
+	controller.queue.Done(key)
+
+	// Changing the provision image requeues every function
+	updated = controller.config.DeepCopy()
+	updated.Data["provision-image"] = "unzip:latest"
+	controller.reloadConfig(updated)
+	if controller.queue.Len() != 2 {
+		t.Errorf("Expecting every function to be requeued, found %d items", controller.queue.Len())
+	}
+}
+
 func testFunc() *kubelessApi.Function {
 	var replicas int32
 	replicas = 10
@@ -337,7 +1136,27 @@ func testController(clientset kubernetes.Interface, namespace string, configData
 	return &FunctionController{
 		logger:      logrus.WithField("pkg", "controller"),
 		clientset:   clientset,
+		recorder:    record.NewFakeRecorder(100),
 		langRuntime: lr,
 		config:      config,
+		activity:    map[string]*functionActivity{},
+		applied:     map[string]interface{}{},
+		ownedInformers: map[string]cache.SharedIndexInformer{
+			"services": coreinformers.NewServiceInformer(clientset, namespace, 0, cache.Indexers{utils.ActivatorPortIndex: utils.ActivatorPortIndexFunc}),
+		},
+	}
+}
+
+// recordedEvents returns the events emitted by the controller since the last call
+func recordedEvents(controller *FunctionController) []string {
+	recorder := controller.recorder.(*record.FakeRecorder)
+	events := []string{}
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
 	}
 }
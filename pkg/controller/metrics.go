@@ -0,0 +1,127 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const queueName = "functions"
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeless_controller_reconcile_total",
+		Help: "Number of times a function has been processed by result",
+	}, []string{"result"})
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kubeless_controller_reconcile_duration_seconds",
+		Help: "Time spent processing a function by result",
+	}, []string{"result"})
+	droppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubeless_controller_dropped_total",
+		Help: "Number of times the controller gave up processing a function after exhausting its retries",
+	})
+	buildJobsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubeless_controller_build_jobs_started_total",
+		Help: "Number of image build jobs started",
+	})
+	registryLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kubeless_controller_registry_lookup_duration_seconds",
+		Help: "Time spent checking if the image of a function exists in the registry by result",
+	}, []string{"result"})
+	driftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeless_controller_drift_corrected_total",
+		Help: "Number of resources of functions restored after being modified or deleted outside of the controller by kind",
+	}, []string{"kind"})
+	informerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubeless_controller_informer_synced",
+		Help: "Whether the cache of an informer has been synced (1) or not (0)",
+	}, []string{"informer"})
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubeless_controller_workqueue_depth",
+		Help: "Number of functions waiting in the workqueue",
+	}, []string{"name"})
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeless_controller_workqueue_adds_total",
+		Help: "Number of functions added to the workqueue",
+	}, []string{"name"})
+	queueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "kubeless_controller_workqueue_queue_duration_microseconds",
+		Help: "Time that a function stays in the workqueue before being processed",
+	}, []string{"name"})
+	queueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "kubeless_controller_workqueue_work_duration_microseconds",
+		Help: "Time spent processing a function taken from the workqueue",
+	}, []string{"name"})
+	queueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeless_controller_workqueue_retries_total",
+		Help: "Number of times a function has been requeued after an error",
+	}, []string{"name"})
+)
+
+// queueMetricsProvider exposes the metrics of the workqueue in Prometheus
+type queueMetricsProvider struct{}
+
+func (queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return queueDepth.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return queueAdds.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return queueLatency.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return queueWorkDuration.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return queueRetries.WithLabelValues(name)
+}
+
+func init() {
+	prometheus.MustRegister(reconcileTotal, reconcileDuration, droppedTotal, buildJobsTotal, registryLookupDuration, driftTotal, informerSynced)
+	prometheus.MustRegister(queueDepth, queueAdds, queueLatency, queueWorkDuration, queueRetries)
+	workqueue.SetProvider(queueMetricsProvider{})
+}
+
+// metricResult returns the label used for the result of an operation
+func metricResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// observeReconcile records the result and duration of processing a function
+func observeReconcile(start time.Time, err error) {
+	result := metricResult(err)
+	reconcileTotal.WithLabelValues(result).Inc()
+	reconcileDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// observeRegistryLookup records the time spent checking if an image exists in the registry
+func observeRegistryLookup(start time.Time, err error) {
+	registryLookupDuration.WithLabelValues(metricResult(err)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	fFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
+	kv1beta1 "github.com/kubeless/kubeless/pkg/client/informers/externalversions/kubeless/v1beta1"
+)
+
+func TestProcessNextItemMetrics(t *testing.T) {
+	controller := testController(fake.NewSimpleClientset(), "default", map[string]string{})
+	controller.informer = kv1beta1.NewFunctionInformer(fFake.NewSimpleClientset(), "", 0, cache.Indexers{})
+	controller.queue = workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0), "test")
+	defer controller.queue.ShutDown()
+
+	errors := testutil.ToFloat64(reconcileTotal.WithLabelValues("error"))
+	dropped := testutil.ToFloat64(droppedTotal)
+
+	// An invalid key fails every time until the controller gives up
+	controller.queue.Add("invalid/key/format")
+	for i := 0; i <= maxRetries; i++ {
+		if !controller.processNextItem() {
+			t.Fatal("Unexpected shutdown of the queue")
+		}
+	}
+	if controller.queue.Len() != 0 {
+		t.Errorf("Expecting the key to be dropped after %d retries", maxRetries)
+	}
+	if v := testutil.ToFloat64(reconcileTotal.WithLabelValues("error")) - errors; v != maxRetries+1 {
+		t.Errorf("Expecting %d failed reconciliations, received %v", maxRetries+1, v)
+	}
+	if v := testutil.ToFloat64(droppedTotal) - dropped; v != 1 {
+		t.Errorf("Expecting the key to be dropped once, received %v", v)
+	}
+	if v := testutil.ToFloat64(queueRetries.WithLabelValues("test")); v != maxRetries {
+		t.Errorf("Expecting %d retries, received %v", maxRetries, v)
+	}
+	if v := testutil.ToFloat64(queueDepth.WithLabelValues("test")); v != 0 {
+		t.Errorf("Expecting an empty queue, received depth %v", v)
+	}
+}
+
+func TestReady(t *testing.T) {
+	controller := testController(fake.NewSimpleClientset(), "default", map[string]string{})
+	if controller.Ready() {
+		t.Error("The controller should not be ready before syncing its caches")
+	}
+	controller.synced = 1
+	if !controller.Ready() {
+		t.Error("The controller should be ready after syncing its caches")
+	}
+}
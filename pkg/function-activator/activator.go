@@ -0,0 +1,353 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubeless/kubeless/pkg/function-proxy/utils"
+	kubelessutil "github.com/kubeless/kubeless/pkg/utils"
+)
+
+const (
+	// readyTimeout is the maximum time to wait for a ready pod of a function
+	readyTimeout = 2 * time.Minute
+	// pollInterval is the time between checks of the pods of a function
+	pollInterval = 500 * time.Millisecond
+)
+
+// activation is the process of scaling up a function. The requests received
+// while it is in progress wait for it to be done
+type activation struct {
+	done chan struct{}
+	url  string
+	err  error
+}
+
+// activator receives the requests of the functions scaled to zero, scales them up
+// and forwards the requests once the function has a ready pod
+type activator struct {
+	clientset    kubernetes.Interface
+	services     cache.SharedIndexInformer
+	client       *http.Client
+	readyTimeout time.Duration
+	pollInterval time.Duration
+	mutex        sync.Mutex
+	activations  map[string]*activation
+}
+
+func newActivator(clientset kubernetes.Interface) *activator {
+	// The services of the functions are indexed by the port of the activator reserved for them
+	services := coreinformers.NewFilteredServiceInformer(clientset, metav1.NamespaceAll, 0, cache.Indexers{
+		kubelessutil.ActivatorPortIndex: kubelessutil.ActivatorPortIndexFunc,
+	}, func(options *metav1.ListOptions) {
+		options.LabelSelector = "created-by=kubeless"
+	})
+	return &activator{
+		clientset: clientset,
+		services:  services,
+		client: &http.Client{
+			// The redirections of a function are returned to the client
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		readyTimeout: readyTimeout,
+		pollInterval: pollInterval,
+		activations:  map[string]*activation{},
+	}
+}
+
+// run starts watching the services of the functions and waits until they are cached
+func (a *activator) run(stopCh <-chan struct{}) error {
+	go a.services.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, a.services.HasSynced) {
+		return fmt.Errorf("Timed out waiting for the services to be cached")
+	}
+	return nil
+}
+
+// resolveService returns the service of the function scaled to zero whose requests
+// are sent to the given port of the activator
+func (a *activator) resolveService(port int32) (*v1.Service, error) {
+	found, err := a.services.GetIndexer().ByIndex(kubelessutil.ActivatorPortIndex, strconv.Itoa(int(port)))
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("Unable to find a function scaled to zero for the port %d", port)
+	case 1:
+		return found[0].(*v1.Service), nil
+	default:
+		return nil, fmt.Errorf("Found several functions scaled to zero for the port %d", port)
+	}
+}
+
+// activate scales up the function of the given service if necessary and
+// returns the URL of one of its ready pods
+func (a *activator) activate(ctx context.Context, svc *v1.Service) (string, error) {
+	key := functionKey(svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
+	a.mutex.Lock()
+	act, ok := a.activations[key]
+	if !ok {
+		act = &activation{done: make(chan struct{})}
+		a.activations[key] = act
+		go func() {
+			act.url, act.err = a.scaleUp(svc)
+			close(act.done)
+			a.mutex.Lock()
+			delete(a.activations, key)
+			a.mutex.Unlock()
+		}()
+	}
+	a.mutex.Unlock()
+
+	select {
+	case <-act.done:
+		return act.url, act.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// scaleUp sets the replicas of the function deployment to one (if it is scaled to zero)
+// and waits for a ready pod
+func (a *activator) scaleUp(svc *v1.Service) (string, error) {
+	ns, name := svc.ObjectMeta.Namespace, svc.ObjectMeta.Name
+	start := time.Now()
+	coldStart := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		dpm, err := a.clientset.AppsV1().Deployments(ns).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if dpm.Spec.Replicas != nil && *dpm.Spec.Replicas > 0 {
+			return nil
+		}
+		replicas := int32(1)
+		dpm.Spec.Replicas = &replicas
+		_, err = a.clientset.AppsV1().Deployments(ns).Update(dpm)
+		coldStart = err == nil
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to scale up the function %s/%s: %v", ns, name, err)
+	}
+	if coldStart {
+		log.Printf("Scaling up function %s/%s", ns, name)
+	}
+
+	port := svc.Spec.Ports[0].TargetPort.IntValue()
+	if port == 0 {
+		port = int(svc.Spec.Ports[0].Port)
+	}
+	url := ""
+	err = wait.PollImmediate(a.pollInterval, a.readyTimeout, func() (bool, error) {
+		pods, err := a.clientset.CoreV1().Pods(ns).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("function=%s", name),
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, pod := range pods.Items {
+			if pod.ObjectMeta.DeletionTimestamp == nil && pod.Status.PodIP != "" && podReady(pod) {
+				url = fmt.Sprintf("http://%s:%d", pod.Status.PodIP, port)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Function %s/%s has no ready pods: %v", ns, name, err)
+	}
+	if coldStart {
+		utils.ObserveColdStart(functionKey(ns, name), time.Since(start))
+		log.Printf("Function %s/%s ready after %v", ns, name, time.Since(start))
+	}
+	return url, nil
+}
+
+func podReady(pod v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady && c.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func functionKey(ns, name string) string {
+	return ns + "/" + name
+}
+
+func copyHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// stream writes the body of the response of a function as it is received
+func stream(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// forward holds the request until the function of the given service is ready and streams it to one of its pods
+func (a *activator) forward(ctx context.Context, svc *v1.Service, w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	target, err := a.activate(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(r.Method, target+r.URL.RequestURI(), r.Body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	copyHeaders(req.Header, r.Header)
+	req.Host = r.Host
+	req.ContentLength = r.ContentLength
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	copyHeaders(w.Header(), res.Header)
+	w.WriteHeader(res.StatusCode)
+	// The response has already been sent, an error can only be logged
+	if err := stream(w, res.Body); err != nil {
+		log.Printf("Unable to send the response of the function %s/%s: %v", svc.ObjectMeta.Namespace, svc.ObjectMeta.Name, err)
+	}
+	return nil, nil
+}
+
+// ServeHTTP sends the request to the function that has the port of the activator that received it.
+// utils.Handler applies the timeout and the metrics of the function calls
+func (a *activator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		http.Error(w, "Error: Unable to get the port of the request", http.StatusInternalServerError)
+		return
+	}
+	svc, err := a.resolveService(int32(addr.Port))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusNotFound)
+		return
+	}
+	utils.CountActivatorRequest(functionKey(svc.ObjectMeta.Namespace, svc.ObjectMeta.Name))
+	utils.Handler(w, r, func(ctx context.Context, w http.ResponseWriter, r *http.Request) ([]byte, error) {
+		return a.forward(ctx, svc, w, r)
+	})
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func main() {
+	a := newActivator(kubelessutil.GetClient())
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := a.run(stopCh); err != nil {
+		log.Fatal(err)
+	}
+
+	port := os.Getenv("ACTIVATOR_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health)
+	mux.Handle("/metrics", utils.PromHTTPHandler())
+
+	// The activator doesn't use utils.NewServer since it should not exit if a request times out.
+	// The requests received on the port of a function go to the activator, the rest to the mux
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok && isFunctionPort(addr.Port) {
+			a.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})}
+
+	listeners := []net.Listener{}
+	for _, addr := range append([]string{":" + port}, functionAddrs()...) {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Unable to listen on %s: %v", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := server.Serve(l); err != http.ErrServerClosed {
+				panic(err)
+			}
+		}(l)
+	}
+
+	utils.GracefulShutdown(server)
+}
+
+// functionAddrs returns the addresses of the ports of the activator reserved for the functions
+func functionAddrs() []string {
+	addrs := []string{}
+	for p := kubelessutil.ActivatorFirstFunctionPort; p <= kubelessutil.ActivatorLastFunctionPort; p++ {
+		addrs = append(addrs, fmt.Sprintf(":%d", p))
+	}
+	return addrs
+}
+
+func isFunctionPort(port int) bool {
+	return port >= kubelessutil.ActivatorFirstFunctionPort && port <= kubelessutil.ActivatorLastFunctionPort
+}
@@ -0,0 +1,156 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kubelessutil "github.com/kubeless/kubeless/pkg/utils"
+)
+
+func scaledToZeroService(name, ns string, activatorPort, port int) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   ns,
+			Labels:      map[string]string{"created-by": "kubeless", "function": name},
+			Annotations: map[string]string{kubelessutil.ScaledToZeroAnnotation: strconv.Itoa(activatorPort)},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http-function-port", Port: 8080, TargetPort: intstr.FromInt(port)},
+			},
+		},
+	}
+}
+
+func TestResolveService(t *testing.T) {
+	running := scaledToZeroService("bar", "default", 8103, 8080)
+	running.ObjectMeta.Annotations = nil
+	a := newActivator(fake.NewSimpleClientset(
+		scaledToZeroService("foo", "default", 8100, 8080),
+		scaledToZeroService("foo", "other", 8101, 8080),
+		scaledToZeroService("baz", "default", 8102, 8080),
+		scaledToZeroService("qux", "other", 8102, 8080),
+		running,
+	))
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := a.run(stopCh); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		port     int32
+		expected string
+	}{
+		{8100, "default/foo"},
+		{8101, "other/foo"},
+		{8102, ""},
+		{8103, ""},
+		{8104, ""},
+	}
+	for _, tt := range tests {
+		svc, err := a.resolveService(tt.port)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("Expecting an error resolving %d, received %s/%s", tt.port, svc.Namespace, svc.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error resolving %d: %v", tt.port, err)
+		} else if functionKey(svc.Namespace, svc.Name) != tt.expected {
+			t.Errorf("Expecting %s for %d, received %s/%s", tt.expected, tt.port, svc.Namespace, svc.Name)
+		}
+	}
+}
+
+func TestActivatorServeHTTP(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Function", "foo")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello " + r.URL.Path + " from " + r.Host))
+	}))
+	defer function.Close()
+	host, portStr, _ := net.SplitHostPort(function.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	replicas := int32(0)
+	clientset := fake.NewSimpleClientset(
+		scaledToZeroService("foo", "default", 8100, port),
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		},
+	)
+	a := newActivator(clientset)
+	a.pollInterval = 10 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := a.run(stopCh); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pod of the function gets ready after the deployment is scaled up
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		clientset.CoreV1().Pods("default").Create(&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-1234", Namespace: "default", Labels: map[string]string{"function": "foo"}},
+			Status: v1.PodStatus{
+				PodIP:      host,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+			},
+		})
+	}()
+
+	// The host of the ingress of the function doesn't identify it, the port of the activator does
+	req := httptest.NewRequest("GET", "http://foo.1.2.3.4.nip.io/path", nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{Port: 8100}))
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	res := w.Result()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusCreated || string(body) != "hello /path from foo.1.2.3.4.nip.io" || res.Header.Get("X-Function") != "foo" {
+		t.Errorf("Unexpected response %d %v: %s", res.StatusCode, res.Header, body)
+	}
+	dpm, _ := clientset.AppsV1().Deployments("default").Get("foo", metav1.GetOptions{})
+	if *dpm.Spec.Replicas != 1 {
+		t.Errorf("Expecting the deployment to be scaled to 1 replica, found %d", *dpm.Spec.Replicas)
+	}
+
+	req = httptest.NewRequest("GET", "http://foo.default/path", nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{Port: 8101}))
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expecting %d for a port without function, received %d", http.StatusNotFound, w.Code)
+	}
+}
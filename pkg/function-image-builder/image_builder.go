@@ -17,151 +17,298 @@ limitations under the License.
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"path"
+	"strings"
+	"time"
 
 	lbuilder "github.com/kubeless/kubeless/pkg/function-image-builder/layer-builder"
+	"github.com/kubeless/kubeless/pkg/registry"
 	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
 )
 
 var globalUsage = `` //TODO: add explanation
 
 func init() {
 	layerCmd.Flags().Bool("insecure", false, "Disable TLS verification.")
-	layerCmd.Flags().StringP("src", "", "", "Source image reference. F.e. dir://path/to/image")
+	layerCmd.Flags().StringP("src", "", "", "Source image reference. F.e. docker://registry.example.com/user/image:tag")
 	layerCmd.Flags().StringP("src-creds", "", "", "Source image credentials in case it is a private registry. F.e. user:my_pass")
 	layerCmd.Flags().StringP("dst", "", "", "Destination image reference. F.e. docker://user/image")
 	layerCmd.Flags().StringP("dst-creds", "", "", "Destination credentials in case it is a docker registry. F.e. user:my_pass")
+	layerCmd.Flags().StringP("intermediate-dst", "", "", "Destination of the image with every layer but the last one. F.e. docker://user/image-deps")
+	layerCmd.Flags().StringArray("created-by", []string{}, "Description of the content of each layer, in the same order of the tar files")
 	layerCmd.Flags().StringP("cwd", "", "", "Working directory")
+	layerCmd.Flags().String("platform", "linux/amd64", "Platform (os/arch[/variant]) to use if the source image is a manifest list or an OCI index")
+	layerCmd.Flags().Bool("all-platforms", false, "Add the layers to every platform of the source image if it is a manifest list or an OCI index")
+	layerCmd.Flags().String("created", "", "Creation time of the layers in RFC 3339 format, the current time is used if empty")
+	layerCmd.Flags().StringArray("label", []string{}, "Label to add to the configuration of the new images, in the format key=value")
+	bundleCmd.Flags().String("files-from", "", "File with the list of files and directories to include, one per line")
+	bundleCmd.Flags().String("mtime", "", "Modification time of the entries of the layer in RFC 3339 format")
 }
 
-func runCommand(command string, args []string) error {
-	cmd := exec.Command(command, args...)
-
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
-	cmd.Start()
-
-	scannerStdout := bufio.NewScanner(stdout)
-	scannerStdout.Split(bufio.ScanLines)
-	for scannerStdout.Scan() {
-		m := scannerStdout.Text()
-		fmt.Fprintln(os.Stdout, m)
+// timeFlag parses a flag with a time in RFC 3339 format, it returns the zero time if the flag is empty
+func timeFlag(cmd *cobra.Command, name string) time.Time {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if value == "" {
+		return time.Time{}
 	}
-	scannerStderr := bufio.NewScanner(stderr)
-	scannerStderr.Split(bufio.ScanLines)
-	for scannerStderr.Scan() {
-		m := scannerStderr.Text()
-		fmt.Fprintln(os.Stderr, m)
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("Unable to parse --%s: %v", name, err)
 	}
+	return t
+}
 
-	return cmd.Wait()
+// registryFor returns the registry of an image with its credentials. The credentials are read from the entry of
+// the registry in the docker config of DOCKER_CONFIG_FOLDER unless they are given as user:password
+func registryFor(ref *registry.Reference, creds string, insecure bool) (*registry.Registry, error) {
+	reg := &registry.Registry{
+		Endpoint: ref.Endpoint(),
+		Version:  "v2",
+		Insecure: insecure,
+	}
+	if configFolder := os.Getenv("DOCKER_CONFIG_FOLDER"); configFolder != "" {
+		config, err := ioutil.ReadFile(path.Join(configFolder, ".dockerconfigjson"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			registries, err := registry.Registries(v1.Secret{Data: map[string][]byte{".dockerconfigjson": config}})
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse the docker config: %v", err)
+			}
+			if configured := registry.Find(registries, ref.Host); configured != nil {
+				if configured.Version == "v2" {
+					// Keep the scheme of the configured registry
+					reg.Endpoint = configured.Endpoint
+				}
+				reg.Creds = configured.Creds
+			}
+		}
+	}
+	if creds != "" {
+		parts := strings.SplitN(creds, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Unable to parse the credentials for %s, expecting user:password", ref.Host)
+		}
+		reg.Creds = registry.Credentials{Username: parts[0], Password: parts[1]}
+	}
+	return reg, nil
 }
 
-func skopeoCopy(src, dst, srcCreds, dstCreds string, insecure bool) error {
-	command := "skopeo"
-	args := []string{"copy"}
-	if srcCreds != "" {
-		args = append(args, "--src-creds", srcCreds)
+// imageFlag parses the image given in a flag and returns the registry it belongs to
+func imageFlag(cmd *cobra.Command, name, creds string, insecure bool) (*registry.Reference, *registry.Registry) {
+	image, err := cmd.Flags().GetString(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if image == "" {
+		return nil, nil
 	}
-	if dstCreds != "" {
-		args = append(args, "--dest-creds", dstCreds)
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if insecure {
-		args = append(args, "--src-tls-verify=false", "--dest-tls-verify=false")
+	if ref.Digest != "" && name != "src" {
+		log.Fatalf("The image of --%s needs a tag instead of a digest", name)
 	}
-	args = append(args, src, dst)
-	return runCommand(command, args)
+	reg, err := registryFor(ref, creds, insecure)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ref, reg
 }
 
 var layerCmd = &cobra.Command{
-	Use:   "add-layer <tar> FLAG",
-	Short: "Add tar as a image layer",
-	Long:  ``,
+	Use:   "add-layer <tar>... FLAG",
+	Short: "Add tars as image layers",
+	Long:  `Add each tar as a new image layer on top of the previous one`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			log.Fatal("Need exactly one argument - layer tar")
+		if len(args) == 0 {
+			log.Fatal("Need at least one argument - layer tar")
 		}
 
-		layerTar := args[0]
+		srcCreds, err := cmd.Flags().GetString("src-creds")
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		srcImage, err := cmd.Flags().GetString("src")
+		dstCreds, err := cmd.Flags().GetString("dst-creds")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		insecure, err := cmd.Flags().GetBool("insecure")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if srcImage == "" {
+
+		srcRef, srcRegistry := imageFlag(cmd, "src", srcCreds, insecure)
+		if srcRef == nil {
 			log.Fatal("Need specify the source image using the flag --src")
 		}
 
-		dstImage, err := cmd.Flags().GetString("dst")
+		dstRef, dstRegistry := imageFlag(cmd, "dst", dstCreds, insecure)
+		if dstRef == nil {
+			log.Fatal("Need specify the destination image using the flag --dst")
+		}
+
+		workDir, err := cmd.Flags().GetString("cwd")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if dstImage == "" {
-			log.Fatal("Need specify the destination image using the flag --dst")
+		if workDir == "" {
+			workDir, err = ioutil.TempDir("", "build")
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 
-		srcCreds, err := cmd.Flags().GetString("src-creds")
+		intermediateRef, intermediateRegistry := imageFlag(cmd, "intermediate-dst", dstCreds, insecure)
+		if intermediateRef != nil && len(args) < 2 {
+			log.Fatal("Need at least two layers to store an intermediate image")
+		}
+
+		createdBy, err := cmd.Flags().GetStringArray("created-by")
 		if err != nil {
 			log.Fatal(err)
 		}
+		if len(createdBy) > len(args) {
+			log.Fatal("Found more layer descriptions than layers")
+		}
+		created := timeFlag(cmd, "created")
+		layers := []lbuilder.LayerSource{}
+		for i, tar := range args {
+			layer := lbuilder.LayerSource{Tar: tar, Created: created}
+			if i < len(createdBy) {
+				layer.CreatedBy = createdBy[i]
+			}
+			layers = append(layers, layer)
+		}
 
-		dstCreds, err := cmd.Flags().GetString("dst-creds")
+		labelFlags, err := cmd.Flags().GetStringArray("label")
 		if err != nil {
 			log.Fatal(err)
 		}
+		labels := map[string]string{}
+		for _, label := range labelFlags {
+			parts := strings.SplitN(label, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				log.Fatalf("Unable to parse the label %q, expecting key=value", label)
+			}
+			labels[parts[0]] = parts[1]
+		}
 
-		workDir, err := cmd.Flags().GetString("cwd")
+		platform, err := cmd.Flags().GetString("platform")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if workDir == "" {
-			workDir, err = ioutil.TempDir("", "build")
+		allPlatforms, err := cmd.Flags().GetBool("all-platforms")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if allPlatforms {
+			platform = ""
+		}
+
+		// Store the manifest and the configuration of the src image, its layers are copied when pushing
+		err = registry.PullManifest(srcRegistry, srcRef.Repository, srcRef.Reference(), workDir, platform)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Succesfully stored the manifest of the base image ", srcRef.Repository, " at ", workDir)
+		sources := []registry.BlobSource{{Registry: srcRegistry, Repository: srcRef.Repository}}
+
+		if intermediateRef != nil {
+			// Add every layer but the last one and publish the intermediate image
+			err = lbuilder.AddTarToLayer(workDir, labels, layers[:len(layers)-1]...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			digest, err := registry.PushImage(workDir, intermediateRegistry, intermediateRef.Repository, intermediateRef.Tag, sources...)
 			if err != nil {
 				log.Fatal(err)
 			}
+			log.Println("Succesfully stored intermediate image at ", intermediateRef.Repository, ":", intermediateRef.Tag, " (", digest, ")")
+			// The final image can mount the layers of the intermediate one
+			sources = append(sources, registry.BlobSource{Registry: intermediateRegistry, Repository: intermediateRef.Repository})
+			layers = layers[len(layers)-1:]
 		}
 
-		insecure, err := cmd.Flags().GetBool("insecure")
+		// Add layers
+		err = lbuilder.AddTarToLayer(workDir, labels, layers...)
 		if err != nil {
 			log.Fatal(err)
 		}
+		for _, layer := range layers {
+			log.Println("Added layer ", layer.Tar, " in ", workDir)
+		}
 
-		// Store src image
-		err = skopeoCopy(srcImage, fmt.Sprintf("dir://%s", workDir), srcCreds, dstCreds, insecure)
+		// Publish new image
+		digest, err := registry.PushImage(workDir, dstRegistry, dstRef.Repository, dstRef.Tag, sources...)
 		if err != nil {
 			log.Fatal(err)
 		}
-		log.Println("Succesfully stored base image ", srcImage, " at ", workDir)
+		log.Println("Succesfully stored final image at ", dstRef.Repository, ":", dstRef.Tag, " (", digest, ")")
+	},
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle <tar> FLAG",
+	Short: "Create a reproducible layer",
+	Long:  `Create a gzipped tar with the files listed in --files-from, sorted, owned by root and with the same modification time`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("Need exactly one argument - layer tar")
+		}
 
-		// Add layer
-		err = lbuilder.AddTarToLayer(workDir, layerTar)
+		filesFrom, err := cmd.Flags().GetString("files-from")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if filesFrom == "" {
+			log.Fatal("Need specify the list of files using the flag --files-from")
+		}
+		list, err := ioutil.ReadFile(filesFrom)
 		if err != nil {
 			log.Fatal(err)
 		}
-		log.Println("Added layer ", layerTar, " in ", workDir)
+		files := []string{}
+		for _, file := range strings.Split(string(list), "\n") {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
 
-		// Publish new image
-		err = skopeoCopy(fmt.Sprintf("dir://%s", workDir), dstImage, srcCreds, dstCreds, insecure)
+		mtime := timeFlag(cmd, "mtime")
+		if mtime.IsZero() {
+			log.Fatal("Need specify the modification time using the flag --mtime")
+		}
+
+		err = lbuilder.CreateLayer(args[0], files, mtime)
 		if err != nil {
 			log.Fatal(err)
 		}
-		log.Println("Succesfully stored final image at ", dstImage)
+		log.Println("Created layer ", args[0], " with ", len(files), " entries")
 	},
 }
 
 func newRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "imbuilder",
-		Short: "Pulls an image and push a new one including a tar file as a new layer",
+		Short: "Pushes a new image including tar files as new layers on top of a base image",
 		Long:  globalUsage,
 	}
 
 	cmd.AddCommand(layerCmd)
+	cmd.AddCommand(bundleCmd)
 	return cmd
 }
 
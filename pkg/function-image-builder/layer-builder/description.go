@@ -45,6 +45,26 @@ type Config struct {
 	Entrypoint   interface{}
 	OnBuild      interface{}
 	Labels       interface{}
+
+	// raw contains the original properties, including the ones that are not part of Config
+	raw map[string]json.RawMessage
+}
+
+// config has the same properties of Config without its methods
+type config Config
+
+// UnmarshalJSON parses a Config keeping its original properties
+func (c *Config) UnmarshalJSON(content []byte) error {
+	err := json.Unmarshal(content, (*config)(c))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &c.raw)
+}
+
+// MarshalJSON returns the content of the Config including the unknown properties of the original one
+func (c Config) MarshalJSON() ([]byte, error) {
+	return mergeJSON(config(c), c.raw)
 }
 
 // HistoryEntry represents a layer creation info
@@ -61,7 +81,7 @@ type Rootfs struct {
 	DiffIds []string `json:"diff_ids"`
 }
 
-// Description represents the specification of a Docker image
+// Description represents the specification of a Docker or OCI image
 type Description struct {
 	Arch            string         `json:"architecture"`
 	Config          Config         `json:"config"`
@@ -72,6 +92,55 @@ type Description struct {
 	History         []HistoryEntry `json:"history"`
 	OS              string         `json:"os"`
 	Rootfs          Rootfs         `json:"rootfs"`
+
+	// raw contains the original properties, including the ones of other formats
+	raw map[string]json.RawMessage
+}
+
+// description has the same properties of Description without its methods
+type description Description
+
+// UnmarshalJSON parses a Description keeping its original properties
+func (d *Description) UnmarshalJSON(content []byte) error {
+	err := json.Unmarshal(content, (*description)(d))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &d.raw)
+}
+
+// MarshalJSON returns the content of the Description. The properties that the original description doesn't have,
+// like the Docker specific ones in OCI images, are not added unless they are required to describe the layers
+func (d Description) MarshalJSON() ([]byte, error) {
+	return mergeJSON(description(d), d.raw, "architecture", "os", "config", "created", "history", "rootfs")
+}
+
+// mergeJSON marshals a value over its original properties so the ones unknown for the value are kept. The properties
+// of the value missing in the original are only added if they are required
+func mergeJSON(value interface{}, original map[string]json.RawMessage, required ...string) ([]byte, error) {
+	content, err := json.Marshal(value)
+	if err != nil || original == nil {
+		return content, err
+	}
+	properties := map[string]json.RawMessage{}
+	err = json.Unmarshal(content, &properties)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]json.RawMessage{}
+	for key, value := range original {
+		merged[key] = value
+	}
+	for key, value := range properties {
+		_, known := original[key]
+		for _, r := range required {
+			known = known || r == key
+		}
+		if known {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
 }
 
 // New generates a Description object based on the description file
@@ -83,8 +152,12 @@ func (d *Description) New(descriptionFile io.Reader) error {
 	return json.Unmarshal(descriptionContent, d)
 }
 
-// AddLayer adds a new Layer to the image Description
-func (d *Description) AddLayer(newLayer *Layer) {
+// AddLayer adds a new Layer to the image Description, recording in its history what the layer contains and
+// when it was created. The current time is used if created is zero
+func (d *Description) AddLayer(newLayer *Layer, createdBy string, created time.Time) {
+	if created.IsZero() {
+		created = time.Now()
+	}
 	//   Delete some properties that doesn't apply anymore
 	d.Config.Hostname = ""
 	d.Config.Image = ""
@@ -92,12 +165,38 @@ func (d *Description) AddLayer(newLayer *Layer) {
 	d.ContainerConfig.Hostname = ""
 	d.ContainerConfig.Image = ""
 	//   Update new properties
-	d.Created = time.Now().UTC().Format(time.RFC3339)
+	d.Created = created.UTC().Format(time.RFC3339)
 	d.History = append(d.History, HistoryEntry{
-		Created: time.Now().UTC().Format(time.RFC3339),
-		Comment: "Created by Kubeless",
+		Created:   d.Created,
+		CreatedBy: createdBy,
+		Comment:   "Created by Kubeless",
 	})
-	d.Rootfs.DiffIds = append(d.Rootfs.DiffIds, fmt.Sprintf("sha256:%s", newLayer.Sha256))
+	diffID := newLayer.DiffID
+	if diffID == "" {
+		diffID = newLayer.Sha256
+	}
+	d.Rootfs.DiffIds = append(d.Rootfs.DiffIds, fmt.Sprintf("sha256:%s", diffID))
+}
+
+// AddLabels adds the given labels to the configuration of the image, keeping the labels it already has
+func (d *Description) AddLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	merged := map[string]interface{}{}
+	if current, ok := d.Config.Labels.(map[string]interface{}); ok {
+		for key, value := range current {
+			merged[key] = value
+		}
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	d.Config.Labels = merged
+	if _, ok := d.Config.raw["Labels"]; d.Config.raw != nil && !ok {
+		// Mark the property as known so it is not dropped when merging with the original configuration
+		d.Config.raw["Labels"] = json.RawMessage("null")
+	}
 }
 
 // Content returns the description content
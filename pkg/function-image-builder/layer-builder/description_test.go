@@ -19,6 +19,7 @@ package layerbuilder
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewDescription(t *testing.T) {
@@ -41,9 +42,9 @@ func TestAddLayerDescription(t *testing.T) {
 		Size:   10,
 		Sha256: "abc123",
 	}
-	d.AddLayer(&newLayer)
+	d.AddLayer(&newLayer, "kubeless: code of the function foo", time.Time{})
 	// Last history entry should be the new layer
-	if d.History[len(d.History)-1].Comment != "Created by Kubeless" {
+	if d.History[len(d.History)-1].Comment != "Created by Kubeless" || d.History[len(d.History)-1].CreatedBy != "kubeless: code of the function foo" {
 		t.Errorf("Failed to include new layer: %v", d.History)
 	}
 	// Last rootfs.diff_id should be the new layer
@@ -67,3 +68,28 @@ func TestDescriptionToLayer(t *testing.T) {
 		t.Errorf("Unexpected size %d", res.Size)
 	}
 }
+
+func TestOCIDescription(t *testing.T) {
+	descFile := strings.NewReader(`{"architecture":"amd64","os":"linux","author":"kubeless","config":{"User":"1000","ExposedPorts":{"8080/tcp":{}},"Env":["PATH=/bin"],"StopSignal":"SIGTERM"},"created":"2018-02-28T22:14:49.023807051Z","history":[{"created":"2018-02-28T22:14:48.759033366Z","created_by":"ADD file in /"}],"rootfs":{"type":"layers","diff_ids":["sha256:c5183829"]}}`)
+	d := Description{}
+	err := d.New(descFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	d.AddLayer(&Layer{Size: 10, Sha256: "abc123", DiffID: "def456"}, "kubeless: code of the function foo", time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC))
+	d.AddLabels(map[string]string{"io.kubeless.function.name": "foo"})
+	content, err := d.Content()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, property := range []string{`"author":"kubeless"`, `"ExposedPorts":{"8080/tcp":{}}`, `"StopSignal":"SIGTERM"`, `"User":"1000"`, `"sha256:def456"`, `"created":"2018-03-01T10:00:00Z","created_by":"kubeless: code of the function foo"`, `"Labels":{"io.kubeless.function.name":"foo"}`} {
+		if !strings.Contains(string(content), property) {
+			t.Errorf("Expecting %s in %s", property, content)
+		}
+	}
+	for _, property := range []string{"docker_version", "container_config", "Hostname"} {
+		if strings.Contains(string(content), property) {
+			t.Errorf("Unexpected property %s in %s", property, content)
+		}
+	}
+}
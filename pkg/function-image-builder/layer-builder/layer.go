@@ -17,8 +17,11 @@ limitations under the License.
 package layerbuilder
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 )
@@ -27,6 +30,10 @@ import (
 type Layer struct {
 	Size   int64
 	Sha256 string
+	// Compressed is true if the layer is a gzipped tar
+	Compressed bool
+	// DiffID is the checksum of the uncompressed tar, it is the same as Sha256 if the layer is not compressed
+	DiffID string
 }
 
 // New returns a Layer based on its file
@@ -37,6 +44,20 @@ func (f *Layer) New(layerFile *os.File) error {
 		return err
 	}
 	f.Sha256 = fmt.Sprintf("%x", sha256.Sum256(fContent))
+	f.DiffID = f.Sha256
+	if bytes.HasPrefix(fContent, []byte{0x1f, 0x8b}) {
+		f.Compressed = true
+		uncompressed, err := gzip.NewReader(bytes.NewReader(fContent))
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, uncompressed)
+		if err != nil {
+			return fmt.Errorf("Unable to uncompress the layer: %v", err)
+		}
+		f.DiffID = fmt.Sprintf("%x", h.Sum(nil))
+	}
 
 	// Calculate size
 	fstat, err := layerFile.Stat()
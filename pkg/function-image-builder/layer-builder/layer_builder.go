@@ -18,6 +18,7 @@ package layerbuilder
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,6 +27,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 func copyReader(src io.Reader, dst string) error {
@@ -70,60 +72,56 @@ func getLayer(file string) (*Layer, error) {
 	return &layer, nil
 }
 
-func saveNewDescription(content []byte, dir, contentChecksum string) error {
+func saveBlob(content []byte, dir, contentChecksum string) error {
 	dLayerFile := path.Join(dir, contentChecksum)
 	return copyReader(bytes.NewReader(content), dLayerFile)
 }
 
-func updateDescription(descriptionDir string, descriptionFile *os.File, newLayer *Layer) (*Description, error) {
-	d := Description{}
-	err := d.New(descriptionFile)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to parse image description: %v", err)
-	}
-	d.AddLayer(newLayer)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to update image description: %v", err)
-	}
-	return &d, nil
+// LayerSource is a tar file to add to an image, the description of its content and its creation time
+type LayerSource struct {
+	Tar       string
+	CreatedBy string
+	Created   time.Time
 }
 
-// AddTarToLayer copies a tar file into a image directory and update its metadata
-func AddTarToLayer(imageDir, tarFile string) error {
-	tarLayer, err := getLayer(tarFile)
-	if err != nil {
-		return err
-	}
-	destFile := path.Join(imageDir, tarLayer.Sha256)
-	err = copyFile(tarFile, destFile)
-	if err != nil {
-		return fmt.Errorf("Failed to copy tar file: %v", err)
-	}
-	log.Printf("Copied source %s to %s", tarFile, destFile)
-
-	// Parse manifest
-	manifestPath := path.Join(imageDir, "manifest.json")
+// readManifest parses the manifest stored in the given file
+func readManifest(manifestPath string) (*Manifest, error) {
 	manifestFile, err := os.Open(manifestPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer manifestFile.Close()
 	m := Manifest{}
 	err = m.New(manifestFile)
 	if err != nil {
-		return fmt.Errorf("Failed to parse image manifest: %v", err)
+		return nil, fmt.Errorf("Failed to parse image manifest: %v", err)
 	}
-	log.Printf("Parsed manifest")
+	return &m, nil
+}
 
-	// Update description
+// addLayersToManifest adds the layers, already copied to the image directory, to a manifest and its description
+// and the labels to the configuration of the description
+func addLayersToManifest(imageDir string, m *Manifest, tarLayers []*Layer, layers []LayerSource, labels map[string]string) error {
+	// Parse description
 	descriptionPath := path.Join(imageDir, strings.Replace(m.Config.Digest, "sha256:", "", -1))
 	descriptionFile, err := os.Open(descriptionPath)
 	if err != nil {
 		return err
 	}
-	description, err := updateDescription(imageDir, descriptionFile, tarLayer)
+	defer descriptionFile.Close()
+	description := Description{}
+	err = description.New(descriptionFile)
 	if err != nil {
-		return err
+		return fmt.Errorf("Unable to parse image description: %v", err)
+	}
+
+	for i, tarLayer := range tarLayers {
+		description.AddLayer(tarLayer, layers[i].CreatedBy, layers[i].Created)
+		m.AddLayer(tarLayer)
 	}
+	description.AddLabels(labels)
+
+	// Store the new description
 	descriptionLayer, err := description.ToLayer()
 	if err != nil {
 		return fmt.Errorf("Unable to generate layer from description: %v", err)
@@ -132,24 +130,105 @@ func AddTarToLayer(imageDir, tarFile string) error {
 	if err != nil {
 		return err
 	}
-	err = saveNewDescription(descriptionContent, imageDir, descriptionLayer.Sha256)
+	err = saveBlob(descriptionContent, imageDir, descriptionLayer.Sha256)
 	if err != nil {
 		return err
 	}
-	log.Printf("Added layer to description at %s", descriptionLayer.Sha256)
-
-	// Update manifest
+	log.Printf("Added %d layers to description at %s", len(layers), descriptionLayer.Sha256)
 	m.UpdateConfig(descriptionLayer)
-	m.AddLayer(tarLayer)
-	mBytes, err := json.Marshal(m)
+	return nil
+}
+
+// AddTarToLayer copies the given tar files into a image directory as new layers, in order, and update its metadata
+// adding the given labels to its configuration. If the directory contains an index (index.json) instead of a
+// manifest the layers are added to the image of every platform of the index
+func AddTarToLayer(imageDir string, labels map[string]string, layers ...LayerSource) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("No layers to add")
+	}
+
+	tarLayers := []*Layer{}
+	for _, source := range layers {
+		tarLayer, err := getLayer(source.Tar)
+		if err != nil {
+			return err
+		}
+		destFile := path.Join(imageDir, tarLayer.Sha256)
+		err = copyFile(source.Tar, destFile)
+		if err != nil {
+			return fmt.Errorf("Failed to copy tar file: %v", err)
+		}
+		log.Printf("Copied source %s to %s", source.Tar, destFile)
+		tarLayers = append(tarLayers, tarLayer)
+	}
+
+	indexPath := path.Join(imageDir, "index.json")
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		manifestPath := path.Join(imageDir, "manifest.json")
+		m, err := readManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+		log.Printf("Parsed manifest")
+		err = addLayersToManifest(imageDir, m, tarLayers, layers, labels)
+		if err != nil {
+			return err
+		}
+		mBytes, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(manifestPath, mBytes, 0644)
+		if err != nil {
+			return err
+		}
+		log.Printf("Updated manifest")
+		return nil
+	}
+
+	// Add the layers to the manifest of every platform, stored as blobs
+	indexFile, err := os.Open(indexPath)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(manifestPath, mBytes, 0644)
+	defer indexFile.Close()
+	index := Index{}
+	err = index.New(indexFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse image index: %v", err)
+	}
+	for n, entry := range index.Manifests {
+		if !index.IsImage(n) {
+			continue
+		}
+		m, err := readManifest(path.Join(imageDir, strings.TrimPrefix(entry.Digest, "sha256:")))
+		if err != nil {
+			return err
+		}
+		err = addLayersToManifest(imageDir, m, tarLayers, layers, labels)
+		if err != nil {
+			return err
+		}
+		mBytes, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		manifestLayer := Layer{Size: int64(len(mBytes)), Sha256: fmt.Sprintf("%x", sha256.Sum256(mBytes))}
+		err = saveBlob(mBytes, imageDir, manifestLayer.Sha256)
+		if err != nil {
+			return err
+		}
+		index.UpdateManifest(n, &manifestLayer)
+		log.Printf("Updated manifest of the platform %d at %s", n, manifestLayer.Sha256)
+	}
+	iBytes, err := json.Marshal(index)
 	if err != nil {
 		return err
 	}
-	log.Printf("Updated manifest")
-
+	err = ioutil.WriteFile(indexPath, iBytes, 0644)
+	if err != nil {
+		return err
+	}
+	log.Printf("Updated index")
 	return nil
 }
@@ -0,0 +1,84 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package layerbuilder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestAddTarToLayer(t *testing.T) {
+	imageDir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(imageDir)
+
+	description := []byte(`{"architecture":"amd64","history":[{"created":"2018-02-28T22:14:48.759033366Z","created_by":"/bin/sh -c #(nop) ADD file:327f69fc in / "}],"os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:c5183829"]}}`)
+	descriptionSha := fmt.Sprintf("%x", sha256.Sum256(description))
+	ioutil.WriteFile(path.Join(imageDir, descriptionSha), description, 0644)
+	ioutil.WriteFile(path.Join(imageDir, "manifest.json"), []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":"sha256:%s"},"layers":[{"digest":"sha256:c5183829"}]}`, descriptionSha)), 0644)
+	layers := []LayerSource{}
+	for _, name := range []string{"deps", "code"} {
+		tar := path.Join(imageDir, name+".tar")
+		ioutil.WriteFile(tar, []byte(name), 0644)
+		layers = append(layers, LayerSource{Tar: tar, CreatedBy: "kubeless: " + name})
+	}
+
+	if err := AddTarToLayer(imageDir, map[string]string{"io.kubeless.function.name": "foo"}, layers...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	manifestFile, _ := os.Open(path.Join(imageDir, "manifest.json"))
+	defer manifestFile.Close()
+	m := Manifest{}
+	m.New(manifestFile)
+	expectedLayers := []string{"sha256:c5183829", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("deps"))), fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("code")))}
+	if len(m.Layers) != len(expectedLayers) {
+		t.Fatalf("Expecting %d layers, received %v", len(expectedLayers), m.Layers)
+	}
+	for i, l := range m.Layers {
+		if l.Digest != expectedLayers[i] {
+			t.Errorf("Expecting the layer %d to be %s, received %s", i, expectedLayers[i], l.Digest)
+		}
+		if _, err := os.Stat(path.Join(imageDir, strings.TrimPrefix(l.Digest, "sha256:"))); i > 0 && err != nil {
+			t.Errorf("Expecting the layer %s to be copied: %v", l.Digest, err)
+		}
+	}
+
+	descriptionFile, err := os.Open(path.Join(imageDir, strings.TrimPrefix(m.Config.Digest, "sha256:")))
+	if err != nil {
+		t.Fatalf("Expecting the new description to be stored: %v", err)
+	}
+	defer descriptionFile.Close()
+	d := Description{}
+	d.New(descriptionFile)
+	if len(d.History) != 3 || d.History[1].CreatedBy != "kubeless: deps" || d.History[2].CreatedBy != "kubeless: code" {
+		t.Errorf("Expecting the history to describe the new layers, received %v", d.History)
+	}
+	if len(d.Rootfs.DiffIds) != 3 || d.Rootfs.DiffIds[2] != expectedLayers[2] {
+		t.Errorf("Unexpected diff ids %v", d.Rootfs.DiffIds)
+	}
+	if labels, ok := d.Config.Labels.(map[string]interface{}); !ok || labels["io.kubeless.function.name"] != "foo" {
+		t.Errorf("Expecting the labels in the configuration, received %v", d.Config.Labels)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package layerbuilder
 
 import (
+	"compress/gzip"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -41,3 +42,29 @@ func TestNewLayer(t *testing.T) {
 		t.Errorf("Wrong size, expecting patata, received %d", layer.Size)
 	}
 }
+
+func TestNewCompressedLayer(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	w := gzip.NewWriter(f)
+	w.Write([]byte("test content"))
+	w.Close()
+	f.Seek(0, 0)
+	layer := Layer{}
+	err = layer.New(f)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !layer.Compressed {
+		t.Error("Expecting the layer to be compressed")
+	}
+	if layer.DiffID != "6ae8a75555209fd6c44157c0aed8016e763ff435a19cf186f76863140143ff72" {
+		t.Errorf("Expecting the checksum of the uncompressed content, received %s", layer.DiffID)
+	}
+	if layer.Sha256 == layer.DiffID {
+		t.Error("Expecting the checksum of the compressed content")
+	}
+}
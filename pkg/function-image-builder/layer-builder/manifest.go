@@ -21,20 +21,72 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 )
 
+const (
+	// DockerManifestMediaType is the media type of the Docker image manifests (schema 2)
+	DockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	// DockerManifestListMediaType is the media type of the Docker multi-platform manifest lists
+	DockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	// DockerLayerMediaType is the media type of the layers of the Docker images
+	DockerLayerMediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	// OCIManifestMediaType is the media type of the OCI image manifests
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// OCIIndexMediaType is the media type of the OCI image indexes
+	OCIIndexMediaType = "application/vnd.oci.image.index.v1+json"
+	// OCIConfigMediaType is the media type of the configuration of the OCI images
+	OCIConfigMediaType = "application/vnd.oci.image.config.v1+json"
+	// OCILayerMediaType is the media type of the uncompressed layers of the OCI images
+	OCILayerMediaType = "application/vnd.oci.image.layer.v1.tar"
+	// OCIGzipLayerMediaType is the media type of the compressed layers of the OCI images
+	OCIGzipLayerMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// Platform is the operating system and architecture of an image of an index
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	Features     []string `json:"features,omitempty"`
+}
+
+// ParsePlatform parses a platform with the format os/arch[/variant]
+func ParsePlatform(platform string) (*Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Unable to parse the platform %q, expecting os/arch[/variant]", platform)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return &p, nil
+}
+
+// Matches returns true if the platform satisfies the requested one. The variant is only compared if requested
+func (p *Platform) Matches(requested *Platform) bool {
+	return p.OS == requested.OS && p.Architecture == requested.Architecture && (requested.Variant == "" || p.Variant == requested.Variant)
+}
+
 type layer struct {
-	MediaType string `json:"mediaType"`
-	Size      int64  `json:"size"`
-	Digest    string `json:"digest"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
 }
 
 // Manifest represent the manifest.json of an image
 type Manifest struct {
-	SchemaVersion int     `json:"schemaVersion"`
-	MediaType     string  `json:"mediaType"`
-	Config        layer   `json:"config"`
-	Layers        []layer `json:"layers"`
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        layer             `json:"config"`
+	Layers        []layer           `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
 }
 
 // New parses an io.Reader into a Manifest
@@ -50,17 +102,72 @@ func (m *Manifest) New(manifestFile io.Reader) error {
 	return nil
 }
 
+// IsOCI returns true if the manifest belongs to an OCI image. The media type is optional in OCI manifests
+func (m *Manifest) IsOCI() bool {
+	return m.MediaType == OCIManifestMediaType || (m.MediaType == "" && m.Config.MediaType == OCIConfigMediaType)
+}
+
 // UpdateConfig overrides the Config information of the manifest with a new Layer
 func (m *Manifest) UpdateConfig(newConfig *Layer) {
 	m.Config.Size = int64(newConfig.Size)
 	m.Config.Digest = fmt.Sprintf("sha256:%s", newConfig.Sha256)
 }
 
-// AddLayer adds a new layer to the list in the Manifest
+// AddLayer adds a new layer to the list in the Manifest, with the media type of the format of the image
 func (m *Manifest) AddLayer(newLayer *Layer) {
+	mediaType := DockerLayerMediaType
+	if m.IsOCI() {
+		mediaType = OCILayerMediaType
+		if newLayer.Compressed {
+			mediaType = OCIGzipLayerMediaType
+		}
+	}
 	m.Layers = append(m.Layers, layer{
-		MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+		MediaType: mediaType,
 		Size:      newLayer.Size,
 		Digest:    fmt.Sprintf("sha256:%s", newLayer.Sha256),
 	})
 }
+
+// Index represents an OCI image index or a Docker manifest list: the manifests of an image for several platforms
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []layer           `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// New parses an io.Reader into an Index
+func (i *Index) New(indexFile io.Reader) error {
+	indexContent, err := ioutil.ReadAll(indexFile)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(indexContent, i)
+}
+
+// IsImage returns true if the entry n of the index is the image of a platform. Indexes may contain other
+// artifacts, like attestations, with an unknown platform
+func (i *Index) IsImage(n int) bool {
+	entry := i.Manifests[n]
+	if entry.MediaType != DockerManifestMediaType && entry.MediaType != OCIManifestMediaType {
+		return false
+	}
+	return entry.Platform == nil || entry.Platform.OS != "unknown"
+}
+
+// Select returns the entry of the index for the given platform
+func (i *Index) Select(platform *Platform) (int, error) {
+	for n, entry := range i.Manifests {
+		if i.IsImage(n) && entry.Platform != nil && entry.Platform.Matches(platform) {
+			return n, nil
+		}
+	}
+	return -1, fmt.Errorf("Unable to find an image for the platform %s/%s", platform.OS, platform.Architecture)
+}
+
+// UpdateManifest points the entry n of the index to a new manifest
+func (i *Index) UpdateManifest(n int, newManifest *Layer) {
+	i.Manifests[n].Size = newManifest.Size
+	i.Manifests[n].Digest = fmt.Sprintf("sha256:%s", newManifest.Sha256)
+}
@@ -73,3 +73,59 @@ func TestUpdateConfig(t *testing.T) {
 		t.Errorf("Unexpected layer %v", m.Config)
 	}
 }
+
+func TestAddOCILayer(t *testing.T) {
+	manifestFile := strings.NewReader(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":1489,"digest":"sha256:c7fc094d"},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":723113,"digest":"sha256:d070b8ef"}],"annotations":{"org.opencontainers.image.source":"https://github.com/kubeless/kubeless"}}`)
+	m := Manifest{}
+	m.New(manifestFile)
+	if !m.IsOCI() {
+		t.Fatal("Expecting an OCI manifest")
+	}
+	m.AddLayer(&Layer{Size: 10, Sha256: "abc"})
+	m.AddLayer(&Layer{Size: 10, Sha256: "def", Compressed: true})
+	if m.Layers[1].MediaType != OCILayerMediaType || m.Layers[2].MediaType != OCIGzipLayerMediaType {
+		t.Errorf("Unexpected media types of the new layers %v", m.Layers)
+	}
+	if m.Annotations["org.opencontainers.image.source"] == "" {
+		t.Error("Expecting the annotations to be kept")
+	}
+}
+
+func TestIndexSelect(t *testing.T) {
+	indexFile := strings.NewReader(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","size":1,"digest":"sha256:amd64","platform":{"architecture":"amd64","os":"linux"}},{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","size":1,"digest":"sha256:armv7","platform":{"architecture":"arm","os":"linux","variant":"v7"}},{"mediaType":"application/vnd.oci.image.manifest.v1+json","size":1,"digest":"sha256:attestation","platform":{"architecture":"unknown","os":"unknown"}}]}`)
+	i := Index{}
+	if err := i.New(indexFile); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := map[string]string{
+		"linux/amd64":  "sha256:amd64",
+		"linux/arm":    "sha256:armv7",
+		"linux/arm/v7": "sha256:armv7",
+	}
+	for platform, digest := range tests {
+		p, err := ParsePlatform(platform)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		n, err := i.Select(p)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if i.Manifests[n].Digest != digest {
+			t.Errorf("Expecting %s for %s, received %s", digest, platform, i.Manifests[n].Digest)
+		}
+	}
+	for _, platform := range []string{"linux/arm/v6", "unknown/unknown"} {
+		p, _ := ParsePlatform(platform)
+		if _, err := i.Select(p); err == nil {
+			t.Errorf("Expecting an error for %s", platform)
+		}
+	}
+	if _, err := ParsePlatform("linux"); err == nil {
+		t.Error("Expecting an error for a platform without architecture")
+	}
+	i.UpdateManifest(0, &Layer{Size: 10, Sha256: "new"})
+	if i.Manifests[0].Digest != "sha256:new" || i.Manifests[0].Size != 10 || i.Manifests[0].Platform.Architecture != "amd64" {
+		t.Errorf("Unexpected entry %+v", i.Manifests[0])
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package layerbuilder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// addToTar writes the header of a file and, if it is a regular file, its content. The owner and the times of
+// the file are replaced so they don't change from one build to another
+func addToTar(tw *tar.Writer, file string, info os.FileInfo, mtime time.Time) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(file)
+		if err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = strings.TrimPrefix(filepath.ToSlash(file), "/")
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.ModTime = mtime
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// CreateLayer writes a gzipped tar with the given files and directories, including their content. The layer is
+// reproducible: the entries are sorted by name, they have the given modification time and belong to root and
+// the gzip header doesn't include any name or time
+func CreateLayer(dst string, files []string, mtime time.Time) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+	mtime = mtime.UTC().Truncate(time.Second)
+	for _, file := range sorted {
+		// Walk visits the entries of every directory in lexical order
+		err = filepath.Walk(file, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return addToTar(tw, p, info, mtime)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gw.Close()
+	if err != nil {
+		return err
+	}
+	return out.Sync()
+}
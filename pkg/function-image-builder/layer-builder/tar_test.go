@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package layerbuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "kubeless", "node_modules", "left-pad"), 0755)
+	ioutil.WriteFile(path.Join(dir, "kubeless", "node_modules", "left-pad", "index.js"), []byte("module.exports = {}"), 0644)
+	ioutil.WriteFile(path.Join(dir, "kubeless", "handler.js"), []byte("module.exports = {foo: () => 'hello'}"), 0644)
+	os.Symlink("handler.js", path.Join(dir, "kubeless", "main.js"))
+	files := []string{
+		path.Join(dir, "kubeless", "node_modules"),
+		path.Join(dir, "kubeless", "main.js"),
+		path.Join(dir, "kubeless", "handler.js"),
+	}
+	mtime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	first := path.Join(dir, "first.tar.gz")
+	if err := CreateLayer(first, files, mtime); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The same content generates the same layer even if the files are modified again and listed in other order
+	os.Chtimes(path.Join(dir, "kubeless", "handler.js"), time.Now(), time.Now())
+	second := path.Join(dir, "second.tar.gz")
+	if err := CreateLayer(second, []string{files[2], files[0], files[1]}, mtime); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	firstContent, _ := ioutil.ReadFile(first)
+	secondContent, _ := ioutil.ReadFile(second)
+	if !bytes.Equal(firstContent, secondContent) {
+		t.Error("Expecting the same content in both layers")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(firstContent))
+	if err != nil {
+		t.Fatalf("Expecting a gzipped tar: %v", err)
+	}
+	if gr.Header.Name != "" || !gr.Header.ModTime.IsZero() {
+		t.Errorf("Unexpected gzip header %+v", gr.Header)
+	}
+	tr := tar.NewReader(gr)
+	names := []string{}
+	prefix := strings.TrimPrefix(dir, "/") + "/kubeless/"
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		names = append(names, strings.TrimPrefix(hdr.Name, prefix))
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" || !hdr.ModTime.Equal(mtime) {
+			t.Errorf("Unexpected header %+v", hdr)
+		}
+		if hdr.Name == prefix+"main.js" && (hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "handler.js") {
+			t.Errorf("Expecting main.js to be a link, received %+v", hdr)
+		}
+	}
+	expected := []string{"handler.js", "main.js", "node_modules/", "node_modules/left-pad/", "node_modules/left-pad/index.js"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expecting the entries %v, received %v", expected, names)
+	}
+}
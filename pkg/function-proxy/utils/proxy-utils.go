@@ -49,6 +49,19 @@ var (
 		Name: "function_failures_total",
 		Help: "Number of exceptions in user function",
 	}, []string{"method"})
+	funcActivatorRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "function_activator_requests_total",
+		Help: "Number of requests received by the activator for a function scaled to zero",
+	}, []string{"function"})
+	funcColdStarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "function_cold_starts_total",
+		Help: "Number of times a function has been scaled up from zero",
+	}, []string{"function"})
+	funcColdStartHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "function_cold_start_duration_seconds",
+		Help:    "Time since a function is scaled up from zero until it has a ready pod",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"function"})
 )
 
 // PromHTTPHandler to expose the metrics, invoked in the golang runtime
@@ -75,7 +88,18 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	prometheus.MustRegister(funcHistogram, funcCalls, funcErrors)
+	prometheus.MustRegister(funcHistogram, funcCalls, funcErrors, funcActivatorRequests, funcColdStarts, funcColdStartHistogram)
+}
+
+// CountActivatorRequest increases the number of requests held by the activator for a function
+func CountActivatorRequest(function string) {
+	funcActivatorRequests.With(prometheus.Labels{"function": function}).Inc()
+}
+
+// ObserveColdStart records the time that a function scaled to zero took to have a ready pod
+func ObserveColdStart(function string, duration time.Duration) {
+	funcColdStarts.With(prometheus.Labels{"function": function}).Inc()
+	funcColdStartHistogram.With(prometheus.Labels{"function": function}).Observe(duration.Seconds())
 }
 
 // Logging Functions, required to expose statusCode property
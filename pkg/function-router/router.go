@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kubeless/kubeless/pkg/function-proxy/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var routedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "function_router_requests_total",
+	Help: "Number of requests routed to each revision of the function",
+}, []string{"revision"})
+
+// target is a revision of the function that receives a share of the requests
+type target struct {
+	Revision int64  `json:"revision"`
+	URL      string `json:"url"`
+	Weight   int32  `json:"weight"`
+	proxy    *httputil.ReverseProxy
+}
+
+// router sends each request to one of its targets with a probability proportional to its weight
+type router struct {
+	targets     []target
+	totalWeight int32
+	random      func(n int32) int32
+}
+
+// newRouter parses the list of targets in JSON format
+func newRouter(targetsJSON string) (*router, error) {
+	r := &router{random: rand.Int31n}
+	if err := json.Unmarshal([]byte(targetsJSON), &r.targets); err != nil {
+		return nil, fmt.Errorf("Unable to parse the router targets: %v", err)
+	}
+	for i := range r.targets {
+		if r.targets[i].Weight < 0 {
+			return nil, fmt.Errorf("Invalid weight %d for revision %d", r.targets[i].Weight, r.targets[i].Revision)
+		}
+		u, err := url.Parse(r.targets[i].URL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid URL for revision %d: %v", r.targets[i].Revision, err)
+		}
+		r.targets[i].proxy = httputil.NewSingleHostReverseProxy(u)
+		r.totalWeight += r.targets[i].Weight
+	}
+	if r.totalWeight == 0 {
+		return nil, fmt.Errorf("At least one target with a positive weight is required")
+	}
+	return r, nil
+}
+
+// pick returns the target for the next request
+func (r *router) pick() *target {
+	n := r.random(r.totalWeight)
+	for i := range r.targets {
+		if n < r.targets[i].Weight {
+			return &r.targets[i]
+		}
+		n -= r.targets[i].Weight
+	}
+	return &r.targets[len(r.targets)-1]
+}
+
+func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t := r.pick()
+	routedRequests.With(prometheus.Labels{"revision": strconv.FormatInt(t.Revision, 10)}).Inc()
+	t.proxy.ServeHTTP(w, req)
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func main() {
+	rand.Seed(time.Now().UnixNano())
+	r, err := newRouter(os.Getenv("ROUTER_TARGETS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	prometheus.MustRegister(routedRequests)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", r)
+	mux.HandleFunc("/healthz", health)
+	mux.Handle("/metrics", utils.PromHTTPHandler())
+
+	server := utils.NewServer(mux)
+
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+
+	utils.GracefulShutdown(server)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterPick(t *testing.T) {
+	r, err := newRouter(`[{"revision": 1, "url": "http://foo-r1:8080", "weight": 90}, {"revision": 2, "url": "http://foo-r2:8080", "weight": 10}]`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[int32]int64{0: 1, 89: 1, 90: 2, 99: 2}
+	for n, revision := range expected {
+		value := n
+		r.random = func(int32) int32 { return value }
+		if picked := r.pick(); picked.Revision != revision {
+			t.Errorf("Expecting revision %d for %d, received %d", revision, n, picked.Revision)
+		}
+	}
+
+	for _, invalid := range []string{"", `[{"revision": 1, "url": "http://foo-r1:8080", "weight": 0}]`, `[{"revision": 1, "url": "http://foo-r1:8080", "weight": -1}]`} {
+		if _, err := newRouter(invalid); err == nil {
+			t.Errorf("Expecting an error for targets %q", invalid)
+		}
+	}
+}
+
+func TestRouterForward(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("revision 2 " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	r, err := newRouter(`[{"revision": 1, "url": "http://foo-r1:8080", "weight": 0}, {"revision": 2, "url": "` + backend.URL + `", "weight": 100}]`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusCreated || string(body) != "revision 2 /foo" {
+		t.Errorf("Unexpected response %d: %s", res.StatusCode, body)
+	}
+}
@@ -64,6 +64,8 @@ type RuntimeInfo struct {
 	LivenessProbeInfo *v1.Probe        `yaml:"livenessProbeInfo,omitempty"`
 	DepName           string           `yaml:"depName"`
 	FileNameSuffix    string           `yaml:"fileNameSuffix"`
+	// BuildBackend overrides the backend used to build the images of the functions of the runtime
+	BuildBackend string `yaml:"buildBackend,omitempty"`
 }
 
 // New initializes a langruntime object
@@ -78,12 +80,35 @@ func New(config *v1.ConfigMap) *Langruntimes {
 
 // ReadConfigMap reads the configmap
 func (l *Langruntimes) ReadConfigMap() {
-	if runtimeImages, ok := l.kubelessConfig.Data["runtime-images"]; ok {
-		err := yaml.Unmarshal([]byte(runtimeImages), &l.AvailableRuntimes)
-		if err != nil {
-			logrus.Fatalf("Unable to get the runtime images: %v", err)
+	if err := l.ParseConfigMap(); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// ParseConfigMap reads the runtimes of the configmap, returning an error if they are not valid.
+// The available runtimes are not modified in that case
+func (l *Langruntimes) ParseConfigMap() error {
+	runtimeImages, ok := l.kubelessConfig.Data["runtime-images"]
+	if !ok {
+		return nil
+	}
+	var ri []RuntimeInfo
+	err := yaml.Unmarshal([]byte(runtimeImages), &ri)
+	if err != nil {
+		return fmt.Errorf("Unable to get the runtime images: %v", err)
+	}
+	for _, runtimeInf := range ri {
+		if runtimeInf.ID == "" {
+			return fmt.Errorf("Unable to get the runtime images: found a runtime without ID")
+		}
+		for _, versionInf := range runtimeInf.Versions {
+			if versionInf.Version == "" {
+				return fmt.Errorf("Unable to get the runtime images: found a version of %s without version number", runtimeInf.ID)
+			}
 		}
 	}
+	l.AvailableRuntimes = ri
+	return nil
 }
 
 // GetRuntimes returns the list of available runtimes as strings
@@ -137,6 +162,16 @@ func (l *Langruntimes) GetRuntimeInfo(runtime string) (RuntimeInfo, error) {
 	return RuntimeInfo{}, fmt.Errorf("Unable to find %s as runtime", runtime)
 }
 
+// GetBuildBackend returns the backend used to build the images of the functions of a runtime or an empty string
+// if the runtime uses the default one
+func (l *Langruntimes) GetBuildBackend(runtime string) string {
+	runtimeInf, err := l.GetRuntimeInfo(runtime)
+	if err != nil {
+		return ""
+	}
+	return runtimeInf.BuildBackend
+}
+
 // GetLivenessProbeInfo returs the liveness probe info regarding a runtime
 func (l *Langruntimes) GetLivenessProbeInfo(runtime string, port int) *v1.Probe {
 	livenessProbe := &v1.Probe{
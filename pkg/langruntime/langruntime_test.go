@@ -101,6 +101,39 @@ func TestGetRuntimes(t *testing.T) {
 	}
 }
 
+func TestParseConfigMap(t *testing.T) {
+	lr := SetupLangRuntime(clientset)
+	if err := lr.ParseConfigMap(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, runtimeImages := range []string{"not: [valid", `[{"versions": []}]`, `[{"ID": "python", "versions": [{"name": "python27"}]}]`} {
+		invalid := New(&v1.ConfigMap{Data: map[string]string{"runtime-images": runtimeImages}})
+		invalid.AvailableRuntimes = lr.AvailableRuntimes
+		if err := invalid.ParseConfigMap(); err == nil {
+			t.Errorf("Expecting an error parsing %s", runtimeImages)
+		}
+		if !reflect.DeepEqual(invalid.AvailableRuntimes, lr.AvailableRuntimes) {
+			t.Errorf("The runtimes should not change if the config is not valid")
+		}
+	}
+}
+
+func TestGetBuildBackend(t *testing.T) {
+	lr := New(&v1.ConfigMap{Data: map[string]string{"runtime-images": `[
+  {"ID": "python", "versions": [{"name": "python27", "version": "2.7"}]},
+  {"ID": "java", "buildBackend": "kaniko", "versions": [{"name": "java8", "version": "1.8"}]}
+]`}})
+	if err := lr.ParseConfigMap(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for runtime, expected := range map[string]string{"python2.7": "", "java1.8": "kaniko", "ruby2.4": ""} {
+		if backend := lr.GetBuildBackend(runtime); backend != expected {
+			t.Errorf("Expecting the backend %q for %s, received %q", expected, runtime, backend)
+		}
+	}
+}
+
 func TestGetBuildContainer(t *testing.T) {
 	lr := SetupLangRuntime(clientset)
 	lr.ReadConfigMap()
@@ -0,0 +1,320 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes returned by the registry API
+const (
+	ErrorCodeBlobUnknown     = "BLOB_UNKNOWN"
+	ErrorCodeManifestUnknown = "MANIFEST_UNKNOWN"
+	ErrorCodeNameUnknown     = "NAME_UNKNOWN"
+	ErrorCodeUnauthorized    = "UNAUTHORIZED"
+	ErrorCodeDenied          = "DENIED"
+	ErrorCodeUnsupported     = "UNSUPPORTED"
+	ErrorCodeTooManyRequests = "TOOMANYREQUESTS"
+)
+
+// Error is an unexpected response of the registry
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Code       string // Code of the first error of the response, if any
+	Message    string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("Unexpected response from %s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += " " + e.Message
+	}
+	return msg
+}
+
+type errorResponse struct {
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// newError parses the body of an error response of the registry
+func newError(resp *http.Response, body []byte) *Error {
+	e := Error{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+	}
+	errResp := errorResponse{}
+	if json.Unmarshal(body, &errResp) == nil && len(errResp.Errors) > 0 {
+		e.Code = errResp.Errors[0].Code
+		e.Message = errResp.Errors[0].Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return &e
+}
+
+// checkResponse returns an *Error if the status of the response is not the expected one
+func checkResponse(resp *http.Response, expected ...int) error {
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return newError(resp, body)
+}
+
+// hasCode returns true if the error is an *Error with any of the given codes or status codes
+func hasCode(err error, codes []string, statusCodes ...int) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if e.Code == code {
+			return true
+		}
+	}
+	for _, status := range statusCodes {
+		if e.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound returns true if the registry doesn't have the requested image, manifest or blob
+func IsNotFound(err error) bool {
+	return hasCode(err, []string{ErrorCodeNameUnknown, ErrorCodeManifestUnknown, ErrorCodeBlobUnknown}, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if the credentials are not valid or don't allow the requested operation
+func IsUnauthorized(err error) bool {
+	return hasCode(err, []string{ErrorCodeUnauthorized, ErrorCodeDenied}, http.StatusUnauthorized, http.StatusForbidden)
+}
+
+// IsUnsupported returns true if the registry doesn't implement the requested operation
+func IsUnsupported(err error) bool {
+	return hasCode(err, []string{ErrorCodeUnsupported}, http.StatusMethodNotAllowed)
+}
+
+// authorization is a value of the Authorization header accepted by a registry
+type authorization struct {
+	header  string
+	expires time.Time // Zero if it doesn't expire
+}
+
+// authorizations caches the authorization of every repository so the tokens are reused until they expire
+var authorizations = struct {
+	sync.Mutex
+	values map[string]authorization
+}{values: map[string]authorization{}}
+
+// defaultTokenExpiration is the validity of the tokens that don't specify it
+const defaultTokenExpiration = 60 * time.Second
+
+var repositoryRegexp = regexp.MustCompile("^/v[0-9]+/(?:repositories/)?(.+?)/(?:manifests|blobs|tags)/")
+
+// authorizationKey identifies the authorization used for a request: the registry, the credentials and the repository
+func (r *Registry) authorizationKey(reqURL string) string {
+	repository := ""
+	if u, err := url.Parse(reqURL); err == nil {
+		if match := repositoryRegexp.FindStringSubmatch(u.Path); len(match) == 2 {
+			repository = match[1]
+		}
+	}
+	creds := sha256.Sum256([]byte(r.Creds.Username + ":" + r.Creds.Password + ":" + r.Creds.Auth))
+	return fmt.Sprintf("%s|%x|%s", r.Endpoint, creds, repository)
+}
+
+func cachedAuthorization(key string) string {
+	authorizations.Lock()
+	defer authorizations.Unlock()
+	auth, ok := authorizations.values[key]
+	if !ok {
+		return ""
+	}
+	if !auth.expires.IsZero() && time.Now().After(auth.expires) {
+		delete(authorizations.values, key)
+		return ""
+	}
+	return auth.header
+}
+
+func storeAuthorization(key string, auth authorization) {
+	authorizations.Lock()
+	defer authorizations.Unlock()
+	authorizations.values[key] = auth
+}
+
+// httpClient returns the client for the registry, skipping the TLS verification if the registry is insecure.
+// The client is created on the first request, so Insecure should not be changed after that
+func (r *Registry) httpClient() *http.Client {
+	r.clientOnce.Do(func() {
+		r.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:              http.ProxyFromEnvironment,
+				MaxIdleConns:       10,
+				IdleConnTimeout:    30 * time.Second,
+				DisableCompression: true,
+				TLSClientConfig:    &tls.Config{InsecureSkipVerify: r.Insecure},
+			},
+		}
+	})
+	return r.client
+}
+
+// basicAuth returns the value of the Authorization header for the basic authentication with the registry credentials
+func (r *Registry) basicAuth() (string, error) {
+	if r.Creds.Username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.Creds.Username+":"+r.Creds.Password)), nil
+	}
+	if r.Creds.Auth != "" {
+		return "Basic " + r.Creds.Auth, nil
+	}
+	return "", fmt.Errorf("The registry %s requires credentials", r.Endpoint)
+}
+
+type authResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+// authorize returns the authorization that satisfies the given challenge of the registry: the credentials for
+// the basic authentication or a token obtained with them
+func (r *Registry) authorize(client *http.Client, challenge string) (authorization, error) {
+	if strings.HasPrefix(challenge, "Basic") {
+		header, err := r.basicAuth()
+		return authorization{header: header}, err
+	}
+	realm, err := findProperty(challenge, "Bearer realm")
+	if err != nil {
+		return authorization{}, fmt.Errorf("Unable to extract auth info: %v", err)
+	}
+	query := url.Values{}
+	for _, property := range []string{"service", "scope"} {
+		if value, err := findProperty(challenge, property); err == nil {
+			query.Set(property, value)
+		}
+	}
+	req, err := http.NewRequest("GET", realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return authorization{}, err
+	}
+	if auth, err := r.basicAuth(); err == nil {
+		// Anonymous tokens are enough for public images
+		req.Header.Set("Authorization", auth)
+	}
+	requested := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return authorization{}, fmt.Errorf("Unable to obtain auth token: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return authorization{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return authorization{}, fmt.Errorf("Unable to obtain auth token: %v", newError(resp, body))
+	}
+	authr := authResponse{}
+	err = json.Unmarshal(body, &authr)
+	if err != nil {
+		return authorization{}, fmt.Errorf("Unable to parse auth token: %v", err)
+	}
+	if authr.Token == "" {
+		authr.Token = authr.AccessToken
+	}
+	issued, err := time.Parse(time.RFC3339, authr.IssuedAt)
+	if err != nil {
+		issued = requested
+	}
+	expiration := defaultTokenExpiration
+	if authr.ExpiresIn > 0 {
+		expiration = time.Duration(authr.ExpiresIn) * time.Second
+	}
+	return authorization{header: "Bearer " + authr.Token, expires: issued.Add(expiration)}, nil
+}
+
+// do sends a request to the registry, authenticating with its credentials if the registry requires it.
+// The authorization is cached for the following requests to the same repository.
+// The body is opened again if the request needs to be repeated after the authentication
+func (r *Registry) do(method, reqURL string, header http.Header, body func() (io.ReadCloser, error), size int64) (*http.Response, error) {
+	client := r.httpClient()
+	key := r.authorizationKey(reqURL)
+	send := func(auth string) (*http.Response, error) {
+		content := io.ReadCloser(http.NoBody)
+		if body != nil {
+			var err error
+			content, err = body()
+			if err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequest(method, reqURL, content)
+		if err != nil {
+			content.Close()
+			return nil, err
+		}
+		req.ContentLength = size
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return client.Do(req)
+	}
+	resp, err := send(cachedAuthorization(key))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+	challenge := resp.Header.Get("Www-Authenticate")
+	if challenge == "" {
+		return nil, fmt.Errorf("Failed to authenticate: unknown authentication format for %s", reqURL)
+	}
+	auth, err := r.authorize(client, challenge)
+	if err != nil {
+		return nil, err
+	}
+	storeAuthorization(key, auth)
+	return send(auth.header)
+}
@@ -0,0 +1,236 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenRegistry is a registry that requires a token issued by its own /token endpoint for every request
+type tokenRegistry struct {
+	*httptest.Server
+	username, password string
+	issuedAt           time.Time
+	expiresIn          int
+	tokensIssued       int
+	tags               []string
+	pageSize           int
+	denyListing        bool
+}
+
+func newTokenRegistry(username, password string) *tokenRegistry {
+	r := &tokenRegistry{username: username, password: password, issuedAt: time.Now(), expiresIn: 300, pageSize: 2}
+	r.Server = httptest.NewServer(r)
+	return r
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q,"message":%q}]}`, code, message)
+}
+
+func (r *tokenRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != r.username || pass != r.password {
+			writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "wrong credentials")
+			return
+		}
+		if req.URL.Query().Get("service") != "test" {
+			writeError(w, http.StatusBadRequest, "", "unknown service")
+			return
+		}
+		r.tokensIssued++
+		json.NewEncoder(w).Encode(authResponse{
+			Token:     fmt.Sprintf("token-%d", r.tokensIssued),
+			ExpiresIn: r.expiresIn,
+			IssuedAt:  r.issuedAt.Format(time.RFC3339),
+		})
+		return
+	}
+	if req.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", r.tokensIssued) {
+		scope := "repository:" + strings.Split(strings.TrimPrefix(req.URL.Path, "/v2/"), "/")[0] + ":pull"
+		w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="%s"`, r.URL, scope))
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "authentication required")
+		return
+	}
+	switch req.URL.Path {
+	case "/v2/foo/tags/list":
+		if r.denyListing {
+			writeError(w, http.StatusForbidden, ErrorCodeDenied, "requested access to the resource is denied")
+			return
+		}
+		start := 0
+		fmt.Sscanf(req.URL.Query().Get("last"), "%d", &start)
+		end := start + r.pageSize
+		if end < len(r.tags) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/foo/tags/list?n=%d&last=%d>; rel="next"`, r.pageSize, end))
+		} else {
+			end = len(r.tags)
+		}
+		json.NewEncoder(w).Encode(tagListV2{Name: "foo", Tags: r.tags[start:end]})
+	case "/v2/foo/manifests/latest":
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	case "/v2/foo/manifests/old":
+		writeError(w, http.StatusNotFound, ErrorCodeManifestUnknown, "manifest unknown")
+	default:
+		writeError(w, http.StatusNotFound, ErrorCodeNameUnknown, "repository name not known to registry")
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	server := newTokenRegistry("user", "pass")
+	defer server.Close()
+	r := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	for i := 0; i < 3; i++ {
+		digest, err := r.ImageDigest("foo", "latest")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if digest != "sha256:abc" {
+			t.Errorf("Unexpected digest %s", digest)
+		}
+	}
+	if server.tokensIssued != 1 {
+		t.Errorf("Expecting the token to be reused, %d tokens were issued", server.tokensIssued)
+	}
+
+	// A different repository requires its own token
+	if _, err := r.ImageExists("bar", "latest"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server.tokensIssued != 2 {
+		t.Errorf("Expecting a new token for a different repository, %d tokens were issued", server.tokensIssued)
+	}
+
+	// The credentials are required to obtain a token
+	wrong := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "wrong"}}
+	if _, err := wrong.ImageDigest("foo", "latest"); err == nil {
+		t.Error("Expecting an error with the wrong credentials")
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	r := &tokenRegistry{username: "user", password: "pass", issuedAt: time.Now(), expiresIn: 300, pageSize: 2}
+	r.Server = httptest.NewUnstartedServer(r)
+	var connections int32
+	r.Server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	r.Server.Start()
+	defer r.Server.Close()
+	reg := Registry{Endpoint: r.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	for i := 0; i < 5; i++ {
+		if _, err := reg.ImageDigest("foo", "latest"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if reg.httpClient() != reg.httpClient() {
+		t.Error("Expecting the HTTP client to be shared by the requests")
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("Expecting the requests to reuse the connection, %d connections were opened", n)
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	server := newTokenRegistry("user", "pass")
+	defer server.Close()
+	server.issuedAt = time.Now().Add(-time.Hour)
+	server.expiresIn = 60
+	r := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	for i := 1; i <= 2; i++ {
+		if _, err := r.ImageDigest("foo", "latest"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server.tokensIssued != i {
+			t.Errorf("Expecting the expired token to be renewed, %d tokens were issued", server.tokensIssued)
+		}
+	}
+}
+
+func TestTagsPagination(t *testing.T) {
+	server := newTokenRegistry("user", "pass")
+	defer server.Close()
+	server.tags = []string{"1", "2", "3", "4", "5"}
+	r := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	tags, err := r.Tags("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, server.tags) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+	exists, err := r.ImageExists("foo", "5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("Expecting the tag of the last page to exist")
+	}
+}
+
+func TestImageExistsFallback(t *testing.T) {
+	server := newTokenRegistry("user", "pass")
+	defer server.Close()
+	server.denyListing = true
+	r := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	if _, err := r.Tags("foo"); !IsUnauthorized(err) {
+		t.Errorf("Expecting an unauthorized error, received %v", err)
+	}
+	exists, err := r.ImageExists("foo", "latest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("Expecting foo:latest to exist")
+	}
+	exists, err = r.ImageExists("foo", "old")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("Expecting foo:old to not exist")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newTokenRegistry("user", "pass")
+	defer server.Close()
+	r := Registry{Endpoint: server.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+
+	_, err := r.Tags("missing")
+	if !IsNotFound(err) {
+		t.Errorf("Expecting a not found error, received %v", err)
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expecting an *Error, received %T", err)
+	}
+	if e.StatusCode != http.StatusNotFound || e.Code != ErrorCodeNameUnknown || e.Message != "repository name not known to registry" {
+		t.Errorf("Unexpected error %+v", e)
+	}
+	if IsUnauthorized(err) || IsUnsupported(err) {
+		t.Errorf("Unexpected classification of %v", err)
+	}
+	if !IsUnsupported(&Error{StatusCode: http.StatusMethodNotAllowed}) {
+		t.Error("Expecting 405 to be unsupported")
+	}
+	if IsNotFound(fmt.Errorf("not found")) {
+		t.Error("Expecting only registry errors to be classified")
+	}
+}
@@ -0,0 +1,521 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	lbuilder "github.com/kubeless/kubeless/pkg/function-image-builder/layer-builder"
+)
+
+// dockerHub is the name of the default registry of the images without a host
+const dockerHub = "docker.io"
+
+// dockerHubIndex is the host used in the credentials of the Docker Hub
+const dockerHubIndex = "index.docker.io"
+
+// Descriptor points to a blob of an image
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// ImageManifest represents the manifest of an image: its configuration and its layers
+type ImageManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Reference represents the name of an image in a registry
+type Reference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image name like registry.example.com/user/image:tag or user/image@sha256:...
+// Images without a host belong to the Docker Hub
+func ParseReference(image string) (*Reference, error) {
+	name := strings.TrimPrefix(image, "docker://")
+	ref := Reference{}
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("Unable to parse image name %q", image)
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Host = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Host = dockerHub
+		ref.Repository = name
+	}
+	if ref.Host == dockerHubIndex {
+		ref.Host = dockerHub
+	}
+	if ref.Host == dockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return &ref, nil
+}
+
+// Reference returns the digest of the image if known or its tag otherwise
+func (ref *Reference) Reference() string {
+	if ref.Digest != "" {
+		return ref.Digest
+	}
+	return ref.Tag
+}
+
+// Endpoint returns the default URL of the registry of the image
+func (ref *Reference) Endpoint() string {
+	if ref.Host == dockerHub {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + ref.Host
+}
+
+// Serves returns true if the image belongs to the registry
+func (r *Registry) Serves(ref *Reference) bool {
+	endpoint, err := url.Parse(r.Endpoint)
+	if err != nil {
+		return false
+	}
+	host := endpoint.Host
+	if host == dockerHubIndex || host == "registry-1.docker.io" {
+		host = dockerHub
+	}
+	return host == ref.Host
+}
+
+func (r *Registry) manifestURL(repository, reference string) string {
+	return fmt.Sprintf("%s/v2/%s/manifests/%s", r.Endpoint, repository, reference)
+}
+
+func (r *Registry) blobURL(repository, digest string) string {
+	return fmt.Sprintf("%s/v2/%s/blobs/%s", r.Endpoint, repository, digest)
+}
+
+// manifestMediaTypes are the formats of manifests and indexes supported
+var manifestMediaTypes = []string{
+	lbuilder.DockerManifestMediaType,
+	lbuilder.DockerManifestListMediaType,
+	lbuilder.OCIManifestMediaType,
+	lbuilder.OCIIndexMediaType,
+}
+
+// manifestMediaType returns the media type of a manifest or an index, which is optional in the OCI formats.
+// The content type is used if the document doesn't include it
+func manifestMediaType(content []byte, contentType string) string {
+	document := struct {
+		MediaType string       `json:"mediaType"`
+		Config    *Descriptor  `json:"config"`
+		Manifests []Descriptor `json:"manifests"`
+	}{}
+	json.Unmarshal(content, &document)
+	if document.MediaType != "" {
+		return document.MediaType
+	}
+	for _, mediaType := range manifestMediaTypes {
+		if contentType == mediaType {
+			return mediaType
+		}
+	}
+	switch {
+	case document.Manifests != nil:
+		return lbuilder.OCIIndexMediaType
+	case document.Config != nil && document.Config.MediaType == lbuilder.OCIConfigMediaType:
+		return lbuilder.OCIManifestMediaType
+	default:
+		return lbuilder.DockerManifestMediaType
+	}
+}
+
+// Manifest returns the manifest or the index of the given image (a tag or a digest) and its content type
+func (r *Registry) Manifest(repository, reference string) ([]byte, string, error) {
+	header := http.Header{"Accept": manifestMediaTypes}
+	resp, err := r.do("GET", r.manifestURL(repository, reference), header, nil, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, "", err
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, resp.Header.Get("Content-Type"), nil
+}
+
+// PutManifest uploads the manifest of an image with the given tag and returns its digest
+func (r *Registry) PutManifest(repository, tag, mediaType string, manifest []byte) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	resp, err := r.do("PUT", r.manifestURL(repository, tag), header, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(manifest)), nil
+	}, int64(len(manifest)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusCreated, http.StatusOK); err != nil {
+		return "", err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	}
+	return digest, nil
+}
+
+// Blob returns the content of a blob of the given repository. The caller must close it
+func (r *Registry) Blob(repository, digest string) (io.ReadCloser, error) {
+	resp, err := r.do("GET", r.blobURL(repository, digest), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ImageLabels returns the labels of the configuration of the given image (a tag or a digest). If the image is a
+// manifest list or an OCI index the labels of its first image are returned
+func (r *Registry) ImageLabels(repository, reference string) (map[string]string, error) {
+	content, contentType, err := r.Manifest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	switch mediaType := manifestMediaType(content, contentType); mediaType {
+	case lbuilder.DockerManifestMediaType, lbuilder.OCIManifestMediaType:
+		manifest := ImageManifest{}
+		err = json.Unmarshal(content, &manifest)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the manifest of %s:%s: %v", repository, reference, err)
+		}
+		blob, err := r.Blob(repository, manifest.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		defer blob.Close()
+		description := struct {
+			Config struct {
+				Labels map[string]string
+			} `json:"config"`
+		}{}
+		err = json.NewDecoder(blob).Decode(&description)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the configuration of %s:%s: %v", repository, reference, err)
+		}
+		return description.Config.Labels, nil
+	case lbuilder.DockerManifestListMediaType, lbuilder.OCIIndexMediaType:
+		index := lbuilder.Index{}
+		err = json.Unmarshal(content, &index)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the index of %s:%s: %v", repository, reference, err)
+		}
+		for n, entry := range index.Manifests {
+			if index.IsImage(n) {
+				return r.ImageLabels(repository, entry.Digest)
+			}
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("The manifest of %s:%s has an unsupported media type %q", repository, reference, mediaType)
+	}
+}
+
+// BlobExists checks if the given repository already contains a blob
+func (r *Registry) BlobExists(repository, digest string) (bool, error) {
+	resp, err := r.do("HEAD", r.blobURL(repository, digest), nil, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// startUpload starts the upload of a blob. If from is not empty the registry tries to mount the blob from that
+// repository instead. It returns true if the blob has been mounted or the location for the upload otherwise
+func (r *Registry) startUpload(repository, digest, from string) (bool, string, error) {
+	uploadURL := fmt.Sprintf("%s/v2/%s/blobs/uploads/", r.Endpoint, repository)
+	if from != "" {
+		uploadURL += "?" + url.Values{"mount": {digest}, "from": {from}}.Encode()
+	}
+	resp, err := r.do("POST", uploadURL, nil, nil, 0)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusCreated, http.StatusAccepted); err != nil {
+		return false, "", err
+	}
+	if resp.StatusCode == http.StatusCreated {
+		return true, "", nil
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return false, "", fmt.Errorf("Unable to parse the upload location: %v", err)
+	}
+	return false, location.String(), nil
+}
+
+// finishUpload sends the content of a blob to an upload location
+func (r *Registry) finishUpload(location string, blob Descriptor, content func() (io.ReadCloser, error)) error {
+	uploadURL, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := uploadURL.Query()
+	query.Set("digest", blob.Digest)
+	uploadURL.RawQuery = query.Encode()
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := r.do("PUT", uploadURL.String(), header, content, blob.Size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, http.StatusCreated)
+}
+
+// BlobSource is a repository that may contain the blobs of an image that is being pushed
+type BlobSource struct {
+	Registry   *Registry
+	Repository string
+}
+
+// blobPath returns the file that stores a blob in an image directory
+func blobPath(dir, digest string) string {
+	return path.Join(dir, strings.TrimPrefix(digest, "sha256:"))
+}
+
+// storeManifest stores the manifest of an image in a file and its configuration as a blob of the directory
+func storeManifest(r *Registry, repository, reference string, content []byte, manifestPath, dir string) error {
+	manifest := ImageManifest{}
+	err := json.Unmarshal(content, &manifest)
+	if err != nil {
+		return fmt.Errorf("Unable to parse the manifest of %s:%s: %v", repository, reference, err)
+	}
+	err = ioutil.WriteFile(manifestPath, content, 0644)
+	if err != nil {
+		return err
+	}
+
+	config, err := r.Blob(repository, manifest.Config.Digest)
+	if err != nil {
+		return fmt.Errorf("Unable to get the configuration of %s:%s: %v", repository, reference, err)
+	}
+	defer config.Close()
+	configContent, err := ioutil.ReadAll(config)
+	if err != nil {
+		return err
+	}
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(configContent)); digest != manifest.Config.Digest {
+		return fmt.Errorf("The configuration of %s:%s has the digest %s, expecting %s", repository, reference, digest, manifest.Config.Digest)
+	}
+	return ioutil.WriteFile(blobPath(dir, manifest.Config.Digest), configContent, 0644)
+}
+
+// PullManifest stores the manifest and the configuration of an image in a directory, with the layout used by
+// the layer-builder. The layers are not downloaded, they are copied from the source of the image when pushing it.
+// If the image is a manifest list or an OCI index, the manifest of the given platform (os/arch[/variant]) is stored.
+// If the platform is empty the index is stored as index.json with the manifests of every platform as blobs
+func PullManifest(r *Registry, repository, reference, dir, platform string) error {
+	content, contentType, err := r.Manifest(repository, reference)
+	if err != nil {
+		return fmt.Errorf("Unable to get the manifest of %s:%s: %v", repository, reference, err)
+	}
+	switch mediaType := manifestMediaType(content, contentType); mediaType {
+	case lbuilder.DockerManifestMediaType, lbuilder.OCIManifestMediaType:
+		return storeManifest(r, repository, reference, content, path.Join(dir, "manifest.json"), dir)
+	case lbuilder.DockerManifestListMediaType, lbuilder.OCIIndexMediaType:
+		index := lbuilder.Index{}
+		err = json.Unmarshal(content, &index)
+		if err != nil {
+			return fmt.Errorf("Unable to parse the index of %s:%s: %v", repository, reference, err)
+		}
+		if platform != "" {
+			p, err := lbuilder.ParsePlatform(platform)
+			if err != nil {
+				return err
+			}
+			n, err := index.Select(p)
+			if err != nil {
+				return fmt.Errorf("Unable to use %s:%s: %v", repository, reference, err)
+			}
+			return PullManifest(r, repository, index.Manifests[n].Digest, dir, "")
+		}
+		for _, entry := range index.Manifests {
+			if entry.MediaType != lbuilder.DockerManifestMediaType && entry.MediaType != lbuilder.OCIManifestMediaType {
+				return fmt.Errorf("The index of %s:%s contains an unsupported manifest %s (%s)", repository, reference, entry.Digest, entry.MediaType)
+			}
+			manifest, _, err := r.Manifest(repository, entry.Digest)
+			if err != nil {
+				return fmt.Errorf("Unable to get the manifest %s of %s:%s: %v", entry.Digest, repository, reference, err)
+			}
+			if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)); digest != entry.Digest {
+				return fmt.Errorf("The manifest %s of %s:%s has the digest %s", entry.Digest, repository, reference, digest)
+			}
+			err = storeManifest(r, repository, entry.Digest, manifest, blobPath(dir, entry.Digest), dir)
+			if err != nil {
+				return err
+			}
+		}
+		return ioutil.WriteFile(path.Join(dir, "index.json"), content, 0644)
+	default:
+		return fmt.Errorf("The manifest of %s:%s has an unsupported media type %q", repository, reference, mediaType)
+	}
+}
+
+// pushBlob makes a blob available in the repository. Blobs that the repository already has are skipped, blobs
+// of other repositories of the same registry are mounted and the rest are uploaded from the image directory or,
+// if they are not there, copied from the first source
+func pushBlob(dir string, r *Registry, repository string, blob Descriptor, sources []BlobSource) error {
+	exists, err := r.BlobExists(repository, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	location := ""
+	for _, source := range sources {
+		if source.Registry.Endpoint != r.Endpoint || source.Repository == repository {
+			continue
+		}
+		var mounted bool
+		mounted, location, err = r.startUpload(repository, blob.Digest, source.Repository)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			return nil
+		}
+	}
+	if location == "" {
+		_, location, err = r.startUpload(repository, blob.Digest, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	content := func() (io.ReadCloser, error) {
+		return os.Open(blobPath(dir, blob.Digest))
+	}
+	if _, err := os.Stat(blobPath(dir, blob.Digest)); os.IsNotExist(err) {
+		if len(sources) == 0 {
+			return fmt.Errorf("Unable to find the blob %s", blob.Digest)
+		}
+		content = func() (io.ReadCloser, error) {
+			return sources[0].Registry.Blob(sources[0].Repository, blob.Digest)
+		}
+	}
+	return r.finishUpload(location, blob, content)
+}
+
+// pushManifest uploads the blobs of a manifest and then the manifest with the given reference
+func pushManifest(dir string, r *Registry, repository, reference, mediaType string, content []byte, sources []BlobSource) (string, error) {
+	manifest := ImageManifest{}
+	err := json.Unmarshal(content, &manifest)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse the image manifest: %v", err)
+	}
+	for _, blob := range append(manifest.Layers, manifest.Config) {
+		err = pushBlob(dir, r, repository, blob, sources)
+		if err != nil {
+			return "", fmt.Errorf("Unable to push the blob %s to %s: %v", blob.Digest, repository, err)
+		}
+	}
+	digest, err := r.PutManifest(repository, reference, manifestMediaType(content, mediaType), content)
+	if err != nil {
+		return "", fmt.Errorf("Unable to push the manifest of %s:%s: %v", repository, reference, err)
+	}
+	return digest, nil
+}
+
+// PushImage uploads the image stored in a directory by PullManifest and the layer-builder with the given tag and
+// returns the digest of its manifest, or of its index if it has one. The sources are the repositories where the
+// blobs missing in the directory are
+func PushImage(dir string, r *Registry, repository, tag string, sources ...BlobSource) (string, error) {
+	content, err := ioutil.ReadFile(path.Join(dir, "index.json"))
+	if os.IsNotExist(err) {
+		content, err = ioutil.ReadFile(path.Join(dir, "manifest.json"))
+		if err != nil {
+			return "", err
+		}
+		return pushManifest(dir, r, repository, tag, "", content, sources)
+	}
+	if err != nil {
+		return "", err
+	}
+	index := lbuilder.Index{}
+	err = json.Unmarshal(content, &index)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse the image index: %v", err)
+	}
+	// The manifests of the index need to exist before it
+	for _, entry := range index.Manifests {
+		manifest, err := ioutil.ReadFile(blobPath(dir, entry.Digest))
+		if err != nil {
+			return "", err
+		}
+		_, err = pushManifest(dir, r, repository, entry.Digest, entry.MediaType, manifest, sources)
+		if err != nil {
+			return "", err
+		}
+	}
+	digest, err := r.PutManifest(repository, tag, manifestMediaType(content, ""), content)
+	if err != nil {
+		return "", fmt.Errorf("Unable to push the index of %s:%s: %v", repository, tag, err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,387 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	lbuilder "github.com/kubeless/kubeless/pkg/function-image-builder/layer-builder"
+)
+
+// testRegistry is a minimal in-process implementation of the registry v2 API
+type testRegistry struct {
+	sync.Mutex
+	username  string
+	password  string
+	blobs     map[string][]byte // repository@digest -> content
+	manifests map[string][]byte // repository:tag -> content
+	mounts    int
+	uploads   int
+}
+
+var (
+	uploadRoute   = regexp.MustCompile("^/v2/(.+)/blobs/uploads/([^/]*)$")
+	blobRoute     = regexp.MustCompile("^/v2/(.+)/blobs/([^/]+)$")
+	manifestRoute = regexp.MustCompile("^/v2/(.+)/manifests/([^/]+)$")
+)
+
+func newTestRegistry(username, password string) (*testRegistry, *httptest.Server) {
+	r := &testRegistry{
+		username:  username,
+		password:  password,
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+	}
+	return r, httptest.NewServer(r)
+}
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// addImage stores a Docker image, or an OCI image if the media type of the manifest is empty, and returns its manifest
+func (r *testRegistry) addImage(repository, tag, mediaType string, config []byte, layers ...[]byte) []byte {
+	manifest := ImageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaType,
+		Config:        Descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Size: int64(len(config)), Digest: digestOf(config)},
+	}
+	layerMediaType := lbuilder.DockerLayerMediaType
+	if mediaType == "" {
+		manifest.Config.MediaType = lbuilder.OCIConfigMediaType
+		layerMediaType = lbuilder.OCIGzipLayerMediaType
+	}
+	r.blobs[repository+"@"+digestOf(config)] = config
+	for _, layer := range layers {
+		r.blobs[repository+"@"+digestOf(layer)] = layer
+		manifest.Layers = append(manifest.Layers, Descriptor{MediaType: layerMediaType, Size: int64(len(layer)), Digest: digestOf(layer)})
+	}
+	content, _ := json.Marshal(manifest)
+	r.manifests[repository+":"+tag] = content
+	r.manifests[repository+":"+digestOf(content)] = content
+	return content
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	if r.username != "" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != r.username || pass != r.password {
+			w.Header().Set("Www-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	switch {
+	case uploadRoute.MatchString(req.URL.Path):
+		match := uploadRoute.FindStringSubmatch(req.URL.Path)
+		repository := match[1]
+		query := req.URL.Query()
+		switch req.Method {
+		case "POST":
+			if from := query.Get("from"); from != "" {
+				if content, ok := r.blobs[from+"@"+query.Get("mount")]; ok {
+					r.blobs[repository+"@"+query.Get("mount")] = content
+					r.mounts++
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/upload-id?_state=abc", repository))
+			w.WriteHeader(http.StatusAccepted)
+		case "PUT":
+			content, _ := ioutil.ReadAll(req.Body)
+			if query.Get("_state") != "abc" || digestOf(content) != query.Get("digest") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.blobs[repository+"@"+query.Get("digest")] = content
+			r.uploads++
+			w.WriteHeader(http.StatusCreated)
+		}
+	case blobRoute.MatchString(req.URL.Path):
+		match := blobRoute.FindStringSubmatch(req.URL.Path)
+		content, ok := r.blobs[match[1]+"@"+match[2]]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		w.Write(content)
+	case manifestRoute.MatchString(req.URL.Path):
+		match := manifestRoute.FindStringSubmatch(req.URL.Path)
+		key := match[1] + ":" + match[2]
+		if req.Method == "PUT" {
+			content, _ := ioutil.ReadAll(req.Body)
+			manifest := ImageManifest{}
+			index := lbuilder.Index{}
+			json.Unmarshal(content, &manifest)
+			json.Unmarshal(content, &index)
+			for _, blob := range append(manifest.Layers, manifest.Config) {
+				if _, ok := r.blobs[match[1]+"@"+blob.Digest]; !ok && index.Manifests == nil {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprintf(w, "blob unknown %s", blob.Digest)
+					return
+				}
+			}
+			for _, entry := range index.Manifests {
+				if _, ok := r.manifests[match[1]+":"+entry.Digest]; !ok {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprintf(w, "manifest unknown %s", entry.Digest)
+					return
+				}
+			}
+			r.manifests[key] = content
+			w.Header().Set("Docker-Content-Digest", digestOf(content))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		content, ok := r.manifests[key]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", manifestMediaType(content, ""))
+		w.Write(content)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"python":                                 {Host: "docker.io", Repository: "library/python", Tag: "latest"},
+		"kubeless/python:2.7":                    {Host: "docker.io", Repository: "kubeless/python", Tag: "2.7"},
+		"docker://index.docker.io/user/foo:abc":  {Host: "docker.io", Repository: "user/foo", Tag: "abc"},
+		"localhost:5000/user/foo@sha256:123":     {Host: "localhost:5000", Repository: "user/foo", Digest: "sha256:123"},
+		"registry.example.com/user/foo-deps:abc": {Host: "registry.example.com", Repository: "user/foo-deps", Tag: "abc"},
+	}
+	for image, expected := range tests {
+		ref, err := ParseReference(image)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %s: %v", image, err)
+		}
+		if !reflect.DeepEqual(*ref, expected) {
+			t.Errorf("Expecting %+v for %s, received %+v", expected, image, *ref)
+		}
+	}
+	ref, _ := ParseReference("kubeless/python:2.7")
+	if ref.Endpoint() != "https://registry-1.docker.io" {
+		t.Errorf("Unexpected endpoint %s", ref.Endpoint())
+	}
+	r := Registry{Endpoint: "https://index.docker.io", Version: "v1"}
+	if !r.Serves(ref) {
+		t.Errorf("Expecting %s to serve %+v", r.Endpoint, ref)
+	}
+}
+
+func TestPushImage(t *testing.T) {
+	base, baseServer := newTestRegistry("", "")
+	defer baseServer.Close()
+	config := []byte(`{"architecture": "amd64"}`)
+	baseLayer := []byte("base layer")
+	base.addImage("kubeless/python", "2.7", lbuilder.DockerManifestMediaType, config, baseLayer)
+
+	target, targetServer := newTestRegistry("user", "pass")
+	defer targetServer.Close()
+
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := &Registry{Endpoint: baseServer.URL, Version: "v2"}
+	err = PullManifest(src, "kubeless/python", "2.7", dir, "linux/amd64")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	manifest := ImageManifest{}
+	content, _ := ioutil.ReadFile(path.Join(dir, "manifest.json"))
+	json.Unmarshal(content, &manifest)
+	if len(manifest.Layers) != 1 || manifest.Layers[0].Digest != digestOf(baseLayer) {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if content, _ := ioutil.ReadFile(path.Join(dir, strings.TrimPrefix(digestOf(config), "sha256:"))); string(content) != string(config) {
+		t.Errorf("Expecting the configuration to be stored, found %q", content)
+	}
+	if _, err := os.Stat(path.Join(dir, strings.TrimPrefix(digestOf(baseLayer), "sha256:"))); !os.IsNotExist(err) {
+		t.Error("Expecting the base layer not to be downloaded")
+	}
+
+	// Add a layer as the layer-builder does
+	newLayer := []byte("function layer")
+	ioutil.WriteFile(path.Join(dir, strings.TrimPrefix(digestOf(newLayer), "sha256:")), newLayer, 0644)
+	manifest.Layers = append(manifest.Layers, Descriptor{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Size: int64(len(newLayer)), Digest: digestOf(newLayer)})
+	content, _ = json.Marshal(manifest)
+	ioutil.WriteFile(path.Join(dir, "manifest.json"), content, 0644)
+
+	dst := &Registry{Endpoint: targetServer.URL, Version: "v2", Creds: Credentials{Username: "user", Password: "pass"}}
+	sources := []BlobSource{{Registry: src, Repository: "kubeless/python"}}
+	digest, err := PushImage(dir, dst, "user/foo-deps", "abc", sources...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if digest != digestOf(content) {
+		t.Errorf("Unexpected digest %s", digest)
+	}
+	for _, blob := range [][]byte{config, baseLayer, newLayer} {
+		if string(target.blobs["user/foo-deps@"+digestOf(blob)]) != string(blob) {
+			t.Errorf("Expecting the blob %q to be uploaded", blob)
+		}
+	}
+	if target.uploads != 3 || target.mounts != 0 {
+		t.Errorf("Expecting 3 uploads, found %d uploads and %d mounts", target.uploads, target.mounts)
+	}
+
+	// The blobs are mounted from other repositories of the same registry
+	sources = append(sources, BlobSource{Registry: dst, Repository: "user/foo-deps"})
+	_, err = PushImage(dir, dst, "user/foo", "abc", sources...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.uploads != 3 || target.mounts != 3 {
+		t.Errorf("Expecting 3 mounts, found %d uploads and %d mounts", target.uploads, target.mounts)
+	}
+	if _, ok := target.manifests["user/foo:abc"]; !ok {
+		t.Error("Expecting the manifest of user/foo:abc to be uploaded")
+	}
+
+	// The blobs that the repository already has are skipped
+	_, err = PushImage(dir, dst, "user/foo", "def", sources...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.uploads != 3 || target.mounts != 3 {
+		t.Errorf("Expecting the blobs to be skipped, found %d uploads and %d mounts", target.uploads, target.mounts)
+	}
+
+	// Wrong credentials
+	dst.Creds.Password = "wrong"
+	if _, err := PushImage(dir, dst, "user/foo", "ghi", sources...); err == nil {
+		t.Error("Expecting an error with the wrong credentials")
+	}
+}
+
+func TestPushIndex(t *testing.T) {
+	base, baseServer := newTestRegistry("", "")
+	defer baseServer.Close()
+	type entry struct {
+		Descriptor
+		Platform lbuilder.Platform `json:"platform"`
+	}
+	index := struct {
+		SchemaVersion int     `json:"schemaVersion"`
+		Manifests     []entry `json:"manifests"`
+	}{SchemaVersion: 2}
+	for _, platform := range []lbuilder.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}, {OS: "unknown", Architecture: "unknown"}} {
+		config := []byte(fmt.Sprintf(`{"architecture":%q,"os":%q,"config":{"ExposedPorts":{"8080/tcp":{}}},"rootfs":{"type":"layers","diff_ids":[]}}`, platform.Architecture, platform.OS))
+		manifest := base.addImage("kubeless/python", platform.Architecture, "", config, []byte("base layer "+platform.Architecture))
+		index.Manifests = append(index.Manifests, entry{
+			Descriptor: Descriptor{MediaType: lbuilder.OCIManifestMediaType, Size: int64(len(manifest)), Digest: digestOf(manifest)},
+			Platform:   platform,
+		})
+	}
+	indexContent, _ := json.Marshal(index)
+	base.manifests["kubeless/python:multi"] = indexContent
+	src := &Registry{Endpoint: baseServer.URL, Version: "v2"}
+
+	// The manifest of the platform is selected
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = PullManifest(src, "kubeless/python", "multi", dir, "linux/arm64")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, _ := ioutil.ReadFile(path.Join(dir, "manifest.json"))
+	if digestOf(content) != index.Manifests[1].Digest {
+		t.Errorf("Expecting the manifest of linux/arm64, received %s", content)
+	}
+	if err := PullManifest(src, "kubeless/python", "multi", dir, "linux/s390x"); err == nil {
+		t.Error("Expecting an error for a missing platform")
+	}
+
+	// Every platform is stored
+	dir, err = ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = PullManifest(src, "kubeless/python", "multi", dir, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tar := path.Join(dir, "code.tar")
+	ioutil.WriteFile(tar, []byte("code"), 0644)
+	err = lbuilder.AddTarToLayer(dir, map[string]string{"io.kubeless.function.name": "foo"}, lbuilder.LayerSource{Tar: tar, CreatedBy: "kubeless: code"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	target, targetServer := newTestRegistry("", "")
+	defer targetServer.Close()
+	dst := &Registry{Endpoint: targetServer.URL, Version: "v2"}
+	digest, err := PushImage(dir, dst, "user/foo", "abc", BlobSource{Registry: src, Repository: "kubeless/python"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	labels, err := dst.ImageLabels("user/foo", "abc")
+	if err != nil || labels["io.kubeless.function.name"] != "foo" {
+		t.Errorf("Expecting the labels of the pushed image, received %v (%v)", labels, err)
+	}
+	pushedIndex := lbuilder.Index{}
+	json.Unmarshal(target.manifests["user/foo:abc"], &pushedIndex)
+	if digest != digestOf(target.manifests["user/foo:abc"]) || len(pushedIndex.Manifests) != 3 {
+		t.Fatalf("Unexpected index %s", target.manifests["user/foo:abc"])
+	}
+	for n, entry := range pushedIndex.Manifests {
+		manifest := ImageManifest{}
+		json.Unmarshal(target.manifests["user/foo:"+entry.Digest], &manifest)
+		if manifestMediaType(target.manifests["user/foo:"+entry.Digest], "") != lbuilder.OCIManifestMediaType {
+			t.Errorf("Expecting the manifest %d to be an OCI manifest", n)
+		}
+		if !pushedIndex.IsImage(n) {
+			// The attestations are not modified
+			if entry.Digest != index.Manifests[n].Digest {
+				t.Errorf("Expecting the manifest %d to be the original one", n)
+			}
+			continue
+		}
+		if len(manifest.Layers) != 2 || manifest.Layers[1].Digest != digestOf([]byte("code")) || manifest.Layers[1].MediaType != lbuilder.OCILayerMediaType {
+			t.Errorf("Expecting the code layer in the manifest %d, received %+v", n, manifest.Layers)
+		}
+		config := target.blobs["user/foo@"+manifest.Config.Digest]
+		if !strings.Contains(string(config), `"ExposedPorts":{"8080/tcp":{}}`) || strings.Contains(string(config), "docker_version") {
+			t.Errorf("Expecting the configuration to keep its properties, received %s", config)
+		}
+	}
+}
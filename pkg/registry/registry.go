@@ -17,13 +17,16 @@ limitations under the License.
 package registry
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"reflect"
+	"net/url"
 	"regexp"
-	"time"
+	"sort"
+	"strings"
+	"sync"
 
 	"k8s.io/api/core/v1"
 )
@@ -41,6 +44,12 @@ type Registry struct {
 	Endpoint string
 	Version  string
 	Creds    Credentials
+	// Insecure disables the verification of the TLS certificate of the registry
+	Insecure bool
+
+	// client is shared by the requests to the registry so its connections are reused
+	client     *http.Client
+	clientOnce sync.Once
 }
 
 type tagv1 struct {
@@ -57,30 +66,92 @@ type dockerCfg struct {
 	Auths map[string]Credentials `json:"auths"`
 }
 
-// New returns a Registry struct parsing its URL and storing the required credentials
-func New(config v1.Secret) (*Registry, error) {
-	// Parse secret
+// registryURLRegexp parses the URLs of the registries with the API version, like https://index.docker.io/v1/
+var registryURLRegexp = regexp.MustCompile("^(https?://.*)/(v[0-9]+)/?$")
+
+// parseRegistryURL returns the endpoint and the API version of a registry of a docker config. Registries given
+// as a bare host (like registry.example.com) use HTTPS and the v2 API
+func parseRegistryURL(registryURL string) (string, string, error) {
+	if parsedURL := registryURLRegexp.FindStringSubmatch(registryURL); len(parsedURL) == 3 {
+		return parsedURL[1], parsedURL[2], nil
+	}
+	endpoint := strings.TrimSuffix(registryURL, "/")
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", "", fmt.Errorf("Unable to parse registry URL %s", registryURL)
+	}
+	return endpoint, "v2", nil
+}
+
+// Registries returns every registry of a docker config secret with its credentials, sorted by URL
+func Registries(config v1.Secret) ([]*Registry, error) {
 	cfg := dockerCfg{}
 	err := json.Unmarshal(config.Data[".dockerconfigjson"], &cfg)
 	if err != nil {
 		return nil, err
 	}
-	regs := reflect.ValueOf(cfg.Auths).MapKeys()
-	if len(regs) > 1 {
-		return nil, fmt.Errorf("Found several registries: %q, unable to decide which one to use", regs)
+	urls := []string{}
+	for registryURL := range cfg.Auths {
+		urls = append(urls, registryURL)
+	}
+	sort.Strings(urls)
+	registries := []*Registry{}
+	for _, registryURL := range urls {
+		endpoint, version, err := parseRegistryURL(registryURL)
+		if err != nil {
+			return nil, err
+		}
+		registries = append(registries, &Registry{
+			Endpoint: endpoint,
+			Version:  version,
+			Creds:    cfg.Auths[registryURL],
+		})
+	}
+	return registries, nil
+}
+
+// New returns a Registry struct parsing its URL and storing the required credentials. The secret must contain
+// a single registry, use Registries and Find for secrets with several ones
+func New(config v1.Secret) (*Registry, error) {
+	registries, err := Registries(config)
+	if err != nil {
+		return nil, err
+	}
+	switch len(registries) {
+	case 0:
+		return nil, fmt.Errorf("Unable to find any registry in the secret %s", config.ObjectMeta.Name)
+	case 1:
+		return registries[0], nil
+	default:
+		endpoints := []string{}
+		for _, r := range registries {
+			endpoints = append(endpoints, r.Endpoint)
+		}
+		return nil, fmt.Errorf("Found several registries: %q, unable to decide which one to use", endpoints)
+	}
+}
+
+// Find returns the registry of the given list that serves the given host (like registry.example.com:5000 or
+// docker.io) or nil if none of them does. The host can also be the URL of the registry
+func Find(registries []*Registry, host string) *Registry {
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
 	}
-	registryURL := regs[0].String()
-	re := regexp.MustCompile("(https?://.*)/(v[0-9]+)/?")
-	parsedURL := re.FindStringSubmatch(registryURL)
-	if len(parsedURL) == 0 {
-		return nil, fmt.Errorf("Unable to parse registry URL %s", registryURL)
+	ref := Reference{Host: strings.TrimSuffix(host, "/")}
+	if ref.Host == dockerHubIndex || ref.Host == "registry-1.docker.io" {
+		ref.Host = dockerHub
 	}
-	reg := Registry{
-		Endpoint: parsedURL[1],
-		Version:  parsedURL[2],
-		Creds:    cfg.Auths[registryURL],
+	for _, r := range registries {
+		if r.Serves(&ref) {
+			return r
+		}
 	}
-	return &reg, err
+	return nil
 }
 
 // getTags return the list of tags from an HTTP response to the tag/list API endpoint
@@ -121,6 +192,9 @@ func (r *Registry) tagURL(img string) (string, error) {
 	}
 }
 
+// linkRegexp parses the Link header of paginated responses
+var linkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="?next"?`)
+
 // findProperty returns the value of a property from a list witht the format 'foo="bar",bar="foo"'
 func findProperty(src, property string) (string, error) {
 	re := regexp.MustCompile(fmt.Sprintf("%s=\"([^\"]*)\"", property))
@@ -131,109 +205,163 @@ func findProperty(src, property string) (string, error) {
 	return res[1], nil
 }
 
-type authResponse struct {
-	Token string `json:"token"`
+// Tags returns every tag of an image, following the pagination of the registry
+func (r *Registry) Tags(id string) ([]string, error) {
+	tagsURL, err := r.tagURL(id)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for tagsURL != "" {
+		resp, err := r.do("GET", tagsURL, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, newError(resp, body)
+		}
+		page, err := r.getTags(body)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page...)
+		tagsURL, err = nextPage(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
 }
 
-// doRequestWithAuth does an HTTP GET agains the given url parsing the authInfo given
-func doRequestWithAuth(authInfo, url string, client *http.Client) ([]byte, error) {
-	bearer, err := findProperty(authInfo, "Bearer realm")
-	if err != nil {
-		return nil, fmt.Errorf("Unable to extract auth info: %v", err)
+// nextPage returns the URL of the next page of a paginated response or an empty string if it is the last one
+func nextPage(resp *http.Response) (string, error) {
+	for _, link := range resp.Header["Link"] {
+		match := linkRegexp.FindStringSubmatch(link)
+		if len(match) != 2 {
+			continue
+		}
+		next, err := resp.Request.URL.Parse(match[1])
+		if err != nil {
+			return "", fmt.Errorf("Unable to parse the link %q: %v", link, err)
+		}
+		return next.String(), nil
 	}
-	service, err := findProperty(authInfo, "service")
+	return "", nil
+}
+
+// manifestExists checks if a manifest exists without downloading it
+func (r *Registry) manifestExists(id, tag string) (bool, error) {
+	resp, err := r.do("HEAD", r.manifestURL(id, tag), http.Header{"Accept": manifestMediaTypes}, nil, 0)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to extract auth info: %v", err)
+		return false, err
 	}
-	scope, err := findProperty(authInfo, "scope")
-	if err != nil {
-		return nil, fmt.Errorf("Unable to extract auth info: %v", err)
+	defer resp.Body.Close()
+	err = checkResponse(resp, http.StatusOK)
+	if IsNotFound(err) {
+		return false, nil
 	}
-	authResp, err := client.Get(fmt.Sprintf("%s?service=%s&scope=%s", bearer, service, scope))
-	if err != nil {
-		return nil, fmt.Errorf("Unable to obtain auth token: %v", err)
+	return err == nil, err
+}
+
+// ImageExists checks if a certain image:tag exists in the registry. If the registry doesn't allow listing the
+// tags of the image it checks if its manifest exists
+func (r *Registry) ImageExists(id, tag string) (bool, error) {
+	tags, err := r.Tags(id)
+	switch {
+	case err == nil:
+		for _, t := range tags {
+			if t == tag {
+				return true, nil
+			}
+		}
+		return false, nil
+	case IsNotFound(err):
+		// There is no image with that ID yet
+		return false, nil
+	case r.Version == "v2" && (IsUnauthorized(err) || IsUnsupported(err)):
+		return r.manifestExists(id, tag)
+	default:
+		return false, err
 	}
-	defer authResp.Body.Close()
-	authb, err := ioutil.ReadAll(authResp.Body)
-	if err != nil {
-		return nil, err
+}
+
+// ImageDigest returns the digest of the manifest of a certain image:tag
+func (r *Registry) ImageDigest(id, tag string) (string, error) {
+	if r.Version != "v2" {
+		return "", fmt.Errorf("API version %s does not support image digests", r.Version)
 	}
-	authr := authResponse{}
-	err = json.Unmarshal(authb, &authr)
+	resp, err := r.do("HEAD", r.manifestURL(id, tag), http.Header{"Accept": manifestMediaTypes}, nil, 0)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to parse auth token: %v", err)
+		return "", err
 	}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", fmt.Errorf("Unable to find the manifest of %s:%s: %v", id, tag, err)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", authr.Token))
-	respWithAuth, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
 	}
-	defer respWithAuth.Body.Close()
-	body, err := ioutil.ReadAll(respWithAuth.Body)
+	// The header is optional, the digest is the checksum of the manifest
+	manifest, _, err := r.Manifest(id, tag)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return body, nil
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)), nil
 }
 
-func (r *Registry) doRequest(url string) ([]byte, error) {
-	tr := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: true,
-	}
-	client := &http.Client{
-		Transport: tr,
-	}
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+type catalog struct {
+	Repositories []string `json:"repositories"`
+}
+
+// Catalog returns every repository of the registry, following the pagination of the registry
+func (r *Registry) Catalog() ([]string, error) {
+	if r.Version != "v2" {
+		return nil, fmt.Errorf("API version %s does not support listing repositories", r.Version)
 	}
-	// Handle auth if needed
-	if resp.StatusCode == 401 {
-		// Get auth info from headers
-		authInfo := resp.Header.Get("Www-Authenticate")
-		if authInfo == "" {
-			return nil, fmt.Errorf("Failed to authenticate: unknown authentication format: %v", body)
+	catalogURL := fmt.Sprintf("%s/v2/_catalog", r.Endpoint)
+	repositories := []string{}
+	for catalogURL != "" {
+		resp, err := r.do("GET", catalogURL, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, newError(resp, body)
+		}
+		page := catalog{}
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, err
 		}
-		body, err = doRequestWithAuth(authInfo, url, client)
+		repositories = append(repositories, page.Repositories...)
+		catalogURL, err = nextPage(resp)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return body, nil
+	return repositories, nil
 }
 
-// ImageExists checks if a certain image:tag exists in the registry
-func (r *Registry) ImageExists(id, tag string) (bool, error) {
-	url, err := r.tagURL(id)
-	if err != nil {
-		return false, err
-	}
-	body, err := r.doRequest(url)
-	if err != nil {
-		return false, err
+// DeleteImage deletes the manifest with the given digest, removing every tag that references it. The registry
+// may not allow deleting images, in that case the error is unsupported
+func (r *Registry) DeleteImage(id, digest string) error {
+	if r.Version != "v2" {
+		return fmt.Errorf("API version %s does not support deleting images", r.Version)
 	}
-	if match, _ := regexp.MatchString("Resource not found", string(body)); match {
-		// There is no image with that ID yet
-		return false, nil
-	}
-	tags, err := r.getTags(body)
+	resp, err := r.do("DELETE", r.manifestURL(id, digest), nil, nil, 0)
 	if err != nil {
-		return false, err
-	}
-	for _, t := range tags {
-		if t == tag {
-			return true, nil
-		}
+		return err
 	}
-	return false, nil
+	defer resp.Body.Close()
+	return checkResponse(resp, http.StatusAccepted, http.StatusOK)
 }
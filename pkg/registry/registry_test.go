@@ -1,6 +1,8 @@
 package registry
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -31,6 +33,41 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewSeveralRegistries(t *testing.T) {
+	s := v1.Secret{
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(`{"auths":{"https://index.docker.io/v1/":{"username":"test","password":"pass"},"mirror.example.com:5000":{"username":"mirror","password":"pass"}}}`),
+		},
+	}
+	if _, err := New(s); err == nil {
+		t.Error("Expecting an error for a secret with several registries")
+	}
+	registries, err := Registries(s)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(registries) != 2 {
+		t.Fatalf("Expecting two registries, received %v", registries)
+	}
+	if registries[0].Endpoint != "https://index.docker.io" || registries[0].Version != "v1" {
+		t.Errorf("Unexpected registry %+v", registries[0])
+	}
+	if registries[1].Endpoint != "https://mirror.example.com:5000" || registries[1].Version != "v2" {
+		t.Errorf("Unexpected registry %+v", registries[1])
+	}
+	for host, expected := range map[string]*Registry{
+		"docker.io":                        registries[0],
+		"index.docker.io":                  registries[0],
+		"mirror.example.com:5000":          registries[1],
+		"https://mirror.example.com:5000/": registries[1],
+		"mirror.example.com":               nil,
+	} {
+		if r := Find(registries, host); r != expected {
+			t.Errorf("Expecting %v for %s, received %v", expected, host, r)
+		}
+	}
+}
+
 func TestTagURLV1(t *testing.T) {
 	r := Registry{
 		Endpoint: "https://registry-1.docker.io",
@@ -90,3 +127,71 @@ func TestGetTagsV2(t *testing.T) {
 		t.Errorf("Unexpected tags: %v", tags)
 	}
 }
+
+func TestImageDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/test/image/manifests/latest" {
+			http.NotFound(w, req)
+			return
+		}
+		if req.Header.Get("Accept") != "application/vnd.docker.distribution.manifest.v2+json" {
+			t.Errorf("Unexpected Accept header %q", req.Header.Get("Accept"))
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	}))
+	defer server.Close()
+	r := Registry{
+		Endpoint: server.URL,
+		Version:  "v2",
+	}
+	digest, err := r.ImageDigest("test/image", "latest")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if digest != "sha256:abc" {
+		t.Errorf("Unexpected digest %s", digest)
+	}
+	if _, err := r.ImageDigest("test/image", "missing"); err == nil {
+		t.Error("Expecting an error for a missing image")
+	}
+}
+
+func TestCatalogAndDeleteImage(t *testing.T) {
+	deleted := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/_catalog" && req.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/_catalog?n=1&last=user%2Ffoo>; rel="next"`)
+			w.Write([]byte(`{"repositories": ["user/foo"]}`))
+		case req.URL.Path == "/v2/_catalog":
+			w.Write([]byte(`{"repositories": ["user/foo-deps"]}`))
+		case req.Method == "DELETE" && req.URL.Path == "/v2/user/foo/manifests/sha256:abc":
+			deleted = req.URL.Path
+			w.WriteHeader(http.StatusAccepted)
+		case req.Method == "DELETE":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	r := Registry{Endpoint: server.URL, Version: "v2"}
+
+	repositories, err := r.Catalog()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(repositories, []string{"user/foo", "user/foo-deps"}) {
+		t.Errorf("Unexpected repositories %v", repositories)
+	}
+	if err := r.DeleteImage("user/foo", "sha256:abc"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted == "" {
+		t.Error("Expecting the manifest to be deleted")
+	}
+	if err := r.DeleteImage("user/bar", "sha256:abc"); !IsUnsupported(err) {
+		t.Errorf("Expecting an unsupported error, received %v", err)
+	}
+}
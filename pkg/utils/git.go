@@ -0,0 +1,248 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	v1 "k8s.io/api/core/v1"
+)
+
+// FunctionSecretMountPath is the directory where the provision container mounts the secret of the function
+const FunctionSecretMountPath = "/function-secret"
+
+// commitRegexp matches full SHA-1 and SHA-256 commit names
+var commitRegexp = regexp.MustCompile("^([0-9a-f]{40}|[0-9a-f]{64})$")
+
+// GitChecksum returns the checksum recorded for the given commit of a function deployed from Git
+func GitChecksum(commit string) string {
+	if len(commit) == 64 {
+		return "sha256:" + commit
+	}
+	return "sha1:" + commit
+}
+
+// gitCommit returns the commit recorded in the checksum of a function deployed from Git
+func gitCommit(checksum string) (string, error) {
+	checksumInfo := strings.Split(checksum, ":")
+	if len(checksumInfo) != 2 || (checksumInfo[0] != "sha1" && checksumInfo[0] != "sha256") || !commitRegexp.MatchString(checksumInfo[1]) {
+		return "", fmt.Errorf("Unable to find the commit of the function in the checksum %q: expecting sha1:<commit> or sha256:<commit>", checksum)
+	}
+	return checksumInfo[1], nil
+}
+
+// gitSubPath returns the clean path of the directory of the repository with the function
+func gitSubPath(p string) (string, error) {
+	if strings.Contains(p, "'") || strings.Contains(p, "..") {
+		return "", fmt.Errorf("Invalid function path %q: it should be a directory of the repository", p)
+	}
+	return strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// getGitProvisionContainer returns the container that clones the repository of the function at the commit of its
+// checksum and copies the function path to the runtime volume. The credentials of private repositories are read
+// from the function secret: username and password for HTTP and ssh-privatekey (and optionally known_hosts) for SSH
+func getGitProvisionContainer(spec kubelessApi.FunctionSpec, prepareImage string, runtimeVolume, depsVolume v1.VolumeMount, resources v1.ResourceRequirements, lr *langruntime.Langruntimes) (v1.Container, error) {
+	if strings.Contains(spec.Function, "'") {
+		return v1.Container{}, fmt.Errorf("Invalid repository %q", spec.Function)
+	}
+	commit, err := gitCommit(spec.Checksum)
+	if err != nil {
+		return v1.Container{}, err
+	}
+	subPath, err := gitSubPath(spec.FunctionPath)
+	if err != nil {
+		return v1.Container{}, err
+	}
+
+	cloneDir := "/tmp/func.git"
+	prepareCommand := appendToCommand("",
+		fmt.Sprintf("git init -q %s", cloneDir),
+		fmt.Sprintf("cd %s", cloneDir),
+		fmt.Sprintf("git remote add origin '%s'", spec.Function),
+	)
+	if spec.FunctionSecret != "" {
+		username := path.Join(FunctionSecretMountPath, "username")
+		password := path.Join(FunctionSecretMountPath, "password")
+		privateKey := path.Join(FunctionSecretMountPath, "ssh-privatekey")
+		knownHosts := path.Join(FunctionSecretMountPath, "known_hosts")
+		prepareCommand = appendToCommand(prepareCommand,
+			fmt.Sprintf(`if [ -f %s ]; then git config credential.helper '!f() { echo "username=$(cat %s)"; echo "password=$(cat %s)"; }; f'; fi`, username, username, password),
+			fmt.Sprintf(`if [ -f %s ]; then export GIT_SSH_COMMAND="ssh -o UserKnownHostsFile=%s"; else export GIT_SSH_COMMAND="ssh -o StrictHostKeyChecking=accept-new"; fi`, knownHosts, knownHosts),
+			fmt.Sprintf(`if [ -f %s ]; then cp %s /tmp/ssh-privatekey && chmod 600 /tmp/ssh-privatekey && export GIT_SSH_COMMAND="$GIT_SSH_COMMAND -i /tmp/ssh-privatekey"; fi`, privateKey, privateKey),
+		)
+	}
+	// Servers may refuse to serve a commit that is not the tip of a ref so fall back to a full fetch.
+	// Checking out the commit verifies the content since the commit name is the checksum of the tree
+	prepareCommand = appendToCommand(prepareCommand,
+		fmt.Sprintf("(git fetch -q --depth 1 origin %s || git fetch -q --tags origin)", commit),
+		fmt.Sprintf("git checkout -q %s", commit),
+		fmt.Sprintf(`test "$(git rev-parse HEAD)" = %s`, commit),
+		fmt.Sprintf("cp -r '%s/.' %s", path.Join(cloneDir, subPath), runtimeVolume.MountPath),
+		fmt.Sprintf("rm -rf %s", path.Join(runtimeVolume.MountPath, ".git")),
+	)
+	if spec.Deps != "" {
+		// Without dependencies, an empty deps file would replace the one of the repository
+		prepareCommand = appendDepsCopy(prepareCommand, spec.FunctionContentType, spec.Runtime, runtimeVolume, depsVolume, lr)
+	}
+	prepareCommand, err = appendManifestCheck(prepareCommand, spec.ChecksumManifest, runtimeVolume.MountPath)
+	if err != nil {
+		return v1.Container{}, err
+	}
+
+	return v1.Container{
+		Name:            "prepare",
+		Image:           prepareImage,
+		Command:         []string{"sh", "-c"},
+		Args:            []string{prepareCommand},
+		VolumeMounts:    []v1.VolumeMount{runtimeVolume, depsVolume},
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Resources:       resources,
+	}, nil
+}
+
+// gitRefs returns the commits of the refs of a repository, with the name of the refs as key.
+// Annotated tags are resolved to their commit
+func gitRefs(lines []string) map[string]string {
+	refs := map[string]string{}
+	peeled := map[string]string{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if strings.HasSuffix(fields[1], "^{}") {
+			peeled[strings.TrimSuffix(fields[1], "^{}")] = fields[0]
+		} else {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	for name, commit := range peeled {
+		refs[name] = commit
+	}
+	return refs
+}
+
+// findGitRef returns the commit of the given ref, looking for it like git does: as a full ref, a tag or a branch.
+// An empty ref is the default branch of the repository
+func findGitRef(refs map[string]string, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	for _, name := range []string{ref, "refs/" + ref, "refs/tags/" + ref, "refs/heads/" + ref} {
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("Unable to find the ref %s in the repository. Abbreviated commits are not supported, use the full SHA", ref)
+}
+
+// readPktLines returns the lines of the ref advertisement of the smart HTTP protocol of Git
+func readPktLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	reader := bufio.NewReader(r)
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(reader, size); err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read the refs of the repository: %v", err)
+		}
+		n, err := strconv.ParseUint(string(size), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the refs of the repository: invalid line length %q", size)
+		}
+		if n == 0 {
+			// Flush packet
+			continue
+		}
+		if n < 4 {
+			return nil, fmt.Errorf("Unable to read the refs of the repository: invalid line length %q", size)
+		}
+		line := make([]byte, n-4)
+		if _, err := io.ReadFull(reader, line); err != nil {
+			return nil, fmt.Errorf("Unable to read the refs of the repository: %v", err)
+		}
+		if bytes.HasPrefix(line, []byte("#")) {
+			// Service announcement
+			continue
+		}
+		// The first ref is followed by the capabilities of the server
+		if i := bytes.IndexByte(line, 0); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, strings.TrimSuffix(string(line), "\n"))
+	}
+}
+
+// ResolveGitRef returns the commit that the given ref (a branch, a tag or a commit) of a repository points to.
+// The refs of HTTP repositories are read with the smart HTTP protocol, authenticating with the given username
+// and password if any. Other repositories are read with git ls-remote and the local credentials
+func ResolveGitRef(repo, ref, username, password string) (string, error) {
+	if commitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+	var lines []string
+	if strings.HasPrefix(repo, "http://") || strings.HasPrefix(repo, "https://") {
+		req, err := http.NewRequest("GET", strings.TrimSuffix(repo, "/")+"/info/refs?service=git-upload-pack", nil)
+		if err != nil {
+			return "", err
+		}
+		if username != "" || password != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return "", fmt.Errorf("Unable to read the refs of %s: %s %s", repo, resp.Status, strings.TrimSpace(string(body)))
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-git-upload-pack-advertisement") {
+			return "", fmt.Errorf("Unable to read the refs of %s: the server doesn't support the smart HTTP protocol", repo)
+		}
+		lines, err = readPktLines(resp.Body)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		out, err := exec.Command("git", "ls-remote", repo).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("Unable to read the refs of %s: %v %s", repo, err, strings.TrimSpace(string(out)))
+		}
+		lines = strings.Split(string(out), "\n")
+	}
+	commit, err := findGitRef(gitRefs(lines), ref)
+	if err != nil {
+		return "", err
+	}
+	return commit, nil
+}
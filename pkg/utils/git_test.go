@@ -0,0 +1,245 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	headCommit   = "1111111111111111111111111111111111111111"
+	branchCommit = "2222222222222222222222222222222222222222"
+	tagObject    = "3333333333333333333333333333333333333333"
+	tagCommit    = "4444444444444444444444444444444444444444"
+)
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// gitServer serves the refs of a repository with the smart HTTP protocol
+func gitServer(username, password string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/org/repo.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		if u, p, _ := r.BasicAuth(); u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		fmt.Fprint(w, pktLine("# service=git-upload-pack\n"), "0000",
+			pktLine(headCommit+" HEAD\x00multi_ack symref=HEAD:refs/heads/master\n"),
+			pktLine(headCommit+" refs/heads/master\n"),
+			pktLine(branchCommit+" refs/heads/dev\n"),
+			pktLine(tagObject+" refs/tags/v1.0\n"),
+			pktLine(tagCommit+" refs/tags/v1.0^{}\n"),
+			"0000")
+	}))
+}
+
+func TestResolveGitRef(t *testing.T) {
+	srv := gitServer("", "")
+	defer srv.Close()
+	repo := srv.URL + "/org/repo.git"
+
+	tests := []struct {
+		ref    string
+		commit string
+	}{
+		{"", headCommit},
+		{"master", headCommit},
+		{"dev", branchCommit},
+		{"refs/heads/dev", branchCommit},
+		{"heads/dev", branchCommit},
+		// Annotated tags resolve to the commit, not to the tag object
+		{"v1.0", tagCommit},
+		// Commits are not resolved
+		{"5555555555555555555555555555555555555555", "5555555555555555555555555555555555555555"},
+	}
+	for _, test := range tests {
+		commit, err := ResolveGitRef(repo, test.ref, "", "")
+		if err != nil {
+			t.Errorf("Unexpected error resolving %q: %v", test.ref, err)
+			continue
+		}
+		if commit != test.commit {
+			t.Errorf("Expecting %q to resolve to %s, received %s", test.ref, test.commit, commit)
+		}
+	}
+
+	if _, err := ResolveGitRef(repo, "missing", "", ""); err == nil {
+		t.Error("Expecting an error for an unknown ref")
+	}
+	if _, err := ResolveGitRef(repo, "abc1234", "", ""); err == nil || !strings.Contains(err.Error(), "full SHA") {
+		t.Errorf("Expecting an error for an abbreviated commit, received %v", err)
+	}
+}
+
+func TestResolveGitRefCredentials(t *testing.T) {
+	srv := gitServer("user", "pass")
+	defer srv.Close()
+	repo := srv.URL + "/org/repo.git"
+
+	if _, err := ResolveGitRef(repo, "dev", "", ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expecting an unauthorized error, received %v", err)
+	}
+	commit, err := ResolveGitRef(repo, "dev", "user", "pass")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if commit != branchCommit {
+		t.Errorf("Expecting %s, received %s", branchCommit, commit)
+	}
+}
+
+func TestGetGitProvisionContainer(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+
+	rvol := v1.VolumeMount{Name: "runtime", MountPath: "/runtime"}
+	dvol := v1.VolumeMount{Name: "deps", MountPath: "/deps"}
+	spec := kubelessApi.FunctionSpec{
+		Function:            "https://github.com/org/repo.git",
+		FunctionContentType: "git+deps",
+		FunctionPath:        "functions/hello/",
+		Checksum:            GitChecksum(branchCommit),
+		Handler:             "hello.foo",
+		Runtime:             "python2.7",
+	}
+	c, err := getGitProvisionContainer(spec, "unzip", rvol, dvol, v1.ResourceRequirements{}, lr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedCommand := "git init -q /tmp/func.git && cd /tmp/func.git && git remote add origin 'https://github.com/org/repo.git' && " +
+		"(git fetch -q --depth 1 origin " + branchCommit + " || git fetch -q --tags origin) && " +
+		"git checkout -q " + branchCommit + " && " +
+		"test \"$(git rev-parse HEAD)\" = " + branchCommit + " && " +
+		"cp -r '/tmp/func.git/functions/hello/.' /runtime && rm -rf /runtime/.git"
+	if c.Args[0] != expectedCommand {
+		t.Errorf("Expecting:\n%s\nReceived:\n%s", expectedCommand, c.Args[0])
+	}
+	if c.Name != "prepare" || c.Image != "unzip" {
+		t.Errorf("Unexpected container %s with image %s", c.Name, c.Image)
+	}
+
+	// The credentials are configured and the deps file of the function replaces the one of the repository
+	spec.FunctionSecret = "git-creds"
+	spec.FunctionContentType = "git"
+	spec.Deps = "requests"
+	c, err = getGitProvisionContainer(spec, "unzip", rvol, dvol, v1.ResourceRequirements{}, lr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"credential.helper", "/function-secret/ssh-privatekey", "/function-secret/known_hosts"} {
+		if !strings.Contains(c.Args[0], s) {
+			t.Errorf("Expecting %q in the command %s", s, c.Args[0])
+		}
+	}
+	if !strings.HasSuffix(c.Args[0], "cp /deps/requirements.txt /runtime") {
+		t.Errorf("Expecting the copy of the deps file in the command %s", c.Args[0])
+	}
+
+	for _, invalid := range []kubelessApi.FunctionSpec{
+		{Function: spec.Function, Checksum: "sha256:abc1234"},
+		{Function: spec.Function, Checksum: ""},
+		{Function: spec.Function, Checksum: spec.Checksum, FunctionPath: "../secrets"},
+		{Function: "https://example.com/'; rm -rf /", Checksum: spec.Checksum},
+	} {
+		if _, err := getGitProvisionContainer(invalid, "unzip", rvol, dvol, v1.ResourceRequirements{}, lr); err == nil {
+			t.Errorf("Expecting an error for %+v", invalid)
+		}
+	}
+}
+
+func TestPopulatePodSpecFunctionSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: kubelessApi.FunctionSpec{
+			Function:            "git@github.com:org/repo.git",
+			FunctionContentType: "git",
+			FunctionSecret:      "git-creds",
+			Checksum:            GitChecksum(headCommit),
+			Handler:             "hello.foo",
+			Runtime:             "python2.7",
+		},
+	}
+	podSpec := v1.PodSpec{}
+	err := populatePodSpec(f, lr, &podSpec, getRuntimeVolumeMount(f.ObjectMeta.Name), "unzip", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found := false
+	for _, v := range podSpec.Volumes {
+		if v.Secret != nil && v.Secret.SecretName == "git-creds" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expecting a volume with the function secret in %+v", podSpec.Volumes)
+	}
+	mounts := podSpec.InitContainers[0].VolumeMounts
+	if m := mounts[len(mounts)-1]; m.MountPath != FunctionSecretMountPath || !m.ReadOnly {
+		t.Errorf("Expecting the function secret mounted in the provision container, received %+v", m)
+	}
+	// The runtime container doesn't have access to the credentials
+	for _, c := range podSpec.InitContainers[1:] {
+		for _, m := range c.VolumeMounts {
+			if m.MountPath == FunctionSecretMountPath {
+				t.Errorf("Unexpected function secret in the container %s", c.Name)
+			}
+		}
+	}
+}
+
+func TestFunctionBuildTagGit(t *testing.T) {
+	f := &kubelessApi.Function{
+		Spec: kubelessApi.FunctionSpec{
+			Function:            "https://github.com/org/repo.git",
+			FunctionContentType: "git",
+			Checksum:            GitChecksum(headCommit),
+		},
+	}
+	tag := FunctionBuildTag(f)
+	f.Spec.Checksum = GitChecksum(branchCommit)
+	if FunctionBuildTag(f) == tag {
+		t.Error("Expecting a different tag for a different commit")
+	}
+	tag = FunctionBuildTag(f)
+	f.Spec.FunctionPath = "other"
+	if FunctionBuildTag(f) == tag {
+		t.Error("Expecting a different tag for a different path")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
 	"github.com/sirupsen/logrus"
@@ -35,7 +36,9 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -51,6 +54,19 @@ import (
 
 const (
 	defaultTimeout = "180"
+	// ChangeCauseAnnotation is the annotation used to record the cause of a function revision
+	ChangeCauseAnnotation = "kubeless.io/change-cause"
+	// ScaledToZeroAnnotation marks the service of a function that has been scaled to zero
+	// and whose requests are being sent to the activator. Its value is the port of the activator
+	// that receives them
+	ScaledToZeroAnnotation = "kubeless.io/scaled-to-zero"
+	// ActivatorFirstFunctionPort and ActivatorLastFunctionPort are the range of ports of the activator.
+	// Every function scaled to zero has its own port, so the activator knows the function a request is
+	// for whatever the host used to reach it
+	ActivatorFirstFunctionPort = 8100
+	ActivatorLastFunctionPort  = 9099
+	// ActivatorPortIndex is the name of the index of the services by their port of the activator
+	ActivatorPortIndex = "activatorPort"
 )
 
 // GetClient returns a k8s clientset to the request from inside of cluster
@@ -252,6 +268,39 @@ func GetPodsByLabel(c kubernetes.Interface, ns, k, v string) (*v1.PodList, error
 	return pods, nil
 }
 
+// PodLogsRetriever is an interface for retrieving the logs of a container
+type PodLogsRetriever interface {
+	GetPodLogs(kubernetes.Interface, string, string, *v1.PodLogOptions) ([]byte, error)
+}
+
+// APIPodLogsRetriever retrieves the logs of the containers from the Kubernetes API
+type APIPodLogsRetriever struct{}
+
+// GetPodLogs returns the logs of a container of the given pod
+func (r *APIPodLogsRetriever) GetPodLogs(c kubernetes.Interface, ns, podName string, opts *v1.PodLogOptions) ([]byte, error) {
+	return c.CoreV1().Pods(ns).GetLogs(podName, opts).Do().Raw()
+}
+
+// GetFunctionEvents returns the events of a function sorted by the last time they happened
+func GetFunctionEvents(c kubernetes.Interface, funcName, ns string) ([]v1.Event, error) {
+	list, err := c.CoreV1().Events(ns).List(metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=Function,involvedObject.name=%s", funcName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := []v1.Event{}
+	for _, e := range list.Items {
+		if e.InvolvedObject.Kind == "Function" && e.InvolvedObject.Name == funcName {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	return events, nil
+}
+
 // GetReadyPod returns the first pod has passed the liveness probe check
 func GetReadyPod(pods *v1.PodList) (v1.Pod, error) {
 	for _, pod := range pods.Items {
@@ -439,6 +488,88 @@ func FunctionObjRemoveFinalizer(kubelessClient versioned.Interface, funcObj *kub
 	return err
 }
 
+// GetFunctionRevisions returns the revisions of a function sorted by revision number
+func GetFunctionRevisions(kubelessClient versioned.Interface, funcName, ns string) ([]*kubelessApi.FunctionRevision, error) {
+	revisionList, err := kubelessClient.KubelessV1beta1().FunctionRevisions(ns).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("created-by=kubeless,function=%s", funcName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	revisions := revisionList.Items
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Spec.Revision < revisions[j].Spec.Revision
+	})
+	return revisions, nil
+}
+
+// FunctionObjGetCondition returns the condition of the given type or nil if it is not set
+func FunctionObjGetCondition(funcObj *kubelessApi.Function, condType kubelessApi.FunctionConditionType) *kubelessApi.FunctionCondition {
+	for i := range funcObj.Status.Conditions {
+		if funcObj.Status.Conditions[i].Type == condType {
+			return &funcObj.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// FunctionObjSetCondition adds or updates a condition of the function status.
+// The transition time is only modified if the status of the condition changes
+func FunctionObjSetCondition(funcObj *kubelessApi.Function, condType kubelessApi.FunctionConditionType, status v1.ConditionStatus, reason, message string) {
+	newCondition := kubelessApi.FunctionCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	if current := FunctionObjGetCondition(funcObj, condType); current != nil {
+		if current.Status == status {
+			newCondition.LastTransitionTime = current.LastTransitionTime
+		}
+		*current = newCondition
+		return
+	}
+	funcObj.Status.Conditions = append(funcObj.Status.Conditions, newCondition)
+}
+
+// FunctionObjRemoveCondition removes a condition from the function status
+func FunctionObjRemoveCondition(funcObj *kubelessApi.Function, condType kubelessApi.FunctionConditionType) {
+	var conditions []kubelessApi.FunctionCondition
+	for _, c := range funcObj.Status.Conditions {
+		if c.Type != condType {
+			conditions = append(conditions, c)
+		}
+	}
+	funcObj.Status.Conditions = conditions
+}
+
+// FunctionObjFailedCondition returns the first step (in reconciliation order) which is not ready or nil if there is none
+func FunctionObjFailedCondition(funcObj *kubelessApi.Function) *kubelessApi.FunctionCondition {
+	for _, condType := range kubelessApi.FunctionConditionTypes {
+		if c := FunctionObjGetCondition(funcObj, condType); c != nil && c.Status == v1.ConditionFalse {
+			return c
+		}
+	}
+	return nil
+}
+
+// UpdateFunctionStatus stores the status of the given function using the status subresource
+func UpdateFunctionStatus(kubelessClient versioned.Interface, funcObj *kubelessApi.Function) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := kubelessClient.KubelessV1beta1().Functions(funcObj.Namespace).Get(funcObj.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if apiequality.Semantic.DeepEqual(current.Status, funcObj.Status) {
+			return nil
+		}
+		current.Status = funcObj.Status
+		_, err = kubelessClient.KubelessV1beta1().Functions(funcObj.Namespace).UpdateStatus(current)
+		return err
+	})
+}
+
 // GetAnnotationsFromCRD gets annotations from a CustomResourceDefinition
 func GetAnnotationsFromCRD(clientset clientsetAPIExtensions.Interface, name string) (map[string]string, error) {
 	crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(name, metav1.GetOptions{})
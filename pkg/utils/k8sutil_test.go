@@ -6,7 +6,10 @@ import (
 	"io"
 	"io/ioutil"
 	"testing"
+	"time"
 
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	kubelessFake "github.com/kubeless/kubeless/pkg/client/clientset/versioned/fake"
 	appsv1 "k8s.io/api/apps/v1"
 	v2beta1 "k8s.io/api/autoscaling/v2beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -377,3 +380,82 @@ func TestGetAnnotationsFromCRD(t *testing.T) {
 	}
 
 }
+
+func TestFunctionObjSetCondition(t *testing.T) {
+	f := &kubelessApi.Function{}
+	FunctionObjSetCondition(f, kubelessApi.FunctionConfigReady, corev1.ConditionTrue, "ConfigCreated", "")
+	FunctionObjSetCondition(f, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "CrashLoopBackOff", "Back-off restarting failed container")
+	if len(f.Status.Conditions) != 2 {
+		t.Fatalf("Expecting 2 conditions but received %d", len(f.Status.Conditions))
+	}
+	failed := FunctionObjFailedCondition(f)
+	if failed == nil || failed.Reason != "CrashLoopBackOff" {
+		t.Errorf("Expecting failed condition CrashLoopBackOff but received %v", failed)
+	}
+
+	// The transition time should only change with the status
+	lastTransition := metav1.NewTime(metav1.Now().Add(-time.Hour))
+	FunctionObjGetCondition(f, kubelessApi.FunctionDeploymentAvailable).LastTransitionTime = lastTransition
+	FunctionObjSetCondition(f, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionFalse, "ImagePullBackOff", "")
+	c := FunctionObjGetCondition(f, kubelessApi.FunctionDeploymentAvailable)
+	if c.Reason != "ImagePullBackOff" || !c.LastTransitionTime.Equal(&lastTransition) {
+		t.Errorf("Unexpected condition %v", c)
+	}
+	FunctionObjSetCondition(f, kubelessApi.FunctionDeploymentAvailable, corev1.ConditionTrue, "MinimumReplicasAvailable", "")
+	c = FunctionObjGetCondition(f, kubelessApi.FunctionDeploymentAvailable)
+	if c.LastTransitionTime.Equal(&lastTransition) {
+		t.Error("Expecting the transition time to be updated")
+	}
+	if failed := FunctionObjFailedCondition(f); failed != nil {
+		t.Errorf("Unexpected failed condition %v", failed)
+	}
+
+	FunctionObjRemoveCondition(f, kubelessApi.FunctionConfigReady)
+	if len(f.Status.Conditions) != 1 || FunctionObjGetCondition(f, kubelessApi.FunctionConfigReady) != nil {
+		t.Errorf("Condition ConfigReady should be removed: %v", f.Status.Conditions)
+	}
+}
+
+func TestUpdateFunctionStatus(t *testing.T) {
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "myns",
+		},
+	}
+	client := kubelessFake.NewSimpleClientset(f)
+
+	status := f.DeepCopy()
+	status.Status.Phase = kubelessApi.FunctionPhaseReady
+	status.Status.ObservedGeneration = 2
+	if err := UpdateFunctionStatus(client, status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updateStatus := 0
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "update" && a.GetSubresource() == "status" {
+			updateStatus++
+		}
+	}
+	if updateStatus != 1 {
+		t.Errorf("Expecting a status update but found %d", updateStatus)
+	}
+	res, err := client.KubelessV1beta1().Functions("myns").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Status.Phase != kubelessApi.FunctionPhaseReady || res.Status.ObservedGeneration != 2 {
+		t.Errorf("Unexpected status %v", res.Status)
+	}
+
+	// An unchanged status should not be updated again
+	client.ClearActions()
+	if err := UpdateFunctionStatus(client, status); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "update" {
+			t.Errorf("Unexpected update action %v", a)
+		}
+	}
+}
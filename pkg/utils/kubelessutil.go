@@ -23,21 +23,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	monitoringv1alpha1 "github.com/coreos/prometheus-operator/pkg/client/monitoring/v1alpha1"
 	"github.com/ghodss/yaml"
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
 	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/registry"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -49,6 +51,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
 // secretsMountPath is the file system path where volumes populated with secrets are mounted.
@@ -77,7 +80,7 @@ func appendToCommand(orig string, command ...string) string {
 	return strings.Join(command, " && ")
 }
 
-func getProvisionContainer(function, checksum, fileName, handler, contentType, runtime, prepareImage string, runtimeVolume, depsVolume v1.VolumeMount, resources v1.ResourceRequirements, lr *langruntime.Langruntimes) (v1.Container, error) {
+func getProvisionContainer(function, checksum, manifest, fileName, handler, contentType, runtime, functionSecret, prepareImage string, runtimeVolume, depsVolume v1.VolumeMount, resources v1.ResourceRequirements, lr *langruntime.Langruntimes) (v1.Container, error) {
 	prepareCommand := ""
 	originFile := path.Join(depsVolume.MountPath, fileName)
 
@@ -89,7 +92,15 @@ func getProvisionContainer(function, checksum, fileName, handler, contentType, r
 		originFile = decodedFile
 	} else if strings.Contains(contentType, "url") {
 		fromURLFile := "/tmp/func.fromurl"
-		prepareCommand = appendToCommand(prepareCommand, fmt.Sprintf("curl '%s' -L --silent --output %s", function, fromURLFile))
+		if functionSecret != "" {
+			// Authenticate with the credentials of the function secret
+			prepareCommand = appendToCommand(prepareCommand,
+				sourceCredentialArgs(),
+				fmt.Sprintf(`curl "$@" '%s' -L --fail --silent --show-error --output %s`, function, fromURLFile),
+			)
+		} else {
+			prepareCommand = appendToCommand(prepareCommand, fmt.Sprintf("curl '%s' -L --silent --output %s", function, fromURLFile))
+		}
 		originFile = fromURLFile
 	} else if strings.Contains(contentType, "text") || contentType == "" {
 		// Assumming that function is plain text
@@ -102,18 +113,15 @@ func getProvisionContainer(function, checksum, fileName, handler, contentType, r
 	if checksum == "" {
 		// DEPRECATED: Checksum may be empty
 	} else {
-		checksumInfo := strings.Split(checksum, ":")
-		switch checksumInfo[0] {
-		case "sha256":
-			shaFile := "/tmp/func.sha256"
-			prepareCommand = appendToCommand(prepareCommand,
-				fmt.Sprintf("echo '%s  %s' > %s", checksumInfo[1], originFile, shaFile),
-				fmt.Sprintf("sha256sum -c %s", shaFile),
-			)
-			break
-		default:
-			return v1.Container{}, fmt.Errorf("Unable to verify checksum %s: Unknown format", checksum)
+		algorithm, digest, err := splitChecksum(checksum)
+		if err != nil {
+			return v1.Container{}, err
 		}
+		shaFile := "/tmp/func." + algorithm
+		prepareCommand = appendToCommand(prepareCommand,
+			fmt.Sprintf("echo '%s  %s' > %s", digest, originFile, shaFile),
+			fmt.Sprintf("%ssum -c %s", algorithm, shaFile),
+		)
 	}
 
 	if strings.Contains(contentType, "zip") {
@@ -139,13 +147,12 @@ func getProvisionContainer(function, checksum, fileName, handler, contentType, r
 		)
 	}
 
-	// Copy deps file to the installation path
-	runtimeInf, err := lr.GetRuntimeInfo(runtime)
-	if err == nil && runtimeInf.DepName != "" && !strings.Contains(contentType, "deps") {
-		depsFile := path.Join(depsVolume.MountPath, runtimeInf.DepName)
-		prepareCommand = appendToCommand(prepareCommand,
-			fmt.Sprintf("cp %s %s", depsFile, runtimeVolume.MountPath),
-		)
+	prepareCommand = appendDepsCopy(prepareCommand, contentType, runtime, runtimeVolume, depsVolume, lr)
+
+	// Verify the extracted files and the dependencies
+	prepareCommand, err := appendManifestCheck(prepareCommand, manifest, runtimeVolume.MountPath)
+	if err != nil {
+		return v1.Container{}, err
 	}
 
 	return v1.Container{
@@ -159,6 +166,19 @@ func getProvisionContainer(function, checksum, fileName, handler, contentType, r
 	}, nil
 }
 
+// appendDepsCopy adds to the command the copy of the deps file to the installation path,
+// unless the dependencies are part of the function bundle
+func appendDepsCopy(prepareCommand, contentType, runtime string, runtimeVolume, depsVolume v1.VolumeMount, lr *langruntime.Langruntimes) string {
+	runtimeInf, err := lr.GetRuntimeInfo(runtime)
+	if err == nil && runtimeInf.DepName != "" && !strings.Contains(contentType, "deps") {
+		depsFile := path.Join(depsVolume.MountPath, runtimeInf.DepName)
+		prepareCommand = appendToCommand(prepareCommand,
+			fmt.Sprintf("cp %s %s", depsFile, runtimeVolume.MountPath),
+		)
+	}
+	return prepareCommand
+}
+
 func addDefaultLabel(labels map[string]string) map[string]string {
 	if labels == nil {
 		labels = make(map[string]string)
@@ -271,7 +291,11 @@ func serviceSpec(funcObj *kubelessApi.Function) v1.ServiceSpec {
 			Type:     v1.ServiceTypeClusterIP,
 		}
 	}
-	return funcObj.Spec.ServiceSpec
+	spec := funcObj.Spec.ServiceSpec
+	if len(spec.Selector) == 0 {
+		spec.Selector = funcObj.ObjectMeta.Labels
+	}
+	return spec
 }
 
 // EnsureFuncService creates/updates a function service
@@ -370,22 +394,46 @@ func populatePodSpec(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes
 			Name:      depsVolumeName,
 			MountPath: "/src",
 		}
-		provisionContainer, err := getProvisionContainer(
-			funcObj.Spec.Function,
-			funcObj.Spec.Checksum,
-			fileName,
-			funcObj.Spec.Handler,
-			funcObj.Spec.FunctionContentType,
-			funcObj.Spec.Runtime,
-			provisionImage,
-			runtimeVolumeMount,
-			srcVolumeMount,
-			resources,
-			lr,
-		)
+		var provisionContainer v1.Container
+		if strings.Contains(funcObj.Spec.FunctionContentType, "git") {
+			provisionContainer, err = getGitProvisionContainer(funcObj.Spec, provisionImage, runtimeVolumeMount, srcVolumeMount, resources, lr)
+		} else {
+			provisionContainer, err = getProvisionContainer(
+				funcObj.Spec.Function,
+				funcObj.Spec.Checksum,
+				funcObj.Spec.ChecksumManifest,
+				fileName,
+				funcObj.Spec.Handler,
+				funcObj.Spec.FunctionContentType,
+				funcObj.Spec.Runtime,
+				funcObj.Spec.FunctionSecret,
+				provisionImage,
+				runtimeVolumeMount,
+				srcVolumeMount,
+				resources,
+				lr,
+			)
+		}
 		if err != nil {
 			return err
 		}
+		if funcObj.Spec.FunctionSecret != "" {
+			// The credentials to fetch the function are only available to the provision container
+			secretVolumeName := funcObj.ObjectMeta.Name + "-function-secret"
+			result.Volumes = append(result.Volumes, v1.Volume{
+				Name: secretVolumeName,
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: funcObj.Spec.FunctionSecret,
+					},
+				},
+			})
+			provisionContainer.VolumeMounts = append(provisionContainer.VolumeMounts, v1.VolumeMount{
+				Name:      secretVolumeName,
+				MountPath: FunctionSecretMountPath,
+				ReadOnly:  true,
+			})
+		}
 		result.InitContainers = []v1.Container{provisionContainer}
 	}
 
@@ -482,45 +530,278 @@ func populatePodSpec(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes
 	return nil
 }
 
-// EnsureFuncImage creates a Job to build a function image
-func EnsureFuncImage(client kubernetes.Interface, funcObj *kubelessApi.Function, lr *langruntime.Langruntimes, or []metav1.OwnerReference, imageName, tag, builderImage, registryHost, dockerSecretName, provisionImage string, registryTLSEnabled bool, imagePullSecrets []v1.LocalObjectReference) error {
-	if len(tag) < 64 {
-		return errors.New("Expecting sha256 as image tag")
+// RegistryCredentialsSecret is the secret with the credentials of the registries used to build the function images:
+// the one where they are pushed and the ones of the base images
+const RegistryCredentialsSecret = "kubeless-registry-credentials"
+
+const (
+	// BuildRegistryAnnotation sets the registry where the image of a function is pushed
+	BuildRegistryAnnotation = "kubeless.io/build-registry"
+	// BuildRepositoryPrefixAnnotation sets the prefix of the repository of the image of a function
+	BuildRepositoryPrefixAnnotation = "kubeless.io/build-repository-prefix"
+)
+
+const (
+	// ImageInstallationLabel is the label of the function images with the UID of the Kubeless configuration of
+	// the installation that built them
+	ImageInstallationLabel = "io.kubeless.installation"
+	// ImageNamespaceLabel is the label of the function images with the namespace of the function
+	ImageNamespaceLabel = "io.kubeless.function.namespace"
+	// ImageFunctionLabel is the label of the function images with the name of the function
+	ImageFunctionLabel = "io.kubeless.function.name"
+)
+
+// BuildTarget is the image generated when building a function
+type BuildTarget struct {
+	Registry *registry.Registry
+	Secret   string // Name of the secret with the credentials of the registry
+	Host     string // Host of the registry
+	Name     string // Name of the image, without the registry host
+	Tag      string // Checksum of the function code and dependencies
+	// The dependencies of the function are stored in a separate image so they are only installed when they change
+	DepsName   string // Name of the image with the dependencies, without the registry host
+	DepsTag    string // Checksum of the runtime and the dependencies (empty if the function has no dependencies)
+	DepsCached bool   // True if the image with the dependencies is already in the registry
+	// Platform of the base image to use if it is a multi-platform image (os/arch[/variant]),
+	// "all" to add the function to every platform or empty for the default of the builder
+	Platform string
+	// Timestamp is recorded as the modification time of the files and the creation time of the layers
+	// so building the same function generates the same image
+	Timestamp time.Time
+	// Labels are added to the configuration of the images so their owner can be identified
+	Labels map[string]string
+}
+
+// Image returns the full reference of the target image
+func (t *BuildTarget) Image() string {
+	return fmt.Sprintf("%s/%s:%s", t.Host, t.Name, t.Tag)
+}
+
+// DepsImage returns the full reference of the image with the dependencies of the function
+func (t *BuildTarget) DepsImage() string {
+	return fmt.Sprintf("%s/%s:%s", t.Host, t.DepsName, t.DepsTag)
+}
+
+// LabelList returns the labels of the target images in the format key=value, sorted by key
+func (t *BuildTarget) LabelList() []string {
+	labels := []string{}
+	for key, value := range t.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// GetBuildRegistry returns the registry where the images of the functions with the given annotations are pushed,
+// with the credentials stored in the namespace, and the prefix of their repositories. The registry is the given one
+// of the credentials (which can be omitted if there is only one) and the prefix is the given one (the username of
+// the credentials by default). The annotations override both of them
+func GetBuildRegistry(client kubernetes.Interface, ns string, annotations map[string]string, pushRegistry, repositoryPrefix string) (*registry.Registry, string, string, error) {
+	secret, err := client.CoreV1().Secrets(ns).Get(RegistryCredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Unable to locate registry credentials to build function image: %v", err)
+	}
+	if value, ok := annotations[BuildRegistryAnnotation]; ok {
+		pushRegistry = value
+	}
+	if value, ok := annotations[BuildRepositoryPrefixAnnotation]; ok {
+		repositoryPrefix = value
+	}
+	var reg *registry.Registry
+	if pushRegistry == "" {
+		reg, err = registry.New(*secret)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("Unable to retrieve registry information: %v. The registry can be set with function-registry in the Kubeless configuration or with the annotation %s", err, BuildRegistryAnnotation)
+		}
+	} else {
+		registries, err := registry.Registries(*secret)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("Unable to retrieve registry information: %v", err)
+		}
+		reg = registry.Find(registries, pushRegistry)
+		if reg == nil {
+			return nil, "", "", fmt.Errorf("Unable to find the credentials of the registry %s in the secret %s", pushRegistry, secret.ObjectMeta.Name)
+		}
+	}
+	regURL, err := url.Parse(reg.Endpoint)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("Unable to parse registry URL: %v", err)
+	}
+	if repositoryPrefix == "" {
+		repositoryPrefix = reg.Creds.Username
+	}
+	repositoryPrefix = strings.Trim(repositoryPrefix, "/")
+	if repositoryPrefix == "" {
+		return nil, "", "", fmt.Errorf("Unable to decide the repository of the function images: the credentials of %s don't have a username, set function-repository-prefix in the Kubeless configuration or the annotation %s", regURL.Host, BuildRepositoryPrefixAnnotation)
+	}
+	return reg, regURL.Host, repositoryPrefix, nil
+}
+
+// GetBuildTarget returns the image to build for the current code of the function, pushed to the registry and
+// under the repository prefix returned by GetBuildRegistry
+func GetBuildTarget(client kubernetes.Interface, funcObj *kubelessApi.Function, pushRegistry, repositoryPrefix string) (*BuildTarget, error) {
+	reg, host, prefix, err := GetBuildRegistry(client, funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Annotations, pushRegistry, repositoryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildTarget{
+		Registry: reg,
+		Secret:   RegistryCredentialsSecret,
+		Host:     host,
+		Name:     FunctionRepository(prefix, funcObj.ObjectMeta.Name),
+		Tag:      FunctionBuildTag(funcObj),
+		DepsName: FunctionDepsRepository(prefix, funcObj.ObjectMeta.Name),
+		DepsTag:  FunctionDepsTag(funcObj),
+	}, nil
+}
+
+// FunctionImageLabels returns the labels of the images of a function built by the installation with the given
+// Kubeless configuration
+func FunctionImageLabels(funcObj *kubelessApi.Function, config *v1.ConfigMap) map[string]string {
+	return map[string]string{
+		ImageInstallationLabel: string(config.ObjectMeta.UID),
+		ImageNamespaceLabel:    funcObj.ObjectMeta.Namespace,
+		ImageFunctionLabel:     funcObj.ObjectMeta.Name,
+	}
+}
+
+// FunctionRepository returns the repository of the images of a function
+func FunctionRepository(prefix, funcName string) string {
+	return fmt.Sprintf("%s/%s", prefix, funcName)
+}
+
+// FunctionDepsRepository returns the repository of the images with the dependencies of a function
+func FunctionDepsRepository(prefix, funcName string) string {
+	return fmt.Sprintf("%s/%s-deps", prefix, funcName)
+}
+
+// BuildTimestamp returns the time to record in the image of the function, from the given source: the creation
+// time of the function ("creation" or empty), the Unix epoch ("epoch") or a fixed time in RFC 3339 format
+func BuildTimestamp(funcObj *kubelessApi.Function, source string) (time.Time, error) {
+	switch source {
+	case "", "creation":
+		if funcObj.ObjectMeta.CreationTimestamp.IsZero() {
+			return time.Unix(0, 0).UTC(), nil
+		}
+		return funcObj.ObjectMeta.CreationTimestamp.Time.UTC(), nil
+	case "epoch":
+		return time.Unix(0, 0).UTC(), nil
+	default:
+		t, err := time.Parse(time.RFC3339, source)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Unable to parse the build timestamp %q: expecting \"creation\", \"epoch\" or a time in RFC 3339 format", source)
+		}
+		return t.UTC(), nil
+	}
+}
+
+// FunctionBuildTag returns the tag of the image of the function: the checksum of its code and dependencies
+func FunctionBuildTag(funcObj *kubelessApi.Function) string {
+	content := fmt.Sprintf("%v%v", funcObj.Spec.Function, funcObj.Spec.Deps)
+	if strings.Contains(funcObj.Spec.FunctionContentType, "git") {
+		// The repository is the same for every commit
+		content += "\n" + funcObj.Spec.Checksum + "\n" + funcObj.Spec.FunctionPath
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// FunctionDepsTag returns the tag of the image with the dependencies of the function: the checksum of its runtime
+// and its dependencies. It is empty if the function doesn't have dependencies
+func FunctionDepsTag(funcObj *kubelessApi.Function) string {
+	deps := funcObj.Spec.Deps
+	if strings.Contains(funcObj.Spec.FunctionContentType, "deps") {
+		// The dependencies are part of the function bundle
+		deps = funcObj.Spec.Checksum
 	}
-	jobName := fmt.Sprintf("build-%s-%s", funcObj.ObjectMeta.Name, tag[0:10])
-	_, err := client.BatchV1().Jobs(funcObj.ObjectMeta.Namespace).Get(jobName, metav1.GetOptions{})
+	if deps == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(funcObj.Spec.Runtime+"\n"+deps)))
+}
+
+// FunctionBuildName returns the name of the FunctionBuild (and of its job) that generates the given tag
+func FunctionBuildName(funcName, tag string) string {
+	return fmt.Sprintf("build-%s-%s", funcName, tag[0:10])
+}
+
+// NewFunctionBuild returns a FunctionBuild of the current code of the function
+func NewFunctionBuild(funcObj *kubelessApi.Function, target *BuildTarget, or []metav1.OwnerReference) *kubelessApi.FunctionBuild {
+	return &kubelessApi.FunctionBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            FunctionBuildName(funcObj.ObjectMeta.Name, target.Tag),
+			Namespace:       funcObj.ObjectMeta.Namespace,
+			OwnerReferences: or,
+			Labels: addDefaultLabel(map[string]string{
+				"function": funcObj.ObjectMeta.Name,
+			}),
+		},
+		Spec: kubelessApi.FunctionBuildSpec{
+			Function: funcObj.ObjectMeta.Name,
+			Checksum: "sha256:" + target.Tag,
+			Runtime:  funcObj.Spec.Runtime,
+			Image:    target.Image(),
+		},
+		Status: kubelessApi.FunctionBuildStatus{
+			Phase: kubelessApi.FunctionBuildPending,
+		},
+	}
+}
+
+// EnsureFuncImage creates a Job to build a function image with the function image builder
+func EnsureFuncImage(client kubernetes.Interface, funcObj *kubelessApi.Function, lr *langruntime.Langruntimes, or []metav1.OwnerReference, target *BuildTarget, builderImage, provisionImage string, registryTLSEnabled bool, imagePullSecrets []v1.LocalObjectReference) error {
+	job, err := NewFuncImageJob(funcObj, lr, or, target, builderImage, provisionImage, registryTLSEnabled, imagePullSecrets)
+	if err != nil {
+		return err
+	}
+	return EnsureBuildJob(client, job)
+}
+
+// EnsureBuildJob creates the job that builds the image of a function if it doesn't exist yet
+func EnsureBuildJob(client kubernetes.Interface, job *batchv1.Job) error {
+	_, err := client.BatchV1().Jobs(job.ObjectMeta.Namespace).Get(job.ObjectMeta.Name, metav1.GetOptions{})
 	if err == nil {
-		// The job already exists
-		logrus.Infof("Found a previous job for building %s:%s", imageName, tag)
+		logrus.Infof("Found a previous job %s for building the function image", job.ObjectMeta.Name)
 		return nil
 	}
+	_, err = client.BatchV1().Jobs(job.ObjectMeta.Namespace).Create(job)
+	if err == nil {
+		logrus.Infof("Started function build job %s", job.ObjectMeta.Name)
+	}
+	return err
+}
+
+// newBuildPodSpec returns the spec of the pod of a build job with the init containers that prepare the function
+// in the runtime volume: the provision of the code, the installation of the dependencies and the compilation
+func newBuildPodSpec(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes, target *BuildTarget, provisionImage string, imagePullSecrets []v1.LocalObjectReference) (v1.PodSpec, v1.VolumeMount, error) {
+	// Failed pods are not restarted but replaced so their logs are available after the job fails
 	podSpec := v1.PodSpec{
-		RestartPolicy: v1.RestartPolicyOnFailure,
+		RestartPolicy: v1.RestartPolicyNever,
+	}
+	if len(target.Tag) < 64 {
+		return podSpec, v1.VolumeMount{}, errors.New("Expecting sha256 as image tag")
 	}
 	runtimeVolumeMount := getRuntimeVolumeMount(funcObj.ObjectMeta.Name)
-	err = populatePodSpec(funcObj, lr, &podSpec, runtimeVolumeMount, provisionImage, imagePullSecrets)
+	err := populatePodSpec(funcObj, lr, &podSpec, runtimeVolumeMount, provisionImage, imagePullSecrets)
 	if err != nil {
-		return err
+		return podSpec, runtimeVolumeMount, err
 	}
-
-	// Add a final initContainer to create the function bundle.tar
-	prepareContainer := v1.Container{}
-	for _, c := range podSpec.InitContainers {
-		if c.Name == "prepare" {
-			prepareContainer = c
-		}
-	}
-	podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
-		Name:         "bundle",
-		Command:      []string{"sh", "-c"},
-		Args:         []string{fmt.Sprintf("tar cvf %s/bundle.tar %s/*", runtimeVolumeMount.MountPath, runtimeVolumeMount.MountPath)},
-		VolumeMounts: prepareContainer.VolumeMounts,
-		Image:        provisionImage,
+	// The registry credentials are mounted in the build container
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: target.Secret,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName: target.Secret,
+			},
+		},
 	})
+	return podSpec, runtimeVolumeMount, nil
+}
 
-	buildJob := batchv1.Job{
+// newBuildJob returns the job that runs the given pod to build the target image of the function
+func newBuildJob(funcObj *kubelessApi.Function, or []metav1.OwnerReference, target *BuildTarget, podSpec v1.PodSpec) *batchv1.Job {
+	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:            jobName,
+			Name:            FunctionBuildName(funcObj.ObjectMeta.Name, target.Tag),
 			Namespace:       funcObj.ObjectMeta.Namespace,
 			OwnerReferences: or,
 			Labels: addDefaultLabel(map[string]string{
@@ -533,24 +814,109 @@ func EnsureFuncImage(client kubernetes.Interface, funcObj *kubelessApi.Function,
 			},
 		},
 	}
+}
+
+// NewFuncImageJob returns the Job that builds a function image with the function image builder.
+// The image contains a layer with the dependencies of the function, also pushed as a separate image to reuse
+// it in the next builds, and a layer with the function code
+func NewFuncImageJob(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes, or []metav1.OwnerReference, target *BuildTarget, builderImage, provisionImage string, registryTLSEnabled bool, imagePullSecrets []v1.LocalObjectReference) (*batchv1.Job, error) {
+	podSpec, runtimeVolumeMount, err := newBuildPodSpec(funcObj, lr, target, provisionImage, imagePullSecrets)
+	if err != nil {
+		return nil, err
+	}
 
 	baseImage, err := lr.GetFunctionImage(funcObj.Spec.Runtime)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	prepareContainer := v1.Container{}
+	install, compile := -1, false
+	for i, c := range podSpec.InitContainers {
+		switch c.Name {
+		case "prepare":
+			prepareContainer = c
+		case "install":
+			install = i
+		case "compile":
+			compile = true
+		}
+	}
+
+	// The layers are generated from the top level entries of the runtime volume
+	runtimePath := runtimeVolumeMount.MountPath
+	listEntries := fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 ! -name '.kubeless-*' ! -name deps.tar.gz ! -name code.tar.gz", runtimePath)
+	codeFiles := path.Join(runtimePath, ".kubeless-code")
+	depsFiles := path.Join(runtimePath, ".kubeless-deps")
+	depsTar := path.Join(runtimePath, "deps.tar.gz")
+	codeTar := path.Join(runtimePath, "code.tar.gz")
+	timestamp := target.Timestamp.UTC().Format(time.RFC3339)
+	// The layers are created by the builder so they are reproducible
+	createLayer := func(tar, files string) string {
+		return fmt.Sprintf("/imbuilder bundle --mtime %s --files-from %s %s", timestamp, files, tar)
+	}
+	depsDescription := fmt.Sprintf("kubeless: dependencies of the runtime %s (%s)", funcObj.Spec.Runtime, target.DepsTag)
+	codeDescription := fmt.Sprintf("kubeless: code of the function %s (%s)", funcObj.ObjectMeta.Name, target.Tag)
+	bundleCommand := ""
+	layerArgs := []string{}
+	switch {
+	case target.DepsTag == "" || install < 0:
+		// The function has no dependencies to install: a single layer with the code
+		bundleCommand = appendToCommand(bundleCommand,
+			fmt.Sprintf("%s > %s", listEntries, codeFiles),
+			createLayer(codeTar, codeFiles),
+		)
+		layerArgs = append(layerArgs, "--created-by", codeDescription, codeTar)
+	case target.DepsCached && !compile:
+		// The dependencies are already in the registry and they are not needed to compile the function
+		podSpec.InitContainers = append(podSpec.InitContainers[:install], podSpec.InitContainers[install+1:]...)
+		baseImage = target.DepsImage()
+		bundleCommand = appendToCommand(bundleCommand,
+			fmt.Sprintf("%s > %s", listEntries, codeFiles),
+			createLayer(codeTar, codeFiles),
+		)
+		layerArgs = append(layerArgs, "--created-by", codeDescription, codeTar)
+	default:
+		// The entries that appear while installing the dependencies belong to the dependencies layer
+		// and the rest of entries (the function files and the compilation results) to the code layer
+		installedFiles := path.Join(runtimePath, ".kubeless-installed")
+		for i, c := range podSpec.InitContainers {
+			switch c.Name {
+			case "prepare":
+				podSpec.InitContainers[i].Args[0] = appendToCommand(c.Args[0], fmt.Sprintf("%s > %s", listEntries, codeFiles))
+			case "install":
+				podSpec.InitContainers[i].Args[0] = appendToCommand(c.Args[0], fmt.Sprintf("%s > %s", listEntries, installedFiles))
+			}
+		}
+		bundleCommand = appendToCommand(bundleCommand,
+			fmt.Sprintf("(grep -vxF -f %s %s > %s || true)", codeFiles, installedFiles, depsFiles),
+			fmt.Sprintf("(%s | grep -vxF -f %s > %s.layer || true)", listEntries, depsFiles, codeFiles),
+			createLayer(codeTar, codeFiles+".layer"),
+		)
+		if target.DepsCached {
+			// Only the code layer is added to the cached dependencies
+			baseImage = target.DepsImage()
+		} else {
+			bundleCommand = appendToCommand(bundleCommand, createLayer(depsTar, depsFiles))
+			layerArgs = append(layerArgs, "--intermediate-dst", fmt.Sprintf("docker://%s", target.DepsImage()), "--created-by", depsDescription, depsTar)
+		}
+		layerArgs = append(layerArgs, "--created-by", codeDescription, codeTar)
 	}
 
+	// Add a final initContainer to create the tar files of the layers
+	podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
+		Name:         "bundle",
+		Command:      []string{"sh", "-c"},
+		Args:         []string{bundleCommand},
+		VolumeMounts: prepareContainer.VolumeMounts,
+		Image:        builderImage,
+	})
+
+	buildJob := newBuildJob(funcObj, or, target, podSpec)
+
 	// Registry volume
-	dockerCredsVol := dockerSecretName
+	dockerCredsVol := target.Secret
 	dockerCredsVolMountPath := "/docker"
-	registryCredsVolume := v1.Volume{
-		Name: dockerCredsVol,
-		VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{
-				SecretName: dockerSecretName,
-			},
-		},
-	}
-	buildJob.Spec.Template.Spec.Volumes = append(buildJob.Spec.Template.Spec.Volumes, registryCredsVolume)
 
 	args := []string{
 		"/imbuilder",
@@ -560,10 +926,21 @@ func EnsureFuncImage(client kubernetes.Interface, funcObj *kubelessApi.Function,
 		args = append(args, "--insecure")
 	}
 	args = append(args,
+		"--created", timestamp,
 		"--src", fmt.Sprintf("docker://%s", baseImage),
-		"--dst", fmt.Sprintf("docker://%s/%s:%s", registryHost, imageName, tag),
-		fmt.Sprintf("%s/bundle.tar", podSpec.InitContainers[0].VolumeMounts[0].MountPath),
+		"--dst", fmt.Sprintf("docker://%s", target.Image()),
 	)
+	switch target.Platform {
+	case "":
+	case "all":
+		args = append(args, "--all-platforms")
+	default:
+		args = append(args, "--platform", target.Platform)
+	}
+	for _, label := range target.LabelList() {
+		args = append(args, "--label", label)
+	}
+	args = append(args, layerArgs...)
 	// Add main container
 	buildJob.Spec.Template.Spec.Containers = []v1.Container{
 		{
@@ -584,13 +961,66 @@ func EnsureFuncImage(client kubernetes.Interface, funcObj *kubelessApi.Function,
 			Args: args,
 		},
 	}
+	return buildJob, nil
+}
 
-	// Create the job if doesn't exists yet
-	_, err = client.BatchV1().Jobs(funcObj.ObjectMeta.Namespace).Create(&buildJob)
-	if err == nil {
-		logrus.Infof("Started function build job %s", jobName)
+const (
+	// BuildContextDir is the directory with the prepared function in the build jobs of the Dockerfile backends
+	BuildContextDir = "/kubeless"
+	// BuildDockerfile is the Dockerfile generated in BuildContextDir by the build jobs of the Dockerfile backends
+	BuildDockerfile = BuildContextDir + "/.kubeless-Dockerfile"
+	// BuildDockerConfigDir is the directory with the docker config.json of the registry credentials in the build
+	// container of the Dockerfile backends, also set as DOCKER_CONFIG
+	BuildDockerConfigDir = "/docker"
+)
+
+// NewDockerfileBuildJob returns a Job that prepares the function like the function image builder does and then
+// runs the given container to build BuildDockerfile with BuildContextDir as context. The Dockerfile copies the
+// prepared function to the runtime image. The container is named "build" and it has the runtime volume and the
+// docker config with the registry credentials mounted
+func NewDockerfileBuildJob(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes, or []metav1.OwnerReference, target *BuildTarget, provisionImage string, imagePullSecrets []v1.LocalObjectReference, build v1.Container) (*batchv1.Job, error) {
+	podSpec, runtimeVolumeMount, err := newBuildPodSpec(funcObj, lr, target, provisionImage, imagePullSecrets)
+	if err != nil {
+		return nil, err
 	}
-	return err
+	if runtimeVolumeMount.MountPath != BuildContextDir {
+		return nil, fmt.Errorf("Unexpected runtime volume path %s", runtimeVolumeMount.MountPath)
+	}
+	baseImage, err := lr.GetFunctionImage(funcObj.Spec.Runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Dockerfile and the files of the builds are excluded from the context
+	podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
+		Name:    "dockerfile",
+		Image:   provisionImage,
+		Command: []string{"sh", "-c"},
+		Args: []string{appendToCommand("",
+			fmt.Sprintf(`printf 'FROM %%s\nCOPY . %%s/\n' %s %s > %s`, baseImage, BuildContextDir, BuildDockerfile),
+			fmt.Sprintf(`printf '.kubeless-*\n.dockerignore\n' > %s`, path.Join(BuildContextDir, ".dockerignore")),
+		)},
+		VolumeMounts: []v1.VolumeMount{runtimeVolumeMount},
+	})
+
+	build.Name = "build"
+	build.WorkingDir = BuildContextDir
+	build.VolumeMounts = append(build.VolumeMounts,
+		runtimeVolumeMount,
+		v1.VolumeMount{
+			Name:      target.Secret,
+			MountPath: BuildDockerConfigDir,
+		},
+	)
+	build.Env = append(build.Env, v1.EnvVar{Name: "DOCKER_CONFIG", Value: BuildDockerConfigDir})
+	podSpec.Containers = []v1.Container{build}
+	// The secret is mounted as a docker config.json
+	for i, vol := range podSpec.Volumes {
+		if vol.Name == target.Secret && vol.Secret != nil {
+			podSpec.Volumes[i].Secret.Items = []v1.KeyToPath{{Key: ".dockerconfigjson", Path: "config.json"}}
+		}
+	}
+	return newBuildJob(funcObj, or, target, podSpec), nil
 }
 
 func svcTargetPort(funcObj *kubelessApi.Function) int32 {
@@ -795,6 +1225,244 @@ func EnsureFuncDeployment(client kubernetes.Interface, funcObj *kubelessApi.Func
 	return err
 }
 
+// ActivatorPort returns the port of the activator that receives the requests of a function scaled to zero
+func ActivatorPort(svc *v1.Service) (int32, error) {
+	value, ok := svc.ObjectMeta.Annotations[ScaledToZeroAnnotation]
+	if !ok {
+		return 0, fmt.Errorf("The function %s/%s is not scaled to zero", svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < ActivatorFirstFunctionPort || port > ActivatorLastFunctionPort {
+		return 0, fmt.Errorf("Invalid activator port %q of the function %s/%s", value, svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
+	}
+	return int32(port), nil
+}
+
+// ActivatorPortIndexFunc indexes the services of the functions scaled to zero by their port of the activator
+func ActivatorPortIndexFunc(obj interface{}) ([]string, error) {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		return []string{}, nil
+	}
+	port, err := ActivatorPort(svc)
+	if err != nil {
+		return []string{}, nil
+	}
+	return []string{strconv.Itoa(int(port))}, nil
+}
+
+// allocateActivatorPort returns a port of the activator that is not used by other functions scaled to zero.
+// The services should be indexed with ActivatorPortIndexFunc
+func allocateActivatorPort(services cache.Indexer) (int32, error) {
+	for port := int32(ActivatorFirstFunctionPort); port <= ActivatorLastFunctionPort; port++ {
+		used, err := services.ByIndex(ActivatorPortIndex, strconv.Itoa(int(port)))
+		if err != nil {
+			return 0, err
+		}
+		if len(used) == 0 {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("All the ports of the activator are in use by functions scaled to zero")
+}
+
+// RedirectFuncServiceToActivator removes the selector of the service of a function so its requests
+// are sent to the given activator endpoints, on a port of the activator reserved for the function.
+// The port is chosen among the ones not used by the given services, indexed with ActivatorPortIndexFunc.
+// Calls for different functions should not run concurrently, since they may reserve the same port
+func RedirectFuncServiceToActivator(client kubernetes.Interface, services cache.Indexer, funcObj *kubelessApi.Function, activator *v1.Endpoints) error {
+	svc, err := client.CoreV1().Services(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	port, err := ActivatorPort(svc)
+	if err != nil {
+		port, err = allocateActivatorPort(services)
+		if err != nil {
+			return err
+		}
+	}
+	if svc.ObjectMeta.Annotations == nil {
+		svc.ObjectMeta.Annotations = map[string]string{}
+	}
+	svc.ObjectMeta.Annotations[ScaledToZeroAnnotation] = strconv.Itoa(int(port))
+	svc.Spec.Selector = nil
+	svc, err = client.CoreV1().Services(funcObj.ObjectMeta.Namespace).Update(svc)
+	if err != nil {
+		return err
+	}
+	// Store the reserved port right away, so the next function doesn't take it before the cache receives the update
+	if err := services.Update(svc); err != nil {
+		return err
+	}
+	return EnsureFuncActivatorEndpoints(client, funcObj, activator, port)
+}
+
+// RestoreFuncService sets back the selector of the service of a function
+// that was sending its requests to the activator
+func RestoreFuncService(client kubernetes.Interface, funcObj *kubelessApi.Function) error {
+	svc, err := client.CoreV1().Services(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	delete(svc.ObjectMeta.Annotations, ScaledToZeroAnnotation)
+	svc.Spec.Selector = serviceSpec(funcObj).Selector
+	_, err = client.CoreV1().Services(funcObj.ObjectMeta.Namespace).Update(svc)
+	return err
+}
+
+// EnsureFuncActivatorEndpoints creates/updates the endpoints of the service of a function
+// (which should not have a selector) so its requests are sent to the given port of the activator endpoints
+func EnsureFuncActivatorEndpoints(client kubernetes.Interface, funcObj *kubelessApi.Function, activator *v1.Endpoints, activatorPort int32) error {
+	subsets := []v1.EndpointSubset{}
+	for _, activatorSubset := range activator.Subsets {
+		if len(activatorSubset.Addresses) == 0 {
+			continue
+		}
+		subset := v1.EndpointSubset{Addresses: activatorSubset.Addresses}
+		// Every port of the function is served by the port of the activator reserved for the function
+		for _, port := range serviceSpec(funcObj).Ports {
+			subset.Ports = append(subset.Ports, v1.EndpointPort{
+				Name:     port.Name,
+				Port:     activatorPort,
+				Protocol: port.Protocol,
+			})
+		}
+		subsets = append(subsets, subset)
+	}
+	if len(subsets) == 0 {
+		return fmt.Errorf("The activator %s/%s doesn't have ready endpoints", activator.ObjectMeta.Namespace, activator.ObjectMeta.Name)
+	}
+	endpoints, err := client.CoreV1().Endpoints(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return err
+		}
+		_, err = client.CoreV1().Endpoints(funcObj.ObjectMeta.Namespace).Create(&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   funcObj.ObjectMeta.Name,
+				Labels: addDefaultLabel(mergeMap(map[string]string{}, funcObj.ObjectMeta.Labels)),
+			},
+			Subsets: subsets,
+		})
+		return err
+	}
+	endpoints.Subsets = subsets
+	_, err = client.CoreV1().Endpoints(funcObj.ObjectMeta.Namespace).Update(endpoints)
+	return err
+}
+
+// FunctionRouterTarget is a service that receives a share of the requests of a function
+type FunctionRouterTarget struct {
+	Revision int64  `json:"revision"`
+	URL      string `json:"url"`
+	Weight   int32  `json:"weight"`
+}
+
+// FunctionServiceURL returns the URL of the service of a function within the cluster
+func FunctionServiceURL(funcObj *kubelessApi.Function) string {
+	return fmt.Sprintf("http://%s.%s:%d", funcObj.ObjectMeta.Name, funcObj.ObjectMeta.Namespace, serviceSpec(funcObj).Ports[0].Port)
+}
+
+// EnsureFuncRouterDeployment creates/updates the deployment of a function with a router
+// that splits the requests between the given targets
+func EnsureFuncRouterDeployment(client kubernetes.Interface, funcObj *kubelessApi.Function, or []metav1.OwnerReference, routerImage string, targets []FunctionRouterTarget, imagePullSecrets []v1.LocalObjectReference) error {
+	targetsJSON, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	maxUnavailable := intstr.FromInt(0)
+	port := svcTargetPort(funcObj)
+	dpm := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            funcObj.ObjectMeta.Name,
+			Labels:          addDefaultLabel(mergeMap(map[string]string{}, funcObj.ObjectMeta.Labels)),
+			OwnerReferences: or,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: funcObj.Spec.Deployment.Spec.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"created-by": funcObj.ObjectMeta.Labels["created-by"], "function": funcObj.ObjectMeta.Labels["function"]},
+			},
+			Strategy: appsv1.DeploymentStrategy{
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: funcObj.ObjectMeta.Labels,
+					Annotations: map[string]string{
+						"prometheus.io/scrape": "true",
+						"prometheus.io/path":   "/metrics",
+						"prometheus.io/port":   strconv.Itoa(int(port)),
+					},
+				},
+				Spec: v1.PodSpec{
+					ImagePullSecrets: imagePullSecrets,
+					Containers: []v1.Container{
+						{
+							Name:  funcObj.ObjectMeta.Name,
+							Image: routerImage,
+							Env: []v1.EnvVar{
+								{
+									Name:  "FUNC_PORT",
+									Value: strconv.Itoa(int(port)),
+								},
+								{
+									Name:  "ROUTER_TARGETS",
+									Value: string(targetsJSON),
+								},
+							},
+							Ports: []v1.ContainerPort{
+								{
+									ContainerPort: port,
+								},
+							},
+							ReadinessProbe: &v1.Probe{
+								Handler: v1.Handler{
+									HTTPGet: &v1.HTTPGetAction{
+										Path: "/healthz",
+										Port: intstr.FromInt(int(port)),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err = client.AppsV1().Deployments(funcObj.ObjectMeta.Namespace).Create(dpm)
+	if err != nil && k8sErrors.IsAlreadyExists(err) {
+		var newDpm *appsv1.Deployment
+		newDpm, err = client.AppsV1().Deployments(funcObj.ObjectMeta.Namespace).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !hasDefaultLabel(newDpm.ObjectMeta.Labels) {
+			return fmt.Errorf("Found a conflicting deployment object %s/%s. Aborting", funcObj.ObjectMeta.Namespace, funcObj.ObjectMeta.Name)
+		}
+		newDpm.ObjectMeta.Labels = dpm.ObjectMeta.Labels
+		newDpm.ObjectMeta.OwnerReferences = or
+		// We should maintain previous selector to avoid duplicated ReplicaSets
+		selector := newDpm.Spec.Selector
+		newDpm.Spec = dpm.Spec
+		newDpm.Spec.Selector = selector
+		data, err := json.Marshal(newDpm)
+		if err != nil {
+			return err
+		}
+		// Use `Patch` to do a rolling update
+		_, err = client.AppsV1().Deployments(funcObj.ObjectMeta.Namespace).Patch(newDpm.Name, types.MergePatchType, data)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
 // CreateServiceMonitor creates a Service Monitor for the given function
 func CreateServiceMonitor(smclient monitoringv1alpha1.MonitoringV1alpha1Client, funcObj *kubelessApi.Function, ns string, or []metav1.OwnerReference) error {
 	_, err := smclient.ServiceMonitors(ns).Get(funcObj.ObjectMeta.Name, metav1.GetOptions{})
@@ -969,8 +1637,15 @@ func GetContentType(filename string) (string, error) {
 	return contentType, nil
 }
 
-// ParseContent Parses the content of a file as string
+// ParseContent Parses the content of a file as string and returns its sha256 checksum
 func ParseContent(file, contentType string) (string, string, error) {
+	return ParseContentWithCredentials(file, contentType, "sha256", nil)
+}
+
+// ParseContentWithCredentials Parses the content of a file as string, downloading
+// it with the given credentials if it is a URL. Returns the checksum of the file
+// computed with the given algorithm
+func ParseContentWithCredentials(file, contentType, checksumAlgorithm string, creds *SourceCredentials) (string, string, error) {
 	var checksum, content string
 
 	if strings.Contains(contentType, "url") {
@@ -979,18 +1654,30 @@ func ParseContent(file, contentType string) (string, string, error) {
 		if err != nil {
 			return "", "", err
 		}
-		resp, err := http.Get(functionURL.String())
+		req, err := http.NewRequest("GET", functionURL.String(), nil)
+		if err != nil {
+			return "", "", err
+		}
+		if creds != nil {
+			if err := creds.Authorize(req); err != nil {
+				return "", "", err
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return "", "", err
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", "", fmt.Errorf("Unable to download %s: %s", file, resp.Status)
+		}
 
 		functionBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return "", "", err
 		}
 		content = string(functionBytes)
-		checksum, err = getSha256(functionBytes)
+		checksum, err = ComputeChecksum(checksumAlgorithm, functionBytes)
 		if err != nil {
 			return "", "", err
 		}
@@ -1006,7 +1693,7 @@ func ParseContent(file, contentType string) (string, string, error) {
 		} else {
 			content = base64.StdEncoding.EncodeToString(functionBytes)
 		}
-		checksum, err = getFileSha256(file)
+		checksum, err = ComputeChecksum(checksumAlgorithm, functionBytes)
 		if err != nil {
 			return "", "", err
 		}
@@ -1014,30 +1701,3 @@ func ParseContent(file, contentType string) (string, string, error) {
 
 	return content, checksum, nil
 }
-
-// Get the checksum of a file using sha256
-func getFileSha256(file string) (string, error) {
-	h := sha256.New()
-	ff, err := os.Open(file)
-	if err != nil {
-		return "", err
-	}
-	defer ff.Close()
-	_, err = io.Copy(h, ff)
-	if err != nil {
-		return "", err
-	}
-	checksum := hex.EncodeToString(h.Sum(nil))
-	return "sha256:" + checksum, err
-}
-
-// Get the checksum using sha256
-func getSha256(bytes []byte) (string, error) {
-	h := sha256.New()
-	_, err := h.Write(bytes)
-	if err != nil {
-		return "", err
-	}
-	checksum := hex.EncodeToString(h.Sum(nil))
-	return "sha256:" + checksum, nil
-}
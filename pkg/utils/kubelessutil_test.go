@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
 	"github.com/kubeless/kubeless/pkg/langruntime"
@@ -15,6 +17,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 )
 
 func getEnvValueFromList(envName string, l []v1.EnvVar) string {
@@ -417,7 +420,18 @@ func TestEnsureImage(t *testing.T) {
 	pullSecrets := []v1.LocalObjectReference{
 		{Name: "creds"},
 	}
-	err := EnsureFuncImage(clientset, f1, lr, or, "user/image", "4840d87600137157493ba43a24f0b4bb6cf524ebbf095ce96c79f85bf5a3ff5a", "kubeless/builder", "registry.docker.io", "registry-creds", "unzip", true, pullSecrets)
+	target := &BuildTarget{
+		Secret:   "registry-creds",
+		Host:     "registry.docker.io",
+		Name:     "user/image",
+		Tag:      "4840d87600137157493ba43a24f0b4bb6cf524ebbf095ce96c79f85bf5a3ff5a",
+		DepsName: "user/image-deps",
+		DepsTag:  FunctionDepsTag(f1),
+		// The files and the layers have the same time in every build
+		Timestamp: time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC),
+		Labels:    FunctionImageLabels(f1, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{UID: "1234"}}),
+	}
+	err := EnsureFuncImage(clientset, f1, lr, or, target, "kubeless/builder", "unzip", true, pullSecrets)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -468,6 +482,40 @@ func TestEnsureImage(t *testing.T) {
 	if !found {
 		t.Fatalf("Cannot find volume mount /var/run/secrets/kubeless.io/my-secret")
 	}
+
+	// The dependencies and the code are pushed as separate layers
+	args := strings.Join(buildContainer.Args, " ")
+	expectedArgs := fmt.Sprintf("--created 2018-03-01T10:00:00Z --src docker://%s --dst docker://%s --label io.kubeless.function.name=%s --label io.kubeless.function.namespace=%s --label io.kubeless.installation=1234 --intermediate-dst docker://%s", "bar", target.Image(), f1.ObjectMeta.Name, f1.ObjectMeta.Namespace, target.DepsImage())
+	if !strings.Contains(args, expectedArgs) || !strings.HasSuffix(args, "/kubeless/deps.tar.gz --created-by kubeless: code of the function f1 ("+target.Tag+") /kubeless/code.tar.gz") {
+		t.Errorf("Unexpected build arguments %s", args)
+	}
+	initContainers := jobs.Items[0].Spec.Template.Spec.InitContainers
+	bundle := initContainers[len(initContainers)-1]
+	if bundle.Name != "bundle" || bundle.Image != "kubeless/builder" || !strings.Contains(bundle.Args[0], "/imbuilder bundle --mtime 2018-03-01T10:00:00Z --files-from /kubeless/.kubeless-deps /kubeless/deps.tar.gz") {
+		t.Errorf("Expecting the builder to create the layers, received %+v", bundle)
+	}
+
+	// The cached dependencies are not installed again
+	clientset.BatchV1().Jobs(ns).Delete(jobs.Items[0].Name, &metav1.DeleteOptions{})
+	target.DepsCached = true
+	target.Platform = "all"
+	err = EnsureFuncImage(clientset, f1, lr, or, target, "kubeless/builder", "unzip", true, pullSecrets)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	jobs, _ = clientset.BatchV1().Jobs(ns).List(metav1.ListOptions{})
+	for _, c := range jobs.Items[0].Spec.Template.Spec.InitContainers {
+		if c.Name == "install" {
+			t.Error("Expecting the install step to be skipped")
+		}
+	}
+	args = strings.Join(jobs.Items[0].Spec.Template.Spec.Containers[0].Args, " ")
+	if !strings.Contains(args, "--src docker://"+target.DepsImage()) || strings.Contains(args, "deps.tar.gz") {
+		t.Errorf("Expecting the code layer on top of the dependencies image, received %s", args)
+	}
+	if !strings.Contains(args, "--all-platforms") {
+		t.Errorf("Expecting the layers to be added to every platform, received %s", args)
+	}
 }
 
 func getDefaultFunc(name, ns string) *kubelessApi.Function {
@@ -956,7 +1004,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	dvol := v1.VolumeMount{Name: "deps", MountPath: "/deps"}
 	resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("100m")}}
 
-	c, err := getProvisionContainer("test", "sha256:abc1234", "test.func", "test.foo", "text", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err := getProvisionContainer("test", "sha256:abc1234", "", "test.func", "test.foo", "text", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -974,7 +1022,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// If the content type is encoded it should decode it
-	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "test.func", "test.foo", "base64", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "", "test.func", "test.foo", "base64", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -992,7 +1040,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// It should skip the dependencies installation if the runtime is not supported
-	c, err = getProvisionContainer("function", "sha256:abc1234", "test.func", "test.foo", "text", "cobol", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("function", "sha256:abc1234", "", "test.func", "test.foo", "text", "cobol", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1001,7 +1049,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// It should extract the file in case it is a Zip
-	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "test.zip", "test.foo", "base64+zip", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "", "test.zip", "test.foo", "base64+zip", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1013,7 +1061,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// It should extract the compressed tar file
-	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "test.tar.gz", "test.foo", "base64+compressedtar", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "", "test.tar.gz", "test.foo", "base64+compressedtar", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1024,8 +1072,25 @@ func TestGetProvisionContainer(t *testing.T) {
 		t.Errorf("Unexpected command: %s", c.Args[0])
 	}
 
+	// It should verify sha512 checksums and the files of the checksum manifest after copying the deps
+	manifest := "sha512:" + strings.Repeat("a", 128) + "  test.py\n"
+	c, err = getProvisionContainer("Zm9vYmFyCg==", "sha512:abc1234", manifest, "test.zip", "test.foo", "base64+zip", "python2.7", "", "unzip", rvol, dvol, resources, lr)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(c.Args[0], "echo 'abc1234  /tmp/func.decoded' > /tmp/func.sha512 && sha512sum -c /tmp/func.sha512") {
+		t.Errorf("Unexpected command: %s", c.Args[0])
+	}
+	if !strings.HasSuffix(c.Args[0], fmt.Sprintf("cp /deps/requirements.txt /runtime && printf '%%s\\n' '%s  test.py' > /tmp/manifest.sha512 && (cd /runtime && sha512sum -c /tmp/manifest.sha512)", strings.Repeat("a", 128))) {
+		t.Errorf("Unexpected command: %s", c.Args[0])
+	}
+	_, err = getProvisionContainer("Zm9vYmFyCg==", "sha256:abc1234", "sha256:abc1234  ../test.py\n", "test.zip", "test.foo", "base64+zip", "python2.7", "", "unzip", rvol, dvol, resources, lr)
+	if err == nil {
+		t.Error("Expecting an error for an invalid checksum manifest")
+	}
+
 	// If the content type is url it should use curl
-	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.py", "sha256:abc1234", "", "test.foo", "url", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.py", "sha256:abc1234", "", "", "test.foo", "url", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1034,7 +1099,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// If the content type is url+zip it should use curl and unzip
-	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.zip", "sha256:abc1234", "", "test.foo", "url+zip", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.zip", "sha256:abc1234", "", "", "test.foo", "url+zip", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1046,7 +1111,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// If the content type is url+compressedtar it should use curl and tar
-	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.tar.gz", "sha256:abc1234", "", "test.foo", "url+compressedtar", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.tar.gz", "sha256:abc1234", "", "", "test.foo", "url+compressedtar", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1058,7 +1123,7 @@ func TestGetProvisionContainer(t *testing.T) {
 	}
 
 	// if the function use bundled deps in remote zip file
-	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.zip", "sha256:abc1234", "", "test.foo", "url+zip+deps", "python2.7", "unzip", rvol, dvol, resources, lr)
+	c, err = getProvisionContainer("https://raw.githubusercontent.com/test/test/test/test.zip", "sha256:abc1234", "", "", "test.foo", "url+zip+deps", "python2.7", "", "unzip", rvol, dvol, resources, lr)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1073,3 +1138,208 @@ func TestGetProvisionContainer(t *testing.T) {
 		t.Errorf("Unexpected command: %s", c.Args[0])
 	}
 }
+
+func TestBuildTimestamp(t *testing.T) {
+	created := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	f := &kubelessApi.Function{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	tests := map[string]time.Time{
+		"":                     created,
+		"creation":             created,
+		"epoch":                time.Unix(0, 0).UTC(),
+		"2019-01-02T03:04:05Z": time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	for source, expected := range tests {
+		timestamp, err := BuildTimestamp(f, source)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !timestamp.Equal(expected) {
+			t.Errorf("Expecting %v for %q, received %v", expected, source, timestamp)
+		}
+	}
+	if _, err := BuildTimestamp(f, "yesterday"); err == nil {
+		t.Error("Expecting an error for an unknown source")
+	}
+}
+
+func TestGetBuildTarget(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: RegistryCredentialsSecret, Namespace: "myns"},
+		Data: map[string][]byte{
+			".dockerconfigjson": []byte(`{"auths": {
+				"https://index.docker.io/v1/": {"username": "hub-user", "password": "pass"},
+				"mirror.example.com": {"username": "mirror-user", "password": "pass"},
+				"https://registry.example.com:5000/v2/": {"auth": "dXNlcjpwYXNz"}
+			}}`),
+		},
+	})
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "myns"},
+		Spec:       kubelessApi.FunctionSpec{Function: "function1", Runtime: "python2.7"},
+	}
+
+	if _, err := GetBuildTarget(clientset, f, "", ""); err == nil {
+		t.Error("Expecting an error when the push registry is not set and there are several ones")
+	}
+	if _, err := GetBuildTarget(clientset, f, "unknown.example.com", ""); err == nil {
+		t.Error("Expecting an error for a registry without credentials")
+	}
+	if _, err := GetBuildTarget(clientset, f, "registry.example.com:5000", ""); err == nil {
+		t.Error("Expecting an error when the credentials don't have a username and there is no prefix")
+	}
+
+	target, err := GetBuildTarget(clientset, f, "mirror.example.com", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.Host != "mirror.example.com" || target.Name != "mirror-user/foo" || target.DepsName != "mirror-user/foo-deps" {
+		t.Errorf("Unexpected target %+v", target)
+	}
+	if target.Registry.Endpoint != "https://mirror.example.com" || target.Registry.Creds.Username != "mirror-user" {
+		t.Errorf("Unexpected registry %+v", target.Registry)
+	}
+
+	target, err = GetBuildTarget(clientset, f, "docker.io", "team/functions/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.Name != "team/functions/foo" || target.Registry.Creds.Username != "hub-user" {
+		t.Errorf("Unexpected target %+v", target)
+	}
+
+	// The annotations of the function override the configuration
+	f.ObjectMeta.Annotations = map[string]string{
+		BuildRegistryAnnotation:         "registry.example.com:5000",
+		BuildRepositoryPrefixAnnotation: "team",
+	}
+	target, err = GetBuildTarget(clientset, f, "docker.io", "team/functions")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if target.Image() != "registry.example.com:5000/team/foo:"+target.Tag {
+		t.Errorf("Unexpected image %s", target.Image())
+	}
+	if target.Registry.Creds.Auth != "dXNlcjpwYXNz" {
+		t.Errorf("Unexpected registry %+v", target.Registry)
+	}
+}
+
+func TestNewDockerfileBuildJob(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "myns"},
+		Spec: kubelessApi.FunctionSpec{
+			Function: "function",
+			Deps:     "deps",
+			Handler:  "foo.bar",
+			Runtime:  "python2.7",
+		},
+	}
+	target := &BuildTarget{
+		Secret: "registry-creds",
+		Host:   "registry.example.com",
+		Name:   "user/foo",
+		Tag:    FunctionBuildTag(f),
+	}
+	job, err := NewDockerfileBuildJob(f, lr, nil, target, "unzip", nil, v1.Container{Image: "builder", Args: []string{"build"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.ObjectMeta.Name != FunctionBuildName("foo", target.Tag) || job.ObjectMeta.Namespace != "myns" {
+		t.Errorf("Unexpected job %s/%s", job.ObjectMeta.Namespace, job.ObjectMeta.Name)
+	}
+	podSpec := job.Spec.Template.Spec
+	initContainers := []string{}
+	for _, c := range podSpec.InitContainers {
+		initContainers = append(initContainers, c.Name)
+	}
+	if !reflect.DeepEqual(initContainers, []string{"prepare", "install", "dockerfile"}) {
+		t.Errorf("Unexpected init containers %v", initContainers)
+	}
+	dockerfile := podSpec.InitContainers[2].Args[0]
+	if !strings.Contains(dockerfile, "bar /kubeless > "+BuildDockerfile) {
+		t.Errorf("Expecting a Dockerfile from the runtime image, received %s", dockerfile)
+	}
+	build := podSpec.Containers[0]
+	if build.Name != "build" || build.Image != "builder" || build.WorkingDir != BuildContextDir {
+		t.Errorf("Unexpected build container %+v", build)
+	}
+	if getEnvValueFromList("DOCKER_CONFIG", build.Env) != BuildDockerConfigDir {
+		t.Errorf("Expecting DOCKER_CONFIG in the build container, received %v", build.Env)
+	}
+	mounts := map[string]string{}
+	for _, m := range build.VolumeMounts {
+		mounts[m.Name] = m.MountPath
+	}
+	if mounts["foo"] != BuildContextDir || mounts["registry-creds"] != BuildDockerConfigDir {
+		t.Errorf("Unexpected volume mounts %v", build.VolumeMounts)
+	}
+	found := false
+	for _, vol := range podSpec.Volumes {
+		if vol.Name == "registry-creds" {
+			found = true
+			if vol.Secret == nil || !reflect.DeepEqual(vol.Secret.Items, []v1.KeyToPath{{Key: ".dockerconfigjson", Path: "config.json"}}) {
+				t.Errorf("Expecting the secret to be mounted as a docker config.json, received %+v", vol)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expecting the volume of the registry credentials")
+	}
+}
+
+func TestRedirectFuncServiceToActivator(t *testing.T) {
+	activator := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "function-activator", Namespace: "kubeless"},
+		Subsets: []v1.EndpointSubset{
+			{Addresses: []v1.EndpointAddress{{IP: "10.0.0.10"}}, Ports: []v1.EndpointPort{{Port: 8080}}},
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ActivatorPortIndex: ActivatorPortIndexFunc})
+	functions := []*kubelessApi.Function{}
+	// Functions with the same name in different namespaces get different ports
+	for _, ns := range []string{"default", "other"} {
+		f := &kubelessApi.Function{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: ns, Labels: map[string]string{"function": "foo"}},
+		}
+		if err := EnsureFuncService(clientset, f, []metav1.OwnerReference{}); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		functions = append(functions, f)
+	}
+
+	for i, f := range functions {
+		if err := RedirectFuncServiceToActivator(clientset, services, f, activator); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		svc, _ := clientset.CoreV1().Services(f.Namespace).Get(f.Name, metav1.GetOptions{})
+		port, err := ActivatorPort(svc)
+		if err != nil || port != ActivatorFirstFunctionPort+int32(i) || svc.Spec.Selector != nil {
+			t.Errorf("Unexpected service of %s/%s: %v", f.Namespace, f.Name, svc)
+		}
+		endpoints, _ := clientset.CoreV1().Endpoints(f.Namespace).Get(f.Name, metav1.GetOptions{})
+		if endpoints.Subsets[0].Addresses[0].IP != "10.0.0.10" || endpoints.Subsets[0].Ports[0].Port != port {
+			t.Errorf("Unexpected endpoints of %s/%s: %v", f.Namespace, f.Name, endpoints.Subsets)
+		}
+	}
+
+	// The port of a function is kept while it is scaled to zero and released once restored
+	if err := RedirectFuncServiceToActivator(clientset, services, functions[1], activator); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	svc, _ := clientset.CoreV1().Services("other").Get("foo", metav1.GetOptions{})
+	if port, _ := ActivatorPort(svc); port != ActivatorFirstFunctionPort+1 {
+		t.Errorf("Expecting the port of the function to be kept, received %d", port)
+	}
+	if err := RestoreFuncService(clientset, functions[0]); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	svc, _ = clientset.CoreV1().Services("default").Get("foo", metav1.GetOptions{})
+	if _, err := ActivatorPort(svc); err == nil {
+		t.Errorf("Expecting the port of the function to be released: %v", svc)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultChecksumAlgorithm is the algorithm of the checksums computed by the CLI if none is given
+const DefaultChecksumAlgorithm = "sha256"
+
+// checksumAlgorithms are the algorithms supported in the checksums of the functions and their manifests
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hexRegexp matches the digests of the checksums
+var hexRegexp = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// ComputeChecksum returns the checksum of the content as <algorithm>:<hex>
+func ComputeChecksum(algorithm string, content []byte) (string, error) {
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("Unsupported checksum algorithm %q, expecting sha256 or sha512", algorithm)
+	}
+	h := newHash()
+	h.Write(content)
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// splitChecksum returns the algorithm and the hex digest of a checksum, if the algorithm is supported
+func splitChecksum(checksum string) (string, string, error) {
+	checksumInfo := strings.SplitN(checksum, ":", 2)
+	_, ok := checksumAlgorithms[checksumInfo[0]]
+	if len(checksumInfo) != 2 || !ok {
+		return "", "", fmt.Errorf("Unable to verify checksum %s: Unknown format", checksum)
+	}
+	if !hexRegexp.MatchString(checksumInfo[1]) {
+		return "", "", fmt.Errorf("Unable to verify checksum %s: Invalid %s digest", checksum, checksumInfo[0])
+	}
+	return checksumInfo[0], checksumInfo[1], nil
+}
+
+// validManifestPath returns an error if the path can't be part of a checksum manifest. The paths are relative
+// to the directory of the function and are written in the provision container between single quotes
+func validManifestPath(p string) error {
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("Invalid path %q in the checksum manifest", p)
+	}
+	if strings.ContainsAny(p, "'\\\n\r") {
+		return fmt.Errorf("Unsupported character in the path %q of the checksum manifest", p)
+	}
+	return nil
+}
+
+// ParseChecksumManifest parses a checksum manifest: one `<algorithm>:<hex>  <path>` line per file of the function
+func ParseChecksumManifest(manifest string) (map[string]string, error) {
+	entries := map[string]string{}
+	for _, line := range strings.Split(manifest, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid line %q in the checksum manifest: it should be <algorithm>:<hex>  <path>", line)
+		}
+		algorithm, digest, err := splitChecksum(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(digest) != 2*checksumAlgorithms[algorithm]().Size() {
+			return nil, fmt.Errorf("Invalid %s checksum of %s in the checksum manifest", algorithm, parts[1])
+		}
+		if err := validManifestPath(parts[1]); err != nil {
+			return nil, err
+		}
+		entries[parts[1]] = parts[0]
+	}
+	return entries, nil
+}
+
+// FormatChecksumManifest returns the manifest of the given checksums, sorted by path
+func FormatChecksumManifest(entries map[string]string) string {
+	paths := []string{}
+	for p := range entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	manifest := ""
+	for _, p := range paths {
+		manifest += fmt.Sprintf("%s  %s\n", entries[p], p)
+	}
+	return manifest
+}
+
+// DiffChecksumManifests returns the paths added, modified and removed between two manifests
+func DiffChecksumManifests(oldEntries, newEntries map[string]string) ([]string, []string, []string) {
+	added, modified, removed := []string{}, []string{}, []string{}
+	for p, checksum := range newEntries {
+		oldChecksum, ok := oldEntries[p]
+		if !ok {
+			added = append(added, p)
+		} else if oldChecksum != checksum {
+			modified = append(modified, p)
+		}
+	}
+	for p := range oldEntries {
+		if _, ok := newEntries[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(modified)
+	sort.Strings(removed)
+	return added, modified, removed
+}
+
+// BundleChecksums returns the checksums of the regular files of a zip or tar bundle, the files that
+// the provision container extracts. It returns nil if the content type is not a bundle or if the
+// compression of the tar file is not supported (xz)
+func BundleChecksums(algorithm, contentType string, content []byte) (map[string]string, error) {
+	entries := map[string]string{}
+	add := func(name string, r io.Reader) error {
+		// Like tar and unzip, extract absolute paths in the destination directory
+		p := path.Clean(strings.TrimLeft(strings.TrimPrefix(name, "./"), "/"))
+		if err := validManifestPath(p); err != nil {
+			return err
+		}
+		fileContent, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		entries[p], err = ComputeChecksum(algorithm, fileContent)
+		return err
+	}
+
+	if strings.Contains(contentType, "zip") {
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the zip file: %v", err)
+		}
+		for _, f := range zr.File {
+			if !f.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	if strings.Contains(contentType, "compressedtar") {
+		var r io.Reader = bytes.NewReader(content)
+		switch {
+		case bytes.HasPrefix(content, []byte{0x1f, 0x8b}):
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read the tar file: %v", err)
+			}
+			defer gr.Close()
+			r = gr
+		case bytes.HasPrefix(content, []byte("BZh")):
+			r = bzip2.NewReader(r)
+		case bytes.HasPrefix(content, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+			return nil, nil
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read the tar file: %v", err)
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				continue
+			}
+			if err := add(hdr.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+	return nil, nil
+}
+
+// appendManifestCheck adds to the command the verification of the files of the checksum manifest in the given directory
+func appendManifestCheck(prepareCommand, manifest, dir string) (string, error) {
+	entries, err := ParseChecksumManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+	byAlgorithm := map[string][]string{}
+	for p, checksum := range entries {
+		algorithm, digest, _ := splitChecksum(checksum)
+		byAlgorithm[algorithm] = append(byAlgorithm[algorithm], fmt.Sprintf("'%s  %s'", digest, p))
+	}
+	algorithms := []string{}
+	for algorithm := range byAlgorithm {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	for _, algorithm := range algorithms {
+		lines := byAlgorithm[algorithm]
+		sort.Strings(lines)
+		manifestFile := "/tmp/manifest." + algorithm
+		prepareCommand = appendToCommand(prepareCommand,
+			fmt.Sprintf("printf '%%s\\n' %s > %s", strings.Join(lines, " "), manifestFile),
+			fmt.Sprintf("(cd %s && %ssum -c %s)", dir, algorithm, manifestFile),
+		)
+	}
+	return prepareCommand, nil
+}
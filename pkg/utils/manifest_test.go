@@ -0,0 +1,164 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeChecksum(t *testing.T) {
+	content := []byte("function")
+	checksum, err := ComputeChecksum("sha512", content)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := fmt.Sprintf("sha512:%x", sha512.Sum512(content)); checksum != expected {
+		t.Errorf("Expecting %s, received %s", expected, checksum)
+	}
+	if _, err := ComputeChecksum("md5", content); err == nil {
+		t.Error("Expecting an error for an unsupported algorithm")
+	}
+}
+
+func TestBundleChecksums(t *testing.T) {
+	files := map[string]string{"handler.py": "def foo(event, context):\n", "lib/util.py": "pass\n"}
+	expected := map[string]string{}
+	for name, content := range files {
+		expected[name] = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	}
+
+	zipContent := &bytes.Buffer{}
+	zw := zip.NewWriter(zipContent)
+	if _, err := zw.Create("lib/"); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	entries, err := BundleChecksums("sha256", "base64+zip", zipContent.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expecting %v, received %v", expected, entries)
+	}
+
+	tarContent := &bytes.Buffer{}
+	gw := gzip.NewWriter(tarContent)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "./lib/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	entries, err = BundleChecksums("sha256", "base64+compressedtar", tarContent.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expecting %v, received %v", expected, entries)
+	}
+
+	entries, err = BundleChecksums("sha256", "text", []byte("function"))
+	if err != nil || entries != nil {
+		t.Errorf("Expecting no checksums for a text function, received %v %v", entries, err)
+	}
+
+	zipContent = &bytes.Buffer{}
+	zw = zip.NewWriter(zipContent)
+	zw.Create("../handler.py")
+	zw.Close()
+	if _, err := BundleChecksums("sha256", "base64+zip", zipContent.Bytes()); err == nil {
+		t.Error("Expecting an error for a file out of the function directory")
+	}
+}
+
+func TestChecksumManifest(t *testing.T) {
+	sha256Sum := "sha256:" + strings.Repeat("a", 64)
+	sha512Sum := "sha512:" + strings.Repeat("b", 128)
+	entries := map[string]string{"lib/util.py": sha512Sum, "handler.py": sha256Sum}
+	manifest := FormatChecksumManifest(entries)
+	if expected := sha256Sum + "  handler.py\n" + sha512Sum + "  lib/util.py\n"; manifest != expected {
+		t.Errorf("Expecting %q, received %q", expected, manifest)
+	}
+	parsed, err := ParseChecksumManifest(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("Expecting %v, received %v", entries, parsed)
+	}
+
+	for _, invalid := range []string{
+		sha256Sum + " handler.py",
+		"md5:" + strings.Repeat("a", 32) + "  handler.py",
+		"sha256:abc  handler.py",
+		sha512Sum[:len(sha512Sum)-1] + "x  handler.py",
+		sha256Sum + "  ../handler.py",
+		sha256Sum + "  /handler.py",
+		sha256Sum + "  it's.py",
+	} {
+		if _, err := ParseChecksumManifest(invalid); err == nil {
+			t.Errorf("Expecting an error parsing %q", invalid)
+		}
+	}
+
+	added, modified, removed := DiffChecksumManifests(entries, map[string]string{"handler.py": sha512Sum, "requirements.txt": sha256Sum})
+	if !reflect.DeepEqual(added, []string{"requirements.txt"}) || !reflect.DeepEqual(modified, []string{"handler.py"}) || !reflect.DeepEqual(removed, []string{"lib/util.py"}) {
+		t.Errorf("Unexpected diff: added %v, modified %v, removed %v", added, modified, removed)
+	}
+}
+
+func TestAppendManifestCheck(t *testing.T) {
+	sha256Sum := "sha256:" + strings.Repeat("a", 64)
+	sha512Sum := "sha512:" + strings.Repeat("b", 128)
+	manifest := sha256Sum + "  handler.py\n" + sha512Sum + "  lib/util.py\n"
+	command, err := appendManifestCheck("cp /src /dst", manifest, "/kubeless")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "cp /src /dst && " +
+		fmt.Sprintf("printf '%%s\\n' '%s  handler.py' > /tmp/manifest.sha256 && (cd /kubeless && sha256sum -c /tmp/manifest.sha256) && ", strings.Repeat("a", 64)) +
+		fmt.Sprintf("printf '%%s\\n' '%s  lib/util.py' > /tmp/manifest.sha512 && (cd /kubeless && sha512sum -c /tmp/manifest.sha512)", strings.Repeat("b", 128))
+	if command != expected {
+		t.Errorf("Expecting\n%s\nreceived\n%s", expected, command)
+	}
+
+	command, err = appendManifestCheck("cp /src /dst", "", "/kubeless")
+	if err != nil || command != "cp /src /dst" {
+		t.Errorf("Expecting the command unchanged without manifest, received %q %v", command, err)
+	}
+	if _, err := appendManifestCheck("", "invalid", "/kubeless"); err == nil {
+		t.Error("Expecting an error for an invalid manifest")
+	}
+}
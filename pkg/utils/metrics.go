@@ -18,7 +18,11 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/prometheus/common/expfmt"
@@ -41,6 +45,11 @@ type MetricsRetriever interface {
 	GetRawMetrics(kubernetes.Interface, string, string) ([]byte, error)
 }
 
+// PodMetricsRetriever is an interface for retreiving the metrics of a single pod
+type PodMetricsRetriever interface {
+	GetPodRawMetrics(kubernetes.Interface, string, string, string) ([]byte, error)
+}
+
 // PrometheusMetricsHandler is a handler for retreiving metrics from Prometheus
 type PrometheusMetricsHandler struct{}
 
@@ -112,6 +121,50 @@ func (h *PrometheusMetricsHandler) GetRawMetrics(apiV1Client kubernetes.Interfac
 	return req.Do().Raw()
 }
 
+// GetPodRawMetrics returns the raw metrics for the Prometheus endpoint of a pod
+func (h *PrometheusMetricsHandler) GetPodRawMetrics(apiV1Client kubernetes.Interface, namespace, podName, port string) ([]byte, error) {
+	req := apiV1Client.CoreV1().RESTClient().Get().Namespace(namespace).Resource("pods").SubResource("proxy").Name(podName + ":" + port).Suffix("/metrics")
+	return req.Do().Raw()
+}
+
+// GetFunctionCalls returns the total number of calls received by the running pods of a function
+func GetFunctionCalls(apiV1Client kubernetes.Interface, h PodMetricsRetriever, namespace, functionName string) (float64, error) {
+	svc, err := apiV1Client.CoreV1().Services(namespace).Get(functionName, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to find the service for function %s", functionName)
+	}
+	// The pods expose the metrics in the target port of the service
+	port := svc.Spec.Ports[0].TargetPort.String()
+	if port == "0" || port == "" {
+		port = strconv.Itoa(int(svc.Spec.Ports[0].Port))
+	}
+	pods, err := apiV1Client.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("function=%s", functionName),
+	})
+	if err != nil {
+		return 0, err
+	}
+	calls := float64(0)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		res, err := h.GetPodRawMetrics(apiV1Client, namespace, pod.ObjectMeta.Name, port)
+		if err != nil {
+			return 0, err
+		}
+		parser := expfmt.TextParser{}
+		parsedData, err := parser.TextToMetricFamilies(bytes.NewReader(res))
+		if err != nil {
+			return 0, err
+		}
+		for _, metric := range parsedData["function_calls_total"].GetMetric() {
+			calls += metric.GetCounter().GetValue()
+		}
+	}
+	return calls, nil
+}
+
 // GetFunctionMetrics returns Prometheus metrics as a slice of *Metrics
 func GetFunctionMetrics(apiV1Client kubernetes.Interface, h MetricsRetriever, namespace, functionName string) []*Metric {
 
@@ -0,0 +1,242 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// allNamespaces is the entry of the trust policy with the keys trusted in every namespace
+const allNamespaces = "*"
+
+// The signature of a function covers a payload with every field that decides which code runs: the checksum,
+// which the provision container verifies against the code it downloads or extracts, how the code is unpacked,
+// the handler, the runtime, the dependencies and the custom image. Ed25519 keys sign the payload. ECDSA P-256
+// keys sign its SHA-256 digest, like `cosign sign-blob`
+
+// signaturePayload is the document covered by the signature of a function. The fields are serialized in order
+type signaturePayload struct {
+	Checksum      string `json:"checksum"`
+	ContentFormat string `json:"function-content-format"`
+	FunctionPath  string `json:"function-path"`
+	Handler       string `json:"handler"`
+	Runtime       string `json:"runtime"`
+	Deps          string `json:"deps"`
+	Image         string `json:"image"`
+}
+
+// contentFormat returns the content type of a function without how the code is fetched (text, base64 or url),
+// which changes when a bundle is moved to an artifact store but doesn't change the code since it is verified
+// by its checksum
+func contentFormat(contentType string) string {
+	parts := strings.SplitN(contentType, "+", 2)
+	switch parts[0] {
+	case "text", "base64", "url":
+		if len(parts) == 1 {
+			return ""
+		}
+		return parts[1]
+	default:
+		return contentType
+	}
+}
+
+// customImage returns the image of the runtime container set in the deployment of the function, if any
+func customImage(spec *kubelessApi.FunctionSpec) string {
+	if len(spec.Deployment.Spec.Template.Spec.Containers) == 0 {
+		return ""
+	}
+	return spec.Deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+// FunctionSignaturePayload returns the document that the signature of the function covers
+func FunctionSignaturePayload(spec *kubelessApi.FunctionSpec) ([]byte, error) {
+	if spec.Checksum == "" {
+		return nil, fmt.Errorf("The function doesn't have a checksum to sign")
+	}
+	return json.Marshal(signaturePayload{
+		Checksum:      spec.Checksum,
+		ContentFormat: contentFormat(spec.FunctionContentType),
+		FunctionPath:  spec.FunctionPath,
+		Handler:       spec.Handler,
+		Runtime:       spec.Runtime,
+		Deps:          spec.Deps,
+		Image:         customImage(spec),
+	})
+}
+
+// SignFunction signs the payload of the function with the given PEM encoded private key (PKCS#8 Ed25519 or
+// ECDSA P-256 keys, e.g. generated with `openssl genpkey -algorithm ed25519`) and stores it in the function
+func SignFunction(spec *kubelessApi.FunctionSpec, keyPEM []byte) error {
+	payload, err := FunctionSignaturePayload(spec)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("Unable to decode the signing key: expecting a PEM encoded private key")
+	}
+	var key interface{}
+	if block.Type == "EC PRIVATE KEY" {
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to parse the signing key: %v", err)
+	}
+	var signature []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, payload)
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("Unsupported ECDSA curve %s, expecting P-256", k.Curve.Params().Name)
+		}
+		digest := sha256.Sum256(payload)
+		signature, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unsupported signing key %T, expecting an Ed25519 or ECDSA P-256 key", key)
+	}
+	spec.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// VerifyFunctionSignature checks that the function is signed by one of the given public keys. The functions
+// that set the image of any container are refused since the image would run code out of the signature
+func VerifyFunctionSignature(spec *kubelessApi.FunctionSpec, keys []crypto.PublicKey) error {
+	podSpec := spec.Deployment.Spec.Template.Spec
+	for _, c := range append(append([]v1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+		if c.Image != "" {
+			return fmt.Errorf("The function sets the image %s, custom images are not allowed for signed functions", c.Image)
+		}
+	}
+	if spec.Signature == "" {
+		return fmt.Errorf("The function is not signed")
+	}
+	if spec.Checksum == "" {
+		return fmt.Errorf("The function doesn't have a checksum, the signature can't be verified")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(spec.Signature))
+	if err != nil {
+		return fmt.Errorf("Unable to decode the signature of the function: %v", err)
+	}
+	payload, err := FunctionSignaturePayload(spec)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(payload)
+	for _, key := range keys {
+		switch k := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, signature) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], signature) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("The signature of the function doesn't match any of the %d trusted keys", len(keys))
+}
+
+// parsePublicKey parses a PEM encoded PKIX Ed25519 or ECDSA P-256 public key, the format of cosign.pub
+func parsePublicKey(keyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("expecting a PEM encoded public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s, expecting P-256", k.Curve.Params().Name)
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported public key %T, expecting an Ed25519 or ECDSA P-256 key", key)
+}
+
+// parseTrustPolicy parses the function-trust-policy of the kubeless configuration: the PEM encoded
+// public keys trusted in each namespace, with "*" for the keys trusted in all of them
+func parseTrustPolicy(config *v1.ConfigMap) (map[string][]crypto.PublicKey, error) {
+	data := config.Data["function-trust-policy"]
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	policy := map[string][]string{}
+	if err := yaml.Unmarshal([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("Unable to parse function-trust-policy: %v", err)
+	}
+	keys := map[string][]crypto.PublicKey{}
+	for ns, pems := range policy {
+		keys[ns] = []crypto.PublicKey{}
+		for i, p := range pems {
+			key, err := parsePublicKey(p)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid key %d of the namespace %s in function-trust-policy: %v", i, ns, err)
+			}
+			keys[ns] = append(keys[ns], key)
+		}
+	}
+	return keys, nil
+}
+
+// ValidateTrustPolicy returns an error if the function-trust-policy of the kubeless configuration is not valid
+func ValidateTrustPolicy(config *v1.ConfigMap) error {
+	_, err := parseTrustPolicy(config)
+	return err
+}
+
+// TrustedKeys returns the public keys allowed to sign the functions of the namespace. It returns nil
+// if the trust policy doesn't include the namespace, in that case the functions don't need to be signed
+func TrustedKeys(config *v1.ConfigMap, namespace string) ([]crypto.PublicKey, error) {
+	policy, err := parseTrustPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+	nsKeys, nsFound := policy[namespace]
+	allKeys, allFound := policy[allNamespaces]
+	if !nsFound && !allFound {
+		return nil, nil
+	}
+	return append(append([]crypto.PublicKey{}, nsKeys...), allKeys...), nil
+}
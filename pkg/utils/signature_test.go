@@ -0,0 +1,201 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func pemKeys(t *testing.T, private crypto.PrivateKey, public crypto.PublicKey) ([]byte, string) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
+
+func TestSignFunction(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	edPrivatePEM, edPublicPEM := pemKeys(t, edPrivate, edPublic)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecPrivatePEM, ecPublicPEM := pemKeys(t, ecPrivate, &ecPrivate.PublicKey)
+	bundle := []byte("function bundle")
+	checksum := fmt.Sprintf("sha256:%x", sha256.Sum256(bundle))
+
+	edKey, err := parsePublicKey(edPublicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := parsePublicKey(ecPublicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signKey := range [][]byte{edPrivatePEM, ecPrivatePEM} {
+		spec := &kubelessApi.FunctionSpec{Checksum: checksum, FunctionContentType: "base64+zip", Handler: "hello.foo", Runtime: "python2.7", Deps: "requests"}
+		if err := SignFunction(spec, signKey); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := VerifyFunctionSignature(spec, []crypto.PublicKey{edKey, ecKey}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		// Moving the bundle to an artifact store doesn't change the code
+		moved := spec.DeepCopy()
+		moved.Function = "https://artifacts.example.com/hello.zip"
+		moved.FunctionContentType = "url+zip"
+		if err := VerifyFunctionSignature(moved, []crypto.PublicKey{edKey, ecKey}); err != nil {
+			t.Errorf("Unexpected error verifying a function moved to an artifact store: %v", err)
+		}
+		// Every field that decides which code runs is covered by the signature
+		for name, change := range map[string]func(*kubelessApi.FunctionSpec){
+			"checksum": func(f *kubelessApi.FunctionSpec) {
+				f.Checksum = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other bundle")))
+			},
+			"content type": func(f *kubelessApi.FunctionSpec) { f.FunctionContentType = "base64+zip+deps" },
+			"path":         func(f *kubelessApi.FunctionSpec) { f.FunctionPath = "other" },
+			"handler":      func(f *kubelessApi.FunctionSpec) { f.Handler = "other.foo" },
+			"runtime":      func(f *kubelessApi.FunctionSpec) { f.Runtime = "python3.7" },
+			"deps":         func(f *kubelessApi.FunctionSpec) { f.Deps = "evil" },
+		} {
+			changed := spec.DeepCopy()
+			change(changed)
+			if err := VerifyFunctionSignature(changed, []crypto.PublicKey{edKey, ecKey}); err == nil {
+				t.Errorf("Expecting an error verifying the signature of a different %s", name)
+			}
+		}
+	}
+
+	// A signature of the payload generated with `cosign sign-blob`
+	spec := &kubelessApi.FunctionSpec{Checksum: checksum, Handler: "hello.foo", Runtime: "python2.7"}
+	payload, err := FunctionSignaturePayload(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"checksum":"` + checksum + `","function-content-format":"","function-path":"","handler":"hello.foo","runtime":"python2.7","deps":"","image":""}`; string(payload) != expected {
+		t.Errorf("Expecting the payload %s, received %s", expected, payload)
+	}
+	digest := sha256.Sum256(payload)
+	cosignSignature, err := ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Signature = base64.StdEncoding.EncodeToString(cosignSignature) + "\n"
+	if err := VerifyFunctionSignature(spec, []crypto.PublicKey{ecKey}); err != nil {
+		t.Errorf("Unexpected error verifying a cosign signature: %v", err)
+	}
+	if err := VerifyFunctionSignature(spec, []crypto.PublicKey{edKey}); err == nil {
+		t.Error("Expecting an error verifying with an untrusted key")
+	}
+
+	// Git commits can be signed with both kinds of keys
+	for _, signKey := range [][]byte{edPrivatePEM, ecPrivatePEM} {
+		spec = &kubelessApi.FunctionSpec{Checksum: GitChecksum(strings.Repeat("a", 40)), FunctionContentType: "git", FunctionPath: "hello"}
+		if err := SignFunction(spec, signKey); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := VerifyFunctionSignature(spec, []crypto.PublicKey{edKey, ecKey}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	// Custom images run code out of the signature
+	withImage := spec.DeepCopy()
+	withImage.Deployment.Spec.Template.Spec.Containers = []v1.Container{{Image: "evil/runtime"}}
+	if err := SignFunction(withImage, edPrivatePEM); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	withInitImage := spec.DeepCopy()
+	withInitImage.Deployment.Spec.Template.Spec.InitContainers = []v1.Container{{Name: "setup", Image: "evil/setup"}}
+
+	tests := []struct {
+		spec *kubelessApi.FunctionSpec
+		err  string
+	}{
+		{&kubelessApi.FunctionSpec{Checksum: checksum}, "not signed"},
+		{&kubelessApi.FunctionSpec{Signature: spec.Signature}, "checksum"},
+		{&kubelessApi.FunctionSpec{Checksum: spec.Checksum, Signature: "not base64"}, "decode"},
+		{withImage, "evil/runtime"},
+		{withInitImage, "evil/setup"},
+	}
+	for _, test := range tests {
+		err := VerifyFunctionSignature(test.spec, []crypto.PublicKey{edKey})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expecting an error containing %q, received %v", test.err, err)
+		}
+	}
+}
+
+func TestTrustedKeys(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edPublicPEM := pemKeys(t, edPrivate, edPublic)
+	_, ecPublicPEM := pemKeys(t, ecPrivate, &ecPrivate.PublicKey)
+	indent := func(key string) string {
+		return "    " + strings.Replace(strings.TrimSpace(key), "\n", "\n    ", -1)
+	}
+	config := &v1.ConfigMap{Data: map[string]string{}}
+
+	keys, err := TrustedKeys(config, "default")
+	if err != nil || keys != nil {
+		t.Errorf("Expecting no keys without policy, received %v %v", keys, err)
+	}
+
+	config.Data["function-trust-policy"] = fmt.Sprintf("production:\n  - |\n%s\n  - |\n%s\n", indent(edPublicPEM), indent(ecPublicPEM))
+	if err := ValidateTrustPolicy(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keys, err = TrustedKeys(config, "production")
+	if err != nil || len(keys) != 2 {
+		t.Errorf("Expecting 2 keys, received %v %v", keys, err)
+	}
+	keys, err = TrustedKeys(config, "default")
+	if err != nil || keys != nil {
+		t.Errorf("Expecting no keys for a namespace out of the policy, received %v %v", keys, err)
+	}
+
+	config.Data["function-trust-policy"] += fmt.Sprintf("\"*\":\n  - |\n%s\nstaging: []\n", indent(edPublicPEM))
+	for ns, expected := range map[string]int{"production": 3, "staging": 1, "default": 1} {
+		keys, err = TrustedKeys(config, ns)
+		if err != nil || len(keys) != expected {
+			t.Errorf("Expecting %d keys for %s, received %v %v", expected, ns, keys, err)
+		}
+	}
+
+	config.Data["function-trust-policy"] = "production:\n  - not a key\n"
+	if err := ValidateTrustPolicy(config); err == nil {
+		t.Error("Expecting an error for an invalid key")
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of the function secret
+const (
+	sourceUsernameKey        = "username"
+	sourcePasswordKey        = "password"
+	sourceHeadersKey         = "headers"
+	sourceAccessKeyIDKey     = "aws-access-key-id"
+	sourceSecretAccessKeyKey = "aws-secret-access-key"
+	sourceSessionTokenKey    = "aws-session-token"
+	sourceRegionKey          = "aws-region"
+	defaultS3Region          = "us-east-1"
+)
+
+// SourceCredentials are the credentials to download the code of a function, read from its function secret
+type SourceCredentials struct {
+	Username string
+	Password string
+	// Headers added to the requests, stored as "Name: value" lines
+	Headers http.Header
+	// S3 are the keys to sign the requests to S3-compatible storage
+	S3 *S3Credentials
+}
+
+// S3Credentials are the keys to sign the requests to S3-compatible storage with AWS Signature Version 4
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+}
+
+// NewSourceCredentials returns the credentials stored in a function secret
+func NewSourceCredentials(secret *v1.Secret) (*SourceCredentials, error) {
+	creds := &SourceCredentials{
+		Username: string(secret.Data[sourceUsernameKey]),
+		Password: string(secret.Data[sourcePasswordKey]),
+	}
+	if headers, ok := secret.Data[sourceHeadersKey]; ok {
+		reader := textproto.NewReader(bufio.NewReader(strings.NewReader(strings.TrimSpace(string(headers)) + "\n\n")))
+		mimeHeader, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the headers of the secret %s: %v", secret.ObjectMeta.Name, err)
+		}
+		creds.Headers = http.Header(mimeHeader)
+	}
+	if _, ok := secret.Data[sourceAccessKeyIDKey]; ok {
+		creds.S3 = &S3Credentials{
+			AccessKeyID:     string(secret.Data[sourceAccessKeyIDKey]),
+			SecretAccessKey: string(secret.Data[sourceSecretAccessKeyKey]),
+			SessionToken:    string(secret.Data[sourceSessionTokenKey]),
+			Region:          string(secret.Data[sourceRegionKey]),
+		}
+		if creds.S3.SecretAccessKey == "" {
+			return nil, fmt.Errorf("The secret %s has the key %s but not %s", secret.ObjectMeta.Name, sourceAccessKeyIDKey, sourceSecretAccessKeyKey)
+		}
+		if creds.S3.Region == "" {
+			creds.S3.Region = defaultS3Region
+		}
+	}
+	return creds, nil
+}
+
+// GetSourceCredentials returns the credentials stored in the given function secret
+func GetSourceCredentials(client kubernetes.Interface, ns, name string) (*SourceCredentials, error) {
+	secret, err := client.CoreV1().Secrets(ns).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the function secret %s: %v", name, err)
+	}
+	return NewSourceCredentials(secret)
+}
+
+// Authorize adds the credentials to a request. The requests to S3-compatible storage are signed so they
+// should not be modified afterwards
+func (c *SourceCredentials) Authorize(req *http.Request) error {
+	for name, values := range c.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if c.S3 != nil {
+		signer := v4.NewSigner(credentials.NewStaticCredentials(c.S3.AccessKeyID, c.S3.SecretAccessKey, c.S3.SessionToken))
+		_, err := signer.Sign(req, nil, "s3", c.S3.Region, time.Now())
+		return err
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return nil
+}
+
+// sourceCredentialArgs returns the commands that set the arguments of curl with the credentials of the function
+// secret mounted in the provision container. The arguments are set as the positional parameters of the shell
+// so the values of the secret are not interpreted by it
+func sourceCredentialArgs() string {
+	secretFile := func(key string) string {
+		return path.Join(FunctionSecretMountPath, key)
+	}
+	return appendToCommand("set --",
+		fmt.Sprintf(`if [ -f %s ]; then set -- "$@" -H @%s; fi`, secretFile(sourceHeadersKey), secretFile(sourceHeadersKey)),
+		fmt.Sprintf(`if [ -f %s ]; then set -- "$@" --aws-sigv4 "aws:amz:$(cat %s 2>/dev/null || echo %s):s3" --user "$(cat %s):$(cat %s)"; elif [ -f %s ]; then set -- "$@" --user "$(cat %s):$(cat %s)"; fi`,
+			secretFile(sourceAccessKeyIDKey), secretFile(sourceRegionKey), defaultS3Region, secretFile(sourceAccessKeyIDKey), secretFile(sourceSecretAccessKeyKey),
+			secretFile(sourceUsernameKey), secretFile(sourceUsernameKey), secretFile(sourcePasswordKey)),
+		fmt.Sprintf(`if [ -f %s ]; then set -- "$@" -H "x-amz-security-token: $(cat %s)"; fi`, secretFile(sourceSessionTokenKey), secretFile(sourceSessionTokenKey)),
+	)
+}
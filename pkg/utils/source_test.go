@@ -0,0 +1,195 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const bundle = "def foo(event, context):\n    return 'hello'\n"
+
+// artifactStore serves the bundle to the requests accepted by the given function
+func artifactStore(authorized func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/functions/hello.py" {
+			http.NotFound(w, r)
+			return
+		}
+		if !authorized(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(bundle))
+	}))
+}
+
+func TestNewSourceCredentials(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds"},
+		Data: map[string][]byte{
+			"headers":               []byte("Private-Token: abc\nx-custom: 1\n"),
+			"aws-access-key-id":     []byte("AKID"),
+			"aws-secret-access-key": []byte("secret"),
+		},
+	}
+	creds, err := NewSourceCredentials(secret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.Headers.Get("Private-Token") != "abc" || creds.Headers.Get("X-Custom") != "1" {
+		t.Errorf("Unexpected headers %v", creds.Headers)
+	}
+	if creds.S3 == nil || creds.S3.AccessKeyID != "AKID" || creds.S3.Region != "us-east-1" {
+		t.Errorf("Unexpected S3 credentials %+v", creds.S3)
+	}
+
+	delete(secret.Data, "aws-secret-access-key")
+	if _, err := NewSourceCredentials(secret); err == nil {
+		t.Error("Expecting an error without the secret access key")
+	}
+	secret.Data = map[string][]byte{"headers": []byte("invalid header")}
+	if _, err := NewSourceCredentials(secret); err == nil {
+		t.Error("Expecting an error for invalid headers")
+	}
+}
+
+func TestParseContentWithCredentials(t *testing.T) {
+	checksum, _ := getChecksum(bundle)
+	expectedChecksum := "sha256:" + checksum
+	tests := []struct {
+		name       string
+		secret     map[string][]byte
+		authorized func(r *http.Request) bool
+	}{
+		{
+			name:   "basic auth",
+			secret: map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+			authorized: func(r *http.Request) bool {
+				u, p, ok := r.BasicAuth()
+				return ok && u == "user" && p == "pass"
+			},
+		},
+		{
+			name:   "headers",
+			secret: map[string][]byte{"headers": []byte("Private-Token: abc")},
+			authorized: func(r *http.Request) bool {
+				return r.Header.Get("Private-Token") == "abc"
+			},
+		},
+		{
+			name: "s3",
+			secret: map[string][]byte{
+				"aws-access-key-id":     []byte("AKID"),
+				"aws-secret-access-key": []byte("secret"),
+				"aws-session-token":     []byte("token"),
+				"aws-region":            []byte("eu-west-1"),
+			},
+			authorized: func(r *http.Request) bool {
+				return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") &&
+					strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request") &&
+					r.Header.Get("X-Amz-Content-Sha256") != "" &&
+					r.Header.Get("X-Amz-Security-Token") == "token"
+			},
+		},
+	}
+	for _, test := range tests {
+		srv := artifactStore(test.authorized)
+		file := srv.URL + "/functions/hello.py"
+
+		if _, _, err := ParseContent(file, "url"); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("%s: expecting an error without credentials, received %v", test.name, err)
+		}
+
+		creds, err := NewSourceCredentials(&v1.Secret{Data: test.secret})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		content, checksum, err := ParseContentWithCredentials(file, "url", "sha256", creds)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if content != bundle || checksum != expectedChecksum {
+			t.Errorf("%s: unexpected content %q with checksum %s", test.name, content, checksum)
+		}
+		srv.Close()
+	}
+}
+
+func TestParseContentChecksumAlgorithm(t *testing.T) {
+	srv := artifactStore(func(r *http.Request) bool { return true })
+	defer srv.Close()
+	expected, _ := ComputeChecksum("sha512", []byte(bundle))
+	_, checksum, err := ParseContentWithCredentials(srv.URL+"/functions/hello.py", "url", "sha512", nil)
+	if err != nil || checksum != expected {
+		t.Errorf("Expecting the checksum %s, received %s (%v)", expected, checksum, err)
+	}
+	if _, _, err := ParseContentWithCredentials(srv.URL+"/functions/hello.py", "url", "md5", nil); err == nil {
+		t.Error("Expecting an error for an unsupported algorithm")
+	}
+}
+
+func TestGetSourceCredentials(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user")},
+	})
+	creds, err := GetSourceCredentials(client, "default", "creds")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.Username != "user" {
+		t.Errorf("Unexpected username %s", creds.Username)
+	}
+	if _, err := GetSourceCredentials(client, "other", "creds"); err == nil {
+		t.Error("Expecting an error for a missing secret")
+	}
+}
+
+func TestGetProvisionContainerFunctionSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+
+	rvol := v1.VolumeMount{Name: "runtime", MountPath: "/runtime"}
+	dvol := v1.VolumeMount{Name: "deps", MountPath: "/deps"}
+	c, err := getProvisionContainer("https://example.com/functions/hello.py", "sha256:abc1234", "", "", "hello.foo", "url", "python2.7", "creds", "unzip", rvol, dvol, v1.ResourceRequirements{}, lr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	command := c.Args[0]
+	for _, s := range []string{
+		"set -- && ",
+		`set -- "$@" -H @/function-secret/headers`,
+		`--aws-sigv4 "aws:amz:$(cat /function-secret/aws-region 2>/dev/null || echo us-east-1):s3"`,
+		`set -- "$@" --user "$(cat /function-secret/username):$(cat /function-secret/password)"`,
+		`curl "$@" 'https://example.com/functions/hello.py' -L --fail --silent --show-error --output /tmp/func.fromurl && `,
+		// The checksum is still verified
+		"sha256sum -c /tmp/func.sha256",
+	} {
+		if !strings.Contains(command, s) {
+			t.Errorf("Expecting %q in the command %s", s, command)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// SetFunctionDefaults fills the fields of a function that are optional
+// with the values used by the controller
+func SetFunctionDefaults(funcObj *kubelessApi.Function) {
+	if funcObj.Spec.Timeout == "" {
+		funcObj.Spec.Timeout = defaultTimeout
+	}
+
+	if funcObj.ObjectMeta.Labels == nil {
+		funcObj.ObjectMeta.Labels = map[string]string{}
+	}
+	if _, ok := funcObj.ObjectMeta.Labels["function"]; !ok {
+		funcObj.ObjectMeta.Labels["function"] = funcObj.ObjectMeta.Name
+	}
+
+	if len(funcObj.Spec.ServiceSpec.Ports) == 0 {
+		funcObj.Spec.ServiceSpec.Ports = serviceSpec(funcObj).Ports
+	}
+	for i := range funcObj.Spec.ServiceSpec.Ports {
+		port := &funcObj.Spec.ServiceSpec.Ports[i]
+		if port.Port == 0 {
+			port.Port = 8080
+		}
+		if port.TargetPort.IntValue() == 0 && port.TargetPort.Type == intstr.Int {
+			port.TargetPort = intstr.FromInt(int(port.Port))
+		}
+		if port.Protocol == "" {
+			port.Protocol = v1.ProtocolTCP
+		}
+	}
+	// The selector is not set: the controller selects the pods with the current labels of the function
+	if funcObj.Spec.ServiceSpec.Type == "" {
+		funcObj.Spec.ServiceSpec.Type = v1.ServiceTypeClusterIP
+	}
+}
+
+// ValidateFunction returns the errors that would prevent the controller from deploying a function
+func ValidateFunction(funcObj *kubelessApi.Function, lr *langruntime.Langruntimes) []error {
+	errs := []error{}
+	customImage := len(funcObj.Spec.Deployment.Spec.Template.Spec.Containers) > 0 &&
+		funcObj.Spec.Deployment.Spec.Template.Spec.Containers[0].Image != ""
+
+	// Functions without code run a custom image and skip the provision steps
+	provisioned := funcObj.Spec.Handler != "" && funcObj.Spec.Function != ""
+
+	validHandler := true
+	if funcObj.Spec.Handler != "" {
+		if _, _, err := splitHandler(funcObj.Spec.Handler); err != nil {
+			validHandler = false
+			errs = append(errs, fmt.Errorf("Invalid handler %q: it should be module_name.handler_name", funcObj.Spec.Handler))
+		}
+	}
+
+	validRuntime := true
+	if provisioned {
+		if _, err := lr.GetRuntimeInfo(funcObj.Spec.Runtime); err != nil {
+			validRuntime = false
+			errs = append(errs, fmt.Errorf("Invalid runtime %q. Supported runtimes are: %s", funcObj.Spec.Runtime, strings.Join(lr.GetRuntimes(), ", ")))
+		} else if !customImage {
+			if _, err := lr.GetFunctionImage(funcObj.Spec.Runtime); err != nil {
+				validRuntime = false
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	validChecksum := true
+	if funcObj.Spec.Checksum != "" {
+		checksumInfo := strings.Split(funcObj.Spec.Checksum, ":")
+		if len(checksumInfo) != 2 || checksumInfo[0] == "" || checksumInfo[1] == "" {
+			validChecksum = false
+			errs = append(errs, fmt.Errorf("Invalid checksum %q: it should be algorithm:value", funcObj.Spec.Checksum))
+		}
+	}
+	if provisioned && validHandler && validRuntime && validChecksum {
+		// The provision container checks the content type and the checksum algorithm
+		var err error
+		if strings.Contains(funcObj.Spec.FunctionContentType, "git") {
+			_, err = getGitProvisionContainer(funcObj.Spec, "", v1.VolumeMount{}, v1.VolumeMount{}, v1.ResourceRequirements{}, lr)
+		} else {
+			_, err = getProvisionContainer(funcObj.Spec.Function, funcObj.Spec.Checksum, funcObj.Spec.ChecksumManifest, "", funcObj.Spec.Handler, funcObj.Spec.FunctionContentType,
+				funcObj.Spec.Runtime, funcObj.Spec.FunctionSecret, "", v1.VolumeMount{}, v1.VolumeMount{}, v1.ResourceRequirements{}, lr)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if funcObj.Spec.Timeout != "" {
+		if timeout, err := strconv.Atoi(funcObj.Spec.Timeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Errorf("Invalid timeout %q: it should be a positive number of seconds", funcObj.Spec.Timeout))
+		}
+	}
+
+	if funcObj.Spec.IdleTimeout != "" {
+		if d, err := time.ParseDuration(funcObj.Spec.IdleTimeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("Invalid idle timeout %q: it should be a duration like 10m", funcObj.Spec.IdleTimeout))
+		}
+	}
+
+	for _, port := range funcObj.Spec.ServiceSpec.Ports {
+		if port.Port < 0 || port.Port > 65535 {
+			errs = append(errs, fmt.Errorf("Invalid service port %d", port.Port))
+		}
+	}
+
+	if len(funcObj.Spec.Traffic) > 0 {
+		total := int32(0)
+		for _, t := range funcObj.Spec.Traffic {
+			if t.Percent < 0 || t.Percent > 100 {
+				errs = append(errs, fmt.Errorf("Invalid traffic percentage %d", t.Percent))
+			}
+			if !t.LatestRevision && t.Revision <= 0 {
+				errs = append(errs, fmt.Errorf("Traffic targets should have a revision or latestRevision"))
+			}
+			total += t.Percent
+		}
+		if total != 100 {
+			errs = append(errs, fmt.Errorf("The traffic percentages sum %d, expecting 100", total))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSetFunctionDefaults(t *testing.T) {
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: kubelessApi.FunctionSpec{
+			Handler: "foo.bar",
+			Runtime: "python2.7",
+		},
+	}
+	SetFunctionDefaults(f)
+	if f.Spec.Timeout != "180" {
+		t.Errorf("Expecting timeout 180, received %s", f.Spec.Timeout)
+	}
+	if f.ObjectMeta.Labels["function"] != "foo" {
+		t.Errorf("Expecting the function label, received %v", f.ObjectMeta.Labels)
+	}
+	if len(f.Spec.ServiceSpec.Ports) != 1 || f.Spec.ServiceSpec.Ports[0].Port != 8080 || f.Spec.ServiceSpec.Ports[0].TargetPort.IntValue() != 8080 {
+		t.Errorf("Unexpected service ports %v", f.Spec.ServiceSpec.Ports)
+	}
+	if f.Spec.ServiceSpec.Selector != nil || f.Spec.ServiceSpec.Type != v1.ServiceTypeClusterIP {
+		t.Errorf("Unexpected service spec %v", f.Spec.ServiceSpec)
+	}
+	// The service selects the pods with the current labels of the function
+	f.ObjectMeta.Labels["function"] = "bar"
+	if selector := serviceSpec(f).Selector; selector["function"] != "bar" {
+		t.Errorf("Expecting the selector to follow the labels of the function, received %v", selector)
+	}
+
+	// Values set by the user are respected
+	f = &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"function": "bar"}},
+		Spec: kubelessApi.FunctionSpec{
+			Timeout: "10",
+			ServiceSpec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{Name: "http", Port: 9090}},
+			},
+		},
+	}
+	SetFunctionDefaults(f)
+	if f.Spec.Timeout != "10" || f.ObjectMeta.Labels["function"] != "bar" {
+		t.Errorf("Unexpected defaults %s %v", f.Spec.Timeout, f.ObjectMeta.Labels)
+	}
+	if p := f.Spec.ServiceSpec.Ports[0]; p.Port != 9090 || p.TargetPort != intstr.FromInt(9090) || p.Protocol != v1.ProtocolTCP {
+		t.Errorf("Unexpected service port %v", p)
+	}
+}
+
+func TestValidateFunction(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+
+	valid := kubelessApi.FunctionSpec{
+		Handler:  "foo.bar",
+		Runtime:  "python2.7",
+		Function: "def bar(): pass",
+		Checksum: "sha256:abc",
+		Timeout:  "180",
+	}
+	tests := []struct {
+		name     string
+		modify   func(spec *kubelessApi.FunctionSpec)
+		expected string
+	}{
+		{"valid", func(spec *kubelessApi.FunctionSpec) {}, ""},
+		{"handler", func(spec *kubelessApi.FunctionSpec) { spec.Handler = "foo" }, "Invalid handler"},
+		{"runtime", func(spec *kubelessApi.FunctionSpec) { spec.Runtime = "cobol" }, "Invalid runtime"},
+		{"runtime version", func(spec *kubelessApi.FunctionSpec) { spec.Runtime = "python9.9" }, "python9.9"},
+		{"checksum format", func(spec *kubelessApi.FunctionSpec) { spec.Checksum = "sha256" }, "Invalid checksum"},
+		{"checksum algorithm", func(spec *kubelessApi.FunctionSpec) { spec.Checksum = "md5:abc" }, "Unable to verify checksum"},
+		{"content type", func(spec *kubelessApi.FunctionSpec) { spec.FunctionContentType = "binary" }, "Unknown format"},
+		{"timeout", func(spec *kubelessApi.FunctionSpec) { spec.Timeout = "-1" }, "Invalid timeout"},
+		{"idle timeout", func(spec *kubelessApi.FunctionSpec) { spec.IdleTimeout = "ten" }, "Invalid idle timeout"},
+		{"traffic", func(spec *kubelessApi.FunctionSpec) {
+			spec.Traffic = []kubelessApi.FunctionTrafficTarget{{Revision: 1, Percent: 50}, {LatestRevision: true, Percent: 40}}
+		}, "expecting 100"},
+		{"custom image", func(spec *kubelessApi.FunctionSpec) {
+			spec.Handler, spec.Function, spec.Runtime = "", "", ""
+			spec.Deployment.Spec.Template.Spec.Containers = []v1.Container{{Image: "foo/bar"}}
+		}, ""},
+	}
+	for _, tt := range tests {
+		spec := valid
+		tt.modify(&spec)
+		errs := ValidateFunction(&kubelessApi.Function{Spec: spec}, lr)
+		if tt.expected == "" {
+			if len(errs) != 0 {
+				t.Errorf("%s: unexpected errors %v", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.expected) {
+			t.Errorf("%s: expecting an error containing %q, received %v", tt.name, tt.expected, errs)
+		}
+	}
+}
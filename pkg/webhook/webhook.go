@@ -0,0 +1,227 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+// Server receives the admission requests of Function objects
+type Server struct {
+	mutex       sync.RWMutex
+	langRuntime *langruntime.Langruntimes
+}
+
+// patchOperation is an operation of a JSON patch (RFC 6902)
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// NewServer returns a webhook server that validates functions against the given runtimes
+func NewServer(lr *langruntime.Langruntimes) *Server {
+	return &Server{langRuntime: lr}
+}
+
+// ReloadConfig validates the functions against the runtimes of the given configmap from now on.
+// The previous runtimes are kept if the configmap is not valid
+func (s *Server) ReloadConfig(config *v1.ConfigMap) {
+	lr := langruntime.New(config)
+	if err := lr.ParseConfigMap(); err != nil {
+		logrus.Errorf("Ignoring the changes of the configmap %s: %v", config.ObjectMeta.Name, err)
+		return
+	}
+	s.mutex.Lock()
+	s.langRuntime = lr
+	s.mutex.Unlock()
+	logrus.Infof("Runtimes reloaded from the configmap %s", config.ObjectMeta.Name)
+}
+
+// Handler returns the HTTP handler of the webhook endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, s.validate)
+	})
+	mux.HandleFunc("/mutate", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, s.mutate)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	return mux
+}
+
+// serve decodes the AdmissionReview of the request and writes back the response of the admit function
+func serve(w http.ResponseWriter, r *http.Request, admit func(*v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		http.Error(w, fmt.Sprintf("Unsupported content type %s, expecting application/json", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("Unable to decode the admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := admit(review.Request)
+	response.UID = review.Request.UID
+	res, err := json.Marshal(v1beta1.AdmissionReview{Response: response})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+func decodeFunction(req *v1beta1.AdmissionRequest) (*kubelessApi.Function, error) {
+	funcObj := &kubelessApi.Function{}
+	if err := json.Unmarshal(req.Object.Raw, funcObj); err != nil {
+		return nil, fmt.Errorf("Unable to decode the function: %v", err)
+	}
+	// The name is not set yet if the function is created with generateName
+	if funcObj.ObjectMeta.Name == "" {
+		funcObj.ObjectMeta.Name = req.Name
+	}
+	return funcObj, nil
+}
+
+func deny(err error) *v1beta1.AdmissionResponse {
+	return &v1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
+		},
+	}
+}
+
+// specUnchanged returns true if the request updates a function without modifying its spec, like the
+// controller adding or removing its finalizer
+func specUnchanged(req *v1beta1.AdmissionRequest, funcObj *kubelessApi.Function) (bool, error) {
+	if req.Operation != v1beta1.Update || len(req.OldObject.Raw) == 0 {
+		return false, nil
+	}
+	oldObj := &kubelessApi.Function{}
+	if err := json.Unmarshal(req.OldObject.Raw, oldObj); err != nil {
+		return false, fmt.Errorf("Unable to decode the previous function: %v", err)
+	}
+	return apiequality.Semantic.DeepEqual(oldObj.Spec, funcObj.Spec), nil
+}
+
+// validate rejects the functions that the controller would not be able to deploy. The functions being
+// deleted and the updates that don't change the spec are always allowed, so a function that is no longer
+// valid (e.g. its runtime has been removed) can still be updated by the controller and deleted
+func (s *Server) validate(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
+	funcObj, err := decodeFunction(req)
+	if err != nil {
+		return deny(err)
+	}
+	if funcObj.ObjectMeta.DeletionTimestamp != nil {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	unchanged, err := specUnchanged(req, funcObj)
+	if err != nil {
+		return deny(err)
+	}
+	if unchanged {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	s.mutex.RLock()
+	lr := s.langRuntime
+	s.mutex.RUnlock()
+	errs := utils.ValidateFunction(funcObj, lr)
+	if len(errs) > 0 {
+		msgs := []string{}
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		logrus.Infof("Rejecting function %s/%s: %s", req.Namespace, funcObj.ObjectMeta.Name, strings.Join(msgs, "; "))
+		return deny(fmt.Errorf("Invalid function %s: %s", funcObj.ObjectMeta.Name, strings.Join(msgs, "; ")))
+	}
+	return &v1beta1.AdmissionResponse{Allowed: true}
+}
+
+// mutate returns a patch that sets the default values of the function. The functions being deleted are
+// not modified
+func (s *Server) mutate(req *v1beta1.AdmissionRequest) *v1beta1.AdmissionResponse {
+	funcObj, err := decodeFunction(req)
+	if err != nil {
+		return deny(err)
+	}
+	if funcObj.ObjectMeta.DeletionTimestamp != nil {
+		return &v1beta1.AdmissionResponse{Allowed: true}
+	}
+	patch, err := defaultsPatch(funcObj)
+	if err != nil {
+		return deny(err)
+	}
+	response := &v1beta1.AdmissionResponse{Allowed: true}
+	if patch != nil {
+		patchType := v1beta1.PatchTypeJSONPatch
+		response.Patch = patch
+		response.PatchType = &patchType
+	}
+	return response
+}
+
+// defaultsPatch returns the JSON patch that fills in the defaults of a function,
+// or nil if the function already has them
+func defaultsPatch(funcObj *kubelessApi.Function) ([]byte, error) {
+	defaulted := funcObj.DeepCopy()
+	utils.SetFunctionDefaults(defaulted)
+
+	ops := []patchOperation{}
+	// "add" replaces the value if it already exists
+	if !apiequality.Semantic.DeepEqual(funcObj.ObjectMeta.Labels, defaulted.ObjectMeta.Labels) {
+		ops = append(ops, patchOperation{Op: "add", Path: "/metadata/labels", Value: defaulted.ObjectMeta.Labels})
+	}
+	if funcObj.Spec.Timeout != defaulted.Spec.Timeout {
+		ops = append(ops, patchOperation{Op: "add", Path: "/spec/timeout", Value: defaulted.Spec.Timeout})
+	}
+	if !apiequality.Semantic.DeepEqual(funcObj.Spec.ServiceSpec, defaulted.Spec.ServiceSpec) {
+		ops = append(ops, patchOperation{Op: "add", Path: "/spec/service", Value: defaulted.Spec.ServiceSpec})
+	}
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ops)
+}
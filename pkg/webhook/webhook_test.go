@@ -0,0 +1,217 @@
+/*
+Copyright (c) 2016-2017 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kubelessApi "github.com/kubeless/kubeless/pkg/apis/kubeless/v1beta1"
+	"github.com/kubeless/kubeless/pkg/langruntime"
+	"github.com/kubeless/kubeless/pkg/utils"
+)
+
+func newTestServer() *Server {
+	clientset := fake.NewSimpleClientset()
+	langruntime.AddFakeConfig(clientset)
+	lr := langruntime.SetupLangRuntime(clientset)
+	lr.ReadConfigMap()
+	return NewServer(lr)
+}
+
+func review(t *testing.T, s *Server, path string, f *kubelessApi.Function) *v1beta1.AdmissionResponse {
+	return reviewUpdate(t, s, path, nil, f)
+}
+
+// reviewUpdate sends the admission review of the update of oldFunc to f, or of its creation if oldFunc is nil
+func reviewUpdate(t *testing.T, s *Server, path string, oldFunc, f *kubelessApi.Function) *v1beta1.AdmissionResponse {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &v1beta1.AdmissionRequest{
+		UID:       types.UID("1234"),
+		Namespace: "default",
+		Operation: v1beta1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+	if oldFunc != nil {
+		oldRaw, err := json.Marshal(oldFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Operation = v1beta1.Update
+		request.OldObject = runtime.RawExtension{Raw: oldRaw}
+	}
+	body, _ := json.Marshal(v1beta1.AdmissionReview{Request: request})
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	res := v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Response.UID != "1234" {
+		t.Errorf("Expecting the UID of the request, received %s", res.Response.UID)
+	}
+	return res.Response
+}
+
+func TestValidate(t *testing.T) {
+	s := newTestServer()
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: kubelessApi.FunctionSpec{
+			Handler:  "foo.bar",
+			Runtime:  "python2.7",
+			Function: "def bar(): pass",
+		},
+	}
+	if res := review(t, s, "/validate", f); !res.Allowed {
+		t.Errorf("Expecting the function to be allowed: %v", res.Result)
+	}
+
+	f.Spec.Handler = "foo"
+	f.Spec.Runtime = "cobol"
+	res := review(t, s, "/validate", f)
+	if res.Allowed {
+		t.Fatal("Expecting the function to be rejected")
+	}
+	if !strings.Contains(res.Result.Message, "Invalid handler") || !strings.Contains(res.Result.Message, "Invalid runtime") {
+		t.Errorf("Unexpected message %s", res.Result.Message)
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	s := newTestServer()
+	// A function whose runtime has been removed from the configuration
+	oldFunc := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Finalizers: []string{"kubeless.io/function"}},
+		Spec: kubelessApi.FunctionSpec{
+			Handler:  "foo.bar",
+			Runtime:  "cobol",
+			Function: "def bar(): pass",
+		},
+	}
+
+	// The controller can remove its finalizer
+	f := oldFunc.DeepCopy()
+	f.ObjectMeta.Finalizers = nil
+	if res := reviewUpdate(t, s, "/validate", oldFunc, f); !res.Allowed {
+		t.Errorf("Expecting an update of the finalizers to be allowed: %v", res.Result)
+	}
+
+	// Any update of a function being deleted is allowed
+	now := metav1.Now()
+	deleting := oldFunc.DeepCopy()
+	deleting.ObjectMeta.DeletionTimestamp = &now
+	f = deleting.DeepCopy()
+	f.Spec.Handler = "foo"
+	if res := reviewUpdate(t, s, "/validate", deleting, f); !res.Allowed {
+		t.Errorf("Expecting an update of a function being deleted to be allowed: %v", res.Result)
+	}
+	if res := reviewUpdate(t, s, "/mutate", deleting, f); !res.Allowed || res.Patch != nil {
+		t.Errorf("Expecting a function being deleted not to be modified, received %v", res)
+	}
+
+	// Changes of the spec are validated
+	f = oldFunc.DeepCopy()
+	f.Spec.Handler = "foo.baz"
+	if res := reviewUpdate(t, s, "/validate", oldFunc, f); res.Allowed {
+		t.Error("Expecting an update of the spec to be validated")
+	}
+}
+
+func TestMutate(t *testing.T) {
+	s := newTestServer()
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: kubelessApi.FunctionSpec{
+			Handler:  "foo.bar",
+			Runtime:  "python2.7",
+			Function: "def bar(): pass",
+		},
+	}
+	res := review(t, s, "/mutate", f)
+	if !res.Allowed || res.PatchType == nil || *res.PatchType != v1beta1.PatchTypeJSONPatch {
+		t.Fatalf("Expecting a JSON patch, received %v", res)
+	}
+	ops := []patchOperation{}
+	if err := json.Unmarshal(res.Patch, &ops); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, op := range ops {
+		paths = append(paths, op.Path)
+	}
+	if strings.Join(paths, ",") != "/metadata/labels,/spec/timeout,/spec/service" {
+		t.Errorf("Unexpected patch %s", res.Patch)
+	}
+
+	// A function with the defaults already set is not modified
+	utils.SetFunctionDefaults(f)
+	res = review(t, s, "/mutate", f)
+	if !res.Allowed || res.Patch != nil {
+		t.Errorf("Expecting no patch, received %s", res.Patch)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	s := newTestServer()
+	f := &kubelessApi.Function{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: kubelessApi.FunctionSpec{
+			Handler:  "foo.bar",
+			Runtime:  "cobol1.0",
+			Function: "function",
+		},
+	}
+	if res := review(t, s, "/validate", f); res.Allowed {
+		t.Fatal("Expecting a function with an unknown runtime to be rejected")
+	}
+
+	config := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubeless-config", Namespace: "kubeless"},
+		Data:       map[string]string{"runtime-images": `[{"ID": "cobol", "versions": [{"name": "cobol10", "version": "1.0"}]}]`},
+	}
+	s.ReloadConfig(config)
+	if res := review(t, s, "/validate", f); !res.Allowed {
+		t.Errorf("Expecting the function to be allowed after adding its runtime: %v", res.Result)
+	}
+
+	// An invalid configuration is ignored
+	config.Data["runtime-images"] = `[{"versions": []}]`
+	s.ReloadConfig(config)
+	if res := review(t, s, "/validate", f); !res.Allowed {
+		t.Errorf("Expecting the previous runtimes to be kept: %v", res.Result)
+	}
+}